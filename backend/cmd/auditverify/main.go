@@ -0,0 +1,68 @@
+// auditverify 驗證操作記錄雜湊鏈是否完整
+//
+// 用法：
+//
+//	go run ./cmd/auditverify -db ./data/memoryark.db -checkpoints /backup/audit-checkpoints.jsonl
+//
+// 結束代碼：0 表示完整，1 表示發現斷點，2 表示執行錯誤
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"memoryark/internal/config"
+	"memoryark/internal/database"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Failed to load configuration:", err)
+	}
+
+	dbPath := flag.String("db", cfg.Database.Path, "數據庫路徑")
+	checkpointFile := flag.String("checkpoints", cfg.Audit.CheckpointFile, "檢查點匯出檔（建議使用異地備份的副本）")
+	key := flag.String("key", cfg.Audit.CheckpointKey, "檢查點簽章金鑰")
+	skipDBCheckpoints := flag.Bool("skip-db-checkpoints", false, "只使用匯出檔中的檢查點")
+	flag.Parse()
+
+	db, err := database.OpenExisting(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "無法開啟數據庫: %v\n", err)
+		os.Exit(2)
+	}
+
+	var checkpoints []models.ActivityLogCheckpoint
+	if !*skipDBCheckpoints {
+		if err := db.Find(&checkpoints).Error; err != nil {
+			fmt.Fprintf(os.Stderr, "讀取檢查點失敗: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if *checkpointFile != "" {
+		exported, err := services.LoadCheckpointFile(*checkpointFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "讀取檢查點匯出檔失敗: %v\n", err)
+			os.Exit(2)
+		}
+		checkpoints = append(checkpoints, exported...)
+	}
+
+	report, err := services.VerifyActivityChain(db, checkpoints, *key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "驗證失敗: %v\n", err)
+		os.Exit(2)
+	}
+
+	output, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(output))
+	if !report.Valid {
+		os.Exit(1)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"memoryark/internal/config"
 	"memoryark/internal/database"
 	"memoryark/internal/api"
+	"memoryark/internal/services"
 	"memoryark/pkg/logger"
 )
 
@@ -18,6 +19,20 @@ func main() {
 		log.Fatal("Failed to load configuration:", err)
 	}
 	
+	// 檢查認證方式設定
+	switch cfg.Auth.Provider {
+	case config.AuthProviderCloudflare:
+	case config.AuthProviderLocalJWT, config.AuthProviderOIDC:
+		if cfg.Auth.JWTSecret == "memoryark-secret-key" {
+			log.Fatalf("AUTH_PROVIDER=%s requires JWT_SECRET to be changed from the default value", cfg.Auth.Provider)
+		}
+		if cfg.Auth.Provider == config.AuthProviderOIDC && !cfg.OIDC.Enabled() {
+			log.Fatal("AUTH_PROVIDER=oidc requires OIDC_ISSUER_URL, OIDC_CLIENT_ID and OIDC_REDIRECT_URL")
+		}
+	default:
+		log.Fatalf("Unknown AUTH_PROVIDER %q (expected cloudflare, local-jwt or oidc)", cfg.Auth.Provider)
+	}
+	
 	// 初始化數據庫
 	log.Printf("Initializing database at path: %s", cfg.Database.Path)
 	db, err := database.Initialize(cfg.Database.Path)
@@ -31,6 +46,29 @@ func main() {
 		log.Printf("Warning: Failed to initialize root admin: %v", err)
 	}
 	
+	// 匯入舊版服務令牌設定
+	if err := database.InitializeServiceTokens(db, cfg); err != nil {
+		log.Printf("Warning: Failed to initialize service tokens: %v", err)
+	}
+	
+	// 為啟用雜湊鏈前的操作記錄建立雜湊鏈，並定期建立檢查點
+	if sealed, err := services.SealLegacyActivityLogs(db); err != nil {
+		log.Printf("Warning: Failed to seal activity logs: %v", err)
+	} else if sealed > 0 {
+		log.Printf("Sealed %d existing activity logs into the hash chain", sealed)
+	}
+	services.StartActivityCheckpoints(db, cfg.Audit)
+	
+	// 為既有檔案補上 ID 路徑
+	if filled, err := services.BackfillTreePaths(db); err != nil {
+		log.Printf("Warning: Failed to backfill file tree paths: %v", err)
+	} else if filled > 0 {
+		log.Printf("Backfilled tree paths for %d files", filled)
+	}
+	
+	// 定期永久刪除超過保留天數的垃圾桶項目
+	services.StartTrashPurge(db, cfg.Trash)
+	
 	// 啟動 API 服務器
 	router := api.SetupRouter(db, cfg)
 	
@@ -0,0 +1,50 @@
+// treerepair 檢查並修復資料夾結構（孤兒項目、循環、虛擬路徑與 ID 路徑偏差）
+//
+// 用法：
+//
+//	go run ./cmd/treerepair -db ./data/memoryark.db          # 只檢查，輸出報告
+//	go run ./cmd/treerepair -db ./data/memoryark.db -fix     # 檢查並修復
+//
+// 結束代碼：0 表示結構一致（或已修復），1 表示發現問題（未修復），2 表示執行錯誤
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"memoryark/internal/config"
+	"memoryark/internal/database"
+	"memoryark/internal/services"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Failed to load configuration:", err)
+	}
+
+	dbPath := flag.String("db", cfg.Database.Path, "數據庫路徑")
+	fix := flag.Bool("fix", false, "修復發現的問題（預設只輸出報告）")
+	flag.Parse()
+
+	db, err := database.OpenExisting(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "無法開啟數據庫: %v\n", err)
+		os.Exit(2)
+	}
+
+	report, err := services.RepairFileTree(db, !*fix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "檢查失敗: %v\n", err)
+		os.Exit(2)
+	}
+
+	output, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(output))
+	if !report.Consistent && !*fix {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/auth"
+	"memoryark/internal/config"
+	"memoryark/internal/models"
+	"memoryark/pkg/api"
+)
+
+const (
+	// defaultAccessTokenDays 個人存取令牌預設有效天數
+	defaultAccessTokenDays = 90
+	// maxAccessTokenDays 個人存取令牌最長有效天數
+	maxAccessTokenDays = 365
+	// maxAccessTokensPerUser 每位用戶可同時持有的有效令牌數量
+	maxAccessTokensPerUser = 20
+)
+
+// AccessTokenHandler 個人存取令牌處理器
+type AccessTokenHandler struct {
+	db  *gorm.DB
+	cfg *config.Config
+}
+
+// NewAccessTokenHandler 創建個人存取令牌處理器
+func NewAccessTokenHandler(db *gorm.DB, cfg *config.Config) *AccessTokenHandler {
+	return &AccessTokenHandler{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+// CreateAccessTokenRequest 建立個人存取令牌請求
+type CreateAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// GetAccessTokens 獲取自己的個人存取令牌列表（不含令牌內容）
+func (h *AccessTokenHandler) GetAccessTokens(c *gin.Context) {
+	var tokens []models.PersonalAccessToken
+	if err := h.db.Where("user_id = ?", c.GetUint("user_id")).
+		Order("created_at DESC").Find(&tokens).Error; err != nil {
+		api.InternalServerError(c, "查詢存取令牌失敗")
+		return
+	}
+
+	api.Success(c, gin.H{
+		"tokens": tokens,
+		"scopes": models.TokenScopePermissions,
+	})
+}
+
+// CreateAccessToken 建立個人存取令牌，令牌內容只在此回應中顯示一次
+func (h *AccessTokenHandler) CreateAccessToken(c *gin.Context) {
+	var req CreateAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "請求格式不正確")
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		api.BadRequest(c, "令牌名稱不可為空且不可超過 100 字元")
+		return
+	}
+
+	scopes, err := normalizeTokenScopes(req.Scopes)
+	if err != nil {
+		api.BadRequest(c, err.Error())
+		return
+	}
+
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = defaultAccessTokenDays
+	}
+	if days < 1 || days > maxAccessTokenDays {
+		api.BadRequest(c, fmt.Sprintf("有效天數需介於 1 到 %d 天", maxAccessTokenDays))
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	var active int64
+	h.db.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+		Count(&active)
+	if active >= maxAccessTokensPerUser {
+		api.BadRequest(c, fmt.Sprintf("最多只能同時擁有 %d 個有效的存取令牌", maxAccessTokensPerUser))
+		return
+	}
+
+	raw, err := auth.GeneratePersonalAccessToken()
+	if err != nil {
+		api.InternalServerError(c, "產生存取令牌失敗")
+		return
+	}
+
+	expiresAt := time.Now().AddDate(0, 0, days)
+	token := models.PersonalAccessToken{
+		UserID:      userID,
+		Name:        name,
+		TokenPrefix: raw[:len(auth.PersonalAccessTokenPrefix)+4],
+		TokenHash:   auth.HashToken(raw),
+		Scopes:      scopes,
+		ExpiresAt:   &expiresAt,
+	}
+	if err := h.db.Create(&token).Error; err != nil {
+		api.InternalServerError(c, "建立存取令牌失敗")
+		return
+	}
+
+	api.SuccessWithMessage(c, gin.H{
+		"token":        raw,
+		"access_token": token,
+	}, "存取令牌已建立，請立即複製保存，之後將無法再次查看")
+}
+
+// RevokeAccessToken 撤銷自己的個人存取令牌
+func (h *AccessTokenHandler) RevokeAccessToken(c *gin.Context) {
+	var token models.PersonalAccessToken
+	if err := h.db.Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("user_id")).
+		First(&token).Error; err != nil {
+		api.NotFound(c, "存取令牌")
+		return
+	}
+
+	if token.RevokedAt == nil {
+		now := time.Now()
+		if err := h.db.Model(&token).Update("revoked_at", now).Error; err != nil {
+			api.InternalServerError(c, "撤銷存取令牌失敗")
+			return
+		}
+	}
+
+	api.SuccessWithMessage(c, token, "存取令牌已撤銷")
+}
+
+// normalizeTokenScopes 檢查令牌範圍並去除重複
+func normalizeTokenScopes(scopes []string) ([]string, error) {
+	seen := map[string]bool{}
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "" || seen[scope] {
+			continue
+		}
+		if !models.IsKnownTokenScope(scope) {
+			return nil, fmt.Errorf("未知的令牌範圍: %s", scope)
+		}
+		seen[scope] = true
+		result = append(result, scope)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("至少需要一個令牌範圍")
+	}
+	return result, nil
+}
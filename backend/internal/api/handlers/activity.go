@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+	"memoryark/pkg/api"
+)
+
+// activityExportBatchSize 匯出操作記錄時每批讀取的筆數
+const activityExportBatchSize = 500
+
+// parseActivityLogFilter 解析操作記錄的查詢參數
+// 支援 user_id、action（逗號分隔）、resource_type、resource_id、from、to（YYYY-MM-DD 或 RFC3339）與 q
+func parseActivityLogFilter(c *gin.Context) (services.ActivityLogFilter, error) {
+	var filter services.ActivityLogFilter
+
+	if value := c.Query("user_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("user_id 格式不正確")
+		}
+		userID := uint(id)
+		filter.UserID = &userID
+	}
+	if value := c.Query("resource_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("resource_id 格式不正確")
+		}
+		resourceID := uint(id)
+		filter.ResourceID = &resourceID
+	}
+	for _, action := range strings.Split(c.Query("action"), ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			filter.Actions = append(filter.Actions, action)
+		}
+	}
+	filter.ResourceType = strings.TrimSpace(c.Query("resource_type"))
+	filter.Search = strings.TrimSpace(c.Query("q"))
+
+	if value := c.Query("from"); value != "" {
+		from, _, err := parseActivityTime(value)
+		if err != nil {
+			return filter, fmt.Errorf("from 日期格式不正確")
+		}
+		filter.From = &from
+	}
+	if value := c.Query("to"); value != "" {
+		to, dateOnly, err := parseActivityTime(value)
+		if err != nil {
+			return filter, fmt.Errorf("to 日期格式不正確")
+		}
+		if dateOnly {
+			// 只指定日期時包含當天整天
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = &to
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return filter, fmt.Errorf("from 必須早於 to")
+	}
+
+	return filter, nil
+}
+
+// parseActivityTime 解析日期（本地時區）或完整時間
+func parseActivityTime(value string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// ExportActivityLogs 依查詢條件串流匯出操作記錄（CSV 或 JSONL）
+func (h *AdminHandler) ExportActivityLogs(c *gin.Context) {
+	filter, err := parseActivityLogFilter(c)
+	if err != nil {
+		api.BadRequest(c, err.Error())
+		return
+	}
+
+	format := strings.ToLower(c.DefaultQuery("format", "csv"))
+	if format != "csv" && format != "jsonl" {
+		api.BadRequest(c, "format 僅支援 csv 或 jsonl")
+		return
+	}
+
+	filename := fmt.Sprintf("activity-logs-%s.%s", time.Now().Format("20060102-150405"), format)
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	var csvWriter *csv.Writer
+	encoder := json.NewEncoder(c.Writer)
+	if format == "csv" {
+		// BOM 讓試算表軟體正確辨識 UTF-8 中文
+		c.Writer.WriteString("\ufeff")
+		csvWriter = csv.NewWriter(c.Writer)
+		csvWriter.Write([]string{"id", "created_at", "user_id", "user_email", "user_name", "action", "resource_type", "resource_id", "ip_address", "details"})
+	}
+
+	var batch []models.ActivityLog
+	result := filter.Apply(h.db.Model(&models.ActivityLog{})).
+		Preload("User").
+		Order("id").
+		FindInBatches(&batch, activityExportBatchSize, func(tx *gorm.DB, _ int) error {
+			for _, entry := range batch {
+				resourceID := ""
+				if entry.ResourceID != nil {
+					resourceID = strconv.FormatUint(uint64(*entry.ResourceID), 10)
+				}
+
+				if csvWriter != nil {
+					csvWriter.Write(csvSafeRow([]string{
+						strconv.FormatUint(uint64(entry.ID), 10),
+						entry.CreatedAt.Format(time.RFC3339),
+						strconv.FormatUint(uint64(entry.UserID), 10),
+						entry.User.Email,
+						entry.User.Name,
+						entry.Action,
+						entry.ResourceType,
+						resourceID,
+						entry.IPAddress,
+						entry.Details,
+					}))
+					continue
+				}
+
+				line := gin.H{
+					"id":            entry.ID,
+					"created_at":    entry.CreatedAt,
+					"user_id":       entry.UserID,
+					"user_email":    entry.User.Email,
+					"user_name":     entry.User.Name,
+					"action":        entry.Action,
+					"resource_type": entry.ResourceType,
+					"resource_id":   entry.ResourceID,
+					"ip_address":    entry.IPAddress,
+				}
+				if json.Valid([]byte(entry.Details)) {
+					line["details"] = json.RawMessage(entry.Details)
+				} else {
+					line["details"] = entry.Details
+				}
+				if err := encoder.Encode(line); err != nil {
+					return err
+				}
+			}
+
+			if csvWriter != nil {
+				csvWriter.Flush()
+				if err := csvWriter.Error(); err != nil {
+					return err
+				}
+			}
+			c.Writer.Flush()
+			return nil
+		})
+
+	if result.Error != nil {
+		// 標頭已送出，只能記錄錯誤並中斷輸出
+		c.Error(result.Error)
+	}
+}
+
+// csvSafeRow 避免以 = + - @ 開頭的內容在試算表中被當成公式執行
+func csvSafeRow(row []string) []string {
+	for i, cell := range row {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			row[i] = "'" + cell
+		}
+	}
+	return row
+}
+
+// FileHistoryEntry 檔案或資料夾的單筆異動記錄
+type FileHistoryEntry struct {
+	ID        uint                            `json:"id"`
+	Action    string                          `json:"action"`
+	CreatedAt time.Time                       `json:"created_at"`
+	UserID    uint                            `json:"user_id"`
+	UserName  string                          `json:"user_name"`
+	Changes   map[string]services.AuditChange `json:"changes,omitempty"`
+	Before    services.AuditSnapshot          `json:"before,omitempty"`
+	After     services.AuditSnapshot          `json:"after,omitempty"`
+}
+
+// GetFileHistory 獲取檔案或資料夾的異動歷程（誰在何時移動、重新命名或刪除）
+func (h *FileHandler) GetFileHistory(c *gin.Context) {
+	fileID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		api.BadRequest(c, "無效的檔案 ID")
+		return
+	}
+
+	// 已刪除的檔案也可查看歷程
+	var file models.File
+	if err := h.db.Unscoped().Select("id").First(&file, fileID).Error; err != nil {
+		api.NotFound(c, "檔案")
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	resourceID := file.ID
+	filter := services.ActivityLogFilter{ResourceType: "file", ResourceID: &resourceID}
+
+	var total int64
+	if err := filter.Apply(h.db.Model(&models.ActivityLog{})).Count(&total).Error; err != nil {
+		api.InternalServerError(c, "查詢檔案歷程失敗")
+		return
+	}
+
+	var logs []models.ActivityLog
+	if err := filter.Apply(h.db.Model(&models.ActivityLog{})).Preload("User").
+		Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&logs).Error; err != nil {
+		api.InternalServerError(c, "查詢檔案歷程失敗")
+		return
+	}
+
+	// 一般成員只需要知道操作者與變更內容，不返回 IP 與請求內容
+	entries := make([]FileHistoryEntry, 0, len(logs))
+	for _, entry := range logs {
+		item := FileHistoryEntry{
+			ID:        entry.ID,
+			Action:    entry.Action,
+			CreatedAt: entry.CreatedAt,
+			UserID:    entry.UserID,
+			UserName:  entry.User.Name,
+		}
+		var details services.AuditDetails
+		if json.Unmarshal([]byte(entry.Details), &details) == nil {
+			item.Changes = details.Changes
+			item.Before = details.Before
+			item.After = details.After
+		}
+		entries = append(entries, item)
+	}
+
+	api.SuccessWithPagination(c, entries, page, limit, total)
+}
+
+// VerifyActivityLogs 驗證操作記錄雜湊鏈，返回第一個斷點
+func (h *AdminHandler) VerifyActivityLogs(c *gin.Context) {
+	checkpoints, err := services.LoadActivityCheckpoints(h.db, h.cfg.Audit)
+	if err != nil {
+		api.InternalServerError(c, "讀取檢查點失敗: "+err.Error())
+		return
+	}
+
+	report, err := services.VerifyActivityChain(h.db, checkpoints, h.cfg.Audit.CheckpointKey)
+	if err != nil {
+		api.InternalServerError(c, "驗證操作記錄失敗")
+		return
+	}
+	api.Success(c, report)
+}
+
+// GetActivityCheckpoints 獲取操作記錄檢查點
+func (h *AdminHandler) GetActivityCheckpoints(c *gin.Context) {
+	var checkpoints []models.ActivityLogCheckpoint
+	if err := h.db.Order("created_at DESC").Limit(100).Find(&checkpoints).Error; err != nil {
+		api.InternalServerError(c, "查詢檢查點失敗")
+		return
+	}
+	api.Success(c, checkpoints)
+}
+
+// CreateActivityCheckpoint 立即建立操作記錄檢查點
+func (h *AdminHandler) CreateActivityCheckpoint(c *gin.Context) {
+	checkpoint, err := services.CreateActivityCheckpoint(h.db, h.cfg.Audit)
+	if err != nil && checkpoint == nil {
+		api.InternalServerError(c, "建立檢查點失敗")
+		return
+	}
+	if err != nil {
+		// 資料庫已記錄，但匯出檔寫入失敗
+		api.SuccessWithMessage(c, checkpoint, err.Error())
+		return
+	}
+	if checkpoint == nil {
+		api.SuccessWithMessage(c, nil, "自上次檢查點後沒有新的操作記錄")
+		return
+	}
+	api.SuccessWithMessage(c, checkpoint, "檢查點已建立")
+}
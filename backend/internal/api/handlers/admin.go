@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
@@ -9,14 +11,18 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"memoryark/internal/auth"
 	"memoryark/internal/config"
+	"memoryark/internal/middleware"
 	"memoryark/internal/models"
+	"memoryark/internal/services"
 )
 
 // AdminHandler 管理員處理器
 type AdminHandler struct {
-	db  *gorm.DB
-	cfg *config.Config
+	db        *gorm.DB
+	cfg       *config.Config
+	wsHandler interface{} // WebSocket 處理器
 }
 
 // NewAdminHandler 創建管理員處理器
@@ -81,12 +87,17 @@ func (h *AdminHandler) GetUsers(c *gin.Context) {
 	})
 }
 
+// SetWebSocketHandler 設置 WebSocket 處理器
+func (h *AdminHandler) SetWebSocketHandler(wsHandler interface{}) {
+	h.wsHandler = wsHandler
+}
+
 // UpdateUserRole 修改用戶角色
 func (h *AdminHandler) UpdateUserRole(c *gin.Context) {
 	userID := c.Param("id")
 	
 	var req struct {
-		Role string `json:"role" binding:"required,oneof=admin user"`
+		Role string `json:"role" binding:"required"`
 	}
 	
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -112,6 +123,43 @@ func (h *AdminHandler) UpdateUserRole(c *gin.Context) {
 		return
 	}
 	
+	// 角色必須存在於角色表
+	var role models.Role
+	if err := h.db.Where("name = ?", req.Role).First(&role).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "INVALID_ROLE",
+				"message": "角色不存在",
+			},
+		})
+		return
+	}
+	
+	// 沒有角色管理權限時，只能在自己具備的權限範圍內調整角色，避免藉此提升權限
+	if !h.callerCoversRoles(c, user.Role, role.Name) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "ROLE_EXCEEDS_PERMISSIONS",
+				"message": "無法指派或調整超出自己權限的角色",
+			},
+		})
+		return
+	}
+	
+	// 避免移除最後一位管理員
+	if req.Role != "admin" && h.isLastActiveAdmin(&user) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "LAST_ADMIN",
+				"message": "無法移除最後一位管理員",
+			},
+		})
+		return
+	}
+	
 	user.Role = req.Role
 	user.UpdatedAt = time.Now()
 	
@@ -126,6 +174,8 @@ func (h *AdminHandler) UpdateUserRole(c *gin.Context) {
 		return
 	}
 	
+	refreshUserConnections(h.wsHandler, user.ID)
+	
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "用戶角色更新成功",
@@ -133,6 +183,35 @@ func (h *AdminHandler) UpdateUserRole(c *gin.Context) {
 	})
 }
 
+// callerCoversRoles 沒有角色管理權限時，呼叫者的角色必須具備列出的每個角色的所有權限
+// 不存在的角色沒有權限需要保護，略過
+func (h *AdminHandler) callerCoversRoles(c *gin.Context, roleNames ...string) bool {
+	if middleware.HasPermission(h.db, c, models.PermRolesManage) {
+		return true
+	}
+	callerRole, err := auth.LoadRole(h.db, c.GetString("user_role"))
+	if err != nil {
+		return false
+	}
+	for _, name := range roleNames {
+		role, err := auth.LoadRole(h.db, name)
+		if err == nil && !callerRole.CoversRole(role) {
+			return false
+		}
+	}
+	return true
+}
+
+// isLastActiveAdmin 檢查用戶是否為最後一位啟用中的管理員
+func (h *AdminHandler) isLastActiveAdmin(user *models.User) bool {
+	if user.Role != "admin" || user.Status != "approved" {
+		return false
+	}
+	var adminCount int64
+	h.db.Model(&models.User{}).Where("role = ? AND status = ?", "admin", "approved").Count(&adminCount)
+	return adminCount <= 1
+}
+
 // UpdateUserStatus 修改用戶狀態
 func (h *AdminHandler) UpdateUserStatus(c *gin.Context) {
 	userID := c.Param("id")
@@ -164,6 +243,38 @@ func (h *AdminHandler) UpdateUserStatus(c *gin.Context) {
 		return
 	}
 	
+	// 不能變更自己的狀態，也不能停用權限比自己高的用戶或最後一位管理員
+	if user.ID == c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "CANNOT_CHANGE_OWN_STATUS",
+				"message": "無法變更自己的狀態",
+			},
+		})
+		return
+	}
+	if !h.callerCoversRoles(c, user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "ROLE_EXCEEDS_PERMISSIONS",
+				"message": "無法變更權限比自己高的用戶狀態",
+			},
+		})
+		return
+	}
+	if req.Status != "approved" && h.isLastActiveAdmin(&user) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "LAST_ADMIN",
+				"message": "無法停用最後一位管理員",
+			},
+		})
+		return
+	}
+	
 	user.Status = req.Status
 	user.UpdatedAt = time.Now()
 	
@@ -178,6 +289,8 @@ func (h *AdminHandler) UpdateUserStatus(c *gin.Context) {
 		return
 	}
 	
+	refreshUserConnections(h.wsHandler, user.ID)
+	
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "用戶狀態更新成功",
@@ -464,7 +577,7 @@ func (h *AdminHandler) GetSystemStats(c *gin.Context) {
 		Total int64
 	}
 	h.db.Model(&models.File{}).
-		Where("is_deleted = ? AND is_directory = ?", false, false).
+		Where("is_deleted = ? AND is_directory = ? AND shortcut_target_id IS NULL", false, false).
 		Select("COALESCE(SUM(file_size), 0) as total").
 		Scan(&totalSize)
 	stats.TotalStorage = totalSize.Total
@@ -476,8 +589,20 @@ func (h *AdminHandler) GetSystemStats(c *gin.Context) {
 	})
 }
 
-// GetActivityLogs 獲取操作記錄
+// GetActivityLogs 獲取操作記錄（支援依用戶、操作、資源、日期範圍篩選與全文搜尋）
 func (h *AdminHandler) GetActivityLogs(c *gin.Context) {
+	filter, err := parseActivityLogFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "INVALID_REQUEST",
+				"message": err.Error(),
+			},
+		})
+		return
+	}
+	
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
 	
@@ -494,7 +619,7 @@ func (h *AdminHandler) GetActivityLogs(c *gin.Context) {
 	var total int64
 	
 	// 計算總數
-	if err := h.db.Model(&models.ActivityLog{}).Count(&total).Error; err != nil {
+	if err := filter.Apply(h.db.Model(&models.ActivityLog{})).Count(&total).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error": gin.H{
@@ -506,8 +631,8 @@ func (h *AdminHandler) GetActivityLogs(c *gin.Context) {
 	}
 	
 	// 獲取操作記錄
-	if err := h.db.Preload("User").
-		Order("created_at DESC").
+	if err := filter.Apply(h.db.Model(&models.ActivityLog{})).Preload("User").
+		Order("created_at DESC, id DESC").
 		Offset(offset).Limit(limit).
 		Find(&logs).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -637,7 +762,7 @@ func (h *AdminHandler) GetAllFiles(c *gin.Context) {
 // DeleteFile 刪除檔案（管理員專用）
 func (h *AdminHandler) DeleteFile(c *gin.Context) {
 	fileID := c.Param("id")
-	adminUserID, _ := c.Get("user_id")
+	adminUserID := c.GetUint("user_id")
 
 	var file models.File
 	if err := h.db.First(&file, fileID).Error; err != nil {
@@ -655,7 +780,7 @@ func (h *AdminHandler) DeleteFile(c *gin.Context) {
 	now := time.Now()
 	file.IsDeleted = true
 	file.DeletedAt = &now
-	file.DeletedBy = adminUserID.(*uint)
+	file.DeletedBy = &adminUserID
 
 	if err := h.db.Save(&file).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -667,6 +792,9 @@ func (h *AdminHandler) DeleteFile(c *gin.Context) {
 		})
 		return
 	}
+	if err := services.RefreshFolderStats(h.db, file.ParentID); err != nil {
+		log.Printf("更新資料夾統計失敗: %v", err)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -713,4 +841,115 @@ func (h *AdminHandler) DownloadFile(c *gin.Context) {
 	c.Header("Content-Disposition", "attachment; filename=\""+file.OriginalName+"\"")
 	c.Header("Content-Type", file.MimeType)
 	c.File(file.FilePath)
-}
\ No newline at end of file
+}
+
+// TransferOwnershipRequest 所有權轉移請求
+type TransferOwnershipRequest struct {
+	ToUserID uint  `json:"to_user_id" binding:"required"`
+	FolderID *uint `json:"folder_id"` // 只轉移此資料夾以下的項目
+	DryRun   bool  `json:"dry_run"`   // 只預覽影響數量
+}
+
+// TransferOwnership 將用戶的檔案、分類、分享與匯出任務轉移給另一位用戶
+func (h *AdminHandler) TransferOwnership(c *gin.Context) {
+	var req TransferOwnershipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "INVALID_REQUEST",
+				"message": "請求格式不正確",
+			},
+		})
+		return
+	}
+
+	var fromUser models.User
+	if err := h.db.First(&fromUser, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "USER_NOT_FOUND",
+				"message": "來源用戶不存在",
+			},
+		})
+		return
+	}
+
+	var toUser models.User
+	if err := h.db.First(&toUser, req.ToUserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "USER_NOT_FOUND",
+				"message": "目標用戶不存在",
+			},
+		})
+		return
+	}
+
+	if toUser.Status != "approved" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "INVALID_TARGET_USER",
+				"message": "目標用戶必須是已核准的帳號",
+			},
+		})
+		return
+	}
+
+	if req.FolderID != nil {
+		var folder models.File
+		if err := h.db.Where("id = ? AND is_directory = ?", *req.FolderID, true).First(&folder).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code": "FOLDER_NOT_FOUND",
+					"message": "資料夾不存在",
+				},
+			})
+			return
+		}
+	}
+
+	result, err := services.TransferOwnership(h.db, services.OwnershipTransferOptions{
+		FromUserID: fromUser.ID,
+		ToUserID:   toUser.ID,
+		FolderID:   req.FolderID,
+		DryRun:     req.DryRun,
+		ActorID:    c.GetUint("user_id"),
+		IPAddress:  c.ClientIP(),
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		code := "TRANSFER_FAILED"
+		if errors.Is(err, services.ErrSameOwner) {
+			status = http.StatusBadRequest
+			code = "INVALID_REQUEST"
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": code,
+				"message": "轉移所有權失敗: " + err.Error(),
+			},
+		})
+		return
+	}
+
+	if req.DryRun {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "預覽轉移影響範圍",
+			"data": result,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("已將 %s 的資源轉移給 %s", fromUser.Name, toUser.Name),
+		"data": result,
+	})
+}
@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,31 +14,59 @@ import (
 	"memoryark/internal/config"
 	"memoryark/internal/models"
 	"memoryark/internal/auth"
+	"memoryark/internal/services"
+	"memoryark/pkg/logger"
 )
 
 // AuthHandler 認證處理器
 type AuthHandler struct {
-	db  *gorm.DB
-	cfg *config.Config
+	db     *gorm.DB
+	cfg    *config.Config
+	mailer services.Mailer // 寄送登入碼，未設定時無法使用登入碼
+
+	accountLimiter *auth.LoginLimiter // 每個帳號的登入失敗次數
+	ipLimiter      *auth.LoginLimiter // 每個 IP 的登入失敗與索取登入碼次數
 }
 
 // NewAuthHandler 創建認證處理器
 func NewAuthHandler(db *gorm.DB, cfg *config.Config) *AuthHandler {
+	mailer, err := services.NewMailer(cfg.Mail)
+	if err != nil {
+		logger.Error("郵件服務設定錯誤，登入碼登入已停用: %v", err)
+	}
+	lockout := time.Duration(cfg.Auth.LoginLockoutMinutes) * time.Minute
 	return &AuthHandler{
-		db:  db,
-		cfg: cfg,
+		db:             db,
+		cfg:            cfg,
+		mailer:         mailer,
+		accountLimiter: auth.NewLoginLimiter(cfg.Auth.LoginMaxAttempts, lockout),
+		ipLimiter:      auth.NewLoginLimiter(cfg.Auth.LoginMaxAttemptsPerIP, lockout),
 	}
 }
 
+// SetMailer 設置寄送登入碼的郵件服務
+func (h *AuthHandler) SetMailer(mailer services.Mailer) {
+	h.mailer = mailer
+}
+
 // RegisterRequest 註冊請求結構 - 按照規格書定義
 type RegisterRequest struct {
 	Name  string `json:"name" binding:"required"`
 	Phone string `json:"phone" binding:"required"`
+	Email string `json:"email"` // 僅內建登入使用，需搭配登入碼證明信箱所有權
+	Code  string `json:"code"`
 }
 
-// LoginRequest 登錄請求結構
+// LoginRequest 登錄請求結構（密碼與登入碼擇一）
 type LoginRequest struct {
-	Email string `json:"email" binding:"required"`
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// LoginCodeRequest 索取登入碼請求結構
+type LoginCodeRequest struct {
+	Email string `json:"email" binding:"required,email"`
 }
 
 // RefreshTokenRequest 刷新令牌請求結構
@@ -43,6 +74,17 @@ type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
+// LogoutRequest 登出請求結構
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// ChangePasswordRequest 變更密碼請求結構
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
 // AuthStatusResponse 認證狀態回應結構
 type AuthStatusResponse struct {
 	Authenticated      bool         `json:"authenticated"`
@@ -62,45 +104,20 @@ func (h *AuthHandler) GetAuthStatus(c *gin.Context) {
 		if email == "" {
 			email = h.cfg.Admin.RootEmail
 		}
-	} else {
-		// 正常模式：從 Cloudflare Access 標頭獲取用戶郵箱
-		// Debug: 記錄所有相關標頭和 cookies
-		fmt.Printf("=== Cloudflare Access Debug ===\n")
-		fmt.Printf("CF-Access-Authenticated-User-Email: %s\n", c.GetHeader("CF-Access-Authenticated-User-Email"))
-		fmt.Printf("Cf-Access-Authenticated-User-Email: %s\n", c.GetHeader("Cf-Access-Authenticated-User-Email"))
-		fmt.Printf("cf-access-authenticated-user-email: %s\n", c.GetHeader("cf-access-authenticated-user-email"))
-		
-		// 檢查所有以 CF 或 cf 開頭的標頭
-		for key, values := range c.Request.Header {
-			if len(key) >= 2 && (key[:2] == "CF" || key[:2] == "Cf" || key[:2] == "cf") {
-				fmt.Printf("Found CF header: %s = %v\n", key, values)
+	} else if h.cfg.Auth.UsesLocalSessions() {
+		// 內建登入或 OIDC：從 Bearer 存取令牌取得用戶郵箱
+		if token := auth.BearerToken(c.Request); token != "" {
+			if claims, err := h.sessions().ValidateAccessToken(token); err == nil {
+				email = claims.Email
 			}
 		}
-		
-		// 檢查 cookies
-		fmt.Printf("=== Cookies ===\n")
-		for _, cookie := range c.Request.Cookies() {
-			if len(cookie.Name) >= 2 && (cookie.Name[:2] == "CF" || cookie.Name[:2] == "cf") {
-				fmt.Printf("Found CF cookie: %s = %s\n", cookie.Name, cookie.Value)
-			}
-		}
-		
-		// 檢查 JWT token 相關的 cookies
-		if jwtCookie, err := c.Cookie("CF_Authorization"); err == nil {
-			fmt.Printf("CF_Authorization cookie found: %s\n", jwtCookie[:50]+"...")
-		}
-		if cfToken, err := c.Cookie("cf-access-token"); err == nil {
-			fmt.Printf("cf-access-token cookie found: %s\n", cfToken[:50]+"...")
-		}
-		fmt.Printf("==============================\n")
-		
-		email = c.GetHeader("CF-Access-Authenticated-User-Email")
-		if email == "" {
-			email = c.GetHeader("Cf-Access-Authenticated-User-Email")
-		}
-		if email == "" {
-			email = c.GetHeader("cf-access-authenticated-user-email")
+	} else {
+		// 正常模式：驗證 Cloudflare Access JWT 後取得用戶郵箱
+		verified, err := auth.CloudflareEmailFromRequest(c.Request, h.cfg.Cloudflare)
+		if err != nil && !errors.Is(err, auth.ErrMissingCloudflareToken) {
+			fmt.Printf("[WARN] Cloudflare Access JWT 驗證失敗: %v\n", err)
 		}
+		email = verified
 	}
 	
 	if email == "" {
@@ -191,41 +208,73 @@ func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data": user,
+		"permissions": auth.RolePermissions(h.db, user.Role),
 	})
 }
 
 // Register 用戶註冊申請 - 按照規格書實現
 func (h *AuthHandler) Register(c *gin.Context) {
-	// 從 Cloudflare Access 標頭獲取用戶郵箱 - 嘗試多種可能的格式
-	email := c.GetHeader("CF-Access-Authenticated-User-Email")
-	if email == "" {
-		email = c.GetHeader("Cf-Access-Authenticated-User-Email")
-	}
-	if email == "" {
-		email = c.GetHeader("cf-access-authenticated-user-email")
-	}
-	if email == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error": gin.H{
-				"code": "NO_CLOUDFLARE_AUTH",
-				"message": "未通過 Cloudflare 認證",
+				"code": "INVALID_REQUEST",
+				"message": "請求格式不正確",
+				"details": err.Error(),
 			},
 		})
 		return
 	}
 
-	var req RegisterRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	var email string
+	if h.cfg.Auth.Provider == config.AuthProviderOIDC {
+		// OIDC 登入時會自動建立註冊申請
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error": gin.H{
-				"code": "INVALID_REQUEST",
-				"message": "請求格式不正確",
-				"details": err.Error(),
+				"code": "USE_OIDC_LOGIN",
+				"message": "請透過登入頁面完成註冊",
 			},
 		})
 		return
+	} else if h.cfg.Auth.IsLocalJWT() {
+		// 內建登入：以登入碼證明信箱所有權
+		email = strings.TrimSpace(req.Email)
+		if email == "" || req.Code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code": "INVALID_REQUEST",
+					"message": "請提供 email 與登入碼",
+				},
+			})
+			return
+		}
+		if err := auth.VerifyLoginCode(h.db, email, req.Code); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code": "INVALID_LOGIN_CODE",
+					"message": "登入碼錯誤或已過期",
+				},
+			})
+			return
+		}
+	} else {
+		// 從已驗證的 Cloudflare Access JWT 取得用戶郵箱
+		verified, err := auth.CloudflareEmailFromRequest(c.Request, h.cfg.Cloudflare)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code": "NO_CLOUDFLARE_AUTH",
+					"message": "未通過 Cloudflare 認證",
+				},
+			})
+			return
+		}
+		email = verified
 	}
 
 	// 檢查是否已經有註冊申請
@@ -345,96 +394,460 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	})
 }
 
-// Login 用戶登錄
+// Login 用戶登錄（AUTH_PROVIDER=local-jwt），可使用密碼或一次性登入碼
 func (h *AuthHandler) Login(c *gin.Context) {
+	if !h.requireLocalAuth(c) {
+		return
+	}
+
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		h.invalidRequest(c, err)
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	if h.loginLocked(c, email) {
+		return
+	}
+
+	var user models.User
+	userErr := h.db.Where("email = ?", email).First(&user).Error
+	if userErr != nil && !errors.Is(userErr, gorm.ErrRecordNotFound) {
+		h.databaseError(c, "資料庫查詢失敗")
+		return
+	}
+
+	authenticated := false
+	switch {
+	case req.Code != "":
+		if err := auth.VerifyLoginCode(h.db, email, req.Code); err == nil {
+			authenticated = userErr == nil
+		} else if !errors.Is(err, auth.ErrInvalidLoginCode) {
+			h.databaseError(c, "驗證登入碼失敗")
+			return
+		}
+	case req.Password != "":
+		authenticated = auth.CheckPassword(user.PasswordHash, req.Password) && userErr == nil
+	default:
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid request format",
+			"success": false,
+			"error": gin.H{
+				"code": "INVALID_REQUEST",
+				"message": "請提供密碼或登入碼",
+			},
 		})
 		return
 	}
-	
-	// 查找用戶
-	var user models.User
-	if err := h.db.Where("email = ? AND status = ?", req.Email, "approved").First(&user).Error; err != nil {
+
+	if !authenticated {
+		h.accountLimiter.Record(loginLimiterKey(email))
+		h.ipLimiter.Record(c.ClientIP())
 		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "User not found or not approved",
+			"success": false,
+			"error": gin.H{
+				"code": "INVALID_CREDENTIALS",
+				"message": "帳號或驗證資訊錯誤",
+			},
 		})
 		return
 	}
-	
-	// 生成 JWT 令牌
-	tokenPair, err := auth.GenerateTokenPair(
-		user.ID,
-		user.Email,
-		user.Role,
-		h.cfg.Auth.JWTSecret,
-		h.cfg.Auth.TokenExpiry,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to generate token",
+	h.accountLimiter.Reset(loginLimiterKey(email))
+
+	if user.Status != "approved" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "USER_NOT_APPROVED",
+				"message": "帳號尚未通過審核",
+			},
 		})
 		return
 	}
-	
+
+	tokenPair, err := h.sessions().IssueTokens(&user, sessionMeta(c))
+	if err != nil {
+		h.databaseError(c, "簽發令牌失敗")
+		return
+	}
+
 	// 更新最後登錄時間
 	now := time.Now()
 	user.LastLoginAt = &now
-	h.db.Save(&user)
-	
+	h.db.Model(&user).Update("last_login_at", now)
+
 	c.JSON(http.StatusOK, gin.H{
-		"user":         user,
-		"access_token": tokenPair.AccessToken,
-		"refresh_token": tokenPair.RefreshToken,
-		"expires_in":   tokenPair.ExpiresIn,
+		"success": true,
+		"data": gin.H{
+			"user":          user,
+			"access_token":  tokenPair.AccessToken,
+			"refresh_token": tokenPair.RefreshToken,
+			"expires_in":    tokenPair.ExpiresIn,
+			"token_type":    tokenPair.TokenType,
+		},
 	})
 }
 
-// RefreshToken 刷新令牌
+// RequestLoginCode 以電子郵件寄送一次性登入碼，無論 email 是否存在都返回相同結果
+func (h *AuthHandler) RequestLoginCode(c *gin.Context) {
+	if !h.requireLocalAuth(c) {
+		return
+	}
+	if h.mailer == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "LOGIN_CODE_UNAVAILABLE",
+				"message": "尚未設定郵件服務，無法使用登入碼",
+			},
+		})
+		return
+	}
+
+	var req LoginCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.invalidRequest(c, err)
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	if h.loginLocked(c, email) {
+		return
+	}
+	// 每次索取都計入 IP 的次數，避免大量寄送郵件
+	h.ipLimiter.Record(c.ClientIP())
+
+	code, err := auth.IssueLoginCode(h.db, email, time.Duration(h.cfg.Auth.LoginCodeExpiry)*time.Minute)
+	switch {
+	case errors.Is(err, auth.ErrLoginCodeTooSoon):
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "LOGIN_CODE_TOO_SOON",
+				"message": "請稍候再重新索取登入碼",
+			},
+		})
+		return
+	case err != nil:
+		h.databaseError(c, "產生登入碼失敗")
+		return
+	}
+
+	body := fmt.Sprintf("您的 MemoryArk 登入碼是 %s，%d 分鐘內有效。\n\n若您沒有要求登入，請忽略此郵件。", code, h.cfg.Auth.LoginCodeExpiry)
+	if err := h.mailer.SendMail(email, "MemoryArk 登入碼", body); err != nil {
+		// 寄送失敗時作廢登入碼，讓用戶可以立即重新索取
+		logger.Error("寄送登入碼失敗: email=%s: %v", email, err)
+		if err := auth.DiscardLoginCodes(h.db, email); err != nil {
+			logger.Error("作廢登入碼失敗: email=%s: %v", email, err)
+		}
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "LOGIN_CODE_SEND_FAILED",
+				"message": "寄送登入碼失敗，請稍後再試",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "登入碼已寄出",
+		"data": gin.H{
+			"expires_in": h.cfg.Auth.LoginCodeExpiry * 60,
+		},
+	})
+}
+
+// RefreshToken 刷新令牌，舊的刷新令牌立即失效
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
+	if !h.requireLocalSessions(c) {
+		return
+	}
+
 	var req RefreshTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid request format",
+		h.invalidRequest(c, err)
+		return
+	}
+
+	tokenPair, _, err := h.sessions().RotateRefreshToken(req.RefreshToken, sessionMeta(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrRefreshTokenReused):
+			logger.Warn("偵測到刷新令牌重複使用，已撤銷該登入的所有令牌 (IP=%s)", c.ClientIP())
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code": "REFRESH_TOKEN_REUSED",
+					"message": "刷新令牌已被使用，請重新登入",
+				},
+			})
+		case errors.Is(err, auth.ErrInvalidRefreshToken):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code": "INVALID_REFRESH_TOKEN",
+					"message": "刷新令牌無效或已過期",
+				},
+			})
+		default:
+			h.databaseError(c, "刷新令牌失敗")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": tokenPair,
+	})
+}
+
+// Logout 用戶登出，撤銷目前的存取令牌與刷新令牌家族
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if !h.cfg.Auth.UsesLocalSessions() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "登出成功",
 		})
 		return
 	}
-	
-	// 刷新令牌
-	tokenPair, err := auth.RefreshToken(
-		req.RefreshToken,
-		h.cfg.Auth.JWTSecret,
-		h.cfg.Auth.TokenExpiry,
-	)
+
+	var req LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.invalidRequest(c, err)
+			return
+		}
+	}
+
+	sessions := h.sessions()
+	claims, err := sessions.ValidateAccessToken(auth.BearerToken(c.Request))
 	if err != nil {
+		// 存取令牌已過期時仍允許以刷新令牌登出
+		claims = nil
+	}
+	if claims == nil && req.RefreshToken == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid refresh token",
+			"success": false,
+			"error": gin.H{
+				"code": "UNAUTHORIZED",
+				"message": "未授權訪問",
+			},
 		})
 		return
 	}
-	
+
+	if claims != nil {
+		if err := sessions.RevokeAccessToken(claims); err != nil {
+			h.databaseError(c, "撤銷令牌失敗")
+			return
+		}
+	}
+
+	if req.RefreshToken != "" {
+		var refresh models.RefreshToken
+		if err := h.db.Where("token_hash = ?", auth.HashToken(req.RefreshToken)).First(&refresh).Error; err == nil {
+			// 有存取令牌時只能撤銷自己的刷新令牌
+			if claims == nil || claims.UserID == refresh.UserID {
+				if err := sessions.RevokeRefreshToken(req.RefreshToken, refresh.UserID); err != nil {
+					h.databaseError(c, "撤銷令牌失敗")
+					return
+				}
+			}
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"access_token":  tokenPair.AccessToken,
-		"refresh_token": tokenPair.RefreshToken,
-		"expires_in":    tokenPair.ExpiresIn,
+		"success": true,
+		"message": "登出成功",
 	})
 }
 
-// Logout 用戶登出
-func (h *AuthHandler) Logout(c *gin.Context) {
-	// 在實際應用中，這裡可以實現令牌黑名單機制
+// ChangePassword 設定或變更密碼，成功後其他裝置的登入全部失效
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	if !h.requireLocalAuth(c) {
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.invalidRequest(c, err)
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "USER_NOT_FOUND",
+				"message": "用戶不存在",
+			},
+		})
+		return
+	}
+
+	// 已設定密碼時必須提供目前的密碼
+	if user.PasswordHash != "" && !auth.CheckPassword(user.PasswordHash, req.CurrentPassword) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "INVALID_CREDENTIALS",
+				"message": "目前的密碼不正確",
+			},
+		})
+		return
+	}
+
+	hash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		if errors.Is(err, auth.ErrPasswordTooShort) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code": "PASSWORD_TOO_SHORT",
+					"message": fmt.Sprintf("密碼至少需要 %d 個字元", auth.MinPasswordLength),
+				},
+			})
+			return
+		}
+		h.databaseError(c, "設定密碼失敗")
+		return
+	}
+
+	if err := h.db.Model(&user).Update("password_hash", hash).Error; err != nil {
+		h.databaseError(c, "設定密碼失敗")
+		return
+	}
+
+	sessions := h.sessions()
+	if err := sessions.RevokeUserSessions(user.ID); err != nil {
+		h.databaseError(c, "撤銷舊登入失敗")
+		return
+	}
+	if claims, ok := c.Get("token_claims"); ok {
+		sessions.RevokeAccessToken(claims.(*auth.JWTClaims))
+	}
+
+	tokenPair, err := sessions.IssueTokens(&user, sessionMeta(c))
+	if err != nil {
+		h.databaseError(c, "簽發令牌失敗")
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Logout successful",
+		"success": true,
+		"message": "密碼已更新",
+		"data": tokenPair,
 	})
 }
 
+// loginLocked 帳號或 IP 的登入嘗試過多時返回 429
+func (h *AuthHandler) loginLocked(c *gin.Context, email string) bool {
+	retryAfter := h.accountLimiter.RetryAfter(loginLimiterKey(email))
+	if ipRetry := h.ipLimiter.RetryAfter(c.ClientIP()); ipRetry > retryAfter {
+		retryAfter = ipRetry
+	}
+	if retryAfter <= 0 {
+		return false
+	}
+
+	c.Header("Retry-After", strconv.Itoa(int(retryAfter/time.Second)+1))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"success": false,
+		"error": gin.H{
+			"code": "TOO_MANY_ATTEMPTS",
+			"message": "嘗試次數過多，請稍後再試",
+		},
+	})
+	return true
+}
+
+// loginLimiterKey 帳號的嘗試次數以不分大小寫的 email 計算
+func loginLimiterKey(email string) string {
+	return strings.ToLower(email)
+}
+
+// requireLocalAuth 內建登入功能只在 AUTH_PROVIDER=local-jwt 時開放
+func (h *AuthHandler) requireLocalAuth(c *gin.Context) bool {
+	if h.cfg.Auth.IsLocalJWT() {
+		return true
+	}
+	c.JSON(http.StatusNotFound, gin.H{
+		"success": false,
+		"error": gin.H{
+			"code": "LOCAL_AUTH_DISABLED",
+			"message": "未啟用內建登入",
+		},
+	})
+	return false
+}
+
+// requireLocalSessions 令牌刷新只在由 MemoryArk 簽發令牌時開放（local-jwt 或 oidc）
+func (h *AuthHandler) requireLocalSessions(c *gin.Context) bool {
+	if h.cfg.Auth.UsesLocalSessions() {
+		return true
+	}
+	c.JSON(http.StatusNotFound, gin.H{
+		"success": false,
+		"error": gin.H{
+			"code": "LOCAL_AUTH_DISABLED",
+			"message": "未啟用內建登入",
+		},
+	})
+	return false
+}
+
+// sessions 取得令牌管理器
+func (h *AuthHandler) sessions() *auth.SessionManager {
+	return auth.NewSessionManager(h.db, h.cfg.Auth)
+}
+
+// invalidRequest 返回請求格式錯誤
+func (h *AuthHandler) invalidRequest(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"success": false,
+		"error": gin.H{
+			"code": "INVALID_REQUEST",
+			"message": "請求格式不正確",
+			"details": err.Error(),
+		},
+	})
+}
+
+// databaseError 返回資料庫錯誤
+func (h *AuthHandler) databaseError(c *gin.Context, message string) {
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"success": false,
+		"error": gin.H{
+			"code": "DATABASE_ERROR",
+			"message": message,
+		},
+	})
+}
+
+// oidcLoginURL 啟用 OIDC 時返回登入入口
+func oidcLoginURL(cfg *config.Config) string {
+	if cfg.Auth.Provider != config.AuthProviderOIDC {
+		return ""
+	}
+	return "/api/auth/oidc/login"
+}
+
+// sessionMeta 取得簽發令牌時記錄的用戶端資訊
+func sessionMeta(c *gin.Context) auth.SessionMeta {
+	return auth.SessionMeta{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
 // GetFeatureConfig 獲取功能配置（提供給前端控制功能顯示）
 func (h *AuthHandler) GetFeatureConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data": gin.H{
+			"authProvider":          h.cfg.Auth.Provider,
+			"oidcLoginUrl":          oidcLoginURL(h.cfg),
 			"enableSharedResources": h.cfg.Features.EnableSharedResources,
 			"enableSabbathData":     h.cfg.Features.EnableSabbathData,
 		},
@@ -8,6 +8,7 @@ import (
 	"gorm.io/gorm"
 
 	"memoryark/internal/config"
+	"memoryark/internal/middleware"
 	"memoryark/internal/models"
 )
 
@@ -328,9 +329,8 @@ func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
 		return
 	}
 
-	// 權限檢查：只有創建者或管理員可以修改
-	user := c.MustGet("user").(models.User)
-	if category.CreatedBy != userID && user.Role != "admin" {
+	// 權限檢查：只有創建者或具備 categories.manage 權限者可以修改
+	if category.CreatedBy != userID && !middleware.HasPermission(h.db, c, models.PermCategoriesManage) {
 		c.JSON(http.StatusForbidden, gin.H{
 			"success": false,
 			"error": gin.H{
@@ -460,9 +460,8 @@ func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
 		return
 	}
 
-	// 權限檢查：只有創建者或管理員可以刪除
-	user := c.MustGet("user").(models.User)
-	if category.CreatedBy != userID && user.Role != "admin" {
+	// 權限檢查：只有創建者或具備 categories.manage 權限者可以刪除
+	if category.CreatedBy != userID && !middleware.HasPermission(h.db, c, models.PermCategoriesManage) {
 		c.JSON(http.StatusForbidden, gin.H{
 			"success": false,
 			"error": gin.H{
@@ -16,6 +16,7 @@ import (
 	"gorm.io/gorm"
 
 	"memoryark/internal/config"
+	"memoryark/internal/middleware"
 	"memoryark/internal/models"
 )
 
@@ -41,6 +42,7 @@ type StreamExportRequest struct {
 	IncludeSubfolders  bool      `json:"include_subfolders"`
 	Format             string    `json:"format"` // zip, tar
 	FileTypes          []string  `json:"file_types"` // image, video, audio, document
+	AllUsers           bool      `json:"all_users"` // 匯出所有用戶的檔案（需要 export.all 權限）
 }
 
 // QuickExportRequest 快速匯出請求
@@ -87,6 +89,17 @@ func (h *ExportHandler) StreamExport(c *gin.Context) {
 		return
 	}
 
+	if req.AllUsers && !middleware.HasPermission(h.db, c, models.PermExportAll) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "INSUFFICIENT_PERMISSIONS",
+				"message": "沒有匯出所有用戶檔案的權限",
+			},
+		})
+		return
+	}
+
 	// 建立匯出任務
 	jobID := uuid.New().String()
 	job := models.ExportJob{
@@ -256,8 +269,10 @@ func (h *ExportHandler) processStreamExport(job models.ExportJob, req StreamExpo
 	h.db.Model(&job).Update("status", "processing")
 
 	// 查詢符合條件的檔案
-	query := h.db.Model(&models.File{}).
-		Where("uploaded_by = ? AND is_deleted = ?", userID, false)
+	query := h.db.Model(&models.File{}).Where("is_deleted = ?", false)
+	if !req.AllUsers {
+		query = query.Where("uploaded_by = ?", userID)
+	}
 
 	// 應用篩選條件
 	if len(req.CategoryIDs) > 0 {
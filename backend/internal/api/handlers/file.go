@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"crypto/md5"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"net/http"
 	"os"
@@ -19,7 +21,9 @@ import (
 	"gorm.io/gorm"
 
 	"memoryark/internal/config"
+	"memoryark/internal/middleware"
 	"memoryark/internal/models"
+	"memoryark/internal/services"
 	"memoryark/pkg/api"
 )
 
@@ -28,6 +32,7 @@ type FileHandler struct {
 	db  *gorm.DB
 	cfg *config.Config
 	wsHandler interface{} // WebSocket 處理器接口
+	jobs      *services.JobQueue // 背景工作佇列
 }
 
 // 允許的檔案擴展名白名單 (教會數位資產管理系統適用)
@@ -149,6 +154,88 @@ func isValidFileExtension(filename string) bool {
 	return allowedExtensions[ext]
 }
 
+// maxUploadFileSize 一般上傳的單檔大小上限 (100MB)
+const maxUploadFileSize = int64(100 * 1024 * 1024)
+
+// uploadValidationError 上傳檔案驗證錯誤
+type uploadValidationError struct {
+	Code    string
+	Message string
+}
+
+// validateUploadFile 檢查上傳檔案是否為系統檔案、類型是否允許以及大小是否超過限制
+func validateUploadFile(file *multipart.FileHeader, maxSize int64) *uploadValidationError {
+	// 檢查是否為系統檔案
+	if strings.EqualFold(file.Filename, "Thumbs.db") ||
+		strings.EqualFold(file.Filename, ".DS_Store") ||
+		strings.HasPrefix(file.Filename, "~") ||
+		strings.HasSuffix(file.Filename, ".tmp") {
+		return &uploadValidationError{
+			Code:    "SYSTEM_FILE",
+			Message: fmt.Sprintf("系統檔案 '%s' 不需要上傳", file.Filename),
+		}
+	}
+
+	// 檢查檔案類型安全性
+	if !isValidFileExtension(file.Filename) {
+		ext := strings.ToLower(filepath.Ext(file.Filename))
+		return &uploadValidationError{
+			Code:    "INVALID_FILE_TYPE",
+			Message: fmt.Sprintf("不允許上傳 '%s' 類型的檔案，基於安全考量", ext),
+		}
+	}
+
+	// 檢查檔案大小
+	if file.Size > maxSize {
+		return &uploadValidationError{
+			Code:    "FILE_TOO_LARGE",
+			Message: "檔案大小超過限制",
+		}
+	}
+
+	return nil
+}
+
+// hashUploadedFile 計算上傳檔案的 SHA256 雜湊值
+func hashUploadedFile(file *multipart.FileHeader) (string, error) {
+	uploadedFile, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer uploadedFile.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, uploadedFile); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// storeUploadedBlob 將上傳檔案以純 UUID 檔名儲存到 hash 前2位的子目錄，返回實體路徑
+func (h *FileHandler) storeUploadedBlob(c *gin.Context, file *multipart.FileHeader, sha256Hash string) (string, error) {
+	// 創建基於 hash 前2位的子目錄結構（提升檔案系統效能）
+	uploadDir := filepath.Join(h.cfg.Upload.UploadPath, "files", sha256Hash[:2])
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		return "", fmt.Errorf("創建儲存目錄失敗: %v", err)
+	}
+
+	physicalPath := filepath.Join(uploadDir, uuid.New().String())
+	if err := c.SaveUploadedFile(file, physicalPath); err != nil {
+		return "", err
+	}
+	return physicalPath, nil
+}
+
+// findBlobByHash 查找相同雜湊值且未刪除的檔案（去重機制）
+func (h *FileHandler) findBlobByHash(sha256Hash string) (*models.File, error) {
+	var existingFile models.File
+	if err := h.db.Where("sha256_hash = ? AND is_deleted = ? AND is_directory = ?", sha256Hash, false, false).
+		First(&existingFile).Error; err != nil {
+		return nil, err
+	}
+	return &existingFile, nil
+}
+
 // NewFileHandler 創建檔案處理器
 func NewFileHandler(db *gorm.DB, cfg *config.Config) *FileHandler {
 	return &FileHandler{
@@ -175,6 +262,20 @@ func (h *FileHandler) broadcastFileEvent(eventType string, folderId *int, messag
 	}
 }
 
+// refreshFolderStats 更新受影響資料夾的大小與項目數統計；失敗時只記錄，可由修復工作重新計算
+func (h *FileHandler) refreshFolderStats(db *gorm.DB, parentIDs ...*uint) {
+	if err := services.RefreshFolderStatsFor(db, parentIDs...); err != nil {
+		log.Printf("更新資料夾統計失敗: %v", err)
+	}
+}
+
+// refreshItemFolderStats 整批加入的項目（例如複製的資料夾）更新其子樹與上層資料夾的統計
+func (h *FileHandler) refreshItemFolderStats(db *gorm.DB, fileID uint) {
+	if err := services.RefreshItemFolderStats(db, fileID); err != nil {
+		log.Printf("更新資料夾統計失敗: %v", err)
+	}
+}
+
 // GetFiles 獲取檔案列表
 func (h *FileHandler) GetFiles(c *gin.Context) {
 	// 驗證用戶已登入（但不限制檔案查看權限，實現共享）
@@ -211,8 +312,8 @@ func (h *FileHandler) GetFiles(c *gin.Context) {
 	
 	// 篩選條件
 	if virtualPath != "" {
-		// 使用虛擬路徑查詢
-		query = query.Where("virtual_path LIKE ?", virtualPath+"%")
+		// 使用虛擬路徑查詢（只比對完整的路徑段）
+		query = services.ScopeVirtualPath(query, virtualPath)
 	} else if parentID == "" {
 		query = query.Where("parent_id IS NULL")
 	} else {
@@ -229,6 +330,9 @@ func (h *FileHandler) GetFiles(c *gin.Context) {
 	} else {
 		query = query.Where("is_deleted = ?", false)
 	}
+
+	// 等待審核的訪客上傳不顯示在檔案列表
+	query = query.Where("(files.review_status IS NULL OR files.review_status <> ?)", models.ReviewStatusPending)
 	
 	// LINE 篩選
 	if fromLine == "true" {
@@ -363,6 +467,7 @@ func (h *FileHandler) SearchFiles(c *gin.Context) {
 	
 	// 構建基礎查詢
 	baseQuery := h.db.Model(&models.File{}).Where("is_deleted = ?", false)
+	baseQuery = baseQuery.Where("(files.review_status IS NULL OR files.review_status <> ?)", models.ReviewStatusPending)
 	
 	// 全文搜尋檔案名稱
 	baseQuery = baseQuery.Where("name LIKE ? OR original_name LIKE ?", 
@@ -371,15 +476,11 @@ func (h *FileHandler) SearchFiles(c *gin.Context) {
 	// 搜尋範圍限制
 	if folderID != "" {
 		if recursive {
-			// 遞迴搜尋：使用虛擬路徑前綴匹配
+			// 遞迴搜尋：使用 ID 路徑前綴匹配
 			var folder models.File
 			if err := h.db.First(&folder, folderID).Error; err == nil && folder.IsDirectory {
 				// 搜尋該資料夾及其所有子資料夾
-				virtualPathPrefix := folder.VirtualPath
-				if virtualPathPrefix != "" && !strings.HasSuffix(virtualPathPrefix, "/") {
-					virtualPathPrefix += "/"
-				}
-				baseQuery = baseQuery.Where("virtual_path LIKE ?", virtualPathPrefix+"%")
+				baseQuery = services.ScopeDescendants(baseQuery, folder)
 			}
 		} else {
 			// 只搜尋直接子檔案
@@ -532,64 +633,27 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 		return
 	}
 	
-	// 檢查是否為系統檔案
-	if strings.EqualFold(file.Filename, "Thumbs.db") ||
-		strings.EqualFold(file.Filename, ".DS_Store") ||
-		strings.HasPrefix(file.Filename, "~") ||
-		strings.HasSuffix(file.Filename, ".tmp") {
+	// 檢查系統檔案、檔案類型及大小
+	if verr := validateUploadFile(file, maxUploadFileSize); verr != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error": gin.H{
-				"code": "SYSTEM_FILE",
-				"message": fmt.Sprintf("系統檔案 '%s' 不需要上傳", file.Filename),
-			},
-		})
-		return
-	}
-	
-	// 檢查檔案類型安全性
-	if !isValidFileExtension(file.Filename) {
-		ext := strings.ToLower(filepath.Ext(file.Filename))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error": gin.H{
-				"code": "INVALID_FILE_TYPE",
-				"message": fmt.Sprintf("不允許上傳 '%s' 類型的檔案，基於安全考量", ext),
-			},
-		})
-		return
-	}
-	
-	// 檢查檔案大小
-	maxSize := int64(100 * 1024 * 1024) // 100MB
-	if file.Size > maxSize {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error": gin.H{
-				"code": "FILE_TOO_LARGE",
-				"message": "檔案大小超過限制",
+				"code": verr.Code,
+				"message": verr.Message,
 			},
 		})
 		return
 	}
 
-	// 開啟上傳的檔案以計算 SHA256
-	uploadedFile, err := file.Open()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error": gin.H{
-				"code": "FILE_READ_ERROR",
-				"message": "無法讀取上傳檔案",
-			},
-		})
+	// 同名衝突的處理方式
+	policy, explicitPolicy, ok := uploadConflictPolicy(c)
+	if !ok {
 		return
 	}
-	defer uploadedFile.Close()
 
 	// 計算 SHA256 雜湊值
-	hash := sha256.New()
-	if _, err := io.Copy(hash, uploadedFile); err != nil {
+	sha256Hash, err := hashUploadedFile(file)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error": gin.H{
@@ -599,11 +663,9 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 		})
 		return
 	}
-	sha256Hash := fmt.Sprintf("%x", hash.Sum(nil))
 
 	// 檢查是否已存在相同雜湊值的檔案（去重機制）
-	var existingFile models.File
-	if err := h.db.Where("sha256_hash = ? AND is_deleted = ?", sha256Hash, false).First(&existingFile).Error; err == nil {
+	if existingFile, err := h.findBlobByHash(sha256Hash); err == nil {
 		// 檔案已存在，創建新的檔案記錄但指向相同的實體檔案
 		
 		// 處理父資料夾和虛擬路徑
@@ -648,30 +710,27 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 			}
 		}
 
-		// 檢查是否在相同位置已存在相同檔名的檔案
-		if sameLocationFile, err := h.checkSameLocationAndName(file.Filename, parentIDPtr, userID); err == nil {
-			// 相同位置 + 相同檔名 + 相同內容 = 跳過上傳
-			if sameLocationFile.SHA256Hash == sha256Hash {
-				c.JSON(http.StatusOK, gin.H{
-					"success": true,
-					"skipped": true,
-					"message": "檔案已存在，跳過上傳",
-					"data": gin.H{
-						"existingFileId": sameLocationFile.ID,
-						"fileName": file.Filename,
-						"reason": "檔案內容和位置完全相同",
-					},
-				})
-				return
-			}
+		// 相同位置已有同名檔案時依衝突處理方式略過、失敗、重新命名或建立新版本（沿用既有的實體檔案）
+		resolution, handled := h.resolveUploadConflict(c, policy, explicitPolicy, file.Filename, parentIDPtr, sha256Hash, userID)
+		if handled {
+			return
+		}
+		if resolution.Status == WriteStatusOverwritten {
+			h.respondNewVersion(c, resolution.Existing, services.FileContent{
+				FilePath:   existingFile.FilePath,
+				SHA256Hash: sha256Hash,
+				FileSize:   file.Size,
+				MimeType:   file.Header.Get("Content-Type"),
+			}, userID)
+			return
 		}
 
 		// 建立虛擬路徑
-		virtualPath := h.buildVirtualPath(parentIDPtr, file.Filename)
+		virtualPath := h.buildVirtualPath(parentIDPtr, resolution.Name)
 
 		// 創建新的檔案記錄（內容去重但不同檔名或位置）
 		fileRecord := models.File{
-			Name:         file.Filename,
+			Name:         resolution.Name,
 			OriginalName: file.Filename,
 			FilePath:     existingFile.FilePath, // 使用相同的實體檔案路徑
 			VirtualPath:  virtualPath,
@@ -696,6 +755,8 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 			return
 		}
 
+		h.refreshFolderStats(h.db, fileRecord.ParentID)
+		
 		// 廣播檔案去重上傳事件
 		var broadcastParentID *int
 		if parentIDPtr != nil {
@@ -711,6 +772,7 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 
 		c.JSON(http.StatusCreated, gin.H{
 			"success": true,
+			"status": resolution.Status,
 			"deduplicated": true,
 			"message": "檔案內容已存在，已建立新的檔案參照",
 			"data": fileRecord,
@@ -727,27 +789,8 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 	}
 
 	// 檔案不存在，需要儲存新檔案
-	// 使用 UUID 作為實體檔案名稱（無副檔名，純 UUID）
-	fileUUID := uuid.New().String()
-	
-	// 創建基於 hash 前2位的子目錄結構（提升檔案系統效能）
-	hashPrefix := sha256Hash[:2]
-	uploadDir := filepath.Join(h.cfg.Upload.UploadPath, "files", hashPrefix)
-	
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error": gin.H{
-				"code": "STORAGE_ERROR",
-				"message": "創建儲存目錄失敗",
-			},
-		})
-		return
-	}
-	
-	// 儲存檔案到實體路徑（使用純 UUID 檔名）
-	physicalPath := filepath.Join(uploadDir, fileUUID)
-	if err := c.SaveUploadedFile(file, physicalPath); err != nil {
+	physicalPath, err := h.storeUploadedBlob(c, file, sha256Hash)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error": gin.H{
@@ -829,12 +872,28 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 		}
 	}
 
+	// 相同位置已有同名檔案時依衝突處理方式略過、失敗、重新命名或建立新版本
+	resolution, handled := h.resolveUploadConflict(c, policy, explicitPolicy, file.Filename, parentIDPtr, sha256Hash, userID)
+	if handled {
+		os.Remove(physicalPath)
+		return
+	}
+	if resolution.Status == WriteStatusOverwritten {
+		h.respondNewVersion(c, resolution.Existing, services.FileContent{
+			FilePath:   physicalPath,
+			SHA256Hash: sha256Hash,
+			FileSize:   file.Size,
+			MimeType:   file.Header.Get("Content-Type"),
+		}, userID)
+		return
+	}
+
 	// 建立虛擬路徑
-	virtualPath := h.buildVirtualPath(parentIDPtr, file.Filename)
+	virtualPath := h.buildVirtualPath(parentIDPtr, resolution.Name)
 	
 	// 創建檔案記錄
 	fileRecord := models.File{
-		Name:         file.Filename,
+		Name:         resolution.Name,
 		OriginalName: file.Filename,
 		FilePath:     physicalPath,
 		VirtualPath:  virtualPath,
@@ -861,6 +920,8 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 		return
 	}
 	
+	h.refreshFolderStats(h.db, fileRecord.ParentID)
+	
 	// 廣播檔案上傳事件
 	var broadcastParentID *int
 	if parentIDPtr != nil {
@@ -876,6 +937,7 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
+		"status": resolution.Status,
 		"message": "檔案上傳成功",
 		"data": fileRecord,
 	})
@@ -967,6 +1029,7 @@ func (h *FileHandler) ensureFolderStructure(userID uint, baseParentID *uint, rel
 			if err := h.db.Create(&newFolder).Error; err != nil {
 				return nil, fmt.Errorf("建立資料夾 '%s' 失敗: %v", folderName, err)
 			}
+			h.refreshFolderStats(h.db, currentParentID)
 			
 			currentParentID = &newFolder.ID
 		}
@@ -1050,6 +1113,7 @@ func (h *FileHandler) CreateFolder(c *gin.Context) {
 		})
 		return
 	}
+	h.refreshFolderStats(h.db, folder.ParentID)
 	
 	// 廣播資料夾創建事件
 	var broadcastParentID *int
@@ -1208,6 +1272,12 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 		return
 	}
 	
+	// 大型資料夾可改以背景工作執行
+	if wantsAsync(c) {
+		h.enqueueJob(c, models.JobTypeDelete, deleteJobParams{FileID: file.ID})
+		return
+	}
+	
 	// 開始事務操作
 	tx := h.db.Begin()
 	defer func() {
@@ -1227,6 +1297,20 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 		return
 	}
 	
+	// 記錄此次一併移至垃圾桶的項目，復原時只還原這些項目
+	affectedIDs, err := h.liveSubtreeIDs(file.ID, tx)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "DELETE_FAILED",
+				"message": "刪除檔案失敗",
+			},
+		})
+		return
+	}
+	
 	// 遞迴刪除檔案/資料夾
 	deletedCount, err := h.deleteFileRecursive(file.ID, userIDVal, tx)
 	if err != nil {
@@ -1241,6 +1325,23 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 		return
 	}
 	
+	h.refreshFolderStats(tx, file.ParentID)
+	
+	operation, err := services.RecordFileOperation(tx, userIDVal, models.FileOperationDelete,
+		fmt.Sprintf("將 '%s' 移至垃圾桶", file.Name),
+		[]models.FileOperationItem{{FileID: file.ID, AffectedIDs: affectedIDs}}, h.cfg.Operation.UndoWindow)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "OPERATION_RECORD_FAILED",
+				"message": "記錄操作失敗",
+			},
+		})
+		return
+	}
+	
 	if err := tx.Commit().Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -1288,54 +1389,11 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 		"data": gin.H{
 			"file": file,
 			"deletedCount": deletedCount,
+			"operationId": operationID(operation),
 		},
 	})
 }
 
-// restoreFileRecursive 遞迴還原檔案/資料夾（內部函數）
-func (h *FileHandler) restoreFileRecursive(fileID uint, tx *gorm.DB) (int, error) {
-	var file models.File
-	if err := tx.First(&file, fileID).Error; err != nil {
-		return 0, err
-	}
-	
-	// 如果沒有被刪除，跳過
-	if !file.IsDeleted {
-		return 0, nil
-	}
-	
-	restoredCount := 0
-	
-	// 還原當前項目
-	file.IsDeleted = false
-	file.DeletedAt = nil
-	file.DeletedBy = nil
-	
-	if err := tx.Save(&file).Error; err != nil {
-		return restoredCount, err
-	}
-	
-	restoredCount++
-	
-	// 如果是資料夾，遞迴還原子項目
-	if file.IsDirectory {
-		var children []models.File
-		if err := tx.Where("parent_id = ? AND is_deleted = ?", fileID, true).Find(&children).Error; err != nil {
-			return restoredCount, err
-		}
-		
-		for _, child := range children {
-			childCount, err := h.restoreFileRecursive(child.ID, tx)
-			if err != nil {
-				return restoredCount, err
-			}
-			restoredCount += childCount
-		}
-	}
-	
-	return restoredCount, nil
-}
-
 // RestoreFile 還原檔案
 func (h *FileHandler) RestoreFile(c *gin.Context) {
 	fileID := c.Param("id")
@@ -1363,45 +1421,28 @@ func (h *FileHandler) RestoreFile(c *gin.Context) {
 		return
 	}
 	
-	// 開始事務操作
-	tx := h.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-	
-	if err := tx.Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error": gin.H{
-				"code": "TRANSACTION_ERROR",
-				"message": "事務開始失敗",
-			},
-		})
+	// 可選擇衝突處理方式與還原位置，預設還原到原位置並重新命名
+	var req RestoreRequest
+	if !bindRestoreRequest(c, &req) {
 		return
 	}
-	
-	// 遞迴還原檔案/資料夾
-	restoredCount, err := h.restoreFileRecursive(file.ID, tx)
+	policy, err := services.ParseConflictPolicy(req.Conflict, services.ConflictRename)
 	if err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error": gin.H{
-				"code": "RESTORE_FAILED",
-				"message": "還原檔案失敗",
-			},
-		})
+		api.BadRequest(c, err.Error())
+		return
+	}
+	if !h.validateRestoreTarget(c, req.TargetFolderID) {
 		return
 	}
 	
-	if err := tx.Commit().Error; err != nil {
+	// 遞迴還原檔案/資料夾，上層資料夾已刪除時一併還原或重建
+	outcomes, err := h.restoreFromTrash(file.ID, req.TargetFolderID, policy, c.GetUint("user_id"))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error": gin.H{
-				"code": "COMMIT_FAILED",
-				"message": "提交事務失敗",
+				"code": "RESTORE_FAILED",
+				"message": "還原檔案失敗",
 			},
 		})
 		return
@@ -1419,10 +1460,24 @@ func (h *FileHandler) RestoreFile(c *gin.Context) {
 		return
 	}
 	
+	restoredCount, skippedCount := countRestored(outcomes)
 	message := "檔案還原成功"
-	if file.IsDirectory && restoredCount > 1 {
+	if file.IsDeleted {
+		message = "目標位置已有同名項目，已略過還原"
+	} else if file.IsDirectory && restoredCount > 1 {
 		message = fmt.Sprintf("資料夾及其 %d 個子項目還原成功", restoredCount-1)
 	}
+	if !file.IsDeleted {
+		var broadcastParentID *int
+		if file.ParentID != nil {
+			id := int(*file.ParentID)
+			broadcastParentID = &id
+		}
+		h.broadcastFileEvent("restore", broadcastParentID, fmt.Sprintf("'%s' 已從垃圾桶還原", file.Name), gin.H{
+			"fileId": file.ID,
+			"fileName": file.Name,
+		})
+	}
 	
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -1430,37 +1485,15 @@ func (h *FileHandler) RestoreFile(c *gin.Context) {
 		"data": gin.H{
 			"file": file,
 			"restoredCount": restoredCount,
+			"skippedCount": skippedCount,
+			"items": outcomes,
 		},
 	})
 }
 
 // PermanentDeleteFile 永久刪除檔案
 func (h *FileHandler) PermanentDeleteFile(c *gin.Context) {
-	// 檢查管理員權限
-	userID, exists := c.Get("user_id")
-	if !exists {
-		api.Unauthorized(c, "未授權訪問")
-		return
-	}
-	
-	userIDVal, ok := userID.(uint)
-	if !ok {
-		api.Error(c, http.StatusInternalServerError, api.ErrInvalidUserID, "無效的用戶ID")
-		return
-	}
-	
-	// 檢查用戶是否為管理員
-	var user models.User
-	if err := h.db.First(&user, userIDVal).Error; err != nil {
-		api.Error(c, http.StatusInternalServerError, api.ErrDatabaseError, "查詢用戶失敗")
-		return
-	}
-	
-	if user.Role != "admin" {
-		api.Forbidden(c, "只有管理員可以永久刪除檔案")
-		return
-	}
-	
+	// 權限由路由的 RequirePermission(files.delete.permanent) 檢查
 	fileID := c.Param("id")
 	
 	var file models.File
@@ -1486,6 +1519,18 @@ func (h *FileHandler) PermanentDeleteFile(c *gin.Context) {
 		return
 	}
 	
+	// 受法律保全的項目（含資料夾內的項目）不能永久刪除
+	if held, err := services.SubtreeOnLegalHold(h.db, &file); err != nil || held {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "LEGAL_HOLD",
+				"message": "項目受法律保全，無法永久刪除",
+			},
+		})
+		return
+	}
+	
 	// 如果是資料夾，需要遞歸刪除子項目
 	if file.IsDirectory {
 		if err := h.permanentDeleteFolderRecursive(file.ID); err != nil {
@@ -1499,16 +1544,8 @@ func (h *FileHandler) PermanentDeleteFile(c *gin.Context) {
 			return
 		}
 	} else {
-		// 刪除實體檔案
-		if file.FilePath != "" {
-			if err := os.Remove(file.FilePath); err != nil {
-				// 記錄錯誤但不中斷操作
-				fmt.Printf("Failed to remove file %s: %v\n", file.FilePath, err)
-			}
-		}
-		
-		// 刪除資料庫記錄
-		if err := h.db.Delete(&file).Error; err != nil {
+		// 刪除資料庫記錄、歷史版本及不再被引用的實體檔案（去重後可能與其他檔案共用）
+		if err := services.PurgeFile(h.db, &file); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"success": false,
 				"error": gin.H{
@@ -1538,28 +1575,31 @@ func (h *FileHandler) permanentDeleteFolderRecursive(folderID uint) error {
 	for _, child := range children {
 		if child.IsDirectory {
 			// 遞歸刪除子資料夾
-			if err := h.permanentDeleteFolderRecursive(child.ID); err != nil {
+			if err := h.permanentDeleteFolderRecursive(child.ID); err != nil && !errors.Is(err, services.ErrNotInTrash) {
 				return err
 			}
-		} else {
-			// 刪除子檔案的實體檔案
-			if child.FilePath != "" {
-				if err := os.Remove(child.FilePath); err != nil {
-					// 記錄錯誤但不中斷操作
-					fmt.Printf("Failed to remove file %s: %v\n", child.FilePath, err)
-				}
-			}
+			continue
 		}
 		
-		// 刪除子項目的資料庫記錄
-		if err := h.db.Delete(&child).Error; err != nil {
+		// 刪除子項目的資料庫記錄、歷史版本及不再被引用的實體檔案
+		if err := services.PurgeFile(h.db, &child); err != nil && !errors.Is(err, services.ErrNotInTrash) {
 			return err
 		}
 	}
 	
-	// 最後刪除資料夾本身
-	if err := h.db.Delete(&models.File{}, folderID).Error; err != nil {
-		return err
+	// 最後刪除資料夾本身（期間被還原時保留）
+	result := h.db.Where("id = ? AND is_deleted = ?", folderID, true).Delete(&models.File{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return services.ErrNotInTrash
+	}
+	if err := services.DeleteUserFileStates(h.db, folderID); err != nil {
+		log.Printf("刪除資料夾 %d 的個人狀態失敗: %v", folderID, err)
+	}
+	if err := services.DeleteFileSocial(h.db, folderID); err != nil {
+		log.Printf("刪除資料夾 %d 的按讚與留言失敗: %v", folderID, err)
 	}
 	
 	return nil
@@ -1603,8 +1643,11 @@ func (h *FileHandler) DownloadFile(c *gin.Context) {
 		return
 	}
 	
+	// 捷徑使用目標檔案目前的內容
+	content := h.shortcutContent(&file)
+	
 	// 檢查檔案是否存在
-	if _, err := os.Stat(file.FilePath); os.IsNotExist(err) {
+	if _, err := os.Stat(content.FilePath); os.IsNotExist(err) {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
 			"error": gin.H{
@@ -1621,13 +1664,14 @@ func (h *FileHandler) DownloadFile(c *gin.Context) {
 		// 記錄錯誤但不中斷下載
 		fmt.Printf("Failed to update download count for file %d: %v\n", file.ID, err)
 	}
+	h.recordFileAccess(c, file.ID, models.FileAccessDownload)
 	
 	// 設定回應標頭
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", file.OriginalName))
-	c.Header("Content-Type", file.MimeType)
-	c.Header("Content-Length", fmt.Sprintf("%d", file.FileSize))
+	c.Header("Content-Type", content.MimeType)
+	c.Header("Content-Length", fmt.Sprintf("%d", content.FileSize))
 	
-	c.File(file.FilePath)
+	c.File(content.FilePath)
 }
 
 // PreviewFile 預覽檔案（內聯顯示，不強制下載）
@@ -1649,8 +1693,11 @@ func (h *FileHandler) PreviewFile(c *gin.Context) {
 	// 檢查檔案權限（如有需要）
 	// TODO: 根據需求添加權限檢查邏輯
 
+	// 捷徑使用目標檔案目前的內容
+	content := h.shortcutContent(&file)
+
 	// 檢查實體檔案是否存在
-	if _, err := os.Stat(file.FilePath); os.IsNotExist(err) {
+	if _, err := os.Stat(content.FilePath); os.IsNotExist(err) {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
 			"error": gin.H{
@@ -1661,12 +1708,14 @@ func (h *FileHandler) PreviewFile(c *gin.Context) {
 		return
 	}
 	
+	h.recordFileAccess(c, file.ID, models.FileAccessPreview)
+
 	// 設定回應標頭（內聯顯示）
-	c.Header("Content-Type", file.MimeType)
-	c.Header("Content-Length", fmt.Sprintf("%d", file.FileSize))
+	c.Header("Content-Type", content.MimeType)
+	c.Header("Content-Length", fmt.Sprintf("%d", content.FileSize))
 	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", file.OriginalName))
 	
-	c.File(file.FilePath)
+	c.File(content.FilePath)
 }
 
 // GetStorageStats 獲取儲存空間統計（供前端使用）
@@ -1676,7 +1725,7 @@ func (h *FileHandler) GetStorageStats(c *gin.Context) {
 		Total int64
 	}
 	h.db.Model(&models.File{}).
-		Where("is_deleted = ? AND is_directory = ?", false, false).
+		Where("is_deleted = ? AND is_directory = ? AND shortcut_target_id IS NULL", false, false).
 		Select("COALESCE(SUM(file_size), 0) as total").
 		Scan(&totalSize)
 	
@@ -1788,10 +1837,19 @@ func (h *FileHandler) MoveFile(c *gin.Context) {
 		return
 	}
 	
-	file.ParentID = req.ParentID
-	file.UpdatedAt = time.Now()
+	if err := h.checkCircularDependency([]uint{file.ID}, req.ParentID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code": "INVALID_TARGET",
+				"message": err.Error(),
+			},
+		})
+		return
+	}
 	
-	if err := h.db.Save(&file).Error; err != nil {
+	operation, err := h.relocateWithJournal(&file, req.ParentID, file.Name, models.FileOperationMove, c.GetUint("user_id"))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error": gin.H{
@@ -1806,6 +1864,7 @@ func (h *FileHandler) MoveFile(c *gin.Context) {
 		"success": true,
 		"message": "檔案移動成功",
 		"data": file,
+		"operationId": operationID(operation),
 	})
 }
 
@@ -1840,10 +1899,8 @@ func (h *FileHandler) RenameFile(c *gin.Context) {
 		return
 	}
 	
-	file.Name = req.Name
-	file.UpdatedAt = time.Now()
-	
-	if err := h.db.Save(&file).Error; err != nil {
+	operation, err := h.relocateWithJournal(&file, file.ParentID, req.Name, models.FileOperationRename, c.GetUint("user_id"))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error": gin.H{
@@ -1858,6 +1915,7 @@ func (h *FileHandler) RenameFile(c *gin.Context) {
 		"success": true,
 		"message": "檔案重命名成功",
 		"data": file,
+		"operationId": operationID(operation),
 	})
 }
 
@@ -1964,104 +2022,63 @@ func (h *FileHandler) GetTrash(c *gin.Context) {
 		}
 	}
 	
-	// 為圖片檔案生成縮圖URL
+	// 為圖片檔案生成縮圖URL，並標示預計自動永久刪除的時間
+	holds, err := services.LoadLegalHolds(h.db)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, api.ErrDatabaseError, "查詢法律保全設定失敗")
+		return
+	}
+	retentionDays := h.cfg.Trash.RetentionDays
 	for i := range files {
 		if files[i].MimeType != "" && strings.HasPrefix(files[i].MimeType, "image/") && !files[i].IsDirectory {
 			files[i].ThumbnailURL = fmt.Sprintf("/api/files/%d/preview", files[i].ID)
 		}
+		files[i].OnLegalHold = holds.Held(&files[i])
+		if !files[i].OnLegalHold {
+			files[i].PurgesAt = services.TrashPurgesAt(files[i].DeletedAt, retentionDays)
+		}
 	}
 	
 	api.SuccessWithPagination(c, gin.H{
 		"files": files,
+		"retentionDays": retentionDays,
 	}, page, limit, total)
 }
 
-// EmptyTrash 清空垃圾桶（僅限管理員）
+// EmptyTrash 清空垃圾桶（需要 trash.empty 權限）
 func (h *FileHandler) EmptyTrash(c *gin.Context) {
-	// 檢查管理員權限
-	userID, exists := c.Get("user_id")
-	if !exists {
-		api.Unauthorized(c, "未授權訪問")
-		return
-	}
-	
-	userIDVal, ok := userID.(uint)
-	if !ok {
-		api.Error(c, http.StatusInternalServerError, api.ErrInvalidUserID, "無效的用戶ID")
+	// 權限由路由的 RequirePermission(trash.empty) 檢查
+	if wantsAsync(c) {
+		h.enqueueJob(c, models.JobTypeEmptyTrash, gin.H{})
 		return
 	}
 	
-	// 檢查用戶是否為管理員
-	var user models.User
-	if err := h.db.First(&user, userIDVal).Error; err != nil {
-		api.Error(c, http.StatusInternalServerError, api.ErrDatabaseError, "查詢用戶失敗")
-		return
-	}
-	
-	if user.Role != "admin" {
-		api.Forbidden(c, "只有管理員可以清空垃圾桶")
+	var totalCount int64
+	if err := h.db.Model(&models.File{}).Where("is_deleted = ?", true).Count(&totalCount).Error; err != nil {
+		api.Error(c, http.StatusInternalServerError, api.ErrDatabaseError, "查詢垃圾桶檔案失敗")
 		return
 	}
 	
-	// 獲取所有垃圾桶中的檔案
-	var deletedFiles []models.File
-	if err := h.db.Where("is_deleted = ?", true).Find(&deletedFiles).Error; err != nil {
-		api.Error(c, http.StatusInternalServerError, api.ErrDatabaseError, "查詢垃圾桶檔案失敗")
+	// 受法律保全的項目及其所在的資料夾會保留
+	result, err := services.PurgeTrash(h.db, nil, c.GetUint("user_id"))
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, api.ErrDatabaseError, "清空垃圾桶失敗")
 		return
 	}
 	
-	deletedCount := 0
-	failedCount := 0
-	
-	// 逐一永久刪除每個檔案
-	for _, file := range deletedFiles {
-		fmt.Printf("[DEBUG] 處理檔案 ID:%d, 名稱:%s, 路徑:%s, 是否目錄:%t\n", file.ID, file.Name, file.FilePath, file.IsDirectory)
-		
-		fileDeleted := true
-		
-		// 刪除實體檔案
-		if !file.IsDirectory && file.FilePath != "" {
-			// 檢查檔案路徑是否為絕對路徑，如果不是則加上 /app/ 前綴
-			filePath := file.FilePath
-			if !strings.HasPrefix(filePath, "/") {
-				filePath = "/app/" + filePath
-			}
-			
-			fmt.Printf("[DEBUG] 嘗試刪除實體檔案: %s\n", filePath)
-			if err := os.Remove(filePath); err != nil {
-				if os.IsNotExist(err) {
-					fmt.Printf("[DEBUG] 檔案不存在，可能已被刪除: %s\n", filePath)
-				} else {
-					fmt.Printf("Failed to remove file %s: %v\n", filePath, err)
-					fileDeleted = false
-				}
-			} else {
-				fmt.Printf("[DEBUG] 成功刪除實體檔案: %s\n", filePath)
-			}
-		}
-		
-		// 如果實體檔案刪除成功或不存在，則刪除資料庫記錄
-		if fileDeleted {
-			fmt.Printf("[DEBUG] 嘗試刪除資料庫記錄 ID:%d\n", file.ID)
-			if err := h.db.Delete(&file).Error; err != nil {
-				fmt.Printf("Failed to delete file record %d: %v\n", file.ID, err)
-				failedCount++
-				continue
-			}
-			fmt.Printf("[DEBUG] 成功刪除檔案 ID:%d\n", file.ID)
-			deletedCount++
-		} else {
-			failedCount++
-		}
+	message := fmt.Sprintf("垃圾桶清空完成，成功刪除 %d 個檔案", result.Purged)
+	if result.Held > 0 {
+		message += fmt.Sprintf("，%d 個項目受法律保全而保留", result.Held)
 	}
-	
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": fmt.Sprintf("垃圾桶清空完成，成功刪除 %d 個檔案", deletedCount),
+		"message": message,
 		"data": gin.H{
-			"deletedCount": deletedCount,
-			"failedCount":  failedCount,
-			"totalCount":   len(deletedFiles),
+			"deletedCount": result.Purged,
+			"failedCount":  result.Failed,
+			"heldCount":    result.Held,
+			"keptCount":    result.Kept,
+			"totalCount":   totalCount,
 		},
 	})
 }
@@ -2094,6 +2111,17 @@ type BatchUploadResult struct {
 	UploadedFiles []models.File         `json:"uploaded_files"`
 	SkippedFiles []SkippedFileInfo     `json:"skipped_files"`
 	FailedFiles  []FailedFileInfo      `json:"failed_files"`
+	Items        []BatchUploadItem     `json:"items"`
+}
+
+// BatchUploadItem 批量上傳中單一檔案的結果
+type BatchUploadItem struct {
+	Filename   string `json:"filename"`
+	Status     string `json:"status"`                // created、renamed、overwritten、unchanged、skipped 或 failed
+	FileID     *uint  `json:"file_id,omitempty"`     // 寫入或覆蓋的檔案ID
+	Name       string `json:"name,omitempty"`        // 寫入時使用的名稱
+	ConflictID *uint  `json:"conflict_id,omitempty"` // 目標位置的同名項目ID
+	Reason     string `json:"reason,omitempty"`
 }
 
 // SkippedFileInfo 跳過的檔案資訊
@@ -2152,6 +2180,11 @@ func (h *FileHandler) BatchUploadFile(c *gin.Context) {
 		}
 	}
 
+	policy, explicit, ok := uploadConflictPolicy(c)
+	if !ok {
+		return
+	}
+
 	// 初始化結果
 	result := BatchUploadResult{
 		Success:       true,
@@ -2159,6 +2192,7 @@ func (h *FileHandler) BatchUploadFile(c *gin.Context) {
 		UploadedFiles: make([]models.File, 0),
 		SkippedFiles:  make([]SkippedFileInfo, 0),
 		FailedFiles:   make([]FailedFileInfo, 0),
+		Items:         make([]BatchUploadItem, 0),
 	}
 
 	// 處理每個檔案
@@ -2174,13 +2208,25 @@ func (h *FileHandler) BatchUploadFile(c *gin.Context) {
 				Size:     fileHeader.Size,
 			})
 			result.SkippedCount++
+			result.Items = append(result.Items, BatchUploadItem{
+				Filename: fileHeader.Filename,
+				Status:   WriteStatusSkipped,
+				Reason:   reason,
+			})
 			fmt.Printf("[INFO] Skipped file: %s (%s)\n", fileHeader.Filename, reason)
 			continue
 		}
 
 		// 嘗試上傳檔案
-		uploadedFile, err := h.processSingleFile(fileHeader, userID, parentID)
+		uploadedFile, resolution, err := h.processSingleFile(c, fileHeader, userID, parentID, policy, explicit)
+		item := BatchUploadItem{Filename: fileHeader.Filename, Status: resolution.Status, Name: resolution.Name}
+		if resolution.Existing != nil {
+			item.ConflictID = &resolution.Existing.ID
+		}
 		if err != nil {
+			item.Status = WriteStatusFailed
+			item.Reason = err.Error()
+			result.Items = append(result.Items, item)
 			result.FailedFiles = append(result.FailedFiles, FailedFileInfo{
 				Filename: fileHeader.Filename,
 				Reason:   err.Error(),
@@ -2191,6 +2237,24 @@ func (h *FileHandler) BatchUploadFile(c *gin.Context) {
 			continue
 		}
 
+		if resolution.Status == WriteStatusSkipped || resolution.Status == WriteStatusUnchanged {
+			item.Reason = "目標位置已有同名項目"
+			if resolution.Status == WriteStatusUnchanged {
+				item.Reason = "檔案內容和位置完全相同"
+			}
+			item.FileID = &resolution.Existing.ID
+			result.Items = append(result.Items, item)
+			result.SkippedFiles = append(result.SkippedFiles, SkippedFileInfo{
+				Filename: fileHeader.Filename,
+				Reason:   item.Reason,
+				Size:     fileHeader.Size,
+			})
+			result.SkippedCount++
+			continue
+		}
+
+		item.FileID = &uploadedFile.ID
+		result.Items = append(result.Items, item)
 		result.UploadedFiles = append(result.UploadedFiles, *uploadedFile)
 		result.UploadedCount++
 		fmt.Printf("[SUCCESS] Uploaded file: %s\n", fileHeader.Filename)
@@ -2251,37 +2315,49 @@ func getSkipReason(filename string, size int64) string {
 	return "未知原因"
 }
 
-// processSingleFile 處理單個檔案上傳
-func (h *FileHandler) processSingleFile(fileHeader *multipart.FileHeader, userID uint, parentID *uint) (*models.File, error) {
+// processSingleFile 處理單個檔案上傳，依衝突處理方式決定寫入名稱或覆蓋同名檔案
+// 同名檔案略過或內容相同時不寫入，返回的檔案為 nil
+func (h *FileHandler) processSingleFile(c *gin.Context, fileHeader *multipart.FileHeader, userID uint, parentID *uint, policy string, explicit bool) (*models.File, nameResolution, error) {
+	resolution := nameResolution{Name: fileHeader.Filename}
+
 	// 檢查檔案類型
 	if !isValidFileExtension(fileHeader.Filename) {
 		ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
-		return nil, fmt.Errorf("不允許上傳 '%s' 類型的檔案", ext)
+		return nil, resolution, fmt.Errorf("不允許上傳 '%s' 類型的檔案", ext)
 	}
 
 	// 檢查檔案大小
 	maxSize := int64(100 * 1024 * 1024) // 100MB
 	if fileHeader.Size > maxSize {
-		return nil, fmt.Errorf("檔案大小超過限制")
+		return nil, resolution, fmt.Errorf("檔案大小超過限制")
 	}
 
 	// 開啟檔案
 	file, err := fileHeader.Open()
 	if err != nil {
-		return nil, fmt.Errorf("無法讀取上傳檔案: %v", err)
+		return nil, resolution, fmt.Errorf("無法讀取上傳檔案: %v", err)
 	}
 	defer file.Close()
 
 	// 讀取檔案內容
 	content, err := io.ReadAll(file)
 	if err != nil {
-		return nil, fmt.Errorf("無法讀取檔案內容: %v", err)
+		return nil, resolution, fmt.Errorf("無法讀取檔案內容: %v", err)
 	}
 
 	// 計算 SHA256
 	sha256Hash := sha256.Sum256(content)
 	sha256Hex := fmt.Sprintf("%x", sha256Hash)
 
+	// 處理同名衝突
+	resolution, err = h.decideUploadConflict(c, policy, explicit, fileHeader.Filename, parentID, sha256Hex, userID)
+	if err != nil {
+		return nil, resolution, err
+	}
+	if resolution.Status == WriteStatusSkipped || resolution.Status == WriteStatusUnchanged {
+		return nil, resolution, nil
+	}
+
 	// 檢查去重 (暫時停用，因為配置中沒有此欄位)
 	// TODO: 添加配置支援後再啟用去重功能
 
@@ -2292,13 +2368,27 @@ func (h *FileHandler) processSingleFile(fileHeader *multipart.FileHeader, userID
 	// 確保上傳目錄存在
 	uploadDir := "./uploads" // 使用固定路徑
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		return nil, fmt.Errorf("建立上傳目錄失敗: %v", err)
+		return nil, resolution, fmt.Errorf("建立上傳目錄失敗: %v", err)
 	}
 
 	// 儲存檔案
 	filePath := filepath.Join(uploadDir, uniqueFilename)
 	if err := os.WriteFile(filePath, content, 0644); err != nil {
-		return nil, fmt.Errorf("儲存檔案失敗: %v", err)
+		return nil, resolution, fmt.Errorf("儲存檔案失敗: %v", err)
+	}
+
+	// 覆蓋同名檔案：以上傳內容建立新版本
+	if resolution.Status == WriteStatusOverwritten {
+		target := resolution.Existing
+		if _, err := h.createNewVersion(target, services.FileContent{
+			FilePath:   filePath,
+			SHA256Hash: sha256Hex,
+			FileSize:   fileHeader.Size,
+			MimeType:   http.DetectContentType(content),
+		}, userID); err != nil {
+			return nil, resolution, fmt.Errorf("建立新版本失敗: %v", err)
+		}
+		return target, resolution, nil
 	}
 
 	// 計算 MD5 (暫時不需要)
@@ -2307,13 +2397,13 @@ func (h *FileHandler) processSingleFile(fileHeader *multipart.FileHeader, userID
 
 	// 建立檔案記錄
 	fileRecord := models.File{
-		Name:         fileHeader.Filename,
+		Name:         resolution.Name,
 		OriginalName: fileHeader.Filename,
 		FilePath:     filePath,
 		FileSize:     fileHeader.Size,
 		MimeType:     http.DetectContentType(content),
 		SHA256Hash:   sha256Hex,
-		VirtualPath:  h.buildVirtualPath(parentID, fileHeader.Filename),
+		VirtualPath:  h.buildVirtualPath(parentID, resolution.Name),
 		ParentID:     parentID,
 		UploadedBy:   userID,
 		IsDirectory:  false,
@@ -2324,10 +2414,11 @@ func (h *FileHandler) processSingleFile(fileHeader *multipart.FileHeader, userID
 	if err := h.db.Create(&fileRecord).Error; err != nil {
 		// 刪除已儲存的檔案
 		os.Remove(filePath)
-		return nil, fmt.Errorf("建立檔案記錄失敗: %v", err)
+		return nil, resolution, fmt.Errorf("建立檔案記錄失敗: %v", err)
 	}
+	h.refreshFolderStats(h.db, fileRecord.ParentID)
 
-	return &fileRecord, nil
+	return &fileRecord, resolution, nil
 }
 
 // ChunkUploadInit 初始化分塊上傳會話
@@ -2564,12 +2655,18 @@ func (h *FileHandler) ChunkUploadFinalize(c *gin.Context) {
 
 	var req struct {
 		SessionID string `json:"sessionId" binding:"required"`
+		Conflict  string `json:"conflict"` // rename、overwrite（預設，建立新版本）、skip 或 fail
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		api.ErrorResponse(c, http.StatusBadRequest, "請求參數錯誤: "+err.Error())
 		return
 	}
+	policy, err := services.ParseConflictPolicy(req.Conflict, services.ConflictOverwrite)
+	if err != nil {
+		api.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	// 查找會話
 	var session models.ChunkSession
@@ -2656,47 +2753,77 @@ func (h *FileHandler) ChunkUploadFinalize(c *gin.Context) {
 		return
 	}
 
-	// 建立檔案記錄
-	fileRecord := models.File{
-		Name:         session.FileName,
-		OriginalName: session.FileName,
-		FilePath:     finalPath,
-		FileSize:     session.FileSize,
-		MimeType:     http.DetectContentType(fileContent),
-		SHA256Hash:   session.FileHash,
-		VirtualPath:  h.buildVirtualPath(session.ParentID, session.FileName),
-		ParentID:     session.ParentID,
-		UploadedBy:   session.UserID,
-		IsDirectory:  false,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+	// 標記會話為已完成並清理臨時分塊檔案
+	completeSession := func() {
+		now := time.Now()
+		if err := h.db.Model(&session).Updates(map[string]interface{}{
+			"status": "completed",
+			"completed_at": &now,
+		}).Error; err != nil {
+			// 這不是致命錯誤，記錄日誌即可
+			fmt.Printf("更新會話狀態失敗: %v\n", err)
+		}
+		go func() {
+			time.Sleep(5 * time.Minute) // 延遲5分鐘清理，確保操作完成
+			os.RemoveAll(chunkDir)
+		}()
 	}
 
-	if err := h.db.Create(&fileRecord).Error; err != nil {
-		os.Remove(finalPath) // 清理已建立的檔案
-		api.ErrorResponse(c, http.StatusInternalServerError, "建立檔案記錄失敗: "+err.Error())
+	// 相同位置已有同名檔案時依衝突處理方式略過、失敗、重新命名或建立新版本
+	resolution, handled := h.resolveUploadConflict(c, policy, req.Conflict != "", session.FileName, session.ParentID, session.FileHash, session.UserID)
+	if handled {
+		os.Remove(finalPath)
+		if resolution.Status == WriteStatusSkipped || resolution.Status == WriteStatusUnchanged {
+			completeSession()
+		}
 		return
 	}
 
-	// 標記會話為已完成
-	now := time.Now()
-	if err := h.db.Model(&session).Updates(map[string]interface{}{
-		"status": "completed",
-		"completed_at": &now,
-	}).Error; err != nil {
-		// 這不是致命錯誤，記錄日誌即可
-		fmt.Printf("更新會話狀態失敗: %v\n", err)
-	}
-
-	// 清理臨時分塊檔案
-	go func() {
-		time.Sleep(5 * time.Minute) // 延遲5分鐘清理，確保操作完成
-		os.RemoveAll(chunkDir)
-	}()
+	var fileRecord models.File
+	message := "檔案上傳完成"
+	if target := resolution.Existing; resolution.Status == WriteStatusOverwritten {
+		if _, err := h.createNewVersion(target, services.FileContent{
+			FilePath:   finalPath,
+			SHA256Hash: session.FileHash,
+			FileSize:   session.FileSize,
+			MimeType:   http.DetectContentType(fileContent),
+		}, session.UserID); err != nil {
+			api.ErrorResponse(c, http.StatusInternalServerError, "建立新版本失敗: "+err.Error())
+			return
+		}
+		fileRecord = *target
+		message = fmt.Sprintf("檔案上傳完成，已建立新版本（第 %d 版）", target.Version)
+	} else {
+		// 建立檔案記錄
+		fileRecord = models.File{
+			Name:         resolution.Name,
+			OriginalName: session.FileName,
+			FilePath:     finalPath,
+			FileSize:     session.FileSize,
+			MimeType:     http.DetectContentType(fileContent),
+			SHA256Hash:   session.FileHash,
+			VirtualPath:  h.buildVirtualPath(session.ParentID, resolution.Name),
+			ParentID:     session.ParentID,
+			UploadedBy:   session.UserID,
+			IsDirectory:  false,
+			CreatedAt:    time.Now(),
+			UpdatedAt:    time.Now(),
+		}
+
+		if err := h.db.Create(&fileRecord).Error; err != nil {
+			os.Remove(finalPath) // 清理已建立的檔案
+			api.ErrorResponse(c, http.StatusInternalServerError, "建立檔案記錄失敗: "+err.Error())
+			return
+		}
+		h.refreshFolderStats(h.db, fileRecord.ParentID)
+	}
+
+	completeSession()
 
 	api.SuccessResponse(c, gin.H{
 		"file": fileRecord,
-		"message": "檔案上傳完成",
+		"status": resolution.Status,
+		"message": message,
 	})
 }
 
@@ -2746,6 +2873,7 @@ type FileOperationRequest struct {
 	FileIDs        []uint `json:"file_ids" binding:"required"`        // 要操作的檔案ID陣列
 	TargetFolderID *uint  `json:"target_folder_id"`                   // 目標資料夾ID（null表示根目錄）
 	OperationType  string `json:"operation_type" binding:"required"`  // "copy" 或 "move"
+	Conflict       string `json:"conflict"`                           // 同名衝突處理方式：rename（預設）、overwrite、skip 或 fail
 }
 
 // FileOperationResponse 檔案操作回應結構
@@ -2754,16 +2882,22 @@ type FileOperationResponse struct {
 	FailedCount   int                  `json:"failed_count"`   // 失敗操作的檔案數量
 	SuccessFiles  []FileOperationResult `json:"success_files"`  // 成功操作的檔案列表
 	FailedFiles   []FileOperationResult `json:"failed_files"`   // 失敗操作的檔案列表
+	SkippedCount  int                  `json:"skipped_count"`  // 因同名衝突略過的檔案數量
+	SkippedFiles  []FileOperationResult `json:"skipped_files"`  // 因同名衝突略過的檔案列表
 	TotalCount    int                  `json:"total_count"`    // 總檔案數量
+	OperationID   *uint                `json:"operation_id,omitempty"` // 操作記錄ID，可用於復原
 }
 
 // FileOperationResult 單個檔案操作結果
 type FileOperationResult struct {
 	OriginalID   uint   `json:"original_id"`   // 原始檔案ID
-	NewID        *uint  `json:"new_id"`        // 新檔案ID（僅複製時有值）
+	NewID        *uint  `json:"new_id"`        // 新檔案ID（複製時，或覆蓋、合併到的既有項目）
 	FileName     string `json:"file_name"`     // 檔案名稱
 	Error        string `json:"error"`         // 錯誤訊息（如果有）
 	VirtualPath  string `json:"virtual_path"`  // 新的虛擬路徑
+	Status       string `json:"status"`        // created、renamed、overwritten、merged、unchanged、skipped 或 failed
+	ConflictID   *uint  `json:"conflict_id,omitempty"` // 目標位置的同名項目ID
+	Children     []FileOperationResult `json:"children,omitempty"` // 合併資料夾時每個子項目的結果
 }
 
 // CopyFiles 複製檔案
@@ -2786,6 +2920,13 @@ func (h *FileHandler) CopyFiles(c *gin.Context) {
 		return
 	}
 
+	policy, err := services.ParseConflictPolicy(req.Conflict, services.ConflictRename)
+	if err != nil {
+		api.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.Conflict = policy
+
 	// 驗證目標資料夾（如果指定）
 	if req.TargetFolderID != nil {
 		var targetFolder models.File
@@ -2796,6 +2937,15 @@ func (h *FileHandler) CopyFiles(c *gin.Context) {
 		}
 	}
 
+	// 大量或大型資料夾可改以背景工作執行
+	if wantsAsync(c) {
+		h.enqueueJob(c, models.JobTypeCopy, req)
+		return
+	}
+
+	var pruned []string
+	opts := fileWriteOptions{policy: req.Conflict, canEdit: middleware.HasPermission(h.db, c, models.PermFilesEdit), pruned: &pruned}
+
 	// 開始事務
 	tx := h.db.Begin()
 	defer func() {
@@ -2807,29 +2957,40 @@ func (h *FileHandler) CopyFiles(c *gin.Context) {
 	response := FileOperationResponse{
 		SuccessFiles: []FileOperationResult{},
 		FailedFiles:  []FileOperationResult{},
+		SkippedFiles: []FileOperationResult{},
 	}
 
+	var operationItems []models.FileOperationItem
+
 	// 逐一處理每個檔案
 	for _, fileID := range req.FileIDs {
-		result := h.copyFileRecursive(fileID, req.TargetFolderID, userID.(uint), tx)
-		
-		if result.Error != "" {
-			response.FailedFiles = append(response.FailedFiles, result)
-			response.FailedCount++
-		} else {
-			response.SuccessFiles = append(response.SuccessFiles, result)
-			response.SuccessCount++
+		result, item := h.applyFileOperation(tx, models.FileOperationCopy, fileID, req.TargetFolderID, userID.(uint), opts)
+		response.add(result)
+		if item != nil {
+			operationItems = append(operationItems, *item)
 		}
 	}
 
 	response.TotalCount = len(req.FileIDs)
 
-	// 如果有任何成功操作，提交事務
-	if response.SuccessCount > 0 {
+	// 如果有任何成功操作（包含部分完成的資料夾合併），記錄操作並提交事務
+	if response.wroteAny() {
+		operation, err := services.RecordFileOperation(tx, userID.(uint), models.FileOperationCopy,
+			fmt.Sprintf("複製 %d 個項目", response.SuccessCount), operationItems, h.cfg.Operation.UndoWindow)
+		if err != nil {
+			tx.Rollback()
+			api.ErrorResponse(c, http.StatusInternalServerError, "記錄操作失敗: "+err.Error())
+			return
+		}
+		if operation != nil {
+			response.OperationID = &operation.ID
+		}
+
 		if err := tx.Commit().Error; err != nil {
 			api.ErrorResponse(c, http.StatusInternalServerError, "提交事務失敗: "+err.Error())
 			return
 		}
+		services.ReleaseBlobs(h.db, pruned)
 
 		// 廣播檔案系統事件
 		// 廣播檔案系統事件
@@ -2867,6 +3028,13 @@ func (h *FileHandler) MoveFiles(c *gin.Context) {
 		return
 	}
 
+	policy, err := services.ParseConflictPolicy(req.Conflict, services.ConflictRename)
+	if err != nil {
+		api.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.Conflict = policy
+
 	// 驗證目標資料夾（如果指定）
 	if req.TargetFolderID != nil {
 		var targetFolder models.File
@@ -2883,6 +3051,15 @@ func (h *FileHandler) MoveFiles(c *gin.Context) {
 		return
 	}
 
+	// 大量或大型資料夾可改以背景工作執行
+	if wantsAsync(c) {
+		h.enqueueJob(c, models.JobTypeMove, req)
+		return
+	}
+
+	var pruned []string
+	opts := fileWriteOptions{policy: req.Conflict, canEdit: middleware.HasPermission(h.db, c, models.PermFilesEdit), pruned: &pruned}
+
 	// 開始事務
 	tx := h.db.Begin()
 	defer func() {
@@ -2894,29 +3071,40 @@ func (h *FileHandler) MoveFiles(c *gin.Context) {
 	response := FileOperationResponse{
 		SuccessFiles: []FileOperationResult{},
 		FailedFiles:  []FileOperationResult{},
+		SkippedFiles: []FileOperationResult{},
 	}
 
+	var operationItems []models.FileOperationItem
+
 	// 逐一處理每個檔案
 	for _, fileID := range req.FileIDs {
-		result := h.moveFileRecursive(fileID, req.TargetFolderID, userID.(uint), tx)
-		
-		if result.Error != "" {
-			response.FailedFiles = append(response.FailedFiles, result)
-			response.FailedCount++
-		} else {
-			response.SuccessFiles = append(response.SuccessFiles, result)
-			response.SuccessCount++
+		result, item := h.applyFileOperation(tx, models.FileOperationMove, fileID, req.TargetFolderID, userID.(uint), opts)
+		response.add(result)
+		if item != nil {
+			operationItems = append(operationItems, *item)
 		}
 	}
 
 	response.TotalCount = len(req.FileIDs)
 
-	// 如果有任何成功操作，提交事務
-	if response.SuccessCount > 0 {
+	// 如果有任何成功操作（包含部分完成的資料夾合併），記錄操作並提交事務
+	if response.wroteAny() {
+		operation, err := services.RecordFileOperation(tx, userID.(uint), models.FileOperationMove,
+			fmt.Sprintf("移動 %d 個項目", len(operationItems)), operationItems, h.cfg.Operation.UndoWindow)
+		if err != nil {
+			tx.Rollback()
+			api.ErrorResponse(c, http.StatusInternalServerError, "記錄操作失敗: "+err.Error())
+			return
+		}
+		if operation != nil {
+			response.OperationID = &operation.ID
+		}
+
 		if err := tx.Commit().Error; err != nil {
 			api.ErrorResponse(c, http.StatusInternalServerError, "提交事務失敗: "+err.Error())
 			return
 		}
+		services.ReleaseBlobs(h.db, pruned)
 
 		// 廣播檔案系統事件
 		var targetFolderID *int
@@ -2934,7 +3122,7 @@ func (h *FileHandler) MoveFiles(c *gin.Context) {
 }
 
 // copyFileRecursive 遞迴複製檔案或資料夾
-func (h *FileHandler) copyFileRecursive(fileID uint, targetFolderID *uint, userID uint, tx *gorm.DB) FileOperationResult {
+func (h *FileHandler) copyFileRecursive(fileID uint, targetFolderID *uint, userID uint, opts fileWriteOptions, tx *gorm.DB) FileOperationResult {
 	var file models.File
 	if err := tx.Where("id = ? AND is_deleted = ?", fileID, false).First(&file).Error; err != nil {
 		return FileOperationResult{
@@ -2947,8 +3135,27 @@ func (h *FileHandler) copyFileRecursive(fileID uint, targetFolderID *uint, userI
 	// 這裡簡化為允許所有用戶複製，實際可根據需求調整
 	
 	// 處理名稱衝突
-	newName := h.resolveNameConflict(file.Name, targetFolderID, tx)
-	newVirtualPath := h.buildVirtualPath(targetFolderID, newName)
+	resolution, err := resolveWriteName(tx, file.Name, targetFolderID, 0, opts.policy)
+	if err != nil {
+		return FileOperationResult{
+			OriginalID: fileID,
+			FileName:   file.Name,
+			Status:     WriteStatusFailed,
+			Error:      "檢查同名項目失敗: " + err.Error(),
+		}
+	}
+	if resolution.Status != WriteStatusCreated && resolution.Status != WriteStatusRenamed {
+		return h.copyOntoExisting(&file, resolution, userID, opts, tx)
+	}
+	newName := resolution.Name
+	newVirtualPath, err := services.VirtualPathFor(tx, targetFolderID, newName)
+	if err != nil {
+		return FileOperationResult{
+			OriginalID: fileID,
+			FileName:   file.Name,
+			Error:      "目標資料夾不存在",
+		}
+	}
 
 	var newFile models.File
 	if file.IsDirectory {
@@ -2991,7 +3198,7 @@ func (h *FileHandler) copyFileRecursive(fileID uint, targetFolderID *uint, userI
 		}
 
 		for _, child := range children {
-			h.copyFileRecursive(child.ID, &newFile.ID, userID, tx)
+			h.copyFileRecursive(child.ID, &newFile.ID, userID, opts, tx)
 		}
 
 	} else {
@@ -3033,11 +3240,12 @@ func (h *FileHandler) copyFileRecursive(fileID uint, targetFolderID *uint, userI
 		NewID:       &newFile.ID,
 		FileName:    file.Name,
 		VirtualPath: newVirtualPath,
+		Status:      resolution.Status,
 	}
 }
 
 // moveFileRecursive 遞迴移動檔案或資料夾
-func (h *FileHandler) moveFileRecursive(fileID uint, targetFolderID *uint, userID uint, tx *gorm.DB) FileOperationResult {
+func (h *FileHandler) moveFileRecursive(fileID uint, targetFolderID *uint, userID uint, opts fileWriteOptions, tx *gorm.DB) FileOperationResult {
 	var file models.File
 	if err := tx.Where("id = ? AND is_deleted = ?", fileID, false).First(&file).Error; err != nil {
 		return FileOperationResult{
@@ -3063,12 +3271,32 @@ func (h *FileHandler) moveFileRecursive(fileID uint, targetFolderID *uint, userI
 			OriginalID:  fileID,
 			FileName:    file.Name,
 			VirtualPath: file.VirtualPath,
+			Status:      WriteStatusUnchanged,
 		}
 	}
 
 	// 處理名稱衝突
-	newName := h.resolveNameConflict(file.Name, targetFolderID, tx)
-	newVirtualPath := h.buildVirtualPath(targetFolderID, newName)
+	resolution, err := resolveWriteName(tx, file.Name, targetFolderID, file.ID, opts.policy)
+	if err != nil {
+		return FileOperationResult{
+			OriginalID: fileID,
+			FileName:   file.Name,
+			Status:     WriteStatusFailed,
+			Error:      "檢查同名項目失敗: " + err.Error(),
+		}
+	}
+	if resolution.Status != WriteStatusCreated && resolution.Status != WriteStatusRenamed {
+		return h.moveOntoExisting(&file, resolution, userID, opts, tx)
+	}
+	newName := resolution.Name
+	newVirtualPath, err := services.VirtualPathFor(tx, targetFolderID, newName)
+	if err != nil {
+		return FileOperationResult{
+			OriginalID: fileID,
+			FileName:   file.Name,
+			Error:      "目標資料夾不存在",
+		}
+	}
 
 	// 更新檔案資訊
 	updates := map[string]interface{}{
@@ -3085,6 +3313,13 @@ func (h *FileHandler) moveFileRecursive(fileID uint, targetFolderID *uint, userI
 			Error:      "更新檔案資訊失敗: " + err.Error(),
 		}
 	}
+	if err := services.UpdateTreePath(tx, fileID); err != nil {
+		return FileOperationResult{
+			OriginalID: fileID,
+			FileName:   file.Name,
+			Error:      "更新檔案資訊失敗: " + err.Error(),
+		}
+	}
 
 	// 如果是資料夾，需要遞迴更新所有子項目的虛擬路徑
 	if file.IsDirectory {
@@ -3101,48 +3336,10 @@ func (h *FileHandler) moveFileRecursive(fileID uint, targetFolderID *uint, userI
 		OriginalID:  fileID,
 		FileName:    file.Name,
 		VirtualPath: newVirtualPath,
+		Status:      resolution.Status,
 	}
 }
 
-// resolveNameConflict 解決名稱衝突
-func (h *FileHandler) resolveNameConflict(originalName string, parentID *uint, tx *gorm.DB) string {
-	// 檢查是否有重複名稱
-	var count int64
-	query := tx.Model(&models.File{}).Where("name = ? AND parent_id = ? AND is_deleted = ?", 
-		originalName, parentID, false)
-	
-	if err := query.Count(&count); err != nil {
-		// 如果查詢失敗，返回原名稱
-		return originalName
-	}
-
-	if count == 0 {
-		return originalName
-	}
-
-	// 生成新名稱
-	ext := filepath.Ext(originalName)
-	baseName := strings.TrimSuffix(originalName, ext)
-	
-	for i := 1; i <= 1000; i++ { // 最多嘗試1000次
-		newName := fmt.Sprintf("%s (%d)%s", baseName, i, ext)
-		
-		var newCount int64
-		if err := tx.Model(&models.File{}).Where("name = ? AND parent_id = ? AND is_deleted = ?", 
-			newName, parentID, false).Count(&newCount); err != nil {
-			continue
-		}
-		
-		if newCount == 0 {
-			return newName
-		}
-	}
-
-	// 如果仍然衝突，使用時間戳
-	timestamp := time.Now().Format("20060102_150405")
-	return fmt.Sprintf("%s_%s%s", baseName, timestamp, ext)
-}
-
 // updateChildrenVirtualPaths 遞迴更新子項目的虛擬路徑
 func (h *FileHandler) updateChildrenVirtualPaths(folderID uint, newParentPath string, tx *gorm.DB) error {
 	var children []models.File
@@ -3194,20 +3391,8 @@ func (h *FileHandler) checkCircularDependency(fileIDs []uint, targetFolderID *ui
 	return nil
 }
 
-// isDescendant 檢查 targetID 是否是 ancestorID 的後代
+// isDescendant 檢查 targetID 是否是 ancestorID 的後代（依 ID 路徑判斷，不需逐層查詢）
 func (h *FileHandler) isDescendant(targetID, ancestorID uint) bool {
-	if targetID == ancestorID {
-		return true
-	}
-
-	var target models.File
-	if err := h.db.Where("id = ?", targetID).First(&target).Error; err != nil {
-		return false
-	}
-
-	if target.ParentID == nil {
-		return false
-	}
-
-	return h.isDescendant(*target.ParentID, ancestorID)
+	descendant, err := services.IsDescendantOf(h.db, targetID, ancestorID)
+	return err == nil && descendant
 }
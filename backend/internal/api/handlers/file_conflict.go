@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/middleware"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+	"memoryark/pkg/api"
+)
+
+// 寫入項目（上傳、複製、移動）的結果狀態
+const (
+	WriteStatusCreated     = "created"     // 目標位置沒有同名項目
+	WriteStatusRenamed     = "renamed"     // 以新名稱寫入
+	WriteStatusOverwritten = "overwritten" // 就地覆蓋既有檔案的內容與描述資料
+	WriteStatusMerged      = "merged"      // 資料夾內容合併到既有的同名資料夾
+	WriteStatusPartial     = "partial"     // 資料夾已合併，但部分子項目略過或失敗
+	WriteStatusUnchanged   = "unchanged"   // 內容相同或已在目標位置，不需寫入
+	WriteStatusSkipped     = "skipped"     // 目標位置已有同名項目，依設定略過
+	WriteStatusFailed      = "failed"
+)
+
+// ErrCodeNameConflict 衝突處理方式為 fail 時的錯誤代碼
+const ErrCodeNameConflict = "NAME_CONFLICT"
+
+// fileWriteOptions 複製或移動時遞迴處理共用的設定
+type fileWriteOptions struct {
+	policy  string    // 同名項目的衝突處理方式
+	canEdit bool      // 具備編輯權限，可覆蓋他人上傳的檔案
+	pruned  *[]string // 覆蓋時被淘汰的歷史版本實體檔案，外層交易提交後才釋放
+}
+
+// nameResolution 寫入前依衝突處理方式決定的結果
+type nameResolution struct {
+	Name     string       // 寫入時使用的名稱（skip 與 fail 時為空）
+	Status   string       // created、renamed、overwritten、skipped 或 failed
+	Existing *models.File // 目標位置既有的同名項目
+}
+
+// resolveWriteName 檢查目標位置的同名項目並依衝突處理方式決定寫入名稱，excludeID 為寫入的項目本身（移動時）
+func resolveWriteName(tx *gorm.DB, name string, parentID *uint, excludeID uint, policy string) (nameResolution, error) {
+	existing, err := services.FindNameConflict(tx, name, parentID, excludeID)
+	if err != nil {
+		return nameResolution{}, err
+	}
+	if existing == nil {
+		return nameResolution{Name: name, Status: WriteStatusCreated}, nil
+	}
+
+	switch policy {
+	case services.ConflictSkip:
+		return nameResolution{Status: WriteStatusSkipped, Existing: existing}, nil
+	case services.ConflictFail:
+		return nameResolution{Status: WriteStatusFailed, Existing: existing}, nil
+	case services.ConflictOverwrite:
+		return nameResolution{Name: name, Status: WriteStatusOverwritten, Existing: existing}, nil
+	default:
+		unique, err := services.UniqueName(tx, name, parentID)
+		if err != nil {
+			return nameResolution{}, err
+		}
+		return nameResolution{Name: unique, Status: WriteStatusRenamed, Existing: existing}, nil
+	}
+}
+
+// overwriteFile 以來源檔案的內容與描述資料就地覆蓋既有檔案
+// 既有檔案保留 ID、分享與位置，舊內容保存為歷史版本
+func (h *FileHandler) overwriteFile(tx *gorm.DB, target *models.File, source *models.File, userID uint, opts fileWriteOptions) error {
+	if target.SHA256Hash != source.SHA256Hash {
+		retention := services.ResolveVersionRetention(tx, target.ParentID, h.cfg.Upload.VersionRetention)
+		_, pruned, err := services.AddFileVersionDeferred(tx, target, services.FileContent{
+			FilePath:   source.FilePath,
+			SHA256Hash: source.SHA256Hash,
+			FileSize:   source.FileSize,
+			MimeType:   source.MimeType,
+		}, userID, retention)
+		if err != nil {
+			return err
+		}
+		if opts.pruned != nil {
+			*opts.pruned = append(*opts.pruned, pruned...)
+		}
+	}
+
+	metadata := map[string]interface{}{
+		"original_name":   source.OriginalName,
+		"thumbnail_url":   source.ThumbnailURL,
+		"category_id":     source.CategoryID,
+		"description":     source.Description,
+		"tags":            source.Tags,
+		"content_type":    source.ContentType,
+		"speaker":         source.Speaker,
+		"sermon_title":    source.SermonTitle,
+		"bible_reference": source.BibleReference,
+	}
+	if err := tx.Model(&models.File{}).Where("id = ?", target.ID).Updates(metadata).Error; err != nil {
+		return err
+	}
+	return services.RefreshFolderStats(tx, target.ParentID)
+}
+
+// uploadConflictPolicy 讀取上傳的衝突處理方式（表單或查詢參數 conflict），預設覆蓋為新版本
+// 舊版用戶端以 new_version=false 表示不建立新版本，視為重新命名；explicit 表示用戶端有明確指定
+func uploadConflictPolicy(c *gin.Context) (policy string, explicit bool, ok bool) {
+	value := c.PostForm("conflict")
+	if value == "" {
+		value = c.Query("conflict")
+	}
+	fallback := services.ConflictOverwrite
+	if c.PostForm("new_version") == "false" {
+		fallback = services.ConflictRename
+	}
+	policy, err := services.ParseConflictPolicy(value, fallback)
+	if err != nil {
+		api.BadRequest(c, err.Error())
+		return "", false, false
+	}
+	return policy, value != "", true
+}
+
+// uploadConflictError 上傳的檔案因同名衝突無法寫入
+type uploadConflictError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *uploadConflictError) Error() string {
+	return e.message
+}
+
+// decideUploadConflict 決定上傳檔案與目標位置同名項目的處理結果
+// 狀態為 overwritten 時 Existing 為要建立新版本的檔案；無法寫入時返回 *uploadConflictError
+func (h *FileHandler) decideUploadConflict(c *gin.Context, policy string, explicit bool, fileName string, parentID *uint, hash string, userID uint) (nameResolution, error) {
+	resolution, err := resolveWriteName(h.db, fileName, parentID, 0, policy)
+	if err != nil {
+		return resolution, err
+	}
+	existing := resolution.Existing
+
+	switch resolution.Status {
+	case WriteStatusFailed:
+		return resolution, &uploadConflictError{http.StatusConflict, ErrCodeNameConflict, "目標位置已有同名項目"}
+	case WriteStatusOverwritten:
+		switch {
+		case existing.IsDirectory:
+			resolution.Status = WriteStatusFailed
+			return resolution, &uploadConflictError{http.StatusConflict, ErrCodeNameConflict, "目標位置已有同名資料夾，無法覆蓋"}
+		case existing.SHA256Hash == hash:
+			resolution.Status = WriteStatusUnchanged
+		case !canReplaceContent(existing, userID, middleware.HasPermission(h.db, c, models.PermFilesEdit)):
+			if explicit {
+				resolution.Status = WriteStatusFailed
+				return resolution, &uploadConflictError{http.StatusForbidden, api.ErrInsufficientPermissions, "沒有權限覆蓋此檔案"}
+			}
+			// 未指定衝突處理方式時，無法覆蓋他人的檔案則改為重新命名
+			unique, err := services.UniqueName(h.db, fileName, parentID)
+			if err != nil {
+				return resolution, err
+			}
+			return nameResolution{Name: unique, Status: WriteStatusRenamed, Existing: existing}, nil
+		}
+	}
+	return resolution, nil
+}
+
+// resolveUploadConflict 處理上傳檔案與目標位置同名項目的衝突
+// 狀態為 overwritten 時 Existing 為要建立新版本的檔案；已回應請求（略過、失敗）時 handled 為 true
+func (h *FileHandler) resolveUploadConflict(c *gin.Context, policy string, explicit bool, fileName string, parentID *uint, hash string, userID uint) (resolution nameResolution, handled bool) {
+	resolution, err := h.decideUploadConflict(c, policy, explicit, fileName, parentID, hash, userID)
+	if err != nil {
+		var conflict *uploadConflictError
+		if !errors.As(err, &conflict) {
+			api.Error(c, http.StatusInternalServerError, api.ErrDatabaseError, "檢查同名檔案失敗")
+			return resolution, true
+		}
+		body := gin.H{
+			"success": false,
+			"status":  WriteStatusFailed,
+			"error":   gin.H{"code": conflict.code, "message": conflict.message},
+		}
+		if resolution.Existing != nil {
+			body["data"] = gin.H{"existingFileId": resolution.Existing.ID, "fileName": fileName}
+		}
+		c.JSON(conflict.status, body)
+		return resolution, true
+	}
+
+	if resolution.Status == WriteStatusSkipped || resolution.Status == WriteStatusUnchanged {
+		reason := "目標位置已有同名項目"
+		if resolution.Status == WriteStatusUnchanged {
+			reason = "檔案內容和位置完全相同"
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"skipped": true,
+			"status":  resolution.Status,
+			"message": "檔案已存在，跳過上傳",
+			"data": gin.H{
+				"existingFileId": resolution.Existing.ID,
+				"fileName":       fileName,
+				"reason":         reason,
+			},
+		})
+		return resolution, true
+	}
+	return resolution, false
+}
+
+// wroteItem 結果是否有寫入任何內容（包含部分完成的資料夾合併）
+func wroteItem(result FileOperationResult) bool {
+	if result.Status == WriteStatusPartial {
+		return true
+	}
+	return result.Error == "" && result.Status != WriteStatusSkipped
+}
+
+// createdNewItem 複製或移動的結果是否在目標位置寫入新項目（沒有衝突或重新命名）
+func createdNewItem(result FileOperationResult) bool {
+	return result.Status == WriteStatusCreated || result.Status == WriteStatusRenamed
+}
+
+// conflictResult 同名項目依衝突處理方式略過或視為錯誤的結果
+func conflictResult(file *models.File, resolution nameResolution) FileOperationResult {
+	result := FileOperationResult{
+		OriginalID: file.ID,
+		FileName:   file.Name,
+		Status:     resolution.Status,
+		ConflictID: &resolution.Existing.ID,
+	}
+	if resolution.Status == WriteStatusFailed {
+		result.Error = "目標位置已有同名項目"
+	}
+	return result
+}
+
+// overwriteError 檢查來源項目能否覆蓋目標位置的同名項目，不能覆蓋時返回原因
+// 覆蓋檔案與上傳新版本使用相同的權限規則
+func overwriteError(source, existing *models.File, userID uint, opts fileWriteOptions) string {
+	if source.IsDirectory != existing.IsDirectory {
+		return "目標位置已有同名但類型不同的項目，無法覆蓋"
+	}
+	if !existing.IsDirectory && !canReplaceContent(existing, userID, opts.canEdit) {
+		return "沒有權限覆蓋此檔案"
+	}
+	return ""
+}
+
+// onExistingResult 覆蓋或合併到既有項目的結果，無法處理時 reason 為原因
+func onExistingResult(file, existing *models.File, status, reason string) FileOperationResult {
+	result := FileOperationResult{
+		OriginalID:  file.ID,
+		FileName:    file.Name,
+		VirtualPath: existing.VirtualPath,
+		Status:      status,
+		ConflictID:  &existing.ID,
+	}
+	if reason != "" {
+		result.Status = WriteStatusFailed
+		result.Error = reason
+		return result
+	}
+	result.NewID = &existing.ID
+	return result
+}
+
+// mergedResult 資料夾合併到既有項目的結果，附上每個子項目的結果
+// 任一子項目略過或失敗時整個資料夾視為部分完成
+func mergedResult(file, existing *models.File, children []FileOperationResult) FileOperationResult {
+	result := onExistingResult(file, existing, WriteStatusMerged, "")
+	result.Children = children
+	for _, child := range children {
+		if child.Status == WriteStatusSkipped || child.Error != "" {
+			result.Status = WriteStatusPartial
+			result.Error = "部分子項目未寫入"
+			break
+		}
+	}
+	return result
+}
+
+// copyOntoExisting 處理複製時目標位置的同名項目：略過、失敗、覆蓋檔案或將資料夾內容合併
+func (h *FileHandler) copyOntoExisting(file *models.File, resolution nameResolution, userID uint, opts fileWriteOptions, tx *gorm.DB) FileOperationResult {
+	existing := resolution.Existing
+	if resolution.Status != WriteStatusOverwritten {
+		return conflictResult(file, resolution)
+	}
+	if existing.ID == file.ID {
+		return onExistingResult(file, existing, WriteStatusUnchanged, "")
+	}
+	if reason := overwriteError(file, existing, userID, opts); reason != "" {
+		return onExistingResult(file, existing, "", reason)
+	}
+
+	if !file.IsDirectory {
+		if err := h.overwriteFile(tx, existing, file, userID, opts); err != nil {
+			return onExistingResult(file, existing, "", "覆蓋檔案失敗: "+err.Error())
+		}
+		return onExistingResult(file, existing, WriteStatusOverwritten, "")
+	}
+
+	// 資料夾的子項目依相同的衝突處理方式複製到既有資料夾
+	var children []models.File
+	if err := tx.Where("parent_id = ? AND is_deleted = ?", file.ID, false).Find(&children).Error; err != nil {
+		return onExistingResult(file, existing, "", "查詢子項目失敗: "+err.Error())
+	}
+	results := make([]FileOperationResult, 0, len(children))
+	for _, child := range children {
+		results = append(results, h.copyFileRecursive(child.ID, &existing.ID, userID, opts, tx))
+	}
+	return mergedResult(file, existing, results)
+}
+
+// moveOntoExisting 處理移動時目標位置的同名項目：略過、失敗、覆蓋檔案或將資料夾內容合併
+// 覆蓋或合併後沒有剩餘內容的來源項目移至垃圾桶
+func (h *FileHandler) moveOntoExisting(file *models.File, resolution nameResolution, userID uint, opts fileWriteOptions, tx *gorm.DB) FileOperationResult {
+	existing := resolution.Existing
+	if resolution.Status != WriteStatusOverwritten {
+		return conflictResult(file, resolution)
+	}
+	if reason := overwriteError(file, existing, userID, opts); reason != "" {
+		return onExistingResult(file, existing, "", reason)
+	}
+
+	if !file.IsDirectory {
+		if err := h.overwriteFile(tx, existing, file, userID, opts); err != nil {
+			return onExistingResult(file, existing, "", "覆蓋檔案失敗: "+err.Error())
+		}
+		if _, err := h.deleteFileRecursive(file.ID, userID, tx); err != nil {
+			return onExistingResult(file, existing, "", "移除來源檔案失敗: "+err.Error())
+		}
+		return onExistingResult(file, existing, WriteStatusOverwritten, "")
+	}
+
+	var children []models.File
+	if err := tx.Where("parent_id = ? AND is_deleted = ?", file.ID, false).Find(&children).Error; err != nil {
+		return onExistingResult(file, existing, "", "查詢子項目失敗: "+err.Error())
+	}
+	results := make([]FileOperationResult, 0, len(children))
+	for _, child := range children {
+		results = append(results, h.moveFileRecursive(child.ID, &existing.ID, userID, opts, tx))
+	}
+	// 略過或無法移動的子項目仍留在來源資料夾
+	var remaining int64
+	if err := tx.Model(&models.File{}).Where("parent_id = ? AND is_deleted = ?", file.ID, false).Count(&remaining).Error; err != nil {
+		return onExistingResult(file, existing, "", "查詢子項目失敗: "+err.Error())
+	}
+	if remaining == 0 {
+		if _, err := h.deleteFileRecursive(file.ID, userID, tx); err != nil {
+			return onExistingResult(file, existing, "", "移除來源資料夾失敗: "+err.Error())
+		}
+	}
+	return mergedResult(file, existing, results)
+}
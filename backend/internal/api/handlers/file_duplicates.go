@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/middleware"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+	"memoryark/pkg/api"
+)
+
+// 重複檔案的合併方式
+const (
+	DuplicateActionShortcut = "shortcut" // 改為指向保留檔案的捷徑，名稱與位置不變
+	DuplicateActionTrash    = "trash"    // 移至垃圾桶，可在期限內復原
+)
+
+// 合併後各檔案的狀態
+const (
+	DuplicateMerged  = "merged"
+	DuplicateSkipped = "skipped"
+	DuplicateFailed  = "failed"
+)
+
+// DuplicateMergeRequest 合併重複內容請求
+// canonical_id 為保留的檔案（預設為最早上傳的檔案），file_ids 未指定時合併其餘所有檔案
+type DuplicateMergeRequest struct {
+	Hash        string `json:"hash" binding:"required"`
+	CanonicalID *uint  `json:"canonical_id"`
+	FileIDs     []uint `json:"file_ids"`
+	Action      string `json:"action"` // shortcut 或 trash，預設 shortcut
+}
+
+// DuplicateMergeResult 單一檔案的合併結果
+type DuplicateMergeResult struct {
+	FileID uint   `json:"file_id"`
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// DuplicateMergeResponse 合併重複內容結果
+type DuplicateMergeResponse struct {
+	CanonicalID   uint                   `json:"canonical_id"`
+	Action        string                 `json:"action"`
+	MergedCount   int                    `json:"merged_count"`
+	ReclaimedSize int64                  `json:"reclaimed_size"`
+	OperationID   *uint                  `json:"operation_id,omitempty"` // 移至垃圾桶時可用於復原
+	Results       []DuplicateMergeResult `json:"results"`
+}
+
+// shortcutContent 捷徑返回目標檔案以提供其目前的內容；目標已刪除時使用捷徑本身保留的內容
+func (h *FileHandler) shortcutContent(file *models.File) *models.File {
+	if file.ShortcutTargetID == nil {
+		return file
+	}
+	var target models.File
+	if err := h.db.Where("id = ? AND is_deleted = ?", *file.ShortcutTargetID, false).First(&target).Error; err != nil {
+		return file
+	}
+	return &target
+}
+
+// GetDuplicates 列出有多個檔案引用相同內容的報表及可回收的大小
+// scope=mine（預設）只比對自己上傳的檔案，scope=all 需要管理所有檔案的權限
+func (h *FileHandler) GetDuplicates(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	var uploadedBy *uint
+	switch c.DefaultQuery("scope", "mine") {
+	case "mine":
+		userID := c.GetUint("user_id")
+		uploadedBy = &userID
+	case "all":
+		if !middleware.HasPermission(h.db, c, models.PermFilesManageAll) {
+			api.Forbidden(c, "沒有權限查看所有用戶的重複檔案")
+			return
+		}
+	default:
+		api.BadRequest(c, "scope 必須是 mine 或 all")
+		return
+	}
+
+	report, err := services.FindDuplicates(h.db, uploadedBy, page, limit)
+	if err != nil {
+		api.InternalServerError(c, "取得重複檔案報表失敗")
+		return
+	}
+	api.Success(c, gin.H{
+		"groups":           report.Groups,
+		"total_groups":     report.TotalGroups,
+		"reclaimable_size": report.ReclaimableSize,
+		"page":             page,
+		"limit":            limit,
+	})
+}
+
+// MergeDuplicates 保留一個檔案，將其餘相同內容的檔案改為捷徑或移至垃圾桶
+// 沒有管理所有檔案權限的用戶只能合併自己上傳的檔案，改為捷徑時保留的檔案也必須是自己上傳的
+func (h *FileHandler) MergeDuplicates(c *gin.Context) {
+	var req DuplicateMergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "請求參數錯誤: "+err.Error())
+		return
+	}
+	if req.Action == "" {
+		req.Action = DuplicateActionShortcut
+	}
+	if req.Action != DuplicateActionShortcut && req.Action != DuplicateActionTrash {
+		api.BadRequest(c, "action 必須是 shortcut 或 trash")
+		return
+	}
+	if req.Action == DuplicateActionTrash && !middleware.HasPermission(h.db, c, models.PermFilesDelete) {
+		api.Forbidden(c, "沒有權限將檔案移至垃圾桶")
+		return
+	}
+
+	files, err := services.DuplicateFilesByHash(h.db, req.Hash)
+	if err != nil {
+		api.InternalServerError(c, "載入重複檔案失敗")
+		return
+	}
+	if len(files) < 2 {
+		api.NotFound(c, "重複內容")
+		return
+	}
+	group := make(map[uint]*models.File, len(files))
+	for i := range files {
+		group[files[i].ID] = &files[i]
+	}
+
+	canonical := &files[0]
+	if req.CanonicalID != nil {
+		if canonical = group[*req.CanonicalID]; canonical == nil {
+			api.BadRequest(c, "保留的檔案不屬於此重複內容")
+			return
+		}
+	}
+
+	fileIDs := req.FileIDs
+	if len(fileIDs) == 0 {
+		for _, file := range files {
+			fileIDs = append(fileIDs, file.ID)
+		}
+	}
+
+	userID := c.GetUint("user_id")
+	manageAll := middleware.HasPermission(h.db, c, models.PermFilesManageAll)
+	// 捷徑會跟隨保留檔案日後的新版本，不能指向他人上傳的檔案
+	if req.Action == DuplicateActionShortcut && canonical.UploadedBy != userID && !manageAll {
+		api.Forbidden(c, "只能以自己上傳的檔案作為保留的檔案")
+		return
+	}
+	response := DuplicateMergeResponse{CanonicalID: canonical.ID, Action: req.Action, Results: []DuplicateMergeResult{}}
+	var targets []*models.File
+	seen := map[uint]bool{}
+	for _, id := range fileIDs {
+		if seen[id] || id == canonical.ID {
+			continue
+		}
+		seen[id] = true
+		file := group[id]
+		switch {
+		case file == nil:
+			response.Results = append(response.Results, DuplicateMergeResult{FileID: id, Status: DuplicateSkipped, Reason: "不是此內容的重複檔案"})
+		case file.UploadedBy != userID && !manageAll:
+			response.Results = append(response.Results, DuplicateMergeResult{FileID: id, Name: file.Name, Status: DuplicateSkipped, Reason: "只能合併自己上傳的檔案"})
+		default:
+			targets = append(targets, file)
+		}
+	}
+
+	tx := h.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var parentIDs []*uint
+	var items []models.FileOperationItem
+	for _, file := range targets {
+		result := DuplicateMergeResult{FileID: file.ID, Name: file.Name, Status: DuplicateMerged}
+		// 每個檔案各自以 savepoint 處理，失敗時只回滾該檔案已寫入的部分
+		if req.Action == DuplicateActionTrash {
+			var affectedIDs []uint
+			if err := tx.Transaction(func(itemTx *gorm.DB) error {
+				ids, err := h.liveSubtreeIDs(file.ID, itemTx)
+				if err != nil {
+					return err
+				}
+				affectedIDs = ids
+				_, err = h.deleteFileRecursive(file.ID, userID, itemTx)
+				return err
+			}); err != nil {
+				result.Status, result.Reason = DuplicateFailed, "移至垃圾桶失敗"
+			} else {
+				items = append(items, models.FileOperationItem{FileID: file.ID, AffectedIDs: affectedIDs})
+			}
+		} else if err := tx.Transaction(func(itemTx *gorm.DB) error {
+			return services.MakeShortcut(itemTx, file.ID, canonical.ID)
+		}); err != nil {
+			result.Status, result.Reason = DuplicateFailed, "建立捷徑失敗"
+		}
+
+		if result.Status == DuplicateMerged {
+			response.MergedCount++
+			response.ReclaimedSize += file.FileSize
+			parentIDs = append(parentIDs, file.ParentID)
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	h.refreshFolderStats(tx, parentIDs...)
+	operation, err := services.RecordFileOperation(tx, userID, models.FileOperationDelete,
+		fmt.Sprintf("合併重複內容，將 %d 個檔案移至垃圾桶", len(items)), items, h.cfg.Operation.UndoWindow)
+	if err != nil {
+		tx.Rollback()
+		api.InternalServerError(c, "記錄操作失敗")
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		api.InternalServerError(c, "合併重複檔案失敗")
+		return
+	}
+	response.OperationID = operationID(operation)
+
+	if response.MergedCount > 0 {
+		h.broadcastFileEvent("files_updated", nil, fmt.Sprintf("已合併 %d 個重複檔案", response.MergedCount), response)
+	}
+	api.Success(c, response)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+	"memoryark/pkg/api"
+)
+
+// 最近項目的預設與最大數量
+const (
+	defaultRecentFiles = 20
+	maxRecentFiles     = 100
+)
+
+// recordFileAccess 記錄目前用戶開啟檔案，失敗時只記錄錯誤
+func (h *FileHandler) recordFileAccess(c *gin.Context, fileID uint, action string) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		return
+	}
+	if err := services.RecordFileAccess(h.db, userID, fileID, action); err != nil {
+		log.Printf("記錄檔案 %d 的開啟記錄失敗: %v", fileID, err)
+	}
+}
+
+// personalStateTarget 取得要設定個人狀態的項目ID
+// 設定時項目必須存在且未刪除（folderOnly 時必須是資料夾）；取消時不檢查，垃圾桶中的項目也能取消
+func (h *FileHandler) personalStateTarget(c *gin.Context, set, folderOnly bool) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		api.BadRequest(c, "無效的檔案ID")
+		return 0, false
+	}
+	if !set {
+		return uint(id), true
+	}
+	var file models.File
+	if err := h.db.First(&file, id).Error; err != nil || file.IsDeleted {
+		api.NotFound(c, "檔案")
+		return 0, false
+	}
+	if folderOnly && !file.IsDirectory {
+		api.BadRequest(c, "只能釘選資料夾")
+		return 0, false
+	}
+	return file.ID, true
+}
+
+// StarFile 為檔案或資料夾加上星號
+func (h *FileHandler) StarFile(c *gin.Context) {
+	h.setStarred(c, true)
+}
+
+// UnstarFile 移除檔案或資料夾的星號
+func (h *FileHandler) UnstarFile(c *gin.Context) {
+	h.setStarred(c, false)
+}
+
+// setStarred 設定目前用戶對項目的星號
+func (h *FileHandler) setStarred(c *gin.Context, starred bool) {
+	fileID, ok := h.personalStateTarget(c, starred, false)
+	if !ok {
+		return
+	}
+	if err := services.SetFileStarred(h.db, c.GetUint("user_id"), fileID, starred); err != nil {
+		api.InternalServerError(c, "更新星號失敗")
+		return
+	}
+	api.Success(c, gin.H{"fileId": fileID, "starred": starred})
+}
+
+// GetStarredFiles 取得目前用戶加星號的檔案與資料夾（垃圾桶中的項目不顯示）
+func (h *FileHandler) GetStarredFiles(c *gin.Context) {
+	states, err := services.StarredFiles(h.db, c.GetUint("user_id"))
+	if err != nil {
+		api.InternalServerError(c, "取得星號項目失敗")
+		return
+	}
+	api.Success(c, states)
+}
+
+// GetRecentFiles 取得目前用戶最近開啟（下載、預覽）或上傳的檔案
+func (h *FileHandler) GetRecentFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultRecentFiles)))
+	if limit < 1 || limit > maxRecentFiles {
+		limit = defaultRecentFiles
+	}
+	states, err := services.RecentFiles(h.db, c.GetUint("user_id"), limit)
+	if err != nil {
+		api.InternalServerError(c, "取得最近項目失敗")
+		return
+	}
+	api.Success(c, states)
+}
+
+// PinFolder 將資料夾釘選到導覽列
+func (h *FileHandler) PinFolder(c *gin.Context) {
+	h.setPinned(c, true)
+}
+
+// UnpinFolder 取消釘選資料夾
+func (h *FileHandler) UnpinFolder(c *gin.Context) {
+	h.setPinned(c, false)
+}
+
+// setPinned 設定目前用戶對資料夾的釘選
+func (h *FileHandler) setPinned(c *gin.Context, pinned bool) {
+	folderID, ok := h.personalStateTarget(c, pinned, true)
+	if !ok {
+		return
+	}
+	if err := services.SetFolderPinned(h.db, c.GetUint("user_id"), folderID, pinned); err != nil {
+		api.InternalServerError(c, "更新釘選失敗")
+		return
+	}
+	api.Success(c, gin.H{"folderId": folderID, "pinned": pinned})
+}
+
+// GetPinnedFolders 取得目前用戶釘選的資料夾，依排列順序
+func (h *FileHandler) GetPinnedFolders(c *gin.Context) {
+	states, err := services.PinnedFolders(h.db, c.GetUint("user_id"))
+	if err != nil {
+		api.InternalServerError(c, "取得釘選資料夾失敗")
+		return
+	}
+	api.Success(c, states)
+}
+
+// ReorderPinnedFolders 調整目前用戶釘選資料夾的順序
+func (h *FileHandler) ReorderPinnedFolders(c *gin.Context) {
+	var req struct {
+		FolderIDs []uint `json:"folder_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "請求參數錯誤: "+err.Error())
+		return
+	}
+	userID := c.GetUint("user_id")
+	if err := services.ReorderPinnedFolders(h.db, userID, req.FolderIDs); err != nil {
+		api.InternalServerError(c, "調整釘選順序失敗")
+		return
+	}
+	states, err := services.PinnedFolders(h.db, userID)
+	if err != nil {
+		api.InternalServerError(c, "取得釘選資料夾失敗")
+		return
+	}
+	api.SuccessWithMessage(c, states, "已更新釘選順序")
+}
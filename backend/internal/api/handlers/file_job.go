@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/auth"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+	"memoryark/pkg/api"
+)
+
+// deleteJobChunkSize 背景刪除每個步驟處理的項目數
+const deleteJobChunkSize = 200
+
+// deleteJobParams 背景刪除工作參數
+type deleteJobParams struct {
+	FileID uint `json:"file_id"`
+}
+
+// deleteJobState 背景刪除工作的檢查點
+type deleteJobState struct {
+	AffectedIDs []uint `json:"affected_ids"` // 依子項目優先的順序移至垃圾桶
+	Next        int    `json:"next"`
+	Deleted     int    `json:"deleted"`
+	OperationID *uint  `json:"operation_id"`
+	Recorded    bool   `json:"recorded"`
+}
+
+// fileOperationJobState 背景複製或移動工作的檢查點
+type fileOperationJobState struct {
+	Next     int                        `json:"next"`
+	Response FileOperationResponse      `json:"response"`
+	Items    []models.FileOperationItem `json:"items"`
+	Recorded bool                       `json:"recorded"`
+}
+
+// SetJobQueue 設置背景工作佇列並註冊檔案樹操作的工作類型
+func (h *FileHandler) SetJobQueue(queue *services.JobQueue) {
+	h.jobs = queue
+	queue.Register(models.JobTypeCopy, h.runCopyJob)
+	queue.Register(models.JobTypeMove, h.runMoveJob)
+	queue.Register(models.JobTypeDelete, h.runDeleteJob)
+	queue.Register(models.JobTypeEmptyTrash, h.runEmptyTrashJob)
+	queue.Register(models.JobTypeFolderStatsRepair, h.runFolderStatsRepairJob)
+	queue.Register(models.JobTypeBulkMetadata, h.runBulkMetadataJob)
+}
+
+// wantsAsync 請求是否要求以背景工作執行（?async=true）
+func wantsAsync(c *gin.Context) bool {
+	async, _ := strconv.ParseBool(c.Query("async"))
+	return async
+}
+
+// enqueueJob 建立背景工作並返回 202
+func (h *FileHandler) enqueueJob(c *gin.Context, jobType string, params interface{}) {
+	if h.jobs == nil {
+		api.Error(c, http.StatusServiceUnavailable, "JOBS_UNAVAILABLE", "背景工作佇列未啟用")
+		return
+	}
+	job, err := h.jobs.Enqueue(c.GetUint("user_id"), jobType, params)
+	if err != nil {
+		api.InternalServerError(c, "建立背景工作失敗")
+		return
+	}
+	c.JSON(http.StatusAccepted, api.StandardResponse{
+		Success: true,
+		Data:    job,
+		Message: "已加入背景工作佇列",
+	})
+}
+
+// userHasPermission 依用戶目前的角色檢查權限，供沒有請求內容的背景工作使用
+func (h *FileHandler) userHasPermission(userID uint, permission string) bool {
+	var user models.User
+	if err := h.db.Select("role").First(&user, userID).Error; err != nil {
+		return false
+	}
+	return auth.HasPermission(h.db, user.Role, permission)
+}
+
+// add 將單一項目的結果加入回應
+func (r *FileOperationResponse) add(result FileOperationResult) {
+	if result.Status == WriteStatusSkipped {
+		r.SkippedFiles = append(r.SkippedFiles, result)
+		r.SkippedCount++
+		return
+	}
+	if result.Error != "" {
+		r.FailedFiles = append(r.FailedFiles, result)
+		r.FailedCount++
+		return
+	}
+	r.SuccessFiles = append(r.SuccessFiles, result)
+	r.SuccessCount++
+}
+
+// wroteAny 是否有任何項目寫入內容，需要提交交易
+func (r *FileOperationResponse) wroteAny() bool {
+	if r.SuccessCount > 0 {
+		return true
+	}
+	for _, result := range r.FailedFiles {
+		if result.Status == WriteStatusPartial {
+			return true
+		}
+	}
+	return false
+}
+
+// applyFileOperation 複製或移動單一項目，成功時一併返回復原所需的操作記錄項目
+// 覆蓋或合併到既有項目的結果無法單純復原，不會記錄
+func (h *FileHandler) applyFileOperation(tx *gorm.DB, opType string, fileID uint, targetFolderID *uint, userID uint, opts fileWriteOptions) (FileOperationResult, *models.FileOperationItem) {
+	if opType == models.FileOperationCopy {
+		result := h.copyFileRecursive(fileID, targetFolderID, userID, opts, tx)
+		if !wroteItem(result) || result.NewID == nil {
+			return result, nil
+		}
+		h.refreshItemFolderStats(tx, *result.NewID)
+		if !createdNewItem(result) {
+			return result, nil
+		}
+		return result, &models.FileOperationItem{FileID: *result.NewID}
+	}
+
+	before, _ := services.SnapshotFileState(tx, fileID)
+	result := h.moveFileRecursive(fileID, targetFolderID, userID, opts, tx)
+	if !wroteItem(result) {
+		return result, nil
+	}
+	if before != nil {
+		h.refreshFolderStats(tx, before.ParentID, targetFolderID)
+	}
+	// 記錄移動前後的位置以便復原（原地不動的項目不需記錄）
+	if !createdNewItem(result) {
+		return result, nil
+	}
+	after, _ := services.SnapshotFileState(tx, fileID)
+	if before == nil || after == nil || services.SameFileLocation(before, after) {
+		return result, nil
+	}
+	return result, &models.FileOperationItem{FileID: fileID, Before: before, After: after}
+}
+
+// runCopyJob 背景複製工作
+func (h *FileHandler) runCopyJob(j *services.JobContext) (interface{}, error) {
+	return h.runFileOperationJob(j, models.FileOperationCopy)
+}
+
+// runMoveJob 背景移動工作
+func (h *FileHandler) runMoveJob(j *services.JobContext) (interface{}, error) {
+	return h.runFileOperationJob(j, models.FileOperationMove)
+}
+
+// runFileOperationJob 逐一複製或移動項目，每個項目各自以交易處理並保存進度
+func (h *FileHandler) runFileOperationJob(j *services.JobContext, opType string) (interface{}, error) {
+	var req FileOperationRequest
+	if err := j.DecodeParams(&req); err != nil {
+		return nil, err
+	}
+	policy, err := services.ParseConflictPolicy(req.Conflict, services.ConflictRename)
+	if err != nil {
+		return nil, err
+	}
+	// 背景執行時沒有請求內容，依工作擁有者目前的角色判斷能否覆蓋他人的檔案
+	var pruned []string
+	opts := fileWriteOptions{policy: policy, canEdit: h.userHasPermission(j.Job.UserID, models.PermFilesEdit), pruned: &pruned}
+	state := fileOperationJobState{Response: FileOperationResponse{
+		SuccessFiles: []FileOperationResult{},
+		FailedFiles:  []FileOperationResult{},
+		SkippedFiles: []FileOperationResult{},
+	}}
+	if err := j.Track(&state); err != nil {
+		return nil, err
+	}
+	if state.Next == 0 {
+		// 排隊期間資料夾結構可能已變更，開始前重新檢查
+		if opType == models.FileOperationMove {
+			if err := h.checkCircularDependency(req.FileIDs, req.TargetFolderID); err != nil {
+				return nil, err
+			}
+		}
+		if err := j.SetTotal(len(req.FileIDs)); err != nil {
+			return nil, err
+		}
+	}
+
+	var runErr error
+	for state.Next < len(req.FileIDs) {
+		if j.Canceled() {
+			runErr = services.ErrJobCanceled
+			break
+		}
+		fileID := req.FileIDs[state.Next]
+		if runErr = j.Transaction(func(tx *gorm.DB) error {
+			result, item := h.applyFileOperation(tx, opType, fileID, req.TargetFolderID, j.Job.UserID, opts)
+			state.Response.add(result)
+			if item != nil {
+				state.Items = append(state.Items, *item)
+			}
+			state.Next++
+			if result.Error != "" {
+				j.Advance(1, 1)
+			} else {
+				j.Advance(1, 0)
+			}
+			return nil
+		}); runErr != nil {
+			break
+		}
+		// 每個項目的交易提交後才釋放被淘汰的歷史版本
+		services.ReleaseBlobs(h.db, pruned)
+		pruned = pruned[:0]
+	}
+	state.Response.TotalCount = len(req.FileIDs)
+
+	// 記錄已完成的部分以便復原（取消時也會記錄）
+	if !state.Recorded && len(state.Items) > 0 {
+		verb := "複製"
+		if opType == models.FileOperationMove {
+			verb = "移動"
+		}
+		if err := j.Transaction(func(tx *gorm.DB) error {
+			operation, err := services.RecordFileOperation(tx, j.Job.UserID, opType,
+				fmt.Sprintf("%s %d 個項目", verb, len(state.Items)), state.Items, h.cfg.Operation.UndoWindow)
+			if err != nil {
+				return err
+			}
+			state.Response.OperationID = operationID(operation)
+			state.Recorded = true
+			return nil
+		}); err != nil && runErr == nil {
+			runErr = err
+		}
+	}
+
+	if state.Response.SuccessCount > 0 {
+		var targetFolderID *int
+		if req.TargetFolderID != nil {
+			val := int(*req.TargetFolderID)
+			targetFolderID = &val
+		}
+		eventType, message := "files_copied", fmt.Sprintf("成功複製 %d 個檔案", state.Response.SuccessCount)
+		if opType == models.FileOperationMove {
+			eventType, message = "files_moved", fmt.Sprintf("成功移動 %d 個檔案", state.Response.SuccessCount)
+		}
+		h.broadcastFileEvent(eventType, targetFolderID, message, state.Response)
+	}
+	return state.Response, runErr
+}
+
+// runDeleteJob 背景刪除工作，分批將資料夾及其子項目移至垃圾桶
+func (h *FileHandler) runDeleteJob(j *services.JobContext) (interface{}, error) {
+	var params deleteJobParams
+	if err := j.DecodeParams(&params); err != nil {
+		return nil, err
+	}
+	var state deleteJobState
+	if err := j.Track(&state); err != nil {
+		return nil, err
+	}
+
+	var file models.File
+	if err := h.db.First(&file, params.FileID).Error; err != nil {
+		return nil, fmt.Errorf("檔案不存在")
+	}
+	if state.AffectedIDs == nil {
+		if file.IsDeleted {
+			return nil, fmt.Errorf("檔案已在垃圾桶中")
+		}
+		ids, err := h.liveSubtreeIDs(file.ID, h.db)
+		if err != nil {
+			return nil, err
+		}
+		// 子項目優先，資料夾本身最後移至垃圾桶
+		for left, right := 0, len(ids)-1; left < right; left, right = left+1, right-1 {
+			ids[left], ids[right] = ids[right], ids[left]
+		}
+		state.AffectedIDs = ids
+		if err := j.SetTotal(len(ids)); err != nil {
+			return nil, err
+		}
+		if err := j.Transaction(func(tx *gorm.DB) error { return nil }); err != nil {
+			return nil, err
+		}
+	}
+
+	var runErr error
+	for state.Next < len(state.AffectedIDs) {
+		if j.Canceled() {
+			runErr = services.ErrJobCanceled
+			break
+		}
+		end := state.Next + deleteJobChunkSize
+		if end > len(state.AffectedIDs) {
+			end = len(state.AffectedIDs)
+		}
+		chunk := state.AffectedIDs[state.Next:end]
+		if runErr = j.Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			result := tx.Model(&models.File{}).Where("id IN ? AND is_deleted = ?", chunk, false).Updates(map[string]interface{}{
+				"is_deleted": true,
+				"deleted_at": now,
+				"deleted_by": j.Job.UserID,
+				"updated_at": now,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			state.Deleted += int(result.RowsAffected)
+			state.Next = end
+			j.Advance(len(chunk), 0)
+			return nil
+		}); runErr != nil {
+			break
+		}
+	}
+
+	if state.Next > 0 {
+		// 取消時資料夾本身可能仍未刪除，重新計算其剩餘內容
+		h.refreshItemFolderStats(h.db, file.ID)
+	}
+
+	// 記錄已移至垃圾桶的項目以便復原（取消時也會記錄）
+	if !state.Recorded && state.Next > 0 {
+		if err := j.Transaction(func(tx *gorm.DB) error {
+			operation, err := services.RecordFileOperation(tx, j.Job.UserID, models.FileOperationDelete,
+				fmt.Sprintf("將 '%s' 移至垃圾桶", file.Name),
+				[]models.FileOperationItem{{FileID: file.ID, AffectedIDs: state.AffectedIDs[:state.Next]}}, h.cfg.Operation.UndoWindow)
+			if err != nil {
+				return err
+			}
+			state.OperationID = operationID(operation)
+			state.Recorded = true
+			return nil
+		}); err != nil && runErr == nil {
+			runErr = err
+		}
+	}
+
+	if state.Deleted > 0 {
+		var broadcastParentID *int
+		if file.ParentID != nil {
+			id := int(*file.ParentID)
+			broadcastParentID = &id
+		}
+		h.broadcastFileEvent("delete", broadcastParentID, fmt.Sprintf("檔案 '%s' 已移至垃圾桶", file.Name), gin.H{
+			"fileId":       file.ID,
+			"fileName":     file.Name,
+			"deletedCount": state.Deleted,
+			"isDirectory":  file.IsDirectory,
+		})
+	}
+	return gin.H{
+		"fileId":       file.ID,
+		"deletedCount": state.Deleted,
+		"operationId":  state.OperationID,
+	}, runErr
+}
+
+// runEmptyTrashJob 背景清空垃圾桶工作，中斷後重新執行會繼續刪除剩餘的項目
+func (h *FileHandler) runEmptyTrashJob(j *services.JobContext) (interface{}, error) {
+	j.Job.Processed, j.Job.Failed = 0, 0
+	failed := 0
+	result, err := services.PurgeTrashWithProgress(h.db, nil, j.Job.UserID, func(result *services.TrashPurgeResult, total int) bool {
+		if j.Job.Total != total {
+			j.SetTotal(total)
+		}
+		j.Advance(1, result.Failed-failed)
+		failed = result.Failed
+		j.Report()
+		return !j.Canceled()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var runErr error
+	if j.Canceled() {
+		runErr = services.ErrJobCanceled
+	}
+	return gin.H{
+		"deletedCount": result.Purged,
+		"failedCount":  result.Failed,
+		"heldCount":    result.Held,
+		"keptCount":    result.Kept,
+	}, runErr
+}
+
+// RepairFolderStats 建立背景工作，從頭重新計算所有資料夾的大小與項目數統計
+func (h *FileHandler) RepairFolderStats(c *gin.Context) {
+	h.enqueueJob(c, models.JobTypeFolderStatsRepair, gin.H{})
+}
+
+// runFolderStatsRepairJob 背景修復資料夾統計工作，中斷後重新執行會從頭計算
+func (h *FileHandler) runFolderStatsRepairJob(j *services.JobContext) (interface{}, error) {
+	j.Job.Processed, j.Job.Failed = 0, 0
+	repaired, err := services.RepairFolderStats(h.db, func(done, total int) bool {
+		if j.Job.Total != total {
+			j.SetTotal(total)
+		}
+		j.Advance(1, 0)
+		j.Report()
+		return !j.Canceled()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var runErr error
+	if j.Canceled() {
+		runErr = services.ErrJobCanceled
+	}
+	return gin.H{"repairedCount": repaired}, runErr
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+	"memoryark/pkg/api"
+)
+
+// bulkMetadataSyncLimit 同步批量編輯的項目上限，超過時需改以背景工作執行
+const bulkMetadataSyncLimit = 500
+
+// metadataJobChunkSize 背景批量編輯每個步驟處理的項目數
+const metadataJobChunkSize = 200
+
+// MetadataQuery 以搜尋條件選取要批量編輯的項目（至少指定一個條件）
+type MetadataQuery struct {
+	Q              string `json:"q"`               // 名稱關鍵字
+	FolderID       *uint  `json:"folder_id"`       // 限定資料夾
+	Recursive      bool   `json:"recursive"`       // 包含子資料夾中的項目
+	CategoryID     *uint  `json:"category_id"`     // 限定分類
+	IncludeFolders bool   `json:"include_folders"` // 一併編輯資料夾
+}
+
+// BulkMetadataRequest 批量編輯描述資料請求，file_ids 與 query 擇一指定
+type BulkMetadataRequest struct {
+	FileIDs []uint                 `json:"file_ids"`
+	Query   *MetadataQuery         `json:"query"`
+	Patch   services.MetadataPatch `json:"patch"`
+	Atomic  bool                   `json:"atomic"` // 任一項目失敗時全部不套用（僅限同步執行）
+}
+
+// BulkMetadataResponse 批量編輯描述資料結果
+type BulkMetadataResponse struct {
+	TotalCount     int                       `json:"total_count"`
+	UpdatedCount   int                       `json:"updated_count"`
+	UnchangedCount int                       `json:"unchanged_count"`
+	FailedCount    int                       `json:"failed_count"`
+	RolledBack     bool                      `json:"rolled_back"` // atomic 模式下因失敗而全部不套用
+	Results        []services.MetadataResult `json:"results"`
+}
+
+// metadataJobParams 背景批量編輯工作參數（建立工作時已決定項目）
+type metadataJobParams struct {
+	FileIDs []uint                 `json:"file_ids"`
+	Patch   services.MetadataPatch `json:"patch"`
+}
+
+// metadataJobState 背景批量編輯工作的檢查點
+type metadataJobState struct {
+	Next     int                  `json:"next"`
+	Response BulkMetadataResponse `json:"response"`
+}
+
+// add 將項目結果加入回應
+func (r *BulkMetadataResponse) add(results []services.MetadataResult) {
+	for _, result := range results {
+		switch result.Status {
+		case services.MetadataUpdated:
+			r.UpdatedCount++
+		case services.MetadataUnchanged:
+			r.UnchangedCount++
+		default:
+			r.FailedCount++
+		}
+	}
+	r.Results = append(r.Results, results...)
+}
+
+// 選取要編輯的項目時的請求錯誤
+var (
+	errInvalidMetadataSelection = errors.New("請指定 file_ids 或 query 其中之一，query 至少需要一個條件")
+	errMetadataFolderNotFound   = errors.New("指定的資料夾不存在")
+)
+
+// errMetadataRolledBack atomic 模式下有項目失敗，取消整個交易
+var errMetadataRolledBack = errors.New("metadata patch rolled back")
+
+// selectMetadataTargets 依請求決定要編輯的項目ID（去除重複，保持順序）
+func (h *FileHandler) selectMetadataTargets(req *BulkMetadataRequest) ([]uint, error) {
+	if (len(req.FileIDs) > 0) == (req.Query != nil) {
+		return nil, errInvalidMetadataSelection
+	}
+	if len(req.FileIDs) > 0 {
+		seen := map[uint]bool{}
+		ids := make([]uint, 0, len(req.FileIDs))
+		for _, id := range req.FileIDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		return ids, nil
+	}
+
+	q := req.Query
+	if q.Q == "" && q.FolderID == nil && q.CategoryID == nil {
+		return nil, errInvalidMetadataSelection
+	}
+	query := h.db.Model(&models.File{}).Where("is_deleted = ?", false).
+		Where("(files.review_status IS NULL OR files.review_status <> ?)", models.ReviewStatusPending)
+	if !q.IncludeFolders {
+		query = query.Where("is_directory = ?", false)
+	}
+	if q.Q != "" {
+		pattern := "%" + services.EscapeLike(q.Q) + "%"
+		query = query.Where(`(name LIKE ? ESCAPE '\' OR original_name LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+	if q.FolderID != nil {
+		if q.Recursive {
+			var folder models.File
+			if err := h.db.Where("id = ? AND is_directory = ?", *q.FolderID, true).First(&folder).Error; err != nil {
+				return nil, errMetadataFolderNotFound
+			}
+			query = services.ScopeDescendants(query, folder)
+		} else {
+			query = query.Where("parent_id = ?", *q.FolderID)
+		}
+	}
+	if q.CategoryID != nil {
+		query = query.Where("category_id = ?", *q.CategoryID)
+	}
+
+	var ids []uint
+	if err := query.Order("id").Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// BulkUpdateMetadata 批量編輯檔案的分類、描述、標籤、講員、講道標題與經文參考
+// 同步執行時在同一個交易中套用；項目較多時以 ?async=true 改為背景工作
+func (h *FileHandler) BulkUpdateMetadata(c *gin.Context) {
+	var req BulkMetadataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "請求參數錯誤: "+err.Error())
+		return
+	}
+	if err := req.Patch.Validate(h.db); err != nil {
+		api.BadRequest(c, err.Error())
+		return
+	}
+
+	ids, err := h.selectMetadataTargets(&req)
+	if err != nil {
+		if errors.Is(err, errInvalidMetadataSelection) || errors.Is(err, errMetadataFolderNotFound) {
+			api.BadRequest(c, err.Error())
+			return
+		}
+		api.InternalServerError(c, "查詢檔案失敗")
+		return
+	}
+
+	if wantsAsync(c) {
+		h.enqueueJob(c, models.JobTypeBulkMetadata, metadataJobParams{FileIDs: ids, Patch: req.Patch})
+		return
+	}
+	if len(ids) > bulkMetadataSyncLimit {
+		api.BadRequest(c, fmt.Sprintf("項目過多（%d 個，上限 %d 個），請改以背景工作執行（?async=true）", len(ids), bulkMetadataSyncLimit))
+		return
+	}
+
+	response := BulkMetadataResponse{TotalCount: len(ids), Results: []services.MetadataResult{}}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		results, err := services.ApplyMetadataPatch(tx, ids, &req.Patch)
+		if err != nil {
+			return err
+		}
+		response.add(results)
+		if req.Atomic && response.FailedCount > 0 {
+			response.RolledBack = true
+			return errMetadataRolledBack
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errMetadataRolledBack) {
+		api.InternalServerError(c, "更新檔案資訊失敗")
+		return
+	}
+
+	if response.RolledBack {
+		c.JSON(http.StatusUnprocessableEntity, api.StandardResponse{
+			Success: false,
+			Data:    response,
+			Error:   &api.ErrorInfo{Code: "BULK_UPDATE_ROLLED_BACK", Message: fmt.Sprintf("%d 個項目無法更新，已全部取消", response.FailedCount)},
+		})
+		return
+	}
+	if response.UpdatedCount > 0 {
+		h.broadcastFileEvent("files_updated", nil, fmt.Sprintf("已更新 %d 個檔案的資訊", response.UpdatedCount), response)
+	}
+	api.SuccessResponse(c, response)
+}
+
+// runBulkMetadataJob 背景批量編輯工作，每批項目各自以交易處理並保存進度
+func (h *FileHandler) runBulkMetadataJob(j *services.JobContext) (interface{}, error) {
+	var params metadataJobParams
+	if err := j.DecodeParams(&params); err != nil {
+		return nil, err
+	}
+	state := metadataJobState{Response: BulkMetadataResponse{Results: []services.MetadataResult{}}}
+	if err := j.Track(&state); err != nil {
+		return nil, err
+	}
+	if state.Next == 0 {
+		if err := j.SetTotal(len(params.FileIDs)); err != nil {
+			return nil, err
+		}
+	}
+
+	var runErr error
+	for state.Next < len(params.FileIDs) {
+		if j.Canceled() {
+			runErr = services.ErrJobCanceled
+			break
+		}
+		end := state.Next + metadataJobChunkSize
+		if end > len(params.FileIDs) {
+			end = len(params.FileIDs)
+		}
+		if runErr = j.Transaction(func(tx *gorm.DB) error {
+			results, err := services.ApplyMetadataPatch(tx, params.FileIDs[state.Next:end], &params.Patch)
+			if err != nil {
+				return err
+			}
+			failed := state.Response.FailedCount
+			state.Response.add(results)
+			j.Advance(end-state.Next, state.Response.FailedCount-failed)
+			state.Next = end
+			return nil
+		}); runErr != nil {
+			break
+		}
+	}
+	state.Response.TotalCount = len(params.FileIDs)
+
+	if state.Response.UpdatedCount > 0 {
+		h.broadcastFileEvent("files_updated", nil, fmt.Sprintf("已更新 %d 個檔案的資訊", state.Response.UpdatedCount), state.Response)
+	}
+	return state.Response, runErr
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/middleware"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+	"memoryark/pkg/api"
+)
+
+// undoConflictError 項目在操作後已被變更，無法安全復原
+type undoConflictError struct {
+	message string
+}
+
+func (e *undoConflictError) Error() string {
+	return e.message
+}
+
+// operationID 返回操作記錄 ID，未記錄時為 nil
+func operationID(op *models.FileOperation) *uint {
+	if op == nil {
+		return nil
+	}
+	return &op.ID
+}
+
+// liveSubtreeIDs 收集刪除時會一併移至垃圾桶的項目（與 deleteFileRecursive 走訪範圍相同）
+func (h *FileHandler) liveSubtreeIDs(rootID uint, tx *gorm.DB) ([]uint, error) {
+	ids := []uint{rootID}
+	frontier := []uint{rootID}
+	visited := map[uint]bool{rootID: true}
+	for len(frontier) > 0 {
+		var next []uint
+		for _, chunk := range services.ChunkIDs(frontier) {
+			var children []models.File
+			if err := tx.Select("id").Where("parent_id IN ? AND is_deleted = ?", chunk, false).Find(&children).Error; err != nil {
+				return nil, err
+			}
+			for _, child := range children {
+				if visited[child.ID] {
+					continue
+				}
+				visited[child.ID] = true
+				ids = append(ids, child.ID)
+				next = append(next, child.ID)
+			}
+		}
+		frontier = next
+	}
+	return ids, nil
+}
+
+// relocateFile 更新項目的名稱與位置，並同步更新子項目的虛擬路徑
+func (h *FileHandler) relocateFile(tx *gorm.DB, file *models.File, parentID *uint, name string) error {
+	virtualPath, err := services.VirtualPathFor(tx, parentID, name)
+	if err != nil {
+		return err
+	}
+	oldParentID := file.ParentID
+	now := time.Now()
+	if err := tx.Model(&models.File{}).Where("id = ?", file.ID).Updates(map[string]interface{}{
+		"name":         name,
+		"parent_id":    parentID,
+		"virtual_path": virtualPath,
+		"updated_at":   now,
+	}).Error; err != nil {
+		return err
+	}
+	file.Name = name
+	file.ParentID = parentID
+	file.VirtualPath = virtualPath
+	file.UpdatedAt = now
+	if err := services.UpdateTreePath(tx, file.ID); err != nil {
+		return err
+	}
+
+	if file.IsDirectory {
+		if err := h.updateChildrenVirtualPaths(file.ID, virtualPath, tx); err != nil {
+			return err
+		}
+	}
+	return services.RefreshFolderStatsFor(tx, oldParentID, parentID)
+}
+
+// relocateWithJournal 在交易中移動或重新命名單一項目並記錄操作
+func (h *FileHandler) relocateWithJournal(file *models.File, parentID *uint, name, opType string, userID uint) (*models.FileOperation, error) {
+	var operation *models.FileOperation
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		before := &models.FileState{Name: file.Name, ParentID: file.ParentID, VirtualPath: file.VirtualPath}
+		if err := h.relocateFile(tx, file, parentID, name); err != nil {
+			return err
+		}
+		after := &models.FileState{Name: file.Name, ParentID: file.ParentID, VirtualPath: file.VirtualPath}
+		if services.SameFileLocation(before, after) {
+			return nil
+		}
+
+		summary := fmt.Sprintf("將 '%s' 重新命名為 '%s'", before.Name, after.Name)
+		if opType == models.FileOperationMove {
+			summary = fmt.Sprintf("將 '%s' 移動到 %s", file.Name, after.VirtualPath)
+		}
+		var err error
+		operation, err = services.RecordFileOperation(tx, userID, opType, summary,
+			[]models.FileOperationItem{{FileID: file.ID, Before: before, After: after}}, h.cfg.Operation.UndoWindow)
+		return err
+	})
+	return operation, err
+}
+
+// GetFileOperations 獲取目前用戶最近的檔案操作記錄
+func (h *FileHandler) GetFileOperations(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	var operations []models.FileOperation
+	if err := h.db.Where("user_id = ?", c.GetUint("user_id")).
+		Order("created_at DESC, id DESC").Limit(limit).Find(&operations).Error; err != nil {
+		api.InternalServerError(c, "查詢操作記錄失敗")
+		return
+	}
+
+	now := time.Now()
+	allowed := map[string]bool{}
+	for i := range operations {
+		if items, err := services.FileOperationItems(&operations[i]); err == nil {
+			operations[i].ItemCount = len(items)
+		}
+		perm := undoPermission(operations[i].Type)
+		if _, ok := allowed[perm]; !ok {
+			allowed[perm] = middleware.HasPermission(h.db, c, perm)
+		}
+		operations[i].CanUndo = allowed[perm] && services.CanUndoFileOperation(&operations[i], now)
+	}
+	api.Success(c, gin.H{
+		"operations":        operations,
+		"undoWindowMinutes": h.cfg.Operation.UndoWindow,
+	})
+}
+
+// undoPermission 復原操作所需的權限：復原複製會刪除副本、復原刪除會從垃圾桶還原，兩者都需要刪除權限
+func undoPermission(opType string) string {
+	switch opType {
+	case models.FileOperationCopy, models.FileOperationDelete:
+		return models.PermFilesDelete
+	}
+	return models.PermFilesEdit
+}
+
+// canUndoOperation 需要具備該類操作的權限，且為操作者本人或可管理所有檔案的用戶
+func (h *FileHandler) canUndoOperation(c *gin.Context, op *models.FileOperation) bool {
+	if !middleware.HasPermission(h.db, c, undoPermission(op.Type)) {
+		return false
+	}
+	if op.UserID == c.GetUint("user_id") {
+		return true
+	}
+	return middleware.HasPermission(h.db, c, models.PermFilesManageAll)
+}
+
+// UndoFileOperation 在期限內復原移動、重新命名、複製或刪除操作
+func (h *FileHandler) UndoFileOperation(c *gin.Context) {
+	opID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		api.BadRequest(c, "無效的操作 ID")
+		return
+	}
+
+	var operation models.FileOperation
+	if err := h.db.First(&operation, opID).Error; err != nil {
+		api.NotFound(c, "操作記錄")
+		return
+	}
+	if !h.canUndoOperation(c, &operation) {
+		api.Forbidden(c, "沒有權限復原此操作")
+		return
+	}
+	if operation.Status != models.FileOperationApplied {
+		api.Error(c, http.StatusConflict, "ALREADY_UNDONE", "此操作已復原")
+		return
+	}
+	if !services.CanUndoFileOperation(&operation, time.Now()) {
+		api.Error(c, http.StatusGone, "OPERATION_EXPIRED", "已超過可復原的期限")
+		return
+	}
+	items, err := services.FileOperationItems(&operation)
+	if err != nil {
+		api.InternalServerError(c, "操作記錄格式錯誤")
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	var fileIDs []uint
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// 以條件更新標記為已復原，避免同一操作被重複復原
+		now := time.Now()
+		result := tx.Model(&models.FileOperation{}).
+			Where("id = ? AND status = ?", operation.ID, models.FileOperationApplied).
+			Updates(map[string]interface{}{"status": models.FileOperationUndone, "undone_at": now, "undone_by": userID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &undoConflictError{message: "此操作已復原"}
+		}
+
+		var err error
+		switch operation.Type {
+		case models.FileOperationMove, models.FileOperationRename:
+			fileIDs, err = h.undoRelocate(tx, items)
+		case models.FileOperationCopy:
+			fileIDs, err = h.undoCopy(tx, items, userID)
+		case models.FileOperationDelete:
+			fileIDs, err = h.undoDelete(tx, items, userID)
+		default:
+			err = &undoConflictError{message: "不支援復原此類型的操作"}
+		}
+		return err
+	})
+	if err != nil {
+		var conflict *undoConflictError
+		if errors.As(err, &conflict) {
+			api.Error(c, http.StatusConflict, "UNDO_CONFLICT", conflict.message)
+			return
+		}
+		api.InternalServerError(c, "復原操作失敗")
+		return
+	}
+
+	h.db.First(&operation, operation.ID)
+	h.broadcastFileEvent("undo", nil, fmt.Sprintf("已復原操作：%s", operation.Summary), gin.H{
+		"operationId": operation.ID,
+		"type":        operation.Type,
+		"fileIds":     fileIDs,
+	})
+	api.SuccessWithMessage(c, gin.H{
+		"operation": operation,
+		"fileIds":   fileIDs,
+	}, "操作已復原")
+}
+
+// undoRelocate 將移動或重新命名的項目放回原位置，項目在操作後已被變更時拒絕復原
+func (h *FileHandler) undoRelocate(tx *gorm.DB, items []models.FileOperationItem) ([]uint, error) {
+	var fileIDs []uint
+	// 反向處理，讓同一操作中的多個項目依相反順序還原
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+		var file models.File
+		if err := tx.Limit(1).Find(&file, item.FileID).Error; err != nil {
+			return nil, err
+		}
+		if file.ID == 0 || file.IsDeleted {
+			return nil, &undoConflictError{message: fmt.Sprintf("'%s' 已被刪除，無法復原", item.After.Name)}
+		}
+		current := &models.FileState{Name: file.Name, ParentID: file.ParentID}
+		if !services.SameFileLocation(current, item.After) {
+			return nil, &undoConflictError{message: fmt.Sprintf("'%s' 在操作後已被變更，無法復原", file.Name)}
+		}
+
+		if item.Before.ParentID != nil {
+			var parent models.File
+			if err := tx.Limit(1).Find(&parent, *item.Before.ParentID).Error; err != nil {
+				return nil, err
+			}
+			if parent.ID == 0 || parent.IsDeleted || !parent.IsDirectory {
+				return nil, &undoConflictError{message: fmt.Sprintf("'%s' 原本所在的資料夾已不存在", file.Name)}
+			}
+		}
+		conflict, err := services.FindNameConflict(tx, item.Before.Name, item.Before.ParentID, file.ID)
+		if err != nil {
+			return nil, err
+		}
+		if conflict != nil {
+			return nil, &undoConflictError{message: fmt.Sprintf("原位置已有同名項目 '%s'", item.Before.Name)}
+		}
+
+		if err := h.relocateFile(tx, &file, item.Before.ParentID, item.Before.Name); err != nil {
+			return nil, err
+		}
+		fileIDs = append(fileIDs, file.ID)
+	}
+	return fileIDs, nil
+}
+
+// undoCopy 將複製產生且仍存在的複本移至垃圾桶
+func (h *FileHandler) undoCopy(tx *gorm.DB, items []models.FileOperationItem, userID uint) ([]uint, error) {
+	var fileIDs []uint
+	for _, item := range items {
+		var file models.File
+		if err := tx.Limit(1).Find(&file, item.FileID).Error; err != nil {
+			return nil, err
+		}
+		if file.ID == 0 || file.IsDeleted {
+			continue
+		}
+		if _, err := h.deleteFileRecursive(file.ID, userID, tx); err != nil {
+			return nil, err
+		}
+		if err := services.RefreshFolderStats(tx, file.ParentID); err != nil {
+			return nil, err
+		}
+		fileIDs = append(fileIDs, file.ID)
+	}
+	return fileIDs, nil
+}
+
+// undoDelete 從垃圾桶還原此次刪除的項目，之前已在垃圾桶的子項目維持不變
+func (h *FileHandler) undoDelete(tx *gorm.DB, items []models.FileOperationItem, userID uint) ([]uint, error) {
+	r := &restorer{tx: tx, h: h, policy: services.ConflictRename, userID: userID}
+	var fileIDs []uint
+	for _, item := range items {
+		var file models.File
+		if err := tx.Limit(1).Find(&file, item.FileID).Error; err != nil {
+			return nil, err
+		}
+		if file.ID == 0 {
+			return nil, &undoConflictError{message: "項目已永久刪除，無法復原"}
+		}
+		// 分批刪除的背景工作被取消時，項目本身可能仍未刪除，只還原已移至垃圾桶的子項目
+		includesSelf := false
+		var descendants []uint
+		for _, id := range item.AffectedIDs {
+			if id == file.ID {
+				includesSelf = true
+			} else {
+				descendants = append(descendants, id)
+			}
+		}
+		if !file.IsDeleted && len(descendants) == 0 {
+			continue
+		}
+
+		virtualPath := file.VirtualPath
+		if file.IsDeleted && includesSelf {
+			// 上層資料夾之後也被刪除時一併還原，原位置有同名項目時重新命名
+			parentID, err := r.ensureParent(&file)
+			if err != nil {
+				return nil, err
+			}
+			name := file.Name
+			conflict, err := services.FindNameConflict(tx, file.Name, parentID, file.ID)
+			if err != nil {
+				return nil, err
+			}
+			if conflict != nil {
+				if name, err = services.UniqueName(tx, file.Name, parentID); err != nil {
+					return nil, err
+				}
+			}
+			if virtualPath, err = r.markRestored(&file, parentID, name); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, chunk := range services.ChunkIDs(descendants) {
+			if err := tx.Model(&models.File{}).Where("id IN ? AND is_deleted = ?", chunk, true).Updates(map[string]interface{}{
+				"is_deleted": false,
+				"deleted_at": nil,
+				"deleted_by": nil,
+				"updated_at": time.Now(),
+			}).Error; err != nil {
+				return nil, err
+			}
+		}
+		if file.IsDirectory {
+			if err := h.updateChildrenVirtualPaths(file.ID, virtualPath, tx); err != nil {
+				return nil, err
+			}
+		}
+		if err := services.RefreshItemFolderStats(tx, file.ID); err != nil {
+			return nil, err
+		}
+		fileIDs = append(fileIDs, file.ID)
+	}
+	return fileIDs, nil
+}
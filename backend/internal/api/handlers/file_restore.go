@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+	"memoryark/pkg/api"
+)
+
+// 還原結果狀態
+const (
+	RestoreStatusRestored         = "restored"
+	RestoreStatusRenamed          = "renamed"
+	RestoreStatusOverwritten      = "overwritten"
+	RestoreStatusSkipped          = "skipped"
+	RestoreStatusFailed           = "failed"
+	RestoreStatusAncestorRestored = "ancestor_restored" // 已刪除的上層資料夾一併還原
+	RestoreStatusAncestorCreated  = "ancestor_created"  // 上層資料夾已永久刪除，依原路徑重新建立
+	RestoreStatusAncestorMerged   = "ancestor_merged"   // 原位置已有同名資料夾，還原到該資料夾內
+)
+
+// RestoreRequest 還原請求，未提供時還原到原位置並以重新命名處理衝突
+type RestoreRequest struct {
+	Conflict       string `json:"conflict"`         // rename、overwrite、skip 或 fail
+	TargetFolderID *uint  `json:"target_folder_id"` // 還原到指定資料夾，為空時還原到原位置
+}
+
+// BatchRestoreRequest 批量還原請求
+type BatchRestoreRequest struct {
+	RestoreRequest
+	FileIDs []uint `json:"file_ids" binding:"required,min=1"`
+}
+
+// RestoreOutcome 單一項目的還原結果
+type RestoreOutcome struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	NewName     string `json:"new_name,omitempty"`
+	ParentID    *uint  `json:"parent_id"`
+	VirtualPath string `json:"virtual_path,omitempty"`
+	ReplacedID  *uint  `json:"replaced_id,omitempty"` // overwrite 時被移至垃圾桶的項目
+	Reason      string `json:"reason,omitempty"`
+}
+
+// restorer 在單一交易中還原一個垃圾桶項目並記錄每個項目的結果
+type restorer struct {
+	tx       *gorm.DB
+	h        *FileHandler
+	policy   string
+	userID   uint
+	outcomes []RestoreOutcome
+}
+
+// bindRestoreRequest 解析還原選項，允許空白請求內容
+func bindRestoreRequest(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil && !errors.Is(err, io.EOF) {
+		api.BadRequest(c, "請求參數錯誤: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// validateRestoreTarget 確認指定的還原位置是未刪除的資料夾
+func (h *FileHandler) validateRestoreTarget(c *gin.Context, targetID *uint) bool {
+	if targetID == nil {
+		return true
+	}
+	var target models.File
+	if err := h.db.Where("id = ? AND is_deleted = ? AND is_directory = ?", *targetID, false, true).First(&target).Error; err != nil {
+		api.BadRequest(c, "目標資料夾不存在或已刪除")
+		return false
+	}
+	return true
+}
+
+// restoreFromTrash 還原垃圾桶中的項目，targetID 為空時還原到原位置（必要時還原或重建上層資料夾）
+func (h *FileHandler) restoreFromTrash(fileID uint, targetID *uint, policy string, userID uint) ([]RestoreOutcome, error) {
+	var outcomes []RestoreOutcome
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		r := &restorer{tx: tx, h: h, policy: policy, userID: userID}
+
+		var file models.File
+		if err := tx.First(&file, fileID).Error; err != nil {
+			return err
+		}
+		if !file.IsDeleted {
+			r.outcomes = append(r.outcomes, RestoreOutcome{
+				ID: file.ID, Name: file.Name, Status: RestoreStatusSkipped, ParentID: file.ParentID,
+				VirtualPath: file.VirtualPath, Reason: "項目未在垃圾桶中",
+			})
+			outcomes = r.outcomes
+			return nil
+		}
+
+		parentID := targetID
+		if parentID == nil {
+			var err error
+			if parentID, err = r.ensureParent(&file); err != nil {
+				return err
+			}
+		}
+		if err := r.restoreItem(&file, parentID); err != nil {
+			return err
+		}
+		// 覆蓋時被取代的項目與還原的項目位於同一資料夾，一併更新統計
+		if err := services.RefreshItemFolderStats(tx, file.ID); err != nil {
+			return err
+		}
+		outcomes = r.outcomes
+		return nil
+	})
+	return outcomes, err
+}
+
+// ensureParent 確保項目原本的上層資料夾存在且未刪除，返回還原後的父資料夾 ID
+func (r *restorer) ensureParent(file *models.File) (*uint, error) {
+	if file.ParentID == nil {
+		return nil, nil
+	}
+
+	var parent models.File
+	if err := r.tx.Limit(1).Find(&parent, *file.ParentID).Error; err != nil {
+		return nil, err
+	}
+	if parent.ID == 0 || !parent.IsDirectory {
+		// 上層資料夾已永久刪除，依虛擬路徑重建
+		return r.recreatePath(path.Dir(file.VirtualPath))
+	}
+	if !parent.IsDeleted {
+		return &parent.ID, nil
+	}
+
+	grandparentID, err := r.ensureParent(&parent)
+	if err != nil {
+		return nil, err
+	}
+
+	// 原位置已有同名資料夾時合併到該資料夾
+	existing, err := services.FindNameConflict(r.tx, parent.Name, grandparentID, parent.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.IsDirectory {
+		r.outcomes = append(r.outcomes, RestoreOutcome{
+			ID: parent.ID, Name: parent.Name, Status: RestoreStatusAncestorMerged,
+			ParentID: grandparentID, VirtualPath: existing.VirtualPath, Reason: "已還原到原位置的同名資料夾",
+		})
+		return &existing.ID, nil
+	}
+
+	// 只還原上層資料夾本身，其他已刪除的子項目仍留在垃圾桶
+	name := parent.Name
+	if existing != nil {
+		if name, err = services.UniqueName(r.tx, parent.Name, grandparentID); err != nil {
+			return nil, err
+		}
+	}
+	virtualPath, err := r.markRestored(&parent, grandparentID, name)
+	if err != nil {
+		return nil, err
+	}
+	outcome := RestoreOutcome{
+		ID: parent.ID, Name: parent.Name, Status: RestoreStatusAncestorRestored,
+		ParentID: grandparentID, VirtualPath: virtualPath,
+	}
+	if name != parent.Name {
+		outcome.NewName = name
+	}
+	r.outcomes = append(r.outcomes, outcome)
+	return &parent.ID, nil
+}
+
+// recreatePath 依虛擬路徑逐層尋找或建立資料夾
+func (r *restorer) recreatePath(dir string) (*uint, error) {
+	var parentID *uint
+	for _, name := range strings.Split(strings.Trim(dir, "/"), "/") {
+		if name == "" || name == "." || name == ".." {
+			continue
+		}
+
+		var folder models.File
+		query := r.tx.Where("name = ? AND is_directory = ? AND is_deleted = ?", name, true, false)
+		if parentID != nil {
+			query = query.Where("parent_id = ?", *parentID)
+		} else {
+			query = query.Where("parent_id IS NULL")
+		}
+		if err := query.Order("id").Limit(1).Find(&folder).Error; err != nil {
+			return nil, err
+		}
+
+		if folder.ID == 0 {
+			virtualPath, err := services.VirtualPathFor(r.tx, parentID, name)
+			if err != nil {
+				return nil, err
+			}
+			folder = models.File{
+				Name:         name,
+				OriginalName: name,
+				VirtualPath:  virtualPath,
+				ParentID:     parentID,
+				UploadedBy:   r.userID,
+				IsDirectory:  true,
+			}
+			if err := r.tx.Create(&folder).Error; err != nil {
+				return nil, err
+			}
+			r.outcomes = append(r.outcomes, RestoreOutcome{
+				ID: folder.ID, Name: name, Status: RestoreStatusAncestorCreated,
+				ParentID: parentID, VirtualPath: virtualPath,
+			})
+		}
+
+		id := folder.ID
+		parentID = &id
+	}
+	return parentID, nil
+}
+
+// restoreItem 依衝突處理方式還原項目，資料夾會遞迴還原其已刪除的子項目
+func (r *restorer) restoreItem(file *models.File, parentID *uint) error {
+	conflict, err := services.FindNameConflict(r.tx, file.Name, parentID, file.ID)
+	if err != nil {
+		return err
+	}
+
+	name := file.Name
+	status := RestoreStatusRestored
+	var replacedID *uint
+	if conflict != nil {
+		switch r.policy {
+		case services.ConflictSkip, services.ConflictFail:
+			// 略過或失敗的項目及其子項目留在垃圾桶
+			status := RestoreStatusSkipped
+			if r.policy == services.ConflictFail {
+				status = RestoreStatusFailed
+			}
+			r.outcomes = append(r.outcomes, RestoreOutcome{
+				ID: file.ID, Name: file.Name, Status: status, ParentID: parentID,
+				Reason: "目標位置已有同名項目",
+			})
+			return nil
+		case services.ConflictOverwrite:
+			// 既有項目移至垃圾桶，仍可再還原
+			if _, err := r.h.deleteFileRecursive(conflict.ID, r.userID, r.tx); err != nil {
+				return err
+			}
+			status = RestoreStatusOverwritten
+			replacedID = &conflict.ID
+		default:
+			if name, err = services.UniqueName(r.tx, file.Name, parentID); err != nil {
+				return err
+			}
+			status = RestoreStatusRenamed
+		}
+	}
+
+	virtualPath, err := r.markRestored(file, parentID, name)
+	if err != nil {
+		return err
+	}
+	outcome := RestoreOutcome{
+		ID: file.ID, Name: file.Name, Status: status, ParentID: parentID,
+		VirtualPath: virtualPath, ReplacedID: replacedID,
+	}
+	if name != file.Name {
+		outcome.NewName = name
+	}
+	r.outcomes = append(r.outcomes, outcome)
+
+	if !file.IsDirectory {
+		return nil
+	}
+
+	var children []models.File
+	if err := r.tx.Where("parent_id = ? AND is_deleted = ?", file.ID, true).Find(&children).Error; err != nil {
+		return err
+	}
+	for i := range children {
+		if err := r.restoreItem(&children[i], &file.ID); err != nil {
+			return err
+		}
+	}
+	// 先前已還原的子項目也需要更新虛擬路徑
+	return r.h.updateChildrenVirtualPaths(file.ID, virtualPath, r.tx)
+}
+
+// markRestored 將項目標記為未刪除並更新名稱、位置與虛擬路徑
+func (r *restorer) markRestored(file *models.File, parentID *uint, name string) (string, error) {
+	virtualPath, err := services.VirtualPathFor(r.tx, parentID, name)
+	if err != nil {
+		return "", err
+	}
+	if err := r.tx.Model(&models.File{}).Where("id = ?", file.ID).Updates(map[string]interface{}{
+		"is_deleted":   false,
+		"deleted_at":   nil,
+		"deleted_by":   nil,
+		"name":         name,
+		"parent_id":    parentID,
+		"virtual_path": virtualPath,
+		"updated_at":   time.Now(),
+	}).Error; err != nil {
+		return "", err
+	}
+	if err := services.UpdateTreePath(r.tx, file.ID); err != nil {
+		return "", err
+	}
+	return virtualPath, nil
+}
+
+// countRestored 統計實際還原（不含上層資料夾與略過）的項目數
+func countRestored(outcomes []RestoreOutcome) (restored, skipped int) {
+	for _, outcome := range outcomes {
+		switch outcome.Status {
+		case RestoreStatusRestored, RestoreStatusRenamed, RestoreStatusOverwritten:
+			restored++
+		case RestoreStatusSkipped, RestoreStatusFailed:
+			skipped++
+		}
+	}
+	return restored, skipped
+}
+
+// BatchRestoreFiles 批量還原垃圾桶項目，每個項目各自以交易處理並返回結果
+func (h *FileHandler) BatchRestoreFiles(c *gin.Context) {
+	var req BatchRestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "請求參數錯誤: "+err.Error())
+		return
+	}
+	policy, err := services.ParseConflictPolicy(req.Conflict, services.ConflictRename)
+	if err != nil {
+		api.BadRequest(c, err.Error())
+		return
+	}
+	if !h.validateRestoreTarget(c, req.TargetFolderID) {
+		return
+	}
+
+	var outcomes []RestoreOutcome
+	for _, fileID := range req.FileIDs {
+		items, err := h.restoreFromTrash(fileID, req.TargetFolderID, policy, c.GetUint("user_id"))
+		if err != nil {
+			reason := "還原失敗"
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				reason = "檔案不存在"
+			}
+			outcomes = append(outcomes, RestoreOutcome{ID: fileID, Status: RestoreStatusFailed, Reason: reason})
+			continue
+		}
+		outcomes = append(outcomes, items...)
+	}
+
+	restored, skipped := countRestored(outcomes)
+	h.broadcastFileEvent("restore", nil, "檔案已從垃圾桶還原", gin.H{"fileIds": req.FileIDs})
+	api.Success(c, gin.H{
+		"restoredCount": restored,
+		"skippedCount":  skipped,
+		"items":         outcomes,
+	})
+}
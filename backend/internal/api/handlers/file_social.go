@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/middleware"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+	"memoryark/pkg/api"
+)
+
+// CommentRequest 新增或修改留言請求，mentions 為 @提及的用戶ID
+type CommentRequest struct {
+	Content  string `json:"content" binding:"required"`
+	ParentID *uint  `json:"parent_id"` // 回覆的留言（僅新增時使用）
+	Mentions []uint `json:"mentions"`
+}
+
+// broadcastUserEvent 發送只有指定用戶收到的即時事件
+func (h *FileHandler) broadcastUserEvent(userID uint, eventType string, message string, data interface{}) {
+	if h.wsHandler != nil {
+		if handler, ok := h.wsHandler.(interface {
+			BroadcastUserEvent(userID uint, eventType string, message string, data interface{})
+		}); ok {
+			handler.BroadcastUserEvent(userID, eventType, message, data)
+		}
+	}
+}
+
+// broadcastFolderEvent 廣播事件給正在瀏覽檔案所在資料夾的用戶
+func (h *FileHandler) broadcastFolderEvent(file *models.File, eventType, message string, data interface{}) {
+	var folderID *int
+	if file.ParentID != nil {
+		id := int(*file.ParentID)
+		folderID = &id
+	}
+	h.broadcastFileEvent(eventType, folderID, message, data)
+}
+
+// socialTarget 取得要按讚或留言的檔案（垃圾桶與審核中的項目不可操作）
+func (h *FileHandler) socialTarget(c *gin.Context) (*models.File, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		api.BadRequest(c, "無效的檔案ID")
+		return nil, false
+	}
+	var file models.File
+	if err := h.db.First(&file, id).Error; err != nil || file.IsDeleted || file.ReviewStatus == models.ReviewStatusPending {
+		api.NotFound(c, "檔案")
+		return nil, false
+	}
+	return &file, true
+}
+
+// LikeFile 對檔案按讚
+func (h *FileHandler) LikeFile(c *gin.Context) {
+	h.setLiked(c, true)
+}
+
+// UnlikeFile 取消對檔案按讚
+func (h *FileHandler) UnlikeFile(c *gin.Context) {
+	h.setLiked(c, false)
+}
+
+// setLiked 設定目前用戶對檔案的按讚，有變更時廣播給瀏覽該資料夾的用戶
+func (h *FileHandler) setLiked(c *gin.Context, liked bool) {
+	file, ok := h.socialTarget(c)
+	if !ok {
+		return
+	}
+	userID := c.GetUint("user_id")
+	likeCount, changed, err := services.SetFileLiked(h.db, userID, file.ID, liked)
+	if err != nil {
+		api.InternalServerError(c, "更新按讚失敗")
+		return
+	}
+
+	data := gin.H{"file_id": file.ID, "liked": liked, "like_count": likeCount}
+	if changed {
+		eventType, message := "file_liked", fmt.Sprintf("'%s' 獲得一個讚", file.Name)
+		if !liked {
+			eventType, message = "file_unliked", fmt.Sprintf("'%s' 少了一個讚", file.Name)
+		}
+		h.broadcastFolderEvent(file, eventType, message, gin.H{"file_id": file.ID, "user_id": userID, "like_count": likeCount})
+	}
+	api.Success(c, data)
+}
+
+// GetFileLikes 取得檔案的按讚記錄與目前用戶是否已按讚
+func (h *FileHandler) GetFileLikes(c *gin.Context) {
+	file, ok := h.socialTarget(c)
+	if !ok {
+		return
+	}
+	likes, err := services.FileLikes(h.db, file.ID)
+	if err != nil {
+		api.InternalServerError(c, "取得按讚記錄失敗")
+		return
+	}
+	userID := c.GetUint("user_id")
+	liked := false
+	for _, like := range likes {
+		if like.UserID == userID {
+			liked = true
+			break
+		}
+	}
+	api.Success(c, gin.H{"like_count": file.LikeCount, "liked": liked, "likes": likes})
+}
+
+// GetFileComments 取得檔案的留言討論串
+func (h *FileHandler) GetFileComments(c *gin.Context) {
+	file, ok := h.socialTarget(c)
+	if !ok {
+		return
+	}
+	comments, err := services.FileComments(h.db, file.ID)
+	if err != nil {
+		api.InternalServerError(c, "取得留言失敗")
+		return
+	}
+	api.Success(c, comments)
+}
+
+// commentError 將留言驗證錯誤轉為回應
+func commentError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrEmptyComment), errors.Is(err, services.ErrCommentTooLong),
+		errors.Is(err, services.ErrInvalidCommentParent), errors.Is(err, services.ErrInvalidMention):
+		api.BadRequest(c, err.Error())
+	case errors.Is(err, services.ErrCommentDeleted):
+		api.Error(c, http.StatusConflict, "COMMENT_DELETED", err.Error())
+	default:
+		api.InternalServerError(c, fallback)
+	}
+}
+
+// notifyMentions 通知被 @提及的用戶（不通知留言者本人）
+func (h *FileHandler) notifyMentions(file *models.File, comment *models.FileComment, authorID uint, userIDs []uint) {
+	for _, id := range userIDs {
+		if id == authorID {
+			continue
+		}
+		h.broadcastUserEvent(id, "comment_mention", fmt.Sprintf("有人在 '%s' 的留言中提及你", file.Name), gin.H{
+			"file_id":    file.ID,
+			"comment_id": comment.ID,
+			"comment":    comment,
+		})
+	}
+}
+
+// CreateFileComment 在檔案上新增留言或回覆
+func (h *FileHandler) CreateFileComment(c *gin.Context) {
+	file, ok := h.socialTarget(c)
+	if !ok {
+		return
+	}
+	var req CommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "請求參數錯誤: "+err.Error())
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	comment, mentioned, err := services.CreateFileComment(h.db, file.ID, userID, req.ParentID, req.Content, req.Mentions)
+	if err != nil {
+		commentError(c, err, "新增留言失敗")
+		return
+	}
+
+	h.broadcastFolderEvent(file, "comment_created", fmt.Sprintf("'%s' 有新留言", file.Name), gin.H{"file_id": file.ID, "comment": comment})
+	h.notifyMentions(file, comment, userID, mentioned)
+	c.JSON(http.StatusCreated, api.StandardResponse{
+		Success: true,
+		Data:    comment,
+		Message: "留言成功",
+	})
+}
+
+// loadFileComment 讀取路由指定的留言，並確認目前用戶是作者或具備留言管理權限
+func (h *FileHandler) loadFileComment(c *gin.Context, file *models.File) (*models.FileComment, bool) {
+	commentID, err := strconv.ParseUint(c.Param("commentId"), 10, 32)
+	if err != nil {
+		api.BadRequest(c, "無效的留言ID")
+		return nil, false
+	}
+	var comment models.FileComment
+	if err := h.db.Where("id = ? AND file_id = ?", commentID, file.ID).First(&comment).Error; err != nil {
+		api.NotFound(c, "留言")
+		return nil, false
+	}
+	if comment.UserID != c.GetUint("user_id") && !h.canModerateComments(c) {
+		api.Forbidden(c, "只能修改或刪除自己的留言")
+		return nil, false
+	}
+	return &comment, true
+}
+
+// canModerateComments 具備留言管理權限的用戶可以編輯與刪除他人的留言
+func (h *FileHandler) canModerateComments(c *gin.Context) bool {
+	return middleware.HasPermission(h.db, c, models.PermCommentsModerate)
+}
+
+// UpdateFileComment 修改留言內容（作者本人或版主）
+func (h *FileHandler) UpdateFileComment(c *gin.Context) {
+	file, ok := h.socialTarget(c)
+	if !ok {
+		return
+	}
+	comment, ok := h.loadFileComment(c, file)
+	if !ok {
+		return
+	}
+	var req CommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "請求參數錯誤: "+err.Error())
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	updated, added, err := services.UpdateFileComment(h.db, comment, userID, req.Content, req.Mentions)
+	if err != nil {
+		commentError(c, err, "修改留言失敗")
+		return
+	}
+
+	h.broadcastFolderEvent(file, "comment_updated", fmt.Sprintf("'%s' 的留言已修改", file.Name), gin.H{"file_id": file.ID, "comment": updated})
+	h.notifyMentions(file, updated, userID, added)
+	api.SuccessWithMessage(c, updated, "留言已修改")
+}
+
+// DeleteFileComment 刪除留言（作者本人或版主），回覆仍保留在討論串中
+func (h *FileHandler) DeleteFileComment(c *gin.Context) {
+	file, ok := h.socialTarget(c)
+	if !ok {
+		return
+	}
+	comment, ok := h.loadFileComment(c, file)
+	if !ok {
+		return
+	}
+	if err := services.DeleteFileComment(h.db, comment, c.GetUint("user_id")); err != nil {
+		api.InternalServerError(c, "刪除留言失敗")
+		return
+	}
+
+	h.broadcastFolderEvent(file, "comment_deleted", fmt.Sprintf("'%s' 的留言已刪除", file.Name), gin.H{"file_id": file.ID, "comment_id": comment.ID})
+	api.SuccessWithMessage(c, gin.H{"comment_id": comment.ID}, "留言已刪除")
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/services"
+	"memoryark/pkg/api"
+)
+
+// CheckFileTree 檢查資料夾結構（孤兒項目、循環與路徑偏差），只返回報告不做任何修改
+func (h *FileHandler) CheckFileTree(c *gin.Context) {
+	report, err := services.RepairFileTree(h.db, true)
+	if err != nil {
+		api.InternalServerError(c, "檢查資料夾結構失敗")
+		return
+	}
+	api.Success(c, report)
+}
+
+// RepairFileTree 修復資料夾結構：孤兒項目與循環移至根目錄，並重新計算偏差的虛擬路徑與 ID 路徑
+func (h *FileHandler) RepairFileTree(c *gin.Context) {
+	report, err := services.RepairFileTree(h.db, false)
+	if err != nil {
+		api.InternalServerError(c, "修復資料夾結構失敗")
+		return
+	}
+	if report.Repaired > 0 {
+		h.broadcastFileEvent("tree_repaired", nil, "資料夾結構已修復", gin.H{"repaired": report.Repaired})
+	}
+	api.SuccessWithMessage(c, report, "資料夾結構檢查完成")
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+	"memoryark/pkg/api"
+)
+
+// FileVersionEntry 版本列表中的單一版本（包含目前版本）
+type FileVersionEntry struct {
+	ID            *uint     `json:"id,omitempty"` // 歷史版本 ID，目前版本為空
+	VersionNumber int       `json:"version_number"`
+	IsCurrent     bool      `json:"is_current"`
+	SHA256Hash    string    `json:"sha256_hash"`
+	FileSize      int64     `json:"size"`
+	MimeType      string    `json:"mime_type"`
+	UploadedBy    uint      `json:"uploaded_by"`
+	UploaderName  string    `json:"uploader_name"`
+	UploadedAt    time.Time `json:"uploaded_at"`
+}
+
+// canReplaceContent 檢查用戶能否取代檔案內容（上傳新版本，或以複製、移動覆蓋）
+// 上傳者本人或具備編輯權限（canEdit）的用戶可以取代
+func canReplaceContent(file *models.File, userID uint, canEdit bool) bool {
+	return file.UploadedBy == userID || canEdit
+}
+
+// createNewVersion 以上傳的內容建立檔案新版本並廣播更新事件
+func (h *FileHandler) createNewVersion(file *models.File, content services.FileContent, userID uint) (*models.FileVersion, error) {
+	retention := services.ResolveVersionRetention(h.db, file.ParentID, h.cfg.Upload.VersionRetention)
+	archived, err := services.AddFileVersion(h.db, file, content, userID, retention)
+	if err != nil {
+		// 新內容的實體檔案沒有被引用時一併清除
+		services.ReleaseBlob(h.db, content.FilePath)
+		return nil, err
+	}
+
+	var broadcastParentID *int
+	if file.ParentID != nil {
+		id := int(*file.ParentID)
+		broadcastParentID = &id
+	}
+	h.broadcastFileEvent("upload", broadcastParentID, fmt.Sprintf("檔案 '%s' 已更新為第 %d 版", file.Name, file.Version), gin.H{
+		"fileId":     file.ID,
+		"fileName":   file.Name,
+		"fileSize":   file.FileSize,
+		"uploadedBy": userID,
+		"version":    file.Version,
+	})
+	return archived, nil
+}
+
+// respondNewVersion 建立檔案新版本並以上傳回應的格式返回
+func (h *FileHandler) respondNewVersion(c *gin.Context, file *models.File, content services.FileContent, userID uint) {
+	archived, err := h.createNewVersion(file, content, userID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, api.ErrDatabaseError, "建立新版本失敗")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":         true,
+		"status":          WriteStatusOverwritten,
+		"versioned":       true,
+		"message":         fmt.Sprintf("已建立新版本（第 %d 版）", file.Version),
+		"data":            file,
+		"previousVersion": archived.VersionNumber,
+	})
+}
+
+// loadVersionedFile 讀取路由參數指定的檔案（不含資料夾與垃圾桶中的檔案）
+func (h *FileHandler) loadVersionedFile(c *gin.Context) (*models.File, bool) {
+	var file models.File
+	if err := h.db.Preload("Uploader").First(&file, c.Param("id")).Error; err != nil || file.IsDeleted {
+		api.NotFound(c, "檔案")
+		return nil, false
+	}
+	if file.IsDirectory {
+		api.BadRequest(c, "資料夾沒有版本歷史")
+		return nil, false
+	}
+	return &file, true
+}
+
+// loadFileVersion 讀取路由參數指定的歷史版本
+func (h *FileHandler) loadFileVersion(c *gin.Context, fileID uint) (*models.FileVersion, bool) {
+	var version models.FileVersion
+	if err := h.db.Where("id = ? AND file_id = ?", c.Param("versionId"), fileID).First(&version).Error; err != nil {
+		api.NotFound(c, "版本")
+		return nil, false
+	}
+	return &version, true
+}
+
+// GetFileVersions 獲取檔案的版本列表（最新在前）
+func (h *FileHandler) GetFileVersions(c *gin.Context) {
+	file, ok := h.loadVersionedFile(c)
+	if !ok {
+		return
+	}
+
+	var versions []models.FileVersion
+	if err := h.db.Preload("Uploader").Where("file_id = ?", file.ID).
+		Order("version_number DESC").Find(&versions).Error; err != nil {
+		api.InternalServerError(c, "查詢版本歷史失敗")
+		return
+	}
+
+	current := FileVersionEntry{
+		VersionNumber: file.Version,
+		IsCurrent:     true,
+		SHA256Hash:    file.SHA256Hash,
+		FileSize:      file.FileSize,
+		MimeType:      file.MimeType,
+		UploadedBy:    file.UploadedBy,
+		UploaderName:  file.Uploader.Name,
+		UploadedAt:    file.CreatedAt,
+	}
+	if current.VersionNumber < 1 {
+		current.VersionNumber = 1
+	}
+	if file.VersionUploadedBy != nil {
+		current.UploadedBy = *file.VersionUploadedBy
+		var uploader models.User
+		if h.db.Select("name").First(&uploader, *file.VersionUploadedBy).Error == nil {
+			current.UploaderName = uploader.Name
+		}
+	}
+	if file.VersionUpdatedAt != nil {
+		current.UploadedAt = *file.VersionUpdatedAt
+	}
+
+	entries := []FileVersionEntry{current}
+	for _, version := range versions {
+		id := version.ID
+		entry := FileVersionEntry{
+			ID:            &id,
+			VersionNumber: version.VersionNumber,
+			SHA256Hash:    version.SHA256Hash,
+			FileSize:      version.FileSize,
+			MimeType:      version.MimeType,
+			UploadedBy:    version.UploadedBy,
+			UploadedAt:    version.UploadedAt,
+		}
+		if version.Uploader != nil {
+			entry.UploaderName = version.Uploader.Name
+		}
+		entries = append(entries, entry)
+	}
+
+	api.Success(c, gin.H{
+		"file_id":   file.ID,
+		"file_name": file.Name,
+		"retention": services.ResolveVersionRetention(h.db, file.ParentID, h.cfg.Upload.VersionRetention),
+		"versions":  entries,
+	})
+}
+
+// DownloadFileVersion 下載檔案的歷史版本
+func (h *FileHandler) DownloadFileVersion(c *gin.Context) {
+	file, ok := h.loadVersionedFile(c)
+	if !ok {
+		return
+	}
+	version, ok := h.loadFileVersion(c, file.ID)
+	if !ok {
+		return
+	}
+
+	if _, err := os.Stat(version.FilePath); os.IsNotExist(err) {
+		api.Error(c, http.StatusNotFound, "PHYSICAL_FILE_NOT_FOUND", "實體檔案不存在")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"v%d-%s\"", version.VersionNumber, file.OriginalName))
+	c.Header("Content-Type", version.MimeType)
+	c.Header("Content-Length", fmt.Sprintf("%d", version.FileSize))
+	c.File(version.FilePath)
+}
+
+// RestoreFileVersion 將歷史版本還原為目前版本；被取代的內容會保存為新的歷史版本
+func (h *FileHandler) RestoreFileVersion(c *gin.Context) {
+	file, ok := h.loadVersionedFile(c)
+	if !ok {
+		return
+	}
+	version, ok := h.loadFileVersion(c, file.ID)
+	if !ok {
+		return
+	}
+	if _, err := os.Stat(version.FilePath); os.IsNotExist(err) {
+		api.Error(c, http.StatusNotFound, "PHYSICAL_FILE_NOT_FOUND", "實體檔案不存在")
+		return
+	}
+
+	retention := services.ResolveVersionRetention(h.db, file.ParentID, h.cfg.Upload.VersionRetention)
+	content := services.FileContent{
+		FilePath:   version.FilePath,
+		SHA256Hash: version.SHA256Hash,
+		FileSize:   version.FileSize,
+		MimeType:   version.MimeType,
+	}
+	restoredFrom := version.VersionNumber
+	if _, err := services.AddFileVersion(h.db, file, content, c.GetUint("user_id"), retention); err != nil {
+		if errors.Is(err, services.ErrSameContent) {
+			api.BadRequest(c, "此版本的內容與目前版本相同")
+			return
+		}
+		api.InternalServerError(c, "還原版本失敗")
+		return
+	}
+
+	var broadcastParentID *int
+	if file.ParentID != nil {
+		id := int(*file.ParentID)
+		broadcastParentID = &id
+	}
+	h.broadcastFileEvent("update", broadcastParentID, fmt.Sprintf("檔案 '%s' 已還原第 %d 版", file.Name, restoredFrom), gin.H{
+		"fileId":       file.ID,
+		"fileName":     file.Name,
+		"version":      file.Version,
+		"restoredFrom": restoredFrom,
+	})
+
+	file.Uploader = models.User{}
+	api.SuccessWithMessage(c, file, fmt.Sprintf("已還原第 %d 版為第 %d 版", restoredFrom, file.Version))
+}
+
+// SetFolderVersionRetention 設定資料夾（含子資料夾）的歷史版本保留數量，null 表示沿用上層或全域設定
+func (h *FileHandler) SetFolderVersionRetention(c *gin.Context) {
+	folderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		api.BadRequest(c, "無效的資料夾 ID")
+		return
+	}
+
+	var req struct {
+		Retention *int `json:"retention"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "請求參數錯誤: "+err.Error())
+		return
+	}
+	if req.Retention != nil && *req.Retention < 0 {
+		api.BadRequest(c, "保留數量不能小於 0")
+		return
+	}
+
+	var folder models.File
+	if err := h.db.First(&folder, folderID).Error; err != nil || folder.IsDeleted {
+		api.NotFound(c, "資料夾")
+		return
+	}
+	if !folder.IsDirectory {
+		api.BadRequest(c, "只能為資料夾設定版本保留數量")
+		return
+	}
+
+	if err := h.db.Model(&folder).Update("version_retention", req.Retention).Error; err != nil {
+		api.InternalServerError(c, "更新版本保留數量失敗")
+		return
+	}
+	folder.VersionRetention = req.Retention
+	api.SuccessWithMessage(c, folder, "版本保留數量已更新")
+}
@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/config"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+	"memoryark/pkg/api"
+)
+
+// defaultTemplateLeadDays 預設提前建立資料夾的天數（每週聚會時，上一次聚會的隔天建立）
+const defaultTemplateLeadDays = 6
+
+// maxTemplatePreview 預覽接下來聚會的最大次數
+const maxTemplatePreview = 20
+
+// FolderTemplateHandler 資料夾範本處理器
+type FolderTemplateHandler struct {
+	db    *gorm.DB
+	cfg   *config.Config
+	files *FileHandler // 共用建立資料夾結構與廣播邏輯
+	loc   *time.Location
+}
+
+// NewFolderTemplateHandler 創建資料夾範本處理器
+func NewFolderTemplateHandler(db *gorm.DB, cfg *config.Config, fileHandler *FileHandler) *FolderTemplateHandler {
+	return &FolderTemplateHandler{
+		db:    db,
+		cfg:   cfg,
+		files: fileHandler,
+		loc:   services.FolderTemplateLocation(cfg.FolderTemplates),
+	}
+}
+
+// FolderTemplateRequest 建立或修改資料夾範本請求
+type FolderTemplateRequest struct {
+	Name        string                     `json:"name" binding:"required"`
+	Description string                     `json:"description"`
+	ParentID    *uint                      `json:"parent_id"`
+	Structure   models.FolderTemplateNodes `json:"structure" binding:"required"`
+	CategoryID  *uint                      `json:"category_id"`
+	Tags        string                     `json:"tags"`
+	Schedule    string                     `json:"schedule"`
+	LeadDays    *int                       `json:"lead_days"`
+	Enabled     *bool                      `json:"enabled"` // 預設在設定排程時啟用
+}
+
+// FolderTemplateFolder 套用範本時建立或沿用的資料夾
+type FolderTemplateFolder struct {
+	ID   uint   `json:"id"`
+	Path string `json:"path"`
+}
+
+// FolderTemplateResult 套用資料夾範本的結果
+type FolderTemplateResult struct {
+	TemplateID uint                   `json:"template_id"`
+	ServiceAt  time.Time              `json:"service_at"`
+	Folders    []FolderTemplateFolder `json:"folders"`
+}
+
+// FolderTemplatePreview 接下來一次聚會將建立的資料夾
+type FolderTemplatePreview struct {
+	ServiceAt time.Time `json:"service_at"`
+	RunAt     time.Time `json:"run_at"`
+	Paths     []string  `json:"paths"`
+}
+
+// ApplyFolderTemplate 以聚會日期代入範本，透過 ensureFolderStructure 建立資料夾（已存在的資料夾沿用）
+// 建立的資料夾擁有者為範本建立者；沒有分類或標籤的資料夾套用範本的預設值
+func (h *FileHandler) ApplyFolderTemplate(template *models.FolderTemplate, serviceAt time.Time) (*FolderTemplateResult, error) {
+	result := &FolderTemplateResult{TemplateID: template.ID, ServiceAt: serviceAt, Folders: []FolderTemplateFolder{}}
+	if err := h.applyTemplateNodes(template, template.Structure, template.ParentID, serviceAt, result); err != nil {
+		return nil, err
+	}
+
+	var folderID *int
+	if template.ParentID != nil {
+		id := int(*template.ParentID)
+		folderID = &id
+	}
+	h.broadcastFileEvent("create", folderID, fmt.Sprintf("已依範本 '%s' 建立 %s 的資料夾", template.Name, serviceAt.Format("2006-01-02")), result)
+	return result, nil
+}
+
+// applyTemplateNodes 逐層建立範本中的資料夾
+func (h *FileHandler) applyTemplateNodes(template *models.FolderTemplate, nodes []models.FolderTemplateNode, parentID *uint, serviceAt time.Time, result *FolderTemplateResult) error {
+	for _, node := range nodes {
+		name, err := services.RenderTemplateName(node.Name, serviceAt)
+		if err != nil {
+			return err
+		}
+		folderID, err := h.ensureFolderStructure(template.CreatedBy, parentID, name)
+		if err != nil {
+			return err
+		}
+		if folderID == nil {
+			return fmt.Errorf("建立資料夾 '%s' 失敗", name)
+		}
+
+		if template.CategoryID != nil {
+			if err := h.db.Model(&models.File{}).Where("id = ? AND category_id IS NULL", *folderID).
+				Update("category_id", *template.CategoryID).Error; err != nil {
+				return err
+			}
+		}
+		if template.Tags != "" {
+			if err := h.db.Model(&models.File{}).Where("id = ? AND (tags = '' OR tags IS NULL)", *folderID).
+				Update("tags", template.Tags).Error; err != nil {
+				return err
+			}
+		}
+
+		var folder models.File
+		if err := h.db.Select("id", "virtual_path").First(&folder, *folderID).Error; err != nil {
+			return err
+		}
+		result.Folders = append(result.Folders, FolderTemplateFolder{ID: folder.ID, Path: folder.VirtualPath})
+
+		if err := h.applyTemplateNodes(template, node.Children, folderID, serviceAt, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunScheduled 背景排程使用的套用函式
+func (h *FolderTemplateHandler) RunScheduled(template *models.FolderTemplate, serviceAt time.Time) error {
+	_, err := h.files.ApplyFolderTemplate(template, serviceAt)
+	return err
+}
+
+// bindTemplate 將請求內容套用到範本並驗證
+func (h *FolderTemplateHandler) bindTemplate(c *gin.Context, template *models.FolderTemplate) bool {
+	var req FolderTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "請求參數錯誤: "+err.Error())
+		return false
+	}
+
+	template.Name = req.Name
+	template.Description = req.Description
+	template.ParentID = req.ParentID
+	template.Structure = req.Structure
+	template.CategoryID = req.CategoryID
+	template.Tags = req.Tags
+	template.Schedule = req.Schedule
+	template.LeadDays = defaultTemplateLeadDays
+	if req.LeadDays != nil {
+		template.LeadDays = *req.LeadDays
+	}
+	template.Enabled = req.Schedule != ""
+	if req.Enabled != nil {
+		template.Enabled = *req.Enabled
+	}
+
+	if err := services.ValidateFolderTemplate(h.db, template); err != nil {
+		if errors.Is(err, services.ErrInvalidFolderTemplate) {
+			api.BadRequest(c, err.Error())
+		} else {
+			api.InternalServerError(c, "驗證資料夾範本失敗")
+		}
+		return false
+	}
+
+	var count int64
+	h.db.Model(&models.FolderTemplate{}).Where("name = ? AND id <> ?", template.Name, template.ID).Count(&count)
+	if count > 0 {
+		api.Error(c, http.StatusConflict, "TEMPLATE_EXISTS", "已有相同名稱的資料夾範本")
+		return false
+	}
+	return true
+}
+
+// loadTemplate 讀取路由指定的資料夾範本
+func (h *FolderTemplateHandler) loadTemplate(c *gin.Context) (*models.FolderTemplate, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		api.BadRequest(c, "無效的範本ID")
+		return nil, false
+	}
+	var template models.FolderTemplate
+	if err := h.db.Preload("Category").First(&template, id).Error; err != nil {
+		api.NotFound(c, "資料夾範本")
+		return nil, false
+	}
+	services.FillNextFolderTemplateRun(&template, time.Now().In(h.loc))
+	return &template, true
+}
+
+// GetFolderTemplates 取得所有資料夾範本及下一次建立的時間
+func (h *FolderTemplateHandler) GetFolderTemplates(c *gin.Context) {
+	var templates []models.FolderTemplate
+	if err := h.db.Preload("Category").Order("name").Find(&templates).Error; err != nil {
+		api.InternalServerError(c, "取得資料夾範本失敗")
+		return
+	}
+	now := time.Now().In(h.loc)
+	for i := range templates {
+		services.FillNextFolderTemplateRun(&templates[i], now)
+	}
+	api.Success(c, templates)
+}
+
+// GetFolderTemplate 取得單一資料夾範本
+func (h *FolderTemplateHandler) GetFolderTemplate(c *gin.Context) {
+	template, ok := h.loadTemplate(c)
+	if !ok {
+		return
+	}
+	api.Success(c, template)
+}
+
+// CreateFolderTemplate 建立資料夾範本
+func (h *FolderTemplateHandler) CreateFolderTemplate(c *gin.Context) {
+	template := models.FolderTemplate{CreatedBy: c.GetUint("user_id")}
+	if !h.bindTemplate(c, &template) {
+		return
+	}
+	if err := h.db.Create(&template).Error; err != nil {
+		api.InternalServerError(c, "建立資料夾範本失敗")
+		return
+	}
+	services.FillNextFolderTemplateRun(&template, time.Now().In(h.loc))
+	c.JSON(http.StatusCreated, api.StandardResponse{
+		Success: true,
+		Data:    template,
+		Message: "資料夾範本建立成功",
+	})
+}
+
+// UpdateFolderTemplate 修改資料夾範本；修改排程後從現在開始計算下一次聚會
+func (h *FolderTemplateHandler) UpdateFolderTemplate(c *gin.Context) {
+	template, ok := h.loadTemplate(c)
+	if !ok {
+		return
+	}
+	schedule := template.Schedule
+	if !h.bindTemplate(c, template) {
+		return
+	}
+	if template.Schedule != schedule {
+		template.LastServiceAt = nil
+	}
+	template.Category = nil
+	if err := h.db.Save(template).Error; err != nil {
+		api.InternalServerError(c, "修改資料夾範本失敗")
+		return
+	}
+	services.FillNextFolderTemplateRun(template, time.Now().In(h.loc))
+	api.SuccessWithMessage(c, template, "資料夾範本已更新")
+}
+
+// DeleteFolderTemplate 刪除資料夾範本（已建立的資料夾保留）
+func (h *FolderTemplateHandler) DeleteFolderTemplate(c *gin.Context) {
+	template, ok := h.loadTemplate(c)
+	if !ok {
+		return
+	}
+	if err := h.db.Delete(&models.FolderTemplate{}, template.ID).Error; err != nil {
+		api.InternalServerError(c, "刪除資料夾範本失敗")
+		return
+	}
+	api.SuccessWithMessage(c, gin.H{"id": template.ID}, "資料夾範本已刪除")
+}
+
+// PreviewFolderTemplate 預覽接下來幾次聚會將建立的資料夾路徑
+func (h *FolderTemplateHandler) PreviewFolderTemplate(c *gin.Context) {
+	template, ok := h.loadTemplate(c)
+	if !ok {
+		return
+	}
+	if template.Schedule == "" {
+		api.BadRequest(c, "此範本沒有設定排程")
+		return
+	}
+	count, _ := strconv.Atoi(c.DefaultQuery("count", "5"))
+	if count < 1 || count > maxTemplatePreview {
+		count = 5
+	}
+
+	now := time.Now().In(h.loc)
+	upcoming, err := services.UpcomingTemplateServices(template, now, count)
+	if err != nil {
+		api.BadRequest(c, err.Error())
+		return
+	}
+	base := ""
+	if template.ParentID != nil {
+		var parent models.File
+		if err := h.db.Select("id", "virtual_path").First(&parent, *template.ParentID).Error; err == nil {
+			base = parent.VirtualPath
+		}
+	}
+
+	previews := make([]FolderTemplatePreview, 0, len(upcoming))
+	for _, serviceAt := range upcoming {
+		paths, err := templatePaths(template.Structure, base, serviceAt)
+		if err != nil {
+			api.BadRequest(c, err.Error())
+			return
+		}
+		runAt := serviceAt.AddDate(0, 0, -template.LeadDays)
+		if runAt.Before(now) {
+			runAt = now
+		}
+		previews = append(previews, FolderTemplatePreview{ServiceAt: serviceAt, RunAt: runAt, Paths: paths})
+	}
+	api.Success(c, previews)
+}
+
+// templatePaths 列出範本代入日期後的所有資料夾路徑
+func templatePaths(nodes []models.FolderTemplateNode, base string, serviceAt time.Time) ([]string, error) {
+	paths := []string{}
+	for _, node := range nodes {
+		name, err := services.RenderTemplateName(node.Name, serviceAt)
+		if err != nil {
+			return nil, err
+		}
+		path := base + "/" + name
+		children, err := templatePaths(node.Children, path, serviceAt)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(append(paths, path), children...)
+	}
+	return paths, nil
+}
+
+// RunFolderTemplate 立即套用資料夾範本：可指定聚會日期（YYYY-MM-DD），否則使用下一次聚會，沒有排程時使用今天
+func (h *FolderTemplateHandler) RunFolderTemplate(c *gin.Context) {
+	template, ok := h.loadTemplate(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Date string `json:"date"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			api.BadRequest(c, "請求參數錯誤: "+err.Error())
+			return
+		}
+	}
+
+	now := time.Now().In(h.loc)
+	serviceAt := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, h.loc)
+	switch {
+	case req.Date != "":
+		date, err := time.ParseInLocation("2006-01-02", req.Date, h.loc)
+		if err != nil {
+			api.BadRequest(c, "日期格式錯誤，請使用 YYYY-MM-DD")
+			return
+		}
+		serviceAt = date
+	case template.Schedule != "":
+		upcoming, err := services.UpcomingTemplateServices(template, now, 1)
+		if err != nil {
+			api.BadRequest(c, err.Error())
+			return
+		}
+		if len(upcoming) > 0 {
+			serviceAt = upcoming[0]
+		}
+	}
+
+	result, err := h.files.ApplyFolderTemplate(template, serviceAt)
+	updates := map[string]interface{}{"last_run_at": now, "last_error": ""}
+	if err != nil {
+		updates["last_error"] = err.Error()
+	}
+	h.db.Model(template).Updates(updates)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidFolderTemplate) {
+			api.BadRequest(c, err.Error())
+			return
+		}
+		api.InternalServerError(c, "套用資料夾範本失敗")
+		return
+	}
+	api.SuccessWithMessage(c, result, fmt.Sprintf("已建立 %s 的資料夾", serviceAt.Format("2006-01-02")))
+}
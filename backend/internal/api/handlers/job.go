@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/config"
+	"memoryark/internal/middleware"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+	"memoryark/pkg/api"
+)
+
+// JobHandler 背景工作處理器
+type JobHandler struct {
+	db    *gorm.DB
+	cfg   *config.Config
+	queue *services.JobQueue
+}
+
+// NewJobHandler 創建背景工作處理器
+func NewJobHandler(db *gorm.DB, cfg *config.Config, queue *services.JobQueue) *JobHandler {
+	return &JobHandler{
+		db:    db,
+		cfg:   cfg,
+		queue: queue,
+	}
+}
+
+// canManageAllJobs 可管理所有檔案的用戶可以查看與取消其他用戶的工作
+func (h *JobHandler) canManageAllJobs(c *gin.Context) bool {
+	return middleware.HasPermission(h.db, c, models.PermFilesManageAll)
+}
+
+// cancelPermission 取消工作所需的權限，與建立該類工作所需的權限相同
+func cancelPermission(jobType string) string {
+	switch jobType {
+	case models.JobTypeDelete:
+		return models.PermFilesDelete
+	case models.JobTypeEmptyTrash:
+		return models.PermTrashEmpty
+	case models.JobTypeFolderStatsRepair:
+		return models.PermFilesManageAll
+	}
+	return models.PermFilesEdit
+}
+
+// loadJob 載入工作並確認目前用戶可以存取
+func (h *JobHandler) loadJob(c *gin.Context) (*models.Job, bool) {
+	jobID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		api.BadRequest(c, "無效的工作 ID")
+		return nil, false
+	}
+	var job models.Job
+	if err := h.db.First(&job, jobID).Error; err != nil {
+		api.NotFound(c, "工作")
+		return nil, false
+	}
+	if job.UserID != c.GetUint("user_id") && !h.canManageAllJobs(c) {
+		// 不透露其他用戶的工作是否存在
+		api.NotFound(c, "工作")
+		return nil, false
+	}
+	return &job, true
+}
+
+// GetJobs 獲取目前用戶的背景工作列表
+func (h *JobHandler) GetJobs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := h.db.Model(&models.Job{})
+	if all, _ := strconv.ParseBool(c.Query("all")); !all || !h.canManageAllJobs(c) {
+		query = query.Where("user_id = ?", c.GetUint("user_id"))
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if jobType := c.Query("type"); jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		api.InternalServerError(c, "查詢背景工作失敗")
+		return
+	}
+	var jobs []models.Job
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&jobs).Error; err != nil {
+		api.InternalServerError(c, "查詢背景工作失敗")
+		return
+	}
+	api.SuccessWithPagination(c, jobs, page, limit, total)
+}
+
+// GetJob 獲取背景工作的狀態、進度與結果
+func (h *JobHandler) GetJob(c *gin.Context) {
+	job, ok := h.loadJob(c)
+	if !ok {
+		return
+	}
+	api.Success(c, job)
+}
+
+// CancelJob 取消排隊中或執行中的背景工作，已完成的步驟會保留
+func (h *JobHandler) CancelJob(c *gin.Context) {
+	job, ok := h.loadJob(c)
+	if !ok {
+		return
+	}
+	if !middleware.HasPermission(h.db, c, cancelPermission(job.Type)) {
+		api.Forbidden(c, "沒有權限取消此工作")
+		return
+	}
+	if err := h.queue.Cancel(job); err != nil {
+		if errors.Is(err, services.ErrJobFinished) {
+			api.Error(c, http.StatusConflict, "JOB_FINISHED", "工作已結束，無法取消")
+			return
+		}
+		api.InternalServerError(c, "取消背景工作失敗")
+		return
+	}
+
+	message := "已要求取消，工作將在目前步驟完成後停止"
+	if job.Status == models.JobCanceled {
+		message = "工作已取消"
+	}
+	api.SuccessWithMessage(c, job, message)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/models"
+	"memoryark/pkg/api"
+)
+
+// LegalHoldRequest 設定法律保全請求
+type LegalHoldRequest struct {
+	Hold   *bool  `json:"hold" binding:"required"`
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// parseLegalHoldRequest 解析法律保全請求，解除保全時清除原因
+func parseLegalHoldRequest(c *gin.Context) (map[string]interface{}, bool) {
+	var req LegalHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "請求參數錯誤: "+err.Error())
+		return nil, false
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if !*req.Hold {
+		reason = ""
+	}
+	return map[string]interface{}{"legal_hold": *req.Hold, "legal_hold_reason": reason}, true
+}
+
+// SetFolderLegalHold 設定資料夾的法律保全，資料夾內所有項目都不會從垃圾桶永久刪除
+func (h *FileHandler) SetFolderLegalHold(c *gin.Context) {
+	folderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		api.BadRequest(c, "無效的資料夾 ID")
+		return
+	}
+	updates, ok := parseLegalHoldRequest(c)
+	if !ok {
+		return
+	}
+
+	// 垃圾桶中的資料夾也可以設定，避免在保留期限內被自動刪除
+	var folder models.File
+	if err := h.db.First(&folder, folderID).Error; err != nil {
+		api.NotFound(c, "資料夾")
+		return
+	}
+	if !folder.IsDirectory {
+		api.BadRequest(c, "只能為資料夾設定法律保全")
+		return
+	}
+
+	if err := h.db.Model(&folder).Updates(updates).Error; err != nil {
+		api.InternalServerError(c, "更新法律保全失敗")
+		return
+	}
+	api.SuccessWithMessage(c, folder, "法律保全設定已更新")
+}
+
+// SetCategoryLegalHold 設定分類的法律保全，此分類的檔案都不會從垃圾桶永久刪除
+func (h *CategoryHandler) SetCategoryLegalHold(c *gin.Context) {
+	categoryID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		api.BadRequest(c, "無效的分類ID")
+		return
+	}
+	updates, ok := parseLegalHoldRequest(c)
+	if !ok {
+		return
+	}
+
+	var category models.Category
+	if err := h.db.First(&category, categoryID).Error; err != nil {
+		api.NotFound(c, "分類")
+		return
+	}
+
+	if err := h.db.Model(&category).Updates(updates).Error; err != nil {
+		api.InternalServerError(c, "更新法律保全失敗")
+		return
+	}
+	api.SuccessWithMessage(c, category, "法律保全設定已更新")
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/auth"
+	"memoryark/internal/config"
+	"memoryark/internal/models"
+	"memoryark/pkg/api"
+	"memoryark/pkg/logger"
+)
+
+const (
+	// oidcStateCookie 綁定登入流程與瀏覽器的 Cookie，防止登入 CSRF
+	oidcStateCookie = "memoryark_oidc_state"
+	// oidcStateTTL 從導向提供者到回呼的最長時間
+	oidcStateTTL = 10 * time.Minute
+)
+
+// OIDCHandler OpenID Connect 登入處理器
+type OIDCHandler struct {
+	db  *gorm.DB
+	cfg *config.Config
+}
+
+// NewOIDCHandler 創建 OIDC 登入處理器
+func NewOIDCHandler(db *gorm.DB, cfg *config.Config) *OIDCHandler {
+	return &OIDCHandler{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+// Login 建立 state、nonce 與 PKCE 後導向提供者的登入頁
+func (h *OIDCHandler) Login(c *gin.Context) {
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	state, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		api.InternalServerError(c, "產生登入狀態失敗")
+		return
+	}
+	nonce, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		api.InternalServerError(c, "產生登入狀態失敗")
+		return
+	}
+	verifier, challenge, err := auth.GeneratePKCE()
+	if err != nil {
+		api.InternalServerError(c, "產生登入狀態失敗")
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, challenge)
+	if err != nil {
+		logger.Error("OIDC discovery failed: %v", err)
+		api.Error(c, http.StatusBadGateway, "OIDC_PROVIDER_UNAVAILABLE", "無法連線至登入提供者")
+		return
+	}
+
+	// 清除過期的登入狀態
+	h.db.Where("expires_at < ?", time.Now()).Delete(&models.OIDCAuthState{})
+
+	if err := h.db.Create(&models.OIDCAuthState{
+		StateHash:    auth.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}).Error; err != nil {
+		api.InternalServerError(c, "儲存登入狀態失敗")
+		return
+	}
+
+	h.setStateCookie(c, state, int(oidcStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback 驗證提供者回傳的授權碼並登入；未註冊的 email 會建立註冊申請
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		logger.Warn("OIDC provider returned error: %s %s", providerErr, c.Query("error_description"))
+		h.redirect(c, url.Values{"auth_error": {"provider_error"}}, nil)
+		return
+	}
+
+	state := c.Query("state")
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	h.setStateCookie(c, "", -1)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		h.redirect(c, url.Values{"auth_error": {"invalid_state"}}, nil)
+		return
+	}
+
+	authState, err := h.consumeState(state)
+	if err != nil {
+		h.redirect(c, url.Values{"auth_error": {"invalid_state"}}, nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	identity, err := provider.Exchange(ctx, c.Query("code"), authState.CodeVerifier, authState.Nonce)
+	if err != nil {
+		if errors.Is(err, auth.ErrOIDCEmailNotAllowed) {
+			h.redirect(c, url.Values{"auth_error": {"email_not_allowed"}}, nil)
+			return
+		}
+		logger.Warn("OIDC login failed: %v", err)
+		h.redirect(c, url.Values{"auth_error": {"login_failed"}}, nil)
+		return
+	}
+
+	var user models.User
+	err = h.db.Where("email = ?", identity.Email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		status, err := h.ensureRegistrationRequest(identity)
+		if err != nil {
+			h.redirect(c, url.Values{"auth_error": {"server_error"}}, nil)
+			return
+		}
+		h.redirect(c, url.Values{"auth_status": {"registration_" + status}, "email": {identity.Email}}, nil)
+		return
+	}
+	if err != nil {
+		h.redirect(c, url.Values{"auth_error": {"server_error"}}, nil)
+		return
+	}
+
+	if user.Status != "approved" {
+		h.redirect(c, url.Values{"auth_status": {user.Status}, "email": {user.Email}}, nil)
+		return
+	}
+
+	tokenPair, err := auth.NewSessionManager(h.db, h.cfg.Auth).IssueTokens(&user, sessionMeta(c))
+	if err != nil {
+		h.redirect(c, url.Values{"auth_error": {"server_error"}}, nil)
+		return
+	}
+	h.db.Model(&user).Update("last_login_at", time.Now())
+
+	// 令牌放在 fragment，不會送到伺服器或出現在存取日誌
+	h.redirect(c, nil, url.Values{
+		"access_token":  {tokenPair.AccessToken},
+		"refresh_token": {tokenPair.RefreshToken},
+		"expires_in":    {strconv.FormatInt(tokenPair.ExpiresIn, 10)},
+		"token_type":    {tokenPair.TokenType},
+	})
+}
+
+// ensureRegistrationRequest 為未註冊的 email 建立註冊申請，已存在時返回其狀態
+func (h *OIDCHandler) ensureRegistrationRequest(identity *auth.OIDCIdentity) (string, error) {
+	var existing models.UserRegistrationRequest
+	err := h.db.Where("email = ?", identity.Email).First(&existing).Error
+	if err == nil {
+		return existing.Status, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+
+	request := models.UserRegistrationRequest{
+		Email:  identity.Email,
+		Name:   identity.Name,
+		Status: "pending",
+	}
+	if err := h.db.Create(&request).Error; err != nil {
+		return "", err
+	}
+	logger.Info("OIDC 登入建立註冊申請: %s", identity.Email)
+	return request.Status, nil
+}
+
+// consumeState 取出並刪除登入狀態，每個 state 只能使用一次
+func (h *OIDCHandler) consumeState(state string) (*models.OIDCAuthState, error) {
+	var authState models.OIDCAuthState
+	if err := h.db.Where("state_hash = ?", auth.HashToken(state)).First(&authState).Error; err != nil {
+		return nil, err
+	}
+
+	res := h.db.Where("id = ?", authState.ID).Delete(&models.OIDCAuthState{})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 || time.Now().After(authState.ExpiresAt) {
+		return nil, errors.New("oidc state expired or already used")
+	}
+	return &authState, nil
+}
+
+// provider 取得 OIDC 提供者，未啟用時返回 404
+func (h *OIDCHandler) provider(c *gin.Context) (*auth.OIDCProvider, bool) {
+	if h.cfg.Auth.Provider != config.AuthProviderOIDC {
+		api.Error(c, http.StatusNotFound, "OIDC_DISABLED", "未啟用 OIDC 登入")
+		return nil, false
+	}
+	provider, err := auth.OIDCProviderFor(h.cfg.OIDC)
+	if err != nil {
+		api.Error(c, http.StatusServiceUnavailable, "OIDC_NOT_CONFIGURED", "OIDC 登入尚未設定")
+		return nil, false
+	}
+	return provider, true
+}
+
+// setStateCookie 設定或清除（maxAge < 0）登入狀態 Cookie
+func (h *OIDCHandler) setStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, "/api/auth/oidc", "", secure, true)
+}
+
+// redirect 導回前端，query 放狀態資訊，fragment 放令牌
+func (h *OIDCHandler) redirect(c *gin.Context, query, fragment url.Values) {
+	target, err := url.Parse(h.cfg.OIDC.PostLoginRedirect)
+	if err != nil {
+		target = &url.URL{Path: "/"}
+	}
+	if len(query) > 0 {
+		values := target.Query()
+		for key, vals := range query {
+			values[key] = vals
+		}
+		target.RawQuery = values.Encode()
+	}
+	if len(fragment) > 0 {
+		target.Fragment = ""
+		target.RawFragment = ""
+		c.Redirect(http.StatusFound, target.String()+"#"+fragment.Encode())
+		return
+	}
+	c.Redirect(http.StatusFound, target.String())
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/auth"
+	"memoryark/internal/config"
+	"memoryark/internal/models"
+	"memoryark/pkg/api"
+)
+
+// RoleHandler 角色與權限處理器
+type RoleHandler struct {
+	db        *gorm.DB
+	cfg       *config.Config
+	wsHandler interface{} // WebSocket 處理器
+}
+
+// NewRoleHandler 創建角色處理器
+func NewRoleHandler(db *gorm.DB, cfg *config.Config) *RoleHandler {
+	return &RoleHandler{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+// roleNamePattern 角色名稱僅允許小寫英數字與連字號
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{1,49}$`)
+
+// RoleRequest 建立或修改角色請求
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	DisplayName string   `json:"display_name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// validatePermissions 檢查權限清單並去除重複
+func validatePermissions(permissions []string) ([]string, error) {
+	seen := map[string]bool{}
+	result := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		p = strings.TrimSpace(p)
+		if p == "" || seen[p] {
+			continue
+		}
+		if !models.IsKnownPermission(p) {
+			return nil, fmt.Errorf("未知的權限: %s", p)
+		}
+		seen[p] = true
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// SetWebSocketHandler 設置 WebSocket 處理器
+func (h *RoleHandler) SetWebSocketHandler(wsHandler interface{}) {
+	h.wsHandler = wsHandler
+}
+
+// refreshUserConnections 通知 WebSocket 重新檢查指定用戶的即時連線權限
+func refreshUserConnections(wsHandler interface{}, userID uint) {
+	if handler, ok := wsHandler.(interface{ RefreshUserPermissions(userID uint) }); ok {
+		handler.RefreshUserPermissions(userID)
+	}
+}
+
+// refreshAllConnections 通知 WebSocket 重新檢查所有即時連線權限
+func refreshAllConnections(wsHandler interface{}) {
+	if handler, ok := wsHandler.(interface{ RefreshAllPermissions() }); ok {
+		handler.RefreshAllPermissions()
+	}
+}
+
+// GetPermissions 獲取所有可指派的權限
+func (h *RoleHandler) GetPermissions(c *gin.Context) {
+	api.Success(c, models.AllPermissions)
+}
+
+// GetRoles 獲取角色列表（含使用人數）
+func (h *RoleHandler) GetRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := h.db.Order("id ASC").Find(&roles).Error; err != nil {
+		api.InternalServerError(c, "查詢角色失敗")
+		return
+	}
+
+	for i := range roles {
+		h.db.Model(&models.User{}).Where("role = ?", roles[i].Name).Count(&roles[i].UserCount)
+	}
+
+	api.Success(c, roles)
+}
+
+// CreateRole 建立角色
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "請求格式不正確")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if !roleNamePattern.MatchString(req.Name) {
+		api.BadRequest(c, "角色名稱只能包含小寫英文、數字與連字號")
+		return
+	}
+
+	permissions, err := validatePermissions(req.Permissions)
+	if err != nil {
+		api.BadRequest(c, err.Error())
+		return
+	}
+
+	var count int64
+	h.db.Model(&models.Role{}).Where("name = ?", req.Name).Count(&count)
+	if count > 0 {
+		api.Error(c, http.StatusConflict, "ROLE_EXISTS", "角色名稱已存在")
+		return
+	}
+
+	role := models.Role{
+		Name:        req.Name,
+		DisplayName: req.DisplayName,
+		Description: req.Description,
+		Permissions: permissions,
+	}
+	if err := h.db.Create(&role).Error; err != nil {
+		api.InternalServerError(c, "建立角色失敗")
+		return
+	}
+
+	auth.InvalidateRoleCache()
+	api.SuccessWithMessage(c, role, "角色建立成功")
+}
+
+// UpdateRole 修改角色的顯示名稱、說明與權限
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	var role models.Role
+	if err := h.db.First(&role, c.Param("id")).Error; err != nil {
+		api.NotFound(c, "角色")
+		return
+	}
+
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "請求格式不正確")
+		return
+	}
+
+	if req.DisplayName != "" {
+		role.DisplayName = req.DisplayName
+	}
+	if req.Description != "" {
+		role.Description = req.Description
+	}
+
+	if req.Permissions != nil {
+		// 管理員角色必須保留完整權限，避免系統被鎖死
+		if role.Name == "admin" {
+			api.Forbidden(c, "無法修改管理員角色的權限")
+			return
+		}
+		permissions, err := validatePermissions(req.Permissions)
+		if err != nil {
+			api.BadRequest(c, err.Error())
+			return
+		}
+		role.Permissions = permissions
+	}
+
+	if err := h.db.Save(&role).Error; err != nil {
+		api.InternalServerError(c, "更新角色失敗")
+		return
+	}
+
+	auth.InvalidateRoleCache()
+	refreshAllConnections(h.wsHandler)
+	api.SuccessWithMessage(c, role, "角色更新成功")
+}
+
+// DeleteRole 刪除未使用的自訂角色
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	var role models.Role
+	if err := h.db.First(&role, c.Param("id")).Error; err != nil {
+		api.NotFound(c, "角色")
+		return
+	}
+
+	if role.IsSystem {
+		api.Forbidden(c, "系統角色無法刪除")
+		return
+	}
+
+	var userCount int64
+	h.db.Model(&models.User{}).Where("role = ?", role.Name).Count(&userCount)
+	if userCount > 0 {
+		api.Error(c, http.StatusConflict, "ROLE_IN_USE", fmt.Sprintf("仍有 %d 位用戶使用此角色", userCount))
+		return
+	}
+
+	if err := h.db.Delete(&role).Error; err != nil {
+		api.InternalServerError(c, "刪除角色失敗")
+		return
+	}
+
+	auth.InvalidateRoleCache()
+	api.SuccessWithMessage(c, nil, "角色已刪除")
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/auth"
+	"memoryark/internal/config"
+	"memoryark/internal/models"
+	"memoryark/pkg/api"
+)
+
+const (
+	// defaultServiceTokenOverlap 輪替後舊令牌預設保留的時間
+	defaultServiceTokenOverlap = time.Hour
+	// maxServiceTokenOverlap 輪替後舊令牌最長保留的時間
+	maxServiceTokenOverlap = 7 * 24 * time.Hour
+)
+
+// serviceClientNamePattern 服務名稱僅允許小寫英數字、底線與連字號
+var serviceClientNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,99}$`)
+
+// ServiceTokenHandler 服務令牌管理處理器
+type ServiceTokenHandler struct {
+	db  *gorm.DB
+	cfg *config.Config
+}
+
+// NewServiceTokenHandler 創建服務令牌管理處理器
+func NewServiceTokenHandler(db *gorm.DB, cfg *config.Config) *ServiceTokenHandler {
+	return &ServiceTokenHandler{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+// ServiceTokenRequest 建立或修改服務令牌請求
+type ServiceTokenRequest struct {
+	ClientName  string   `json:"client_name"`
+	Description *string  `json:"description"`
+	Scopes      []string `json:"scopes"`
+	AllowedIPs  []string `json:"allowed_ips"`
+	IsActive    *bool    `json:"is_active"`
+}
+
+// RotateServiceTokenRequest 輪替服務令牌請求
+type RotateServiceTokenRequest struct {
+	OverlapMinutes *int `json:"overlap_minutes"` // 舊令牌繼續有效的分鐘數，0 表示立即失效
+}
+
+// GetServiceTokens 獲取服務令牌列表（不含令牌內容）
+func (h *ServiceTokenHandler) GetServiceTokens(c *gin.Context) {
+	var tokens []models.ServiceToken
+	if err := h.db.Order("client_name ASC").Find(&tokens).Error; err != nil {
+		api.InternalServerError(c, "查詢服務令牌失敗")
+		return
+	}
+
+	api.Success(c, gin.H{
+		"tokens": tokens,
+		"scopes": models.AllServiceScopes,
+	})
+}
+
+// CreateServiceToken 建立服務令牌，令牌內容只在此回應中顯示一次
+func (h *ServiceTokenHandler) CreateServiceToken(c *gin.Context) {
+	var req ServiceTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "請求格式不正確")
+		return
+	}
+
+	req.ClientName = strings.TrimSpace(req.ClientName)
+	if !serviceClientNamePattern.MatchString(req.ClientName) {
+		api.BadRequest(c, "服務名稱只能包含小寫英文、數字、底線與連字號")
+		return
+	}
+
+	scopes, err := validateServiceScopes(req.Scopes)
+	if err != nil {
+		api.BadRequest(c, err.Error())
+		return
+	}
+	allowedIPs, err := validateIPAllowlist(req.AllowedIPs)
+	if err != nil {
+		api.BadRequest(c, err.Error())
+		return
+	}
+
+	var count int64
+	h.db.Model(&models.ServiceToken{}).Where("client_name = ?", req.ClientName).Count(&count)
+	if count > 0 {
+		api.Error(c, http.StatusConflict, "SERVICE_TOKEN_EXISTS", "服務名稱已存在")
+		return
+	}
+
+	raw, err := auth.GenerateServiceToken()
+	if err != nil {
+		api.InternalServerError(c, "產生服務令牌失敗")
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	token := models.ServiceToken{
+		ClientName:  req.ClientName,
+		TokenPrefix: raw[:len(auth.ServiceTokenPrefix)+4],
+		TokenHash:   auth.HashToken(raw),
+		Scopes:      scopes,
+		AllowedIPs:  allowedIPs,
+		IsActive:    true,
+		CreatedBy:   &userID,
+	}
+	if req.Description != nil {
+		token.Description = *req.Description
+	}
+	if err := h.db.Create(&token).Error; err != nil {
+		api.InternalServerError(c, "建立服務令牌失敗")
+		return
+	}
+
+	api.SuccessWithMessage(c, gin.H{
+		"token":         raw,
+		"service_token": token,
+	}, "服務令牌已建立，請立即複製保存，之後將無法再次查看")
+}
+
+// UpdateServiceToken 修改服務令牌的說明、範圍、IP 允許清單與啟用狀態
+func (h *ServiceTokenHandler) UpdateServiceToken(c *gin.Context) {
+	var token models.ServiceToken
+	if err := h.db.First(&token, c.Param("id")).Error; err != nil {
+		api.NotFound(c, "服務令牌")
+		return
+	}
+
+	var req ServiceTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "請求格式不正確")
+		return
+	}
+
+	if req.Description != nil {
+		token.Description = *req.Description
+	}
+	if req.Scopes != nil {
+		scopes, err := validateServiceScopes(req.Scopes)
+		if err != nil {
+			api.BadRequest(c, err.Error())
+			return
+		}
+		token.Scopes = scopes
+	}
+	if req.AllowedIPs != nil {
+		allowedIPs, err := validateIPAllowlist(req.AllowedIPs)
+		if err != nil {
+			api.BadRequest(c, err.Error())
+			return
+		}
+		token.AllowedIPs = allowedIPs
+	}
+	if req.IsActive != nil {
+		token.IsActive = *req.IsActive
+	}
+
+	if err := h.db.Save(&token).Error; err != nil {
+		api.InternalServerError(c, "更新服務令牌失敗")
+		return
+	}
+
+	api.SuccessWithMessage(c, token, "服務令牌已更新")
+}
+
+// RotateServiceToken 產生新的服務令牌，舊令牌在重疊期間內仍可使用
+func (h *ServiceTokenHandler) RotateServiceToken(c *gin.Context) {
+	var token models.ServiceToken
+	if err := h.db.First(&token, c.Param("id")).Error; err != nil {
+		api.NotFound(c, "服務令牌")
+		return
+	}
+
+	var req RotateServiceTokenRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			api.BadRequest(c, "請求格式不正確")
+			return
+		}
+	}
+
+	overlap := defaultServiceTokenOverlap
+	if req.OverlapMinutes != nil {
+		overlap = time.Duration(*req.OverlapMinutes) * time.Minute
+	}
+	if overlap < 0 || overlap > maxServiceTokenOverlap {
+		api.BadRequest(c, fmt.Sprintf("重疊時間需介於 0 到 %d 分鐘", int(maxServiceTokenOverlap.Minutes())))
+		return
+	}
+
+	raw, err := auth.GenerateServiceToken()
+	if err != nil {
+		api.InternalServerError(c, "產生服務令牌失敗")
+		return
+	}
+
+	now := time.Now()
+	token.PreviousTokenHash = ""
+	token.PreviousExpiresAt = nil
+	if overlap > 0 {
+		expiresAt := now.Add(overlap)
+		token.PreviousTokenHash = token.TokenHash
+		token.PreviousExpiresAt = &expiresAt
+	}
+	token.TokenHash = auth.HashToken(raw)
+	token.TokenPrefix = raw[:len(auth.ServiceTokenPrefix)+4]
+	token.RotatedAt = &now
+
+	if err := h.db.Save(&token).Error; err != nil {
+		api.InternalServerError(c, "輪替服務令牌失敗")
+		return
+	}
+
+	api.SuccessWithMessage(c, gin.H{
+		"token":         raw,
+		"service_token": token,
+	}, "服務令牌已輪替，請立即更新服務設定")
+}
+
+// DeleteServiceToken 刪除服務令牌，立即失效
+func (h *ServiceTokenHandler) DeleteServiceToken(c *gin.Context) {
+	var token models.ServiceToken
+	if err := h.db.First(&token, c.Param("id")).Error; err != nil {
+		api.NotFound(c, "服務令牌")
+		return
+	}
+
+	if err := h.db.Delete(&token).Error; err != nil {
+		api.InternalServerError(c, "刪除服務令牌失敗")
+		return
+	}
+
+	api.SuccessWithMessage(c, nil, "服務令牌已刪除")
+}
+
+// validateServiceScopes 檢查服務令牌範圍並去除重複
+func validateServiceScopes(scopes []string) (models.StringList, error) {
+	seen := map[string]bool{}
+	result := models.StringList{}
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || seen[scope] {
+			continue
+		}
+		if !models.IsKnownServiceScope(scope) {
+			return nil, fmt.Errorf("未知的服務範圍: %s", scope)
+		}
+		seen[scope] = true
+		result = append(result, scope)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("至少需要一個服務範圍")
+	}
+	return result, nil
+}
+
+// validateIPAllowlist 檢查 IP 允許清單，每一項需為 IP 或 CIDR
+func validateIPAllowlist(entries []string) (models.StringList, error) {
+	result := models.StringList{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return nil, fmt.Errorf("無效的 CIDR: %s", entry)
+			}
+		} else if net.ParseIP(entry) == nil {
+			return nil, fmt.Errorf("無效的 IP: %s", entry)
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
@@ -0,0 +1,507 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"memoryark/internal/config"
+	"memoryark/internal/middleware"
+	"memoryark/internal/models"
+	"memoryark/pkg/api"
+)
+
+// UploadLinkHandler 訪客上傳連結處理器
+type UploadLinkHandler struct {
+	db    *gorm.DB
+	cfg   *config.Config
+	files *FileHandler // 共用上傳驗證、去重與廣播邏輯
+}
+
+// NewUploadLinkHandler 創建訪客上傳連結處理器
+func NewUploadLinkHandler(db *gorm.DB, cfg *config.Config, fileHandler *FileHandler) *UploadLinkHandler {
+	return &UploadLinkHandler{
+		db:    db,
+		cfg:   cfg,
+		files: fileHandler,
+	}
+}
+
+// CreateUploadLinkRequest 建立訪客上傳連結請求
+type CreateUploadLinkRequest struct {
+	FolderID       uint       `json:"folder_id" binding:"required"`
+	Title          string     `json:"title"`
+	Description    string     `json:"description"`
+	CategoryID     *uint      `json:"category_id"`
+	Password       string     `json:"password"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	ExpiresInHours *int       `json:"expires_in_hours"`
+	MaxFiles       *int       `json:"max_files"`
+	MaxFileSize    *int64     `json:"max_file_size"`
+	MaxTotalSize   *int64     `json:"max_total_size"`
+	RequireReview  bool       `json:"require_review"`
+}
+
+// ReviewGuestUploadsRequest 審核訪客上傳請求
+type ReviewGuestUploadsRequest struct {
+	FileIDs []uint `json:"file_ids" binding:"required,min=1"`
+	Action  string `json:"action" binding:"required,oneof=approve reject"`
+}
+
+// generateUploadLinkToken 產生隨機的連結 token
+func generateUploadLinkToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// CreateUploadLink 建立訪客上傳連結
+func (h *UploadLinkHandler) CreateUploadLink(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		api.Unauthorized(c, "未授權訪問")
+		return
+	}
+
+	var req CreateUploadLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "請求格式不正確: "+err.Error())
+		return
+	}
+
+	// 目標資料夾必須存在且未被刪除
+	var folder models.File
+	if err := h.db.Where("id = ? AND is_directory = ? AND is_deleted = ?", req.FolderID, true, false).
+		First(&folder).Error; err != nil {
+		api.NotFound(c, "目標資料夾")
+		return
+	}
+
+	if (req.MaxFiles != nil && *req.MaxFiles <= 0) ||
+		(req.MaxFileSize != nil && *req.MaxFileSize <= 0) ||
+		(req.MaxTotalSize != nil && *req.MaxTotalSize <= 0) {
+		api.BadRequest(c, "上傳限制必須大於 0")
+		return
+	}
+
+	expiresAt := req.ExpiresAt
+	if expiresAt == nil && req.ExpiresInHours != nil && *req.ExpiresInHours > 0 {
+		t := time.Now().Add(time.Duration(*req.ExpiresInHours) * time.Hour)
+		expiresAt = &t
+	}
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		api.BadRequest(c, "過期時間必須晚於現在")
+		return
+	}
+
+	token, err := generateUploadLinkToken()
+	if err != nil {
+		api.InternalServerError(c, "產生連結失敗")
+		return
+	}
+
+	link := models.UploadLink{
+		Token:         token,
+		Title:         strings.TrimSpace(req.Title),
+		Description:   req.Description,
+		FolderID:      folder.ID,
+		CategoryID:    req.CategoryID,
+		CreatedBy:     userID.(uint),
+		ExpiresAt:     expiresAt,
+		MaxFiles:      req.MaxFiles,
+		MaxFileSize:   req.MaxFileSize,
+		MaxTotalSize:  req.MaxTotalSize,
+		RequireReview: req.RequireReview,
+		IsActive:      true,
+	}
+	if link.Title == "" {
+		link.Title = folder.Name
+	}
+
+	if req.Password != "" {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			api.InternalServerError(c, "設定連結密碼失敗")
+			return
+		}
+		link.PasswordHash = string(hashed)
+	}
+
+	if err := h.db.Create(&link).Error; err != nil {
+		api.InternalServerError(c, "建立上傳連結失敗")
+		return
+	}
+	link.HasPassword = link.PasswordHash != ""
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "訪客上傳連結已建立",
+		"data": gin.H{
+			"link":       link,
+			"upload_url": fmt.Sprintf("/api/public/upload/%s", link.Token),
+		},
+	})
+}
+
+// GetUploadLinks 獲取目前用戶建立的訪客上傳連結
+func (h *UploadLinkHandler) GetUploadLinks(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var links []models.UploadLink
+	if err := h.db.Preload("Folder").Where("created_by = ?", userID).
+		Order("created_at DESC").Find(&links).Error; err != nil {
+		api.InternalServerError(c, "查詢上傳連結失敗")
+		return
+	}
+
+	for i := range links {
+		links[i].HasPassword = links[i].PasswordHash != ""
+	}
+
+	api.Success(c, links)
+}
+
+// RevokeUploadLink 停用訪客上傳連結
+func (h *UploadLinkHandler) RevokeUploadLink(c *gin.Context) {
+	link, ok := h.loadManagedLink(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Model(link).Update("is_active", false).Error; err != nil {
+		api.InternalServerError(c, "停用上傳連結失敗")
+		return
+	}
+
+	api.SuccessWithMessage(c, nil, "上傳連結已停用")
+}
+
+// GetPendingUploads 獲取連結中等待審核的訪客上傳
+func (h *UploadLinkHandler) GetPendingUploads(c *gin.Context) {
+	link, ok := h.loadManagedLink(c)
+	if !ok {
+		return
+	}
+
+	var files []models.File
+	if err := h.db.Where("upload_link_id = ? AND review_status = ? AND is_deleted = ?",
+		link.ID, models.ReviewStatusPending, false).
+		Order("created_at ASC").Find(&files).Error; err != nil {
+		api.InternalServerError(c, "查詢待審核檔案失敗")
+		return
+	}
+
+	api.Success(c, files)
+}
+
+// ReviewUploads 核准或拒絕訪客上傳的檔案
+func (h *UploadLinkHandler) ReviewUploads(c *gin.Context) {
+	link, ok := h.loadManagedLink(c)
+	if !ok {
+		return
+	}
+	reviewerID := c.GetUint("user_id")
+
+	var req ReviewGuestUploadsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "請求格式不正確: "+err.Error())
+		return
+	}
+
+	var files []models.File
+	if err := h.db.Where("id IN ? AND upload_link_id = ? AND review_status = ?",
+		req.FileIDs, link.ID, models.ReviewStatusPending).Find(&files).Error; err != nil {
+		api.InternalServerError(c, "查詢待審核檔案失敗")
+		return
+	}
+	if len(files) == 0 {
+		api.Error(c, http.StatusNotFound, api.ErrFileNotFound, "沒有可審核的檔案")
+		return
+	}
+
+	ids := make([]uint, 0, len(files))
+	for _, f := range files {
+		ids = append(ids, f.ID)
+	}
+
+	updates := map[string]interface{}{"review_status": models.ReviewStatusApproved}
+	if req.Action == "reject" {
+		// 拒絕的檔案移至垃圾桶，保留復原的機會
+		now := time.Now()
+		updates = map[string]interface{}{
+			"review_status": models.ReviewStatusRejected,
+			"is_deleted":    true,
+			"deleted_at":    &now,
+			"deleted_by":    reviewerID,
+		}
+	}
+
+	if err := h.db.Model(&models.File{}).Where("id IN ?", ids).Updates(updates).Error; err != nil {
+		api.InternalServerError(c, "更新審核狀態失敗")
+		return
+	}
+	if req.Action == "reject" {
+		h.files.refreshFolderStats(h.db, &link.FolderID)
+	}
+
+	if req.Action == "approve" {
+		folderID := int(link.FolderID)
+		for _, f := range files {
+			h.files.broadcastFileEvent("upload", &folderID, fmt.Sprintf("訪客上傳的檔案 '%s' 已核准", f.Name), gin.H{
+				"fileId":     f.ID,
+				"fileName":   f.Name,
+				"fileSize":   f.FileSize,
+				"uploadedBy": f.UploadedBy,
+				"guestName":  f.GuestName,
+			})
+		}
+	}
+
+	api.Success(c, gin.H{
+		"action":      req.Action,
+		"reviewed":    len(ids),
+		"file_ids":    ids,
+		"upload_link": link.ID,
+	})
+}
+
+// loadManagedLink 讀取連結並確認目前用戶為建立者或具備 upload_links.manage 權限
+func (h *UploadLinkHandler) loadManagedLink(c *gin.Context) (*models.UploadLink, bool) {
+	var link models.UploadLink
+	if err := h.db.First(&link, c.Param("id")).Error; err != nil {
+		api.NotFound(c, "上傳連結")
+		return nil, false
+	}
+
+	if link.CreatedBy != c.GetUint("user_id") &&
+		!middleware.HasPermission(h.db, c, models.PermUploadLinksManage) {
+		api.Forbidden(c, "無權限管理此上傳連結")
+		return nil, false
+	}
+
+	return &link, true
+}
+
+// loadActiveLink 依 token 讀取仍可使用的連結
+func (h *UploadLinkHandler) loadActiveLink(c *gin.Context) (*models.UploadLink, bool) {
+	var link models.UploadLink
+	if err := h.db.Preload("Folder").Where("token = ?", c.Param("token")).First(&link).Error; err != nil {
+		api.NotFound(c, "上傳連結")
+		return nil, false
+	}
+
+	if !link.IsActive || link.IsExpired() {
+		api.Error(c, http.StatusGone, "LINK_EXPIRED", "上傳連結已失效")
+		return nil, false
+	}
+
+	if link.Folder == nil || link.Folder.IsDeleted {
+		api.Error(c, http.StatusGone, "FOLDER_UNAVAILABLE", "目標資料夾已不存在")
+		return nil, false
+	}
+
+	return &link, true
+}
+
+// GetPublicUploadLink 訪客查看上傳連結資訊
+func (h *UploadLinkHandler) GetPublicUploadLink(c *gin.Context) {
+	link, ok := h.loadActiveLink(c)
+	if !ok {
+		return
+	}
+
+	var remainingFiles *int
+	if link.MaxFiles != nil {
+		remaining := *link.MaxFiles - link.UploadedCount
+		if remaining < 0 {
+			remaining = 0
+		}
+		remainingFiles = &remaining
+	}
+
+	maxFileSize := maxUploadFileSize
+	if link.MaxFileSize != nil && *link.MaxFileSize < maxFileSize {
+		maxFileSize = *link.MaxFileSize
+	}
+
+	api.Success(c, gin.H{
+		"title":           link.Title,
+		"description":     link.Description,
+		"folder_name":     link.Folder.Name,
+		"expires_at":      link.ExpiresAt,
+		"has_password":    link.PasswordHash != "",
+		"max_file_size":   maxFileSize,
+		"max_total_size":  link.MaxTotalSize,
+		"remaining_files": remainingFiles,
+		"require_review":  link.RequireReview,
+	})
+}
+
+// GuestUpload 訪客透過上傳連結上傳檔案（歸屬於連結建立者）
+func (h *UploadLinkHandler) GuestUpload(c *gin.Context) {
+	link, ok := h.loadActiveLink(c)
+	if !ok {
+		return
+	}
+
+	// 驗證連結密碼
+	if link.PasswordHash != "" {
+		password := c.PostForm("password")
+		if password == "" {
+			password = c.GetHeader("X-Upload-Password")
+		}
+		if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+			api.Unauthorized(c, "上傳連結密碼錯誤")
+			return
+		}
+	}
+
+	guestName := strings.TrimSpace(c.PostForm("guest_name"))
+	if guestName == "" {
+		api.BadRequest(c, "請填寫上傳者名稱")
+		return
+	}
+	if len([]rune(guestName)) > 100 {
+		api.BadRequest(c, "上傳者名稱過長")
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "NO_FILE", "沒有選擇檔案")
+		return
+	}
+
+	maxSize := maxUploadFileSize
+	if link.MaxFileSize != nil && *link.MaxFileSize < maxSize {
+		maxSize = *link.MaxFileSize
+	}
+	if verr := validateUploadFile(file, maxSize); verr != nil {
+		api.Error(c, http.StatusBadRequest, verr.Code, verr.Message)
+		return
+	}
+
+	sha256Hash, err := hashUploadedFile(file)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "HASH_CALCULATION_ERROR", "計算檔案雜湊值失敗")
+		return
+	}
+
+	// 相同位置 + 相同檔名 + 相同內容 = 跳過上傳
+	if sameFile, err := h.files.checkSameLocationAndName(file.Filename, &link.FolderID, link.CreatedBy); err == nil &&
+		sameFile.SHA256Hash == sha256Hash {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"skipped": true,
+			"message": "檔案已存在，跳過上傳",
+		})
+		return
+	}
+
+	// 去重：相同內容沿用既有的實體檔案
+	deduplicated := false
+	var physicalPath string
+	if existing, err := h.files.findBlobByHash(sha256Hash); err == nil {
+		physicalPath = existing.FilePath
+		deduplicated = true
+	} else {
+		physicalPath, err = h.files.storeUploadedBlob(c, file, sha256Hash)
+		if err != nil {
+			api.Error(c, http.StatusInternalServerError, "SAVE_FAILED", "儲存檔案失敗")
+			return
+		}
+	}
+
+	reviewStatus := ""
+	if link.RequireReview {
+		reviewStatus = models.ReviewStatusPending
+	}
+
+	fileRecord := models.File{
+		Name:         file.Filename,
+		OriginalName: file.Filename,
+		FilePath:     physicalPath,
+		VirtualPath:  h.files.buildVirtualPath(&link.FolderID, file.Filename),
+		SHA256Hash:   sha256Hash,
+		FileSize:     file.Size,
+		MimeType:     file.Header.Get("Content-Type"),
+		ParentID:     &link.FolderID,
+		CategoryID:   link.CategoryID,
+		UploadedBy:   link.CreatedBy,
+		Tags:         "guest:" + guestName,
+		UploadLinkID: &link.ID,
+		GuestName:    guestName,
+		ReviewStatus: reviewStatus,
+	}
+
+	errLimitReached := fmt.Errorf("upload link limit reached")
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// 以條件式更新佔用名額，避免同時上傳超過限制
+		result := tx.Model(&models.UploadLink{}).
+			Where("id = ? AND (max_files IS NULL OR uploaded_count < max_files)", link.ID).
+			Where("max_total_size IS NULL OR uploaded_size + ? <= max_total_size", file.Size).
+			Updates(map[string]interface{}{
+				"uploaded_count": gorm.Expr("uploaded_count + 1"),
+				"uploaded_size":  gorm.Expr("uploaded_size + ?", file.Size),
+				"last_used_at":   time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errLimitReached
+		}
+		return tx.Create(&fileRecord).Error
+	})
+	if err != nil {
+		if !deduplicated {
+			os.Remove(physicalPath)
+		}
+		if err == errLimitReached {
+			api.Error(c, http.StatusForbidden, "UPLOAD_LIMIT_REACHED", "已達上傳連結的數量或容量限制")
+			return
+		}
+		api.Error(c, http.StatusInternalServerError, api.ErrDatabaseError, "創建檔案記錄失敗")
+		return
+	}
+	h.files.refreshFolderStats(h.db, fileRecord.ParentID)
+
+	// 待審核的檔案不廣播，避免在核准前曝光
+	if reviewStatus != models.ReviewStatusPending {
+		folderID := int(link.FolderID)
+		h.files.broadcastFileEvent("upload", &folderID, fmt.Sprintf("訪客 '%s' 上傳了檔案 '%s'", guestName, file.Filename), gin.H{
+			"fileId":       fileRecord.ID,
+			"fileName":     fileRecord.Name,
+			"fileSize":     fileRecord.FileSize,
+			"uploadedBy":   fileRecord.UploadedBy,
+			"guestName":    guestName,
+			"deduplicated": deduplicated,
+		})
+	}
+
+	message := "檔案上傳成功"
+	if reviewStatus == models.ReviewStatusPending {
+		message = "檔案上傳成功，等待審核"
+	}
+
+	// 訪客只需要知道上傳結果，不返回內部路徑等資訊
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": message,
+		"data": gin.H{
+			"fileName":      fileRecord.Name,
+			"size":          fileRecord.FileSize,
+			"pendingReview": reviewStatus == models.ReviewStatusPending,
+		},
+	})
+}
@@ -6,7 +6,9 @@ import (
 	
 	"memoryark/internal/config"
 	"memoryark/internal/middleware"
+	"memoryark/internal/models"
 	"memoryark/internal/api/handlers"
+	"memoryark/internal/services"
 	"memoryark/internal/websocket"
 )
 
@@ -25,14 +27,42 @@ func SetupRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
 	
 	// 初始化處理器
 	authHandler := handlers.NewAuthHandler(db, cfg)
-	wsHandler := websocket.NewWebSocketHandler()
+	wsHandler := websocket.NewWebSocketHandler(db, cfg)
 	fileHandler := handlers.NewFileHandler(db, cfg)
 	fileHandler.SetWebSocketHandler(wsHandler)
 	categoryHandler := handlers.NewCategoryHandler(db, cfg)
 	exportHandler := handlers.NewExportHandler(db, cfg)
 	// userHandler := handlers.NewUserHandler(db, cfg)
 	adminHandler := handlers.NewAdminHandler(db, cfg)
+	adminHandler.SetWebSocketHandler(wsHandler)
 	lineHandler := handlers.NewLineHandler(db)
+	uploadLinkHandler := handlers.NewUploadLinkHandler(db, cfg, fileHandler)
+	roleHandler := handlers.NewRoleHandler(db, cfg)
+	roleHandler.SetWebSocketHandler(wsHandler)
+	accessTokenHandler := handlers.NewAccessTokenHandler(db, cfg)
+	serviceTokenHandler := handlers.NewServiceTokenHandler(db, cfg)
+	oidcHandler := handlers.NewOIDCHandler(db, cfg)
+	
+	// 背景工作佇列：大型資料夾的複製、移動、刪除與清空垃圾桶
+	jobQueue := services.NewJobQueue(db, cfg.Jobs.Workers)
+	jobQueue.SetNotifier(wsHandler)
+	fileHandler.SetJobQueue(jobQueue)
+	jobQueue.Start()
+	jobHandler := handlers.NewJobHandler(db, cfg, jobQueue)
+	
+	// 資料夾範本：依排程在聚會前自動建立資料夾
+	folderTemplateHandler := handlers.NewFolderTemplateHandler(db, cfg, fileHandler)
+	services.StartFolderTemplates(db, cfg.FolderTemplates, folderTemplateHandler.RunScheduled)
+	
+	// 權限檢查簡寫
+	requirePerm := func(permissions ...string) gin.HandlerFunc {
+		return middleware.RequirePermission(db, permissions...)
+	}
+	
+	// 操作稽核簡寫（param 為路由中資源識別碼的參數名稱）
+	audit := func(action, resourceType, param string) gin.HandlerFunc {
+		return middleware.Audit(db, action, resourceType, param)
+	}
 	
 	// API 版本分組
 	v1 := router.Group("/api")
@@ -44,82 +74,144 @@ func SetupRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
 		public.HEAD("/health", handlers.HealthCheck)
 		public.GET("/auth/status", authHandler.GetAuthStatus)
 		public.POST("/auth/register", authHandler.Register)
+		public.POST("/auth/login", authHandler.Login)
+		public.POST("/auth/login/code", authHandler.RequestLoginCode)
+		public.POST("/auth/refresh", authHandler.RefreshToken)
+		public.POST("/auth/logout", authHandler.Logout)
+		public.GET("/auth/oidc/login", oidcHandler.Login)
+		public.GET("/auth/oidc/callback", oidcHandler.Callback)
 		public.GET("/features/config", authHandler.GetFeatureConfig)
 		
-		// WebSocket 路由 (開發階段暫時放在公開路由)
-		public.GET("/ws", wsHandler.HandleWebSocket)
+		// 訪客上傳連結（無需帳號）
+		public.GET("/public/upload/:token", uploadLinkHandler.GetPublicUploadLink)
+		public.POST("/public/upload/:token", audit("guest_upload", "file", ""), uploadLinkHandler.GuestUpload)
 	}
 	
 	// 需要認證的路由 (用戶網頁介面)
 	protected := v1.Group("/")
-	protected.Use(middleware.CloudflareAccessMiddleware(cfg, db))
+	protected.Use(middleware.AuthMiddleware(cfg, db))
 
 	// API 專用路由 (服務間通信，如 LINE Service)
 	apiRoutes := v1.Group("/api-access")
-	apiRoutes.Use(middleware.APITokenMiddleware(cfg))
+	apiRoutes.Use(middleware.APITokenMiddleware(cfg, db))
 	{
-		// LINE Service 檔案上傳專用端點
-		apiRoutes.POST("/files/upload", fileHandler.UploadFile)
-		apiRoutes.GET("/files/:id", fileHandler.GetFileDetails)
+		// LINE Service 檔案上傳專用端點（也接受個人存取令牌）
+		apiRoutes.POST("/files/upload", middleware.RequireClientAccess(db, models.ServiceScopeFilesUpload, models.PermFilesUpload), audit("upload", "file", ""), fileHandler.UploadFile)
+		apiRoutes.GET("/files/:id", middleware.RequireClientAccess(db, models.ServiceScopeFilesRead, models.PermFilesRead), fileHandler.GetFileDetails)
 		
 		// LINE 用戶和記錄管理 API (供 LINE Service 調用)
-		apiRoutes.POST("/line/users", lineHandler.SaveLineUser)
-		apiRoutes.POST("/line/upload-records", lineHandler.CreateUploadRecord)
+		apiRoutes.POST("/line/users", middleware.RequireClientAccess(db, models.ServiceScopeLineUsers), lineHandler.SaveLineUser)
+		apiRoutes.POST("/line/upload-records", middleware.RequireClientAccess(db, models.ServiceScopeLineRecords), lineHandler.CreateUploadRecord)
 	}
 
 	{
 		// 認證相關
 		protected.GET("/auth/me", authHandler.GetCurrentUser)
+		protected.PUT("/auth/password", middleware.RequireInteractiveSession(), audit("change_password", "user", ""), authHandler.ChangePassword)
+		
+		// WebSocket 即時事件（依用戶權限過濾）
+		protected.GET("/ws", requirePerm(models.PermFilesRead), wsHandler.HandleWebSocket)
+		
+		// 個人存取令牌
+		protected.GET("/tokens", middleware.RequireInteractiveSession(), accessTokenHandler.GetAccessTokens)
+		protected.POST("/tokens", middleware.RequireInteractiveSession(), audit("create_access_token", "personal_access_token", ""), accessTokenHandler.CreateAccessToken)
+		protected.DELETE("/tokens/:id", middleware.RequireInteractiveSession(), audit("revoke_access_token", "personal_access_token", "id"), accessTokenHandler.RevokeAccessToken)
 		
 		// 檔案管理 - 根據規格書 API 設計
-		protected.GET("/files", fileHandler.GetFiles)
+		protected.GET("/files", requirePerm(models.PermFilesRead), fileHandler.GetFiles)
 		// 檔案搜尋
-		protected.GET("/files/search", fileHandler.SearchFiles)
-		protected.GET("/files/:id", fileHandler.GetFileDetails)
-		protected.POST("/files/upload", fileHandler.UploadFile)
-		protected.POST("/files/batch-upload", fileHandler.BatchUploadFile)
-		protected.PUT("/files/:id", fileHandler.UpdateFile)
-		protected.DELETE("/files/:id", fileHandler.DeleteFile)
-		protected.POST("/files/:id/restore", fileHandler.RestoreFile)
-		protected.DELETE("/files/:id/permanent", fileHandler.PermanentDeleteFile)
-		protected.GET("/files/:id/download", fileHandler.DownloadFile)
-		protected.GET("/files/:id/preview", fileHandler.PreviewFile)
-		protected.POST("/files/:id/share", fileHandler.CreateShareLink)
+		protected.GET("/files/search", requirePerm(models.PermFilesRead), fileHandler.SearchFiles)
+		// 個人的星號、最近項目與釘選資料夾
+		protected.GET("/files/starred", requirePerm(models.PermFilesRead), fileHandler.GetStarredFiles)
+		protected.GET("/files/recent", requirePerm(models.PermFilesRead), fileHandler.GetRecentFiles)
+		// 重複內容報表與合併
+		protected.GET("/files/duplicates", requirePerm(models.PermFilesRead), fileHandler.GetDuplicates)
+		protected.POST("/files/duplicates/merge", requirePerm(models.PermFilesEdit), audit("merge_duplicates", "file", ""), fileHandler.MergeDuplicates)
+		protected.PUT("/files/:id/star", requirePerm(models.PermFilesPersonalize), fileHandler.StarFile)
+		protected.DELETE("/files/:id/star", requirePerm(models.PermFilesPersonalize), fileHandler.UnstarFile)
+		protected.GET("/folders/pinned", requirePerm(models.PermFilesRead), fileHandler.GetPinnedFolders)
+		protected.PUT("/folders/pinned/order", requirePerm(models.PermFilesPersonalize), fileHandler.ReorderPinnedFolders)
+		protected.PUT("/folders/:id/pin", requirePerm(models.PermFilesPersonalize), fileHandler.PinFolder)
+		protected.DELETE("/folders/:id/pin", requirePerm(models.PermFilesPersonalize), fileHandler.UnpinFolder)
+		protected.GET("/files/:id", requirePerm(models.PermFilesRead), fileHandler.GetFileDetails)
+		protected.GET("/files/:id/history", requirePerm(models.PermFilesRead), fileHandler.GetFileHistory)
+		protected.GET("/files/:id/versions", requirePerm(models.PermFilesRead), fileHandler.GetFileVersions)
+		protected.GET("/files/:id/versions/:versionId/download", requirePerm(models.PermFilesRead), fileHandler.DownloadFileVersion)
+		protected.POST("/files/:id/versions/:versionId/restore", requirePerm(models.PermFilesEdit), audit("restore_version", "file", "id"), fileHandler.RestoreFileVersion)
+		protected.POST("/files/upload", requirePerm(models.PermFilesUpload), audit("upload", "file", ""), fileHandler.UploadFile)
+		protected.POST("/files/batch-upload", requirePerm(models.PermFilesUpload), audit("upload", "file", ""), fileHandler.BatchUploadFile)
+		protected.POST("/files/metadata", requirePerm(models.PermFilesEdit), audit("bulk_update_metadata", "file", ""), fileHandler.BulkUpdateMetadata)
+		protected.PUT("/files/:id", requirePerm(models.PermFilesEdit), audit("update", "file", "id"), fileHandler.UpdateFile)
+		protected.DELETE("/files/:id", requirePerm(models.PermFilesDelete), audit("delete", "file", "id"), fileHandler.DeleteFile)
+		protected.POST("/files/:id/restore", requirePerm(models.PermFilesDelete), audit("restore", "file", "id"), fileHandler.RestoreFile)
+		protected.DELETE("/files/:id/permanent", requirePerm(models.PermFilesDeletePermanent), audit("permanent_delete", "file", "id"), fileHandler.PermanentDeleteFile)
+		protected.GET("/files/:id/download", requirePerm(models.PermFilesRead), fileHandler.DownloadFile)
+		protected.GET("/files/:id/preview", requirePerm(models.PermFilesRead), fileHandler.PreviewFile)
+		protected.POST("/files/:id/share", requirePerm(models.PermFilesShare), audit("share", "file", "id"), fileHandler.CreateShareLink)
+		
+		// 按讚與留言
+		protected.GET("/files/:id/likes", requirePerm(models.PermFilesRead), fileHandler.GetFileLikes)
+		protected.PUT("/files/:id/like", requirePerm(models.PermFilesComment), audit("like", "file", "id"), fileHandler.LikeFile)
+		protected.DELETE("/files/:id/like", requirePerm(models.PermFilesComment), audit("unlike", "file", "id"), fileHandler.UnlikeFile)
+		protected.GET("/files/:id/comments", requirePerm(models.PermFilesRead), fileHandler.GetFileComments)
+		protected.POST("/files/:id/comments", requirePerm(models.PermFilesComment), audit("create_comment", "file_comment", ""), fileHandler.CreateFileComment)
+		protected.PUT("/files/:id/comments/:commentId", requirePerm(models.PermFilesComment), audit("update_comment", "file_comment", "commentId"), fileHandler.UpdateFileComment)
+		protected.DELETE("/files/:id/comments/:commentId", requirePerm(models.PermFilesComment), audit("delete_comment", "file_comment", "commentId"), fileHandler.DeleteFileComment)
 		
 		// 分塊上傳 API
-		protected.POST("/files/chunk-init", fileHandler.ChunkUploadInit)
-		protected.POST("/files/chunk-upload", fileHandler.ChunkUpload)
-		protected.POST("/files/chunk-finalize", fileHandler.ChunkUploadFinalize)
-		protected.GET("/files/chunk-status/:sessionId", fileHandler.GetChunkUploadStatus)
+		protected.POST("/files/chunk-init", requirePerm(models.PermFilesUpload), fileHandler.ChunkUploadInit)
+		protected.POST("/files/chunk-upload", requirePerm(models.PermFilesUpload), fileHandler.ChunkUpload)
+		protected.POST("/files/chunk-finalize", requirePerm(models.PermFilesUpload), audit("upload", "file", ""), fileHandler.ChunkUploadFinalize)
+		protected.GET("/files/chunk-status/:sessionId", requirePerm(models.PermFilesUpload), fileHandler.GetChunkUploadStatus)
 		
 		// 儲存空間統計
 		protected.GET("/storage/stats", fileHandler.GetStorageStats)
 		
 		// 垃圾桶管理
-		protected.GET("/trash", fileHandler.GetTrash)
+		protected.GET("/trash", requirePerm(models.PermFilesDelete), fileHandler.GetTrash)
+		protected.POST("/trash/restore", requirePerm(models.PermFilesDelete), audit("restore", "file", ""), fileHandler.BatchRestoreFiles)
+
+		// 檔案操作記錄與復原
+		protected.GET("/operations", requirePerm(models.PermFilesRead), fileHandler.GetFileOperations)
+		protected.POST("/operations/:id/undo", requirePerm(models.PermFilesEdit), audit("undo", "file_operation", "id"), fileHandler.UndoFileOperation)
+		
+		// 背景工作
+		protected.GET("/jobs", requirePerm(models.PermFilesRead), jobHandler.GetJobs)
+		protected.GET("/jobs/:id", requirePerm(models.PermFilesRead), jobHandler.GetJob)
+		protected.POST("/jobs/:id/cancel", requirePerm(models.PermFilesRead), audit("cancel_job", "job", "id"), jobHandler.CancelJob)
 		
 		// 資料夾管理
-		protected.POST("/folders", fileHandler.CreateFolder)
-		protected.PUT("/folders/:id/move", fileHandler.MoveFile)
-		protected.PUT("/folders/:id/rename", fileHandler.RenameFile)
+		protected.POST("/folders", requirePerm(models.PermFilesUpload), audit("create_folder", "file", ""), fileHandler.CreateFolder)
+		protected.PUT("/folders/:id/move", requirePerm(models.PermFilesEdit), audit("move", "file", "id"), fileHandler.MoveFile)
+		protected.PUT("/folders/:id/rename", requirePerm(models.PermFilesEdit), audit("rename", "file", "id"), fileHandler.RenameFile)
+		protected.PUT("/folders/:id/version-retention", requirePerm(models.PermFilesEdit), audit("update_version_retention", "file", "id"), fileHandler.SetFolderVersionRetention)
+		protected.PUT("/folders/:id/legal-hold", requirePerm(models.PermTrashLegalHold), audit("update_legal_hold", "file", "id"), fileHandler.SetFolderLegalHold)
 		
 		// 檔案複製和移動
-		protected.POST("/files/copy", fileHandler.CopyFiles)
-		protected.POST("/files/move", fileHandler.MoveFiles)
+		protected.POST("/files/copy", requirePerm(models.PermFilesEdit), audit("copy", "file", ""), fileHandler.CopyFiles)
+		protected.POST("/files/move", requirePerm(models.PermFilesEdit), audit("move", "file", ""), fileHandler.MoveFiles)
+		
+		// 訪客上傳連結管理
+		protected.GET("/upload-links", requirePerm(models.PermFilesShare), uploadLinkHandler.GetUploadLinks)
+		protected.POST("/upload-links", requirePerm(models.PermFilesShare), audit("create_upload_link", "upload_link", ""), uploadLinkHandler.CreateUploadLink)
+		protected.DELETE("/upload-links/:id", requirePerm(models.PermFilesShare), audit("revoke_upload_link", "upload_link", "id"), uploadLinkHandler.RevokeUploadLink)
+		protected.GET("/upload-links/:id/pending", requirePerm(models.PermFilesShare), uploadLinkHandler.GetPendingUploads)
+		protected.POST("/upload-links/:id/review", requirePerm(models.PermFilesShare), audit("review_upload", "file", ""), uploadLinkHandler.ReviewUploads)
 		
 		// 分類管理
 		protected.GET("/categories", categoryHandler.GetCategories)
 		protected.GET("/categories/:id", categoryHandler.GetCategory)
-		protected.POST("/categories", categoryHandler.CreateCategory)
-		protected.PUT("/categories/:id", categoryHandler.UpdateCategory)
-		protected.DELETE("/categories/:id", categoryHandler.DeleteCategory)
+		protected.POST("/categories", requirePerm(models.PermCategoriesCreate), audit("create_category", "category", ""), categoryHandler.CreateCategory)
+		protected.PUT("/categories/:id", requirePerm(models.PermCategoriesCreate), audit("update_category", "category", "id"), categoryHandler.UpdateCategory)
+		protected.DELETE("/categories/:id", requirePerm(models.PermCategoriesCreate), audit("delete_category", "category", "id"), categoryHandler.DeleteCategory)
+		protected.PUT("/categories/:id/legal-hold", requirePerm(models.PermTrashLegalHold), audit("update_legal_hold", "category", "id"), categoryHandler.SetCategoryLegalHold)
 		
 		
-		protected.GET("/categories/:id/files", categoryHandler.GetCategoryFiles)
+		protected.GET("/categories/:id/files", requirePerm(models.PermFilesRead), categoryHandler.GetCategoryFiles)
 		
 		// 匯出功能
-		protected.POST("/export/stream", exportHandler.StreamExport)
-		protected.GET("/export/quick", exportHandler.QuickStreamExport)
+		protected.POST("/export/stream", requirePerm(models.PermExportCreate), exportHandler.StreamExport)
+		protected.GET("/export/quick", requirePerm(models.PermExportCreate), exportHandler.QuickStreamExport)
 		protected.GET("/export/status/:jobId", exportHandler.GetExportStatus)
 		protected.GET("/export/download/:jobId", exportHandler.DownloadExport)
 		protected.GET("/export/history", exportHandler.GetUserExports)
@@ -127,49 +219,79 @@ func SetupRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
 	
 	// 管理員路由 - 根據規格書定義
 	admin := v1.Group("/admin")
-	admin.Use(middleware.CloudflareAccessMiddleware(cfg, db))
-	admin.Use(middleware.RequireRole("admin"))
+	admin.Use(middleware.AuthMiddleware(cfg, db))
 	{
 		// 用戶管理
-		admin.GET("/users", adminHandler.GetUsers)
-		admin.PUT("/users/:id/role", adminHandler.UpdateUserRole)
-		admin.PUT("/users/:id/status", adminHandler.UpdateUserStatus)
+		admin.GET("/users", requirePerm(models.PermUsersView), adminHandler.GetUsers)
+		admin.PUT("/users/:id/role", requirePerm(models.PermUsersManage), audit("update_user_role", "user", "id"), adminHandler.UpdateUserRole)
+		admin.PUT("/users/:id/status", requirePerm(models.PermUsersManage), audit("update_user_status", "user", "id"), adminHandler.UpdateUserStatus)
+		admin.POST("/users/:id/transfer-ownership", requirePerm(models.PermUsersManage), adminHandler.TransferOwnership)
 		
 		// 註冊申請管理
-		admin.GET("/registrations", adminHandler.GetRegistrations)
-		admin.PUT("/registrations/:id/approve", adminHandler.ApproveRegistration)
-		admin.PUT("/registrations/:id/reject", adminHandler.RejectRegistration)
+		admin.GET("/registrations", requirePerm(models.PermUsersApprove), adminHandler.GetRegistrations)
+		admin.PUT("/registrations/:id/approve", requirePerm(models.PermUsersApprove), audit("approve_registration", "registration", "id"), adminHandler.ApproveRegistration)
+		admin.PUT("/registrations/:id/reject", requirePerm(models.PermUsersApprove), audit("reject_registration", "registration", "id"), adminHandler.RejectRegistration)
 		
 		// 系統管理
-		admin.GET("/stats", adminHandler.GetSystemStats)
-		admin.GET("/logs", adminHandler.GetActivityLogs)
+		admin.GET("/stats", requirePerm(models.PermSystemStats), adminHandler.GetSystemStats)
+		admin.GET("/logs", requirePerm(models.PermLogsView), adminHandler.GetActivityLogs)
+		admin.GET("/logs/verify", requirePerm(models.PermLogsView), adminHandler.VerifyActivityLogs)
+		admin.GET("/logs/checkpoints", requirePerm(models.PermLogsView), adminHandler.GetActivityCheckpoints)
+		admin.POST("/logs/checkpoints", requirePerm(models.PermLogsManage), audit("create_activity_checkpoint", "activity_checkpoint", ""), adminHandler.CreateActivityCheckpoint)
+		admin.GET("/logs/export", requirePerm(models.PermLogsView), audit("export_activity_logs", "activity_log", ""), adminHandler.ExportActivityLogs)
 		
 		// 檔案管理
-		admin.GET("/files", adminHandler.GetAllFiles)
-		admin.DELETE("/files/:id", adminHandler.DeleteFile)
-		admin.GET("/files/:id/download", adminHandler.DownloadFile)
+		admin.GET("/files", requirePerm(models.PermFilesManageAll), adminHandler.GetAllFiles)
+		admin.DELETE("/files/:id", requirePerm(models.PermFilesManageAll), audit("delete", "file", "id"), adminHandler.DeleteFile)
+		admin.GET("/files/:id/download", requirePerm(models.PermFilesManageAll), adminHandler.DownloadFile)
+		admin.POST("/folders/repair-stats", requirePerm(models.PermFilesManageAll), audit("repair_folder_stats", "file", ""), fileHandler.RepairFolderStats)
+		admin.GET("/files/tree/check", requirePerm(models.PermFilesManageAll), fileHandler.CheckFileTree)
+		admin.POST("/files/tree/repair", requirePerm(models.PermFilesManageAll), audit("repair_file_tree", "file", ""), fileHandler.RepairFileTree)
 		
-		// 垃圾桶管理（僅限管理員）
-		admin.POST("/trash/empty", fileHandler.EmptyTrash)
+		// 角色與權限管理
+		admin.GET("/permissions", requirePerm(models.PermRolesManage), roleHandler.GetPermissions)
+		admin.GET("/roles", requirePerm(models.PermRolesManage), roleHandler.GetRoles)
+		admin.POST("/roles", requirePerm(models.PermRolesManage), audit("create_role", "role", ""), roleHandler.CreateRole)
+		admin.PUT("/roles/:id", requirePerm(models.PermRolesManage), audit("update_role", "role", "id"), roleHandler.UpdateRole)
+		admin.DELETE("/roles/:id", requirePerm(models.PermRolesManage), audit("delete_role", "role", "id"), roleHandler.DeleteRole)
+		
+		// 服務令牌管理
+		admin.GET("/service-tokens", requirePerm(models.PermServiceTokensManage), serviceTokenHandler.GetServiceTokens)
+		admin.POST("/service-tokens", requirePerm(models.PermServiceTokensManage), audit("create_service_token", "service_token", ""), serviceTokenHandler.CreateServiceToken)
+		admin.PUT("/service-tokens/:id", requirePerm(models.PermServiceTokensManage), audit("update_service_token", "service_token", "id"), serviceTokenHandler.UpdateServiceToken)
+		admin.POST("/service-tokens/:id/rotate", requirePerm(models.PermServiceTokensManage), audit("rotate_service_token", "service_token", "id"), serviceTokenHandler.RotateServiceToken)
+		admin.DELETE("/service-tokens/:id", requirePerm(models.PermServiceTokensManage), audit("delete_service_token", "service_token", "id"), serviceTokenHandler.DeleteServiceToken)
+		
+		// 資料夾範本管理
+		admin.GET("/folder-templates", requirePerm(models.PermFolderTemplatesManage), folderTemplateHandler.GetFolderTemplates)
+		admin.POST("/folder-templates", requirePerm(models.PermFolderTemplatesManage), audit("create_folder_template", "folder_template", ""), folderTemplateHandler.CreateFolderTemplate)
+		admin.GET("/folder-templates/:id", requirePerm(models.PermFolderTemplatesManage), folderTemplateHandler.GetFolderTemplate)
+		admin.PUT("/folder-templates/:id", requirePerm(models.PermFolderTemplatesManage), audit("update_folder_template", "folder_template", "id"), folderTemplateHandler.UpdateFolderTemplate)
+		admin.DELETE("/folder-templates/:id", requirePerm(models.PermFolderTemplatesManage), audit("delete_folder_template", "folder_template", "id"), folderTemplateHandler.DeleteFolderTemplate)
+		admin.GET("/folder-templates/:id/preview", requirePerm(models.PermFolderTemplatesManage), folderTemplateHandler.PreviewFolderTemplate)
+		admin.POST("/folder-templates/:id/run", requirePerm(models.PermFolderTemplatesManage), audit("run_folder_template", "folder_template", "id"), folderTemplateHandler.RunFolderTemplate)
+		
+		// 垃圾桶管理
+		admin.POST("/trash/empty", requirePerm(models.PermTrashEmpty), audit("empty_trash", "file", ""), fileHandler.EmptyTrash)
 		
 		// LINE 功能管理
-		admin.GET("/line/upload-records", lineHandler.GetUploadRecords)
-		admin.GET("/line/upload-records/:id", lineHandler.GetUploadRecord)
-		admin.DELETE("/line/upload-records/:id", lineHandler.DeleteUploadRecord)
-		admin.DELETE("/line/upload-records/batch", lineHandler.BatchDeleteUploadRecords)
+		admin.GET("/line/upload-records", requirePerm(models.PermLineManage), lineHandler.GetUploadRecords)
+		admin.GET("/line/upload-records/:id", requirePerm(models.PermLineManage), lineHandler.GetUploadRecord)
+		admin.DELETE("/line/upload-records/:id", requirePerm(models.PermLineManage), audit("delete_line_upload_record", "line_upload_record", "id"), lineHandler.DeleteUploadRecord)
+		admin.DELETE("/line/upload-records/batch", requirePerm(models.PermLineManage), audit("delete_line_upload_record", "line_upload_record", ""), lineHandler.BatchDeleteUploadRecords)
 		
-		admin.GET("/line/users", lineHandler.GetUsers)
-		admin.GET("/line/users/:line_user_id", lineHandler.GetUser)
-		admin.PUT("/line/users/:line_user_id/status", lineHandler.UpdateUserStatus)
+		admin.GET("/line/users", requirePerm(models.PermLineManage), lineHandler.GetUsers)
+		admin.GET("/line/users/:line_user_id", requirePerm(models.PermLineManage), lineHandler.GetUser)
+		admin.PUT("/line/users/:line_user_id/status", requirePerm(models.PermLineManage), audit("update_line_user_status", "line_user", "line_user_id"), lineHandler.UpdateUserStatus)
 		
-		admin.GET("/line/groups", lineHandler.GetGroups)
+		admin.GET("/line/groups", requirePerm(models.PermLineManage), lineHandler.GetGroups)
 		
-		admin.GET("/line/webhook-logs", lineHandler.GetWebhookLogs)
+		admin.GET("/line/webhook-logs", requirePerm(models.PermLineManage), lineHandler.GetWebhookLogs)
 		
-		admin.GET("/line/settings", lineHandler.GetSettings)
-		admin.PUT("/line/settings/:setting_key", lineHandler.UpdateSetting)
+		admin.GET("/line/settings", requirePerm(models.PermLineManage), lineHandler.GetSettings)
+		admin.PUT("/line/settings/:setting_key", requirePerm(models.PermLineManage), audit("update_line_setting", "line_setting", "setting_key"), lineHandler.UpdateSetting)
 		
-		admin.GET("/line/statistics", lineHandler.GetStatistics)
+		admin.GET("/line/statistics", requirePerm(models.PermLineManage), lineHandler.GetStatistics)
 	}
 	
 	// 靜態文件服務
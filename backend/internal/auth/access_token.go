@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+// PersonalAccessTokenPrefix 個人存取令牌的固定前綴，用來與 JWT 區分
+const PersonalAccessTokenPrefix = "mak_"
+
+// accessTokenTouchInterval 最後使用時間的更新間隔，避免每個請求都寫入資料庫
+const accessTokenTouchInterval = time.Minute
+
+// ErrInvalidAccessToken 個人存取令牌不存在、已撤銷、已過期或用戶已停用
+var ErrInvalidAccessToken = errors.New("invalid personal access token")
+
+// IsPersonalAccessToken 判斷令牌是否為個人存取令牌
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// GeneratePersonalAccessToken 產生新的個人存取令牌
+func GeneratePersonalAccessToken() (string, error) {
+	raw, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + raw, nil
+}
+
+// AuthenticatePersonalAccessToken 驗證個人存取令牌並返回其所屬用戶
+func AuthenticatePersonalAccessToken(db *gorm.DB, raw, clientIP string) (*models.PersonalAccessToken, *models.User, error) {
+	var token models.PersonalAccessToken
+	if err := db.Preload("User").Where("token_hash = ?", HashToken(raw)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAccessToken
+		}
+		return nil, nil, err
+	}
+
+	if !token.IsActive() || token.User.ID == 0 || token.User.Status != "approved" {
+		return nil, nil, ErrInvalidAccessToken
+	}
+
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > accessTokenTouchInterval || token.LastUsedIP != clientIP {
+		db.Model(&models.PersonalAccessToken{}).Where("id = ?", token.ID).
+			Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": clientIP})
+		token.LastUsedAt = &now
+		token.LastUsedIP = clientIP
+	}
+
+	user := token.User
+	return &token, &user, nil
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"memoryark/internal/config"
+)
+
+// Cloudflare Access 傳遞 JWT 的標頭與 Cookie 名稱
+const (
+	CloudflareJWTHeader   = "Cf-Access-Jwt-Assertion"
+	CloudflareJWTCookie   = "CF_Authorization"
+	cloudflareEmailHeader = "Cf-Access-Authenticated-User-Email"
+)
+
+var (
+	// ErrCloudflareNotConfigured 未設定團隊網域或 AUD，無法驗證 JWT
+	ErrCloudflareNotConfigured = errors.New("cloudflare access verification is not configured")
+	// ErrMissingCloudflareToken 請求中沒有 Cloudflare Access JWT
+	ErrMissingCloudflareToken = errors.New("missing cloudflare access token")
+)
+
+// CloudflareClaims Cloudflare Access JWT 內容
+type CloudflareClaims struct {
+	Email string `json:"email"`
+	Type  string `json:"type"`
+	jwt.RegisteredClaims
+}
+
+// CloudflareVerifier 驗證 Cloudflare Access JWT 的簽章、issuer、audience 與有效期限
+type CloudflareVerifier struct {
+	issuer   string
+	audience string
+	jwks     *JWKSCache
+}
+
+// NewCloudflareVerifier 建立 Cloudflare Access JWT 驗證器
+func NewCloudflareVerifier(issuer, audience string, jwks *JWKSCache) *CloudflareVerifier {
+	return &CloudflareVerifier{
+		issuer:   issuer,
+		audience: audience,
+		jwks:     jwks,
+	}
+}
+
+// Verify 驗證 token 並返回其中的 claims
+func (v *CloudflareVerifier) Verify(tokenString string) (*CloudflareClaims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithAudience(v.audience),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(30*time.Second),
+	)
+
+	claims := &CloudflareClaims{}
+	if _, err := parser.ParseWithClaims(tokenString, claims, v.jwks.Keyfunc); err != nil {
+		return nil, err
+	}
+
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("token has no expiry")
+	}
+	if claims.Email == "" {
+		// Service Token 產生的 JWT 沒有 email，不能對應到用戶
+		return nil, errors.New("token has no email claim")
+	}
+
+	return claims, nil
+}
+
+var (
+	cloudflareVerifiersMu sync.Mutex
+	cloudflareVerifiers   = map[string]*CloudflareVerifier{}
+)
+
+// CloudflareVerifierFor 依設定取得共用的驗證器（共用公鑰快取）
+func CloudflareVerifierFor(cfg config.CloudflareConfig) (*CloudflareVerifier, error) {
+	issuer := cfg.TeamURL()
+	audience := cfg.AudienceTag()
+	jwksURL := cfg.JWKSURL()
+	if issuer == "" || audience == "" || jwksURL == "" {
+		return nil, ErrCloudflareNotConfigured
+	}
+
+	key := strings.Join([]string{issuer, audience, jwksURL}, "|")
+
+	cloudflareVerifiersMu.Lock()
+	defer cloudflareVerifiersMu.Unlock()
+
+	if verifier, ok := cloudflareVerifiers[key]; ok {
+		return verifier, nil
+	}
+	verifier := NewCloudflareVerifier(issuer, audience, NewJWKSCache(jwksURL, nil))
+	cloudflareVerifiers[key] = verifier
+	return verifier, nil
+}
+
+// CloudflareTokenFromRequest 從標頭或 CF_Authorization Cookie 取得 Access JWT
+func CloudflareTokenFromRequest(r *http.Request) string {
+	if token := r.Header.Get(CloudflareJWTHeader); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie(CloudflareJWTCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// CloudflareEmailFromRequest 驗證 Cloudflare Access JWT 並返回已認證的 email
+func CloudflareEmailFromRequest(r *http.Request, cfg config.CloudflareConfig) (string, error) {
+	if cfg.TrustEmailHeader {
+		// 舊版行為：僅在源站無法被直接連線時使用
+		email := r.Header.Get(cloudflareEmailHeader)
+		if email == "" {
+			return "", ErrMissingCloudflareToken
+		}
+		return email, nil
+	}
+
+	token := CloudflareTokenFromRequest(r)
+	if token == "" {
+		return "", ErrMissingCloudflareToken
+	}
+
+	verifier, err := CloudflareVerifierFor(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := verifier.Verify(token)
+	if err != nil {
+		return "", fmt.Errorf("invalid cloudflare access token: %w", err)
+	}
+	return claims.Email, nil
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"memoryark/internal/config"
+)
+
+const (
+	testIssuer   = "https://memoryark-test.cloudflareaccess.com"
+	testAudience = "test-aud-tag"
+)
+
+// jwksServer 本地 JWKS 替身伺服器，可模擬金鑰輪替
+type jwksServer struct {
+	mu       sync.Mutex
+	keys     map[string]*rsa.PrivateKey
+	requests int
+	server   *httptest.Server
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	s := &jwksServer{keys: map[string]*rsa.PrivateKey{}}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests++
+
+		var keys []map[string]string
+		for kid, key := range s.keys {
+			keys = append(keys, map[string]string{
+				"kid": kid,
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// rotate 以新金鑰取代所有舊金鑰
+func (s *jwksServer) rotate(t *testing.T, kid string) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	s.mu.Lock()
+	s.keys = map[string]*rsa.PrivateKey{kid: key}
+	s.mu.Unlock()
+	return key
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims CloudflareClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func validClaims() CloudflareClaims {
+	now := time.Now()
+	return CloudflareClaims{
+		Email: "member@example.com",
+		Type:  "app",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{testAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}
+}
+
+// TestCloudflareVerifier 測試簽章、issuer、audience 與有效期限驗證
+func TestCloudflareVerifier(t *testing.T) {
+	srv := newJWKSServer(t)
+	key := srv.rotate(t, "kid-1")
+	verifier := NewCloudflareVerifier(testIssuer, testAudience, NewJWKSCache(srv.server.URL, nil))
+
+	claims, err := verifier.Verify(signToken(t, key, "kid-1", validClaims()))
+	if err != nil {
+		t.Fatalf("Expected valid token, got error: %v", err)
+	}
+	if claims.Email != "member@example.com" {
+		t.Errorf("Unexpected email %q", claims.Email)
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	invalid := map[string]func() string{
+		"wrong audience": func() string {
+			c := validClaims()
+			c.Audience = jwt.ClaimStrings{"other-app"}
+			return signToken(t, key, "kid-1", c)
+		},
+		"wrong issuer": func() string {
+			c := validClaims()
+			c.Issuer = "https://attacker.cloudflareaccess.com"
+			return signToken(t, key, "kid-1", c)
+		},
+		"expired": func() string {
+			c := validClaims()
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+			return signToken(t, key, "kid-1", c)
+		},
+		"missing expiry": func() string {
+			c := validClaims()
+			c.ExpiresAt = nil
+			return signToken(t, key, "kid-1", c)
+		},
+		"forged signature": func() string {
+			return signToken(t, otherKey, "kid-1", validClaims())
+		},
+		"unsigned": func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims())
+			token.Header["kid"] = "kid-1"
+			s, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return s
+		},
+	}
+	for name, build := range invalid {
+		if _, err := verifier.Verify(build()); err == nil {
+			t.Errorf("%s: expected verification to fail", name)
+		}
+	}
+
+	if srv.requests != 1 {
+		t.Errorf("Expected JWKS to be fetched once and cached, got %d requests", srv.requests)
+	}
+}
+
+// TestJWKSKeyRotation 測試遇到未知 kid 時重新取得公鑰
+func TestJWKSKeyRotation(t *testing.T) {
+	srv := newJWKSServer(t)
+	oldKey := srv.rotate(t, "kid-old")
+	cache := NewJWKSCache(srv.server.URL, nil)
+	cache.minRefreshInterval = 0
+	verifier := NewCloudflareVerifier(testIssuer, testAudience, cache)
+
+	if _, err := verifier.Verify(signToken(t, oldKey, "kid-old", validClaims())); err != nil {
+		t.Fatalf("Expected old key to verify: %v", err)
+	}
+
+	newKey := srv.rotate(t, "kid-new")
+	if _, err := verifier.Verify(signToken(t, newKey, "kid-new", validClaims())); err != nil {
+		t.Fatalf("Expected rotated key to verify after refetch: %v", err)
+	}
+	if srv.requests != 2 {
+		t.Errorf("Expected 2 JWKS requests, got %d", srv.requests)
+	}
+
+	// 未知 kid 的重新取得受最短間隔限制
+	cache.minRefreshInterval = time.Hour
+	if _, err := verifier.Verify(signToken(t, newKey, "kid-unknown", validClaims())); err == nil {
+		t.Errorf("Expected unknown kid to fail")
+	}
+	if srv.requests != 2 {
+		t.Errorf("Unknown kid should not trigger refetch within interval, got %d requests", srv.requests)
+	}
+}
+
+// TestCloudflareEmailFromRequest 測試從標頭與 Cookie 取得並驗證 JWT
+func TestCloudflareEmailFromRequest(t *testing.T) {
+	srv := newJWKSServer(t)
+	key := srv.rotate(t, "kid-1")
+	cfg := config.CloudflareConfig{
+		Domain:   "memoryark-test.cloudflareaccess.com",
+		Audience: testAudience,
+		CertsURL: srv.server.URL,
+	}
+	token := signToken(t, key, "kid-1", validClaims())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.Header.Set(CloudflareJWTHeader, token)
+	if email, err := CloudflareEmailFromRequest(req, cfg); err != nil || email != "member@example.com" {
+		t.Errorf("Header token: got email=%q err=%v", email, err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.AddCookie(&http.Cookie{Name: CloudflareJWTCookie, Value: token})
+	if email, err := CloudflareEmailFromRequest(req, cfg); err != nil || email != "member@example.com" {
+		t.Errorf("Cookie token: got email=%q err=%v", email, err)
+	}
+
+	// 只有 Email 標頭（直接連線源站偽造）應被拒絕
+	req = httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.Header.Set("Cf-Access-Authenticated-User-Email", "admin@example.com")
+	if _, err := CloudflareEmailFromRequest(req, cfg); err != ErrMissingCloudflareToken {
+		t.Errorf("Expected ErrMissingCloudflareToken for header-only request, got %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.Header.Set(CloudflareJWTHeader, token)
+	if _, err := CloudflareEmailFromRequest(req, config.CloudflareConfig{}); err != ErrCloudflareNotConfigured {
+		t.Errorf("Expected ErrCloudflareNotConfigured, got %v", err)
+	}
+}
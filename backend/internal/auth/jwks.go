@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// jwksCacheTTL 公鑰快取時間，過期後於下次驗證時重新取得
+	jwksCacheTTL = time.Hour
+	// jwksMinRefreshInterval 遇到未知 kid 時重新取得公鑰的最短間隔，避免被大量偽造 token 觸發請求
+	jwksMinRefreshInterval = 30 * time.Second
+)
+
+// ErrUnknownSigningKey 找不到對應 kid 的公鑰
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// jsonWebKey JWKS 中的單一公鑰
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// JWKSCache 快取遠端 JWKS 公鑰，支援金鑰輪替（遇到未知 kid 時重新取得）
+type JWKSCache struct {
+	url                string
+	client             *http.Client
+	minRefreshInterval time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]interface{}
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+// NewJWKSCache 建立 JWKS 公鑰快取
+func NewJWKSCache(url string, client *http.Client) *JWKSCache {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &JWKSCache{
+		url:                url,
+		client:             client,
+		minRefreshInterval: jwksMinRefreshInterval,
+		keys:               map[string]interface{}{},
+	}
+}
+
+// Keyfunc 提供給 jwt 解析器使用的公鑰查詢函數
+func (c *JWKSCache) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token header missing kid")
+	}
+	return c.GetKey(kid)
+}
+
+// GetKey 依 kid 取得公鑰，快取過期或找不到時重新取得
+func (c *JWKSCache) GetKey(kid string) (interface{}, error) {
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	fresh := time.Since(c.fetchedAt) < jwksCacheTTL
+	c.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+
+	if err := c.refresh(!fresh); err != nil {
+		// 取得失敗時仍可使用過期快取中的公鑰
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+// refresh 重新取得 JWKS；force 為 false 時受最短間隔限制
+func (c *JWKSCache) refresh(force bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if force && time.Since(c.fetchedAt) < jwksCacheTTL {
+		return nil // 已由其他請求更新
+	}
+	if !force && time.Since(c.lastAttempt) < c.minRefreshInterval {
+		return nil
+	}
+	c.lastAttempt = time.Now()
+
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return fmt.Errorf("fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("decode jwks: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(body.Keys))
+	for _, jwk := range body.Keys {
+		if jwk.Kid == "" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return errors.New("jwks contains no usable keys")
+	}
+
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	return nil
+}
+
+// publicKey 將 JWK 轉換為 RSA 或 ECDSA 公鑰
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
@@ -5,13 +5,22 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// jwtIssuer 內建 JWT 的簽發者
+	jwtIssuer = "memoryark"
+	// TokenTypeAccess 存取令牌類型
+	TokenTypeAccess = "access"
 )
 
 // JWTClaims JWT 聲明結構
 type JWTClaims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID    uint   `json:"user_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	TokenType string `json:"token_type"`
 	jwt.RegisteredClaims
 }
 
@@ -20,81 +29,54 @@ type TokenPair struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 	ExpiresIn    int64  `json:"expires_in"`
+	TokenType    string `json:"token_type"`
 }
 
-// GenerateTokenPair 生成令牌對
-func GenerateTokenPair(userID uint, email, role, secret string, expiry int) (*TokenPair, error) {
-	// 生成訪問令牌
-	accessClaims := JWTClaims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expiry) * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "memoryark",
-			Subject:   email,
-		},
-	}
-
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessTokenString, err := accessToken.SignedString([]byte(secret))
-	if err != nil {
-		return nil, err
-	}
-
-	// 生成刷新令牌（有效期更長）
-	refreshClaims := JWTClaims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+// GenerateAccessToken 生成存取令牌，每個令牌帶有唯一 jti 以便撤銷
+func GenerateAccessToken(userID uint, email, role, secret string, expiry time.Duration) (string, *JWTClaims, error) {
+	now := time.Now()
+	claims := &JWTClaims{
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		TokenType: TokenTypeAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expiry*7) * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "memoryark",
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    jwtIssuer,
 			Subject:   email,
 		},
 	}
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshTokenString, err := refreshToken.SignedString([]byte(secret))
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(secret))
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
-
-	return &TokenPair{
-		AccessToken:  accessTokenString,
-		RefreshToken: refreshTokenString,
-		ExpiresIn:    int64(expiry * 3600), // 轉換為秒
-	}, nil
+	return signed, claims, nil
 }
 
-// ValidateToken 驗證令牌
+// ValidateToken 驗證令牌簽章、簽發者與有效期限
 func ValidateToken(tokenString, secret string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(jwtIssuer),
+	)
+	token, err := parser.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(secret), nil
 	})
-
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*JWTClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
 	}
-
-	return nil, errors.New("invalid token")
-}
-
-// RefreshToken 刷新令牌
-func RefreshToken(refreshTokenString, secret string, expiry int) (*TokenPair, error) {
-	claims, err := ValidateToken(refreshTokenString, secret)
-	if err != nil {
-		return nil, err
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("token has no expiry")
 	}
-
-	// 生成新的令牌對
-	return GenerateTokenPair(claims.UserID, claims.Email, claims.Role, secret, expiry)
+	return claims, nil
 }
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+const (
+	// loginCodeMaxAttempts 單一登入碼允許的錯誤次數
+	loginCodeMaxAttempts = 5
+	// loginCodeResendInterval 同一 email 重新索取登入碼的最短間隔
+	loginCodeResendInterval = time.Minute
+)
+
+var (
+	// ErrInvalidLoginCode 登入碼錯誤、已使用或已過期
+	ErrInvalidLoginCode = errors.New("invalid or expired login code")
+	// ErrLoginCodeTooSoon 索取登入碼過於頻繁
+	ErrLoginCodeTooSoon = errors.New("login code requested too soon")
+)
+
+// IssueLoginCode 為 email 產生六位數一次性登入碼，先前未使用的登入碼會失效
+func IssueLoginCode(db *gorm.DB, email string, ttl time.Duration) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var recent int64
+		if err := tx.Model(&models.LoginCode{}).
+			Where("email = ? AND created_at > ?", email, time.Now().Add(-loginCodeResendInterval)).
+			Count(&recent).Error; err != nil {
+			return err
+		}
+		if recent > 0 {
+			return ErrLoginCodeTooSoon
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.LoginCode{}).
+			Where("email = ? AND used_at IS NULL", email).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.LoginCode{
+			Email:     email,
+			CodeHash:  HashToken(email + ":" + code),
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// DiscardLoginCodes 刪除 email 尚未使用的登入碼（例如寄送失敗時），之後可立即重新索取
+func DiscardLoginCodes(db *gorm.DB, email string) error {
+	return db.Where("email = ? AND used_at IS NULL", email).Delete(&models.LoginCode{}).Error
+}
+
+// VerifyLoginCode 驗證並消耗登入碼，錯誤次數過多時登入碼作廢
+func VerifyLoginCode(db *gorm.DB, email, code string) error {
+	matched := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var loginCode models.LoginCode
+		err := tx.Where("email = ? AND used_at IS NULL AND expires_at > ?", email, time.Now()).
+			Order("created_at DESC").First(&loginCode).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidLoginCode
+			}
+			return err
+		}
+		if loginCode.Attempts >= loginCodeMaxAttempts {
+			return ErrInvalidLoginCode
+		}
+
+		expected := HashToken(email + ":" + code)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(loginCode.CodeHash)) != 1 {
+			// 錯誤次數必須保留，因此不以錯誤結束交易
+			return tx.Model(&loginCode).Update("attempts", gorm.Expr("attempts + 1")).Error
+		}
+
+		res := tx.Model(&models.LoginCode{}).
+			Where("id = ? AND used_at IS NULL", loginCode.ID).
+			Update("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidLoginCode
+		}
+		matched = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return ErrInvalidLoginCode
+	}
+	return nil
+}
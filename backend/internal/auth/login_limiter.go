@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// loginLimiterMaxKeys 記錄的鍵超過此數量時清除已過期的紀錄
+const loginLimiterMaxKeys = 10000
+
+// LoginLimiter 記錄登入嘗試次數，時間窗內嘗試過多的帳號或 IP 暫時鎖定。
+// 紀錄只保存在記憶體中，服務重新啟動後歸零。
+type LoginLimiter struct {
+	mu          sync.Mutex
+	maxAttempts int
+	window      time.Duration
+	attempts    map[string]*loginAttempts
+}
+
+// loginAttempts 單一鍵在目前時間窗內的嘗試紀錄
+type loginAttempts struct {
+	count       int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+// NewLoginLimiter 創建登入嘗試限制器，maxAttempts 小於等於 0 時不限制
+// window 同時是計算嘗試次數的時間窗與鎖定時間
+func NewLoginLimiter(maxAttempts int, window time.Duration) *LoginLimiter {
+	return &LoginLimiter{
+		maxAttempts: maxAttempts,
+		window:      window,
+		attempts:    make(map[string]*loginAttempts),
+	}
+}
+
+// RetryAfter 返回鍵剩餘的鎖定時間，未鎖定時為 0
+func (l *LoginLimiter) RetryAfter(key string) time.Duration {
+	if l.maxAttempts <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.attempts[key]
+	if !ok {
+		return 0
+	}
+	if remaining := time.Until(entry.lockedUntil); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// Record 記錄一次嘗試，達到上限時鎖定該鍵
+func (l *LoginLimiter) Record(key string) {
+	if l.maxAttempts <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if len(l.attempts) >= loginLimiterMaxKeys {
+		l.prune(now)
+	}
+
+	entry, ok := l.attempts[key]
+	if !ok || now.Sub(entry.windowStart) > l.window {
+		entry = &loginAttempts{windowStart: now}
+		l.attempts[key] = entry
+	}
+	entry.count++
+	if entry.count >= l.maxAttempts {
+		entry.lockedUntil = now.Add(l.window)
+	}
+}
+
+// Reset 清除鍵的嘗試紀錄（例如登入成功後）
+func (l *LoginLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, key)
+}
+
+// prune 清除時間窗與鎖定都已結束的紀錄
+func (l *LoginLimiter) prune(now time.Time) {
+	for key, entry := range l.attempts {
+		if now.Sub(entry.windowStart) > l.window && now.After(entry.lockedUntil) {
+			delete(l.attempts, key)
+		}
+	}
+}
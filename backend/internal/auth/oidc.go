@@ -0,0 +1,311 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"memoryark/internal/config"
+)
+
+// oidcDiscoveryTTL 提供者設定的快取時間
+const oidcDiscoveryTTL = time.Hour
+
+var (
+	// ErrOIDCNotConfigured 未設定 OIDC 提供者
+	ErrOIDCNotConfigured = errors.New("oidc provider is not configured")
+	// ErrOIDCEmailNotAllowed email 未驗證或不在允許的網域中
+	ErrOIDCEmailNotAllowed = errors.New("oidc email is not allowed")
+)
+
+// oidcDiscovery OpenID Provider 設定（/.well-known/openid-configuration）
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCIdentity 從 ID Token 對應出的用戶身分
+type OIDCIdentity struct {
+	Subject string
+	Email   string
+	Name    string
+}
+
+// OIDCProvider 以授權碼 + PKCE 流程向 OpenID Connect 提供者登入
+type OIDCProvider struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+
+	mu           sync.Mutex
+	discovery    *oidcDiscovery
+	discoveredAt time.Time
+	jwks         *JWKSCache
+}
+
+// NewOIDCProvider 建立 OIDC 提供者
+func NewOIDCProvider(cfg config.OIDCConfig, client *http.Client) *OIDCProvider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &OIDCProvider{cfg: cfg, client: client}
+}
+
+var (
+	oidcProvidersMu sync.Mutex
+	oidcProviders   = map[string]*OIDCProvider{}
+)
+
+// OIDCProviderFor 依設定取得共用的提供者（共用設定與公鑰快取）
+func OIDCProviderFor(cfg config.OIDCConfig) (*OIDCProvider, error) {
+	if !cfg.Enabled() {
+		return nil, ErrOIDCNotConfigured
+	}
+
+	key := cfg.IssuerURL + "|" + cfg.ClientID
+	oidcProvidersMu.Lock()
+	defer oidcProvidersMu.Unlock()
+
+	if provider, ok := oidcProviders[key]; ok {
+		return provider, nil
+	}
+	provider := NewOIDCProvider(cfg, nil)
+	oidcProviders[key] = provider
+	return provider, nil
+}
+
+// GeneratePKCE 產生 PKCE code_verifier 與 S256 code_challenge
+func GeneratePKCE() (verifier, challenge string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(buf)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// AuthCodeURL 產生導向提供者登入頁的網址
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange 以授權碼換取 ID Token，驗證後返回用戶身分
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return p.VerifyIDToken(ctx, body.IDToken, nonce)
+}
+
+// VerifyIDToken 驗證 ID Token 的簽章、issuer、audience、有效期限與 nonce，並對應出用戶身分
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*OIDCIdentity, error) {
+	discovery, jwks, err := p.discoverWithKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(30*time.Second),
+	)
+
+	claims := jwt.MapClaims{}
+	if _, err := parser.ParseWithClaims(rawIDToken, claims, jwks.Keyfunc); err != nil {
+		return nil, err
+	}
+
+	if exp, err := claims.GetExpirationTime(); err != nil || exp == nil {
+		return nil, errors.New("id token has no expiry")
+	}
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, errors.New("id token nonce mismatch")
+	}
+	// 多個 audience 時 azp 必須是本應用
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.cfg.ClientID {
+			return nil, errors.New("id token azp mismatch")
+		}
+	}
+
+	return p.mapIdentity(claims)
+}
+
+// mapIdentity 依設定的 claim 名稱取得 email 與名稱，並檢查 email 是否允許登入
+func (p *OIDCProvider) mapIdentity(claims jwt.MapClaims) (*OIDCIdentity, error) {
+	subject, _ := claims.GetSubject()
+	email, _ := claims[p.cfg.EmailClaim].(string)
+	email = strings.TrimSpace(email)
+	if subject == "" || email == "" {
+		return nil, errors.New("id token is missing subject or email")
+	}
+
+	if p.cfg.RequireVerifiedEmail && p.cfg.EmailClaim == "email" {
+		// 部分提供者以字串表示布林值
+		switch verified := claims["email_verified"].(type) {
+		case bool:
+			if !verified {
+				return nil, ErrOIDCEmailNotAllowed
+			}
+		case string:
+			if verified != "true" {
+				return nil, ErrOIDCEmailNotAllowed
+			}
+		default:
+			return nil, ErrOIDCEmailNotAllowed
+		}
+	}
+
+	if len(p.cfg.AllowedDomains) > 0 {
+		domain := strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+		allowed := false
+		for _, d := range p.cfg.AllowedDomains {
+			if strings.EqualFold(strings.TrimPrefix(d, "@"), domain) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, ErrOIDCEmailNotAllowed
+		}
+	}
+
+	name, _ := claims[p.cfg.NameClaim].(string)
+	if strings.TrimSpace(name) == "" {
+		name = strings.SplitN(email, "@", 2)[0]
+	}
+
+	return &OIDCIdentity{Subject: subject, Email: email, Name: name}, nil
+}
+
+// discover 取得並快取提供者設定
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	discovery, _, err := p.discoverWithKeys(ctx)
+	return discovery, err
+}
+
+// discoverWithKeys 取得並快取提供者設定與公鑰快取，issuer 必須與設定一致
+func (p *OIDCProvider) discoverWithKeys(ctx context.Context) (*oidcDiscovery, *JWKSCache, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil && time.Since(p.discoveredAt) < oidcDiscoveryTTL {
+		return p.discovery, p.jwks, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.IssuerURL+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if p.discovery != nil {
+			return p.discovery, p.jwks, nil
+		}
+		return nil, nil, fmt.Errorf("fetch oidc discovery: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if p.discovery != nil {
+			return p.discovery, p.jwks, nil
+		}
+		return nil, nil, fmt.Errorf("fetch oidc discovery: unexpected status %d", resp.StatusCode)
+	}
+
+	var discovery oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, nil, fmt.Errorf("decode oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.cfg.IssuerURL {
+		return nil, nil, fmt.Errorf("oidc issuer mismatch: %s", discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, nil, errors.New("oidc discovery document is incomplete")
+	}
+
+	if p.jwks == nil || p.discovery == nil || p.discovery.JWKSURI != discovery.JWKSURI {
+		p.jwks = NewJWKSCache(discovery.JWKSURI, p.client)
+	}
+	p.discovery = &discovery
+	p.discoveredAt = time.Now()
+	return p.discovery, p.jwks, nil
+}
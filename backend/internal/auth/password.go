@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength 密碼最短長度
+const MinPasswordLength = 8
+
+// ErrPasswordTooShort 密碼長度不足
+var ErrPasswordTooShort = errors.New("password too short")
+
+// dummyPasswordHash 用戶不存在時仍執行一次比對，避免以回應時間推測帳號是否存在
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("memoryark-dummy-password"), bcrypt.DefaultCost)
+
+// HashPassword 產生密碼雜湊
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword 比對密碼，hash 為空時一律失敗
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
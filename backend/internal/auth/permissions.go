@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+// roleCacheTTL 角色權限快取時間，避免每個請求都查詢資料庫
+const roleCacheTTL = 30 * time.Second
+
+type cachedRole struct {
+	role     models.Role
+	loadedAt time.Time
+}
+
+var (
+	roleCacheMu sync.RWMutex
+	roleCache   = map[string]cachedRole{}
+)
+
+// LoadRole 讀取角色（含短暫快取）
+func LoadRole(db *gorm.DB, roleName string) (*models.Role, error) {
+	roleCacheMu.RLock()
+	cached, ok := roleCache[roleName]
+	roleCacheMu.RUnlock()
+	if ok && time.Since(cached.loadedAt) < roleCacheTTL {
+		role := cached.role
+		return &role, nil
+	}
+
+	var role models.Role
+	if err := db.Where("name = ?", roleName).First(&role).Error; err != nil {
+		return nil, err
+	}
+
+	roleCacheMu.Lock()
+	roleCache[roleName] = cachedRole{role: role, loadedAt: time.Now()}
+	roleCacheMu.Unlock()
+
+	return &role, nil
+}
+
+// InvalidateRoleCache 角色權限變更後清除快取
+func InvalidateRoleCache() {
+	roleCacheMu.Lock()
+	roleCache = map[string]cachedRole{}
+	roleCacheMu.Unlock()
+}
+
+// RolePermissions 取得角色的權限清單，角色不存在時返回空清單
+func RolePermissions(db *gorm.DB, roleName string) []string {
+	role, err := LoadRole(db, roleName)
+	if err != nil {
+		return []string{}
+	}
+	return role.Permissions
+}
+
+// HasPermission 檢查角色是否具備指定權限
+func HasPermission(db *gorm.DB, roleName, permission string) bool {
+	if roleName == "" {
+		return false
+	}
+	role, err := LoadRole(db, roleName)
+	if err != nil {
+		return false
+	}
+	return role.HasPermission(permission)
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+// ServiceTokenPrefix 系統產生的服務令牌前綴
+const ServiceTokenPrefix = "msvc_"
+
+var (
+	// ErrInvalidServiceToken 服務令牌不存在、已停用或已過了輪替重疊期
+	ErrInvalidServiceToken = errors.New("invalid service token")
+	// ErrServiceTokenIPDenied 來源 IP 不在服務令牌的允許清單中
+	ErrServiceTokenIPDenied = errors.New("client ip not allowed for service token")
+)
+
+// GenerateServiceToken 產生新的服務令牌
+func GenerateServiceToken() (string, error) {
+	raw, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	return ServiceTokenPrefix + raw, nil
+}
+
+// AuthenticateServiceToken 以固定時間比對令牌雜湊，驗證來源 IP 並記錄使用統計
+func AuthenticateServiceToken(db *gorm.DB, raw, clientIP string) (*models.ServiceToken, error) {
+	var tokens []models.ServiceToken
+	if err := db.Where("is_active = ?", true).Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+
+	hash := []byte(HashToken(raw))
+	var matched *models.ServiceToken
+	for i := range tokens {
+		token := &tokens[i]
+		// 逐一比對所有令牌，不提早結束，避免以回應時間推測令牌
+		current := subtle.ConstantTimeCompare(hash, []byte(token.TokenHash)) == 1
+		previous := token.PreviousTokenHash != "" &&
+			subtle.ConstantTimeCompare(hash, []byte(token.PreviousTokenHash)) == 1 &&
+			token.InOverlapWindow()
+		if (current || previous) && matched == nil {
+			matched = token
+		}
+	}
+	if matched == nil {
+		return nil, ErrInvalidServiceToken
+	}
+
+	if !IPAllowed(matched.AllowedIPs, clientIP) {
+		return matched, ErrServiceTokenIPDenied
+	}
+
+	now := time.Now()
+	db.Model(&models.ServiceToken{}).Where("id = ?", matched.ID).UpdateColumns(map[string]interface{}{
+		"last_used_at": now,
+		"last_used_ip": clientIP,
+		"use_count":    gorm.Expr("use_count + 1"),
+	})
+	matched.LastUsedAt = &now
+	matched.LastUsedIP = clientIP
+	matched.UseCount++
+
+	return matched, nil
+}
+
+// IPAllowed 檢查 IP 是否符合允許清單（IP 或 CIDR），清單為空時不限制
+func IPAllowed(allowed []string, clientIP string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if strings.Contains(entry, "/") {
+			if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if allowedIP := net.ParseIP(entry); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
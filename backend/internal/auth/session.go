@@ -0,0 +1,302 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"memoryark/internal/config"
+	"memoryark/internal/models"
+)
+
+var (
+	// ErrInvalidRefreshToken 刷新令牌不存在、已過期或已撤銷
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused 已輪替過的刷新令牌被再次使用，整個令牌家族已撤銷
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+	// ErrTokenRevoked 存取令牌已被撤銷
+	ErrTokenRevoked = errors.New("token has been revoked")
+)
+
+// SessionMeta 簽發令牌時記錄的用戶端資訊
+type SessionMeta struct {
+	IPAddress string
+	UserAgent string
+}
+
+// SessionManager 管理內建 JWT 登入的令牌簽發、輪替與撤銷
+type SessionManager struct {
+	db         *gorm.DB
+	secret     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// NewSessionManager 創建令牌管理器
+func NewSessionManager(db *gorm.DB, cfg config.AuthConfig) *SessionManager {
+	return &SessionManager{
+		db:         db,
+		secret:     cfg.JWTSecret,
+		accessTTL:  time.Duration(cfg.TokenExpiry) * time.Hour,
+		refreshTTL: time.Duration(cfg.RefreshExpiry) * time.Hour,
+	}
+}
+
+// HashToken 計算不透明令牌的 SHA256 雜湊，資料庫只保存雜湊值
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateOpaqueToken 產生隨機不透明令牌
+func GenerateOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// WebSocketBearerProtocol 瀏覽器建立 WebSocket 時無法設定標頭，
+// 改以子協定 ["memoryark.bearer", <token>] 傳遞令牌
+const WebSocketBearerProtocol = "memoryark.bearer"
+
+// BearerToken 從 Authorization 標頭（或 WebSocket 子協定）取得 Bearer 令牌
+func BearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+
+	protocols := strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",")
+	if len(protocols) == 2 && strings.TrimSpace(protocols[0]) == WebSocketBearerProtocol {
+		return strings.TrimSpace(protocols[1])
+	}
+	return ""
+}
+
+// IssueTokens 為新的登入簽發令牌對（建立新的令牌家族）
+func (m *SessionManager) IssueTokens(user *models.User, meta SessionMeta) (*TokenPair, error) {
+	var pair *TokenPair
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		pair, _, err = m.issue(tx, user, uuid.New().String(), meta)
+		return err
+	})
+	return pair, err
+}
+
+// RotateRefreshToken 以刷新令牌換取新的令牌對，舊令牌立即失效。
+// 已輪替過的令牌被再次使用時視為外洩，撤銷整個令牌家族。
+func (m *SessionManager) RotateRefreshToken(refreshToken string, meta SessionMeta) (*TokenPair, *models.User, error) {
+	var (
+		pair   *TokenPair
+		user   models.User
+		reused bool
+	)
+
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		if err := tx.Where("token_hash = ?", HashToken(refreshToken)).First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		if current.RevokedAt != nil {
+			if current.ReplacedBy != nil {
+				reused = true
+				return ErrRefreshTokenReused
+			}
+			return ErrInvalidRefreshToken
+		}
+		if time.Now().After(current.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		if err := tx.First(&user, current.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		if user.Status != "approved" {
+			return ErrInvalidRefreshToken
+		}
+
+		// 以條件更新搶佔令牌，並行請求中只有一個能成功輪替
+		now := time.Now()
+		res := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Update("revoked_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			reused = true
+			return ErrRefreshTokenReused
+		}
+
+		var (
+			next *models.RefreshToken
+			err  error
+		)
+		pair, next, err = m.issue(tx, &user, current.FamilyID, meta)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).Where("id = ?", current.ID).
+			Update("replaced_by", next.ID).Error
+	})
+
+	if reused {
+		// 在交易外撤銷，避免被上面的回滾一併取消
+		if err := m.revokeFamilyByHash(HashToken(refreshToken)); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, &user, nil
+}
+
+// ValidateAccessToken 驗證存取令牌並檢查是否已被撤銷
+func (m *SessionManager) ValidateAccessToken(tokenString string) (*JWTClaims, error) {
+	claims, err := ValidateToken(tokenString, m.secret)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != TokenTypeAccess || claims.ID == "" {
+		return nil, errors.New("not an access token")
+	}
+
+	var count int64
+	if err := m.db.Model(&models.RevokedToken{}).Where("jti = ?", claims.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrTokenRevoked
+	}
+
+	// 令牌的簽發時間只精確到秒，與失效時間比較時同樣取到秒
+	var user models.User
+	if err := m.db.Select("id", "tokens_valid_after").Where("id = ?", claims.UserID).Limit(1).Find(&user).Error; err != nil {
+		return nil, err
+	}
+	if user.TokensValidAfter != nil && claims.IssuedAt != nil &&
+		claims.IssuedAt.Time.Before(user.TokensValidAfter.Truncate(time.Second)) {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// RevokeAccessToken 將存取令牌加入撤銷清單，並清除已過期的撤銷紀錄
+func (m *SessionManager) RevokeAccessToken(claims *JWTClaims) error {
+	if claims == nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+
+	revoked := models.RevokedToken{
+		JTI:       claims.ID,
+		UserID:    claims.UserID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if err := m.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error; err != nil {
+		return err
+	}
+
+	// 過期的令牌本身已無法通過驗證，不需要繼續保留
+	return m.db.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error
+}
+
+// RevokeRefreshToken 撤銷刷新令牌所屬的整個令牌家族（登出）
+func (m *SessionManager) RevokeRefreshToken(refreshToken string, userID uint) error {
+	var token models.RefreshToken
+	err := m.db.Where("token_hash = ? AND user_id = ?", HashToken(refreshToken), userID).First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		return err
+	}
+	return m.revokeFamily(m.db, token.FamilyID)
+}
+
+// RevokeUserSessions 撤銷用戶所有的刷新令牌與已簽發的存取令牌（例如變更密碼後）
+func (m *SessionManager) RevokeUserSessions(userID uint) error {
+	if err := m.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	return m.revokeAccessTokens(userID)
+}
+
+// revokeAccessTokens 讓用戶目前為止簽發的存取令牌全部失效
+func (m *SessionManager) revokeAccessTokens(userID uint) error {
+	return m.db.Model(&models.User{}).Where("id = ?", userID).
+		Update("tokens_valid_after", time.Now()).Error
+}
+
+// issue 簽發存取令牌並建立屬於 familyID 的刷新令牌
+func (m *SessionManager) issue(tx *gorm.DB, user *models.User, familyID string, meta SessionMeta) (*TokenPair, *models.RefreshToken, error) {
+	accessToken, _, err := GenerateAccessToken(user.ID, user.Email, user.Role, m.secret, m.accessTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, err := GenerateOpaqueToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	refresh := &models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: HashToken(raw),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(m.refreshTTL),
+		IPAddress: meta.IPAddress,
+		UserAgent: meta.UserAgent,
+	}
+	if err := tx.Create(refresh).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: raw,
+		ExpiresIn:    int64(m.accessTTL.Seconds()),
+		TokenType:    "Bearer",
+	}, refresh, nil
+}
+
+// revokeFamilyByHash 依令牌雜湊撤銷其所屬家族，並讓該用戶已簽發的存取令牌失效
+func (m *SessionManager) revokeFamilyByHash(tokenHash string) error {
+	var token models.RefreshToken
+	if err := m.db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return err
+	}
+	if err := m.revokeFamily(m.db, token.FamilyID); err != nil {
+		return err
+	}
+	// 外洩的刷新令牌可能已換得存取令牌，無法逐一得知，改以時間點讓它們全部失效
+	return m.revokeAccessTokens(token.UserID)
+}
+
+// revokeFamily 撤銷同一家族中所有尚未撤銷的刷新令牌
+func (m *SessionManager) revokeFamily(tx *gorm.DB, familyID string) error {
+	return tx.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
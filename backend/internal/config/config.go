@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	
 	"github.com/joho/godotenv"
 )
@@ -12,13 +13,20 @@ type Config struct {
 	Server    ServerConfig
 	Database  DatabaseConfig
 	Auth      AuthConfig
+	Mail      MailConfig
 	Upload    UploadConfig
 	Storage   StorageConfig
 	Cloudflare CloudflareConfig
+	OIDC      OIDCConfig
 	Admin     AdminConfig
 	Development DevelopmentConfig
 	Features  FeatureConfig
 	API       APIConfig
+	Audit     AuditConfig
+	Trash     TrashConfig
+	Operation OperationConfig
+	Jobs      JobConfig
+	FolderTemplates FolderTemplateConfig
 }
 
 // ServerConfig 服務器配置
@@ -33,11 +41,61 @@ type DatabaseConfig struct {
 	Path string
 }
 
+// 認證方式
+const (
+	AuthProviderCloudflare = "cloudflare" // 由 Cloudflare Access 驗證身分（預設）
+	AuthProviderLocalJWT   = "local-jwt"  // 內建帳號登入，簽發 JWT
+	AuthProviderOIDC       = "oidc"       // 透過 OpenID Connect 提供者登入後簽發 JWT
+)
+
 // AuthConfig 認證配置
 type AuthConfig struct {
-	JWTSecret     string
-	TokenExpiry   int
-	RefreshExpiry int
+	Provider              string // cloudflare 或 local-jwt
+	JWTSecret             string
+	TokenExpiry           int // 存取令牌有效時間（小時）
+	RefreshExpiry         int // 刷新令牌有效時間（小時）
+	LoginCodeExpiry       int // 一次性登入碼有效時間（分鐘）
+	LoginMaxAttempts      int // 同一帳號在鎖定時間內允許的登入失敗次數，0 表示不限制
+	LoginMaxAttemptsPerIP int // 同一 IP 在鎖定時間內允許的登入失敗與索取登入碼次數，0 表示不限制
+	LoginLockoutMinutes   int // 計算嘗試次數的時間窗與鎖定時間（分鐘）
+}
+
+// MailConfig 郵件寄送配置（一次性登入碼），未設定 SMTP 主機時無法使用登入碼
+type MailConfig struct {
+	SMTPHost     string
+	SMTPPort     int // 支援 STARTTLS 的連接埠，通常為 587
+	SMTPUsername string
+	SMTPPassword string
+	From         string // 寄件者，例如 MemoryArk <noreply@example.com>
+}
+
+// IsLocalJWT 是否使用內建 JWT 登入
+func (c AuthConfig) IsLocalJWT() bool {
+	return c.Provider == AuthProviderLocalJWT
+}
+
+// UsesLocalSessions 是否由 MemoryArk 自行簽發與驗證 JWT（local-jwt 與 oidc）
+func (c AuthConfig) UsesLocalSessions() bool {
+	return c.Provider == AuthProviderLocalJWT || c.Provider == AuthProviderOIDC
+}
+
+// OIDCConfig OpenID Connect 登入配置
+type OIDCConfig struct {
+	IssuerURL            string   // 提供者的 issuer，例如 https://accounts.google.com
+	ClientID             string
+	ClientSecret         string
+	RedirectURL          string   // 回呼位址，例如 https://example.com/api/auth/oidc/callback
+	Scopes               []string
+	EmailClaim           string   // 對應到用戶 email 的 claim
+	NameClaim            string   // 對應到用戶名稱的 claim
+	AllowedDomains       []string // 允許的 email 網域，空白表示不限制
+	RequireVerifiedEmail bool     // 要求 email_verified 為 true
+	PostLoginRedirect    string   // 登入完成後導向的前端位址
+}
+
+// Enabled 是否已設定 OIDC 登入
+func (c OIDCConfig) Enabled() bool {
+	return c.IssuerURL != "" && c.ClientID != "" && c.RedirectURL != ""
 }
 
 // UploadConfig 上傳配置
@@ -45,6 +103,7 @@ type UploadConfig struct {
 	MaxFileSize  int64
 	AllowedTypes []string
 	UploadPath   string
+	VersionRetention int // 每個檔案保留的歷史版本數量，0 表示不限制
 }
 
 // StorageConfig 儲存空間配置
@@ -54,10 +113,44 @@ type StorageConfig struct {
 
 // CloudflareConfig Cloudflare 配置
 type CloudflareConfig struct {
-	Domain       string
-	ClientID     string
-	ClientSecret string
-	Enabled      bool
+	Domain           string // Cloudflare Access 團隊網域，例如 myteam.cloudflareaccess.com
+	ClientID         string
+	ClientSecret     string
+	Enabled          bool
+	Audience         string // Access 應用程式的 AUD 標籤
+	CertsURL         string // JWKS 位址，預設為 https://<Domain>/cdn-cgi/access/certs
+	TrustEmailHeader bool   // 不驗證 JWT，直接信任 Email 標頭（僅限源站無法被直接連線時）
+}
+
+// TeamURL 返回團隊網域的完整 URL（同時也是 JWT 的 issuer）
+func (c CloudflareConfig) TeamURL() string {
+	domain := strings.TrimSuffix(strings.TrimSpace(c.Domain), "/")
+	if domain == "" {
+		return ""
+	}
+	if !strings.HasPrefix(domain, "http://") && !strings.HasPrefix(domain, "https://") {
+		domain = "https://" + domain
+	}
+	return domain
+}
+
+// JWKSURL 返回簽章公鑰的位址
+func (c CloudflareConfig) JWKSURL() string {
+	if c.CertsURL != "" {
+		return c.CertsURL
+	}
+	if team := c.TeamURL(); team != "" {
+		return team + "/cdn-cgi/access/certs"
+	}
+	return ""
+}
+
+// AudienceTag 返回驗證用的 AUD，未設定時沿用 ClientID
+func (c CloudflareConfig) AudienceTag() string {
+	if c.Audience != "" {
+		return c.Audience
+	}
+	return c.ClientID
 }
 
 // AdminConfig 管理員配置
@@ -85,6 +178,35 @@ type APIConfig struct {
 	LineServiceToken string // LINE Service API Token
 }
 
+// AuditConfig 操作記錄防竄改配置
+type AuditConfig struct {
+	CheckpointInterval int    // 自動建立檢查點的間隔（小時），0 表示停用
+	CheckpointFile     string // 檢查點匯出檔（JSONL），應定期備份到其他位置
+	CheckpointKey      string // 檢查點簽章金鑰（HMAC-SHA256），空白表示不簽章
+}
+
+// TrashConfig 垃圾桶保留配置
+type TrashConfig struct {
+	RetentionDays int // 項目移至垃圾桶後保留的天數，0 表示不自動永久刪除
+	PurgeInterval int // 檢查過期項目的間隔（小時）
+}
+
+// OperationConfig 檔案操作記錄配置
+type OperationConfig struct {
+	UndoWindow int // 移動、重新命名、複製與刪除可復原的期限（分鐘）
+}
+
+// JobConfig 背景工作配置
+type JobConfig struct {
+	Workers int // 同時執行的背景工作數量
+}
+
+// FolderTemplateConfig 資料夾範本排程配置
+type FolderTemplateConfig struct {
+	CheckInterval int    // 檢查是否需要建立排程資料夾的間隔（分鐘），0 表示停用自動建立
+	Timezone      string // 解讀 cron 排程與日期佔位符的時區，空白表示伺服器時區
+}
+
 // Load 載入配置
 func Load() (*Config, error) {
 	// 載入 .env 文件（如果存在）
@@ -100,14 +222,27 @@ func Load() (*Config, error) {
 			Path: getEnv("DATABASE_PATH", "./data/memoryark.db"),
 		},
 		Auth: AuthConfig{
-			JWTSecret:     getEnv("JWT_SECRET", "memoryark-secret-key"),
-			TokenExpiry:   getEnvInt("TOKEN_EXPIRY", 24),
-			RefreshExpiry: getEnvInt("REFRESH_EXPIRY", 168),
+			Provider:              strings.ToLower(getEnv("AUTH_PROVIDER", AuthProviderCloudflare)),
+			JWTSecret:             getEnv("JWT_SECRET", "memoryark-secret-key"),
+			TokenExpiry:           getEnvInt("TOKEN_EXPIRY", 24),
+			RefreshExpiry:         getEnvInt("REFRESH_EXPIRY", 168),
+			LoginCodeExpiry:       getEnvInt("LOGIN_CODE_EXPIRY", 10),
+			LoginMaxAttempts:      getEnvInt("LOGIN_MAX_ATTEMPTS", 5),
+			LoginMaxAttemptsPerIP: getEnvInt("LOGIN_MAX_ATTEMPTS_PER_IP", 20),
+			LoginLockoutMinutes:   getEnvInt("LOGIN_LOCKOUT_MINUTES", 15),
+		},
+		Mail: MailConfig{
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     getEnvInt("SMTP_PORT", 587),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			From:         getEnv("MAIL_FROM", ""),
 		},
 		Upload: UploadConfig{
 			MaxFileSize:  getEnvInt64("MAX_FILE_SIZE", 100*1024*1024), // 100MB
 			AllowedTypes: []string{".jpg", ".jpeg", ".png", ".gif", ".mp4", ".mp3", ".wav", ".pdf", ".doc", ".docx"},
 			UploadPath:   getEnv("UPLOAD_PATH", "./uploads"),
+			VersionRetention: getEnvInt("FILE_VERSION_RETENTION", 10),
 		},
 		Storage: StorageConfig{
 			TotalCapacity: getEnvInt64("TOTAL_STORAGE_CAPACITY", 10*1024*1024*1024), // 10GB 默認
@@ -117,6 +252,21 @@ func Load() (*Config, error) {
 			ClientID:     getEnv("CLOUDFLARE_CLIENT_ID", ""),
 			ClientSecret: getEnv("CLOUDFLARE_CLIENT_SECRET", ""),
 			Enabled:      getEnvBool("CLOUDFLARE_ENABLED", false),
+			Audience:         getEnv("CLOUDFLARE_AUD", ""),
+			CertsURL:         getEnv("CLOUDFLARE_CERTS_URL", ""),
+			TrustEmailHeader: getEnvBool("CLOUDFLARE_TRUST_EMAIL_HEADER", false),
+		},
+		OIDC: OIDCConfig{
+			IssuerURL:            strings.TrimSuffix(getEnv("OIDC_ISSUER_URL", ""), "/"),
+			ClientID:             getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret:         getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:          getEnv("OIDC_REDIRECT_URL", ""),
+			Scopes:               getEnvList("OIDC_SCOPES", []string{"openid", "email", "profile"}),
+			EmailClaim:           getEnv("OIDC_EMAIL_CLAIM", "email"),
+			NameClaim:            getEnv("OIDC_NAME_CLAIM", "name"),
+			AllowedDomains:       getEnvList("OIDC_ALLOWED_DOMAINS", nil),
+			RequireVerifiedEmail: getEnvBool("OIDC_REQUIRE_VERIFIED_EMAIL", true),
+			PostLoginRedirect:    getEnv("OIDC_POST_LOGIN_REDIRECT", "/"),
 		},
 		Admin: AdminConfig{
 			RootEmail: getEnv("ROOT_ADMIN_EMAIL", ""),
@@ -135,6 +285,25 @@ func Load() (*Config, error) {
 		API: APIConfig{
 			LineServiceToken: getEnv("LINE_SERVICE_API_TOKEN", ""),
 		},
+		Audit: AuditConfig{
+			CheckpointInterval: getEnvInt("AUDIT_CHECKPOINT_INTERVAL", 24),
+			CheckpointFile:     getEnv("AUDIT_CHECKPOINT_FILE", "./data/audit-checkpoints.jsonl"),
+			CheckpointKey:      getEnv("AUDIT_CHECKPOINT_KEY", ""),
+		},
+		Trash: TrashConfig{
+			RetentionDays: getEnvInt("TRASH_RETENTION_DAYS", 0),
+			PurgeInterval: getEnvInt("TRASH_PURGE_INTERVAL", 6),
+		},
+		Operation: OperationConfig{
+			UndoWindow: getEnvInt("OPERATION_UNDO_WINDOW", 60),
+		},
+		Jobs: JobConfig{
+			Workers: getEnvInt("JOB_WORKERS", 2),
+		},
+		FolderTemplates: FolderTemplateConfig{
+			CheckInterval: getEnvInt("FOLDER_TEMPLATE_CHECK_INTERVAL", 10),
+			Timezone:      getEnv("FOLDER_TEMPLATE_TIMEZONE", ""),
+		},
 	}
 	
 	return config, nil
@@ -168,6 +337,21 @@ func getEnvInt64(key string, defaultValue int64) int64 {
 	return defaultValue
 }
 
+// getEnvList 獲取以逗號或空白分隔的清單環境變量
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	if len(fields) == 0 {
+		return defaultValue
+	}
+	return fields
+}
+
 // getEnvBool 獲取布爾環境變量
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
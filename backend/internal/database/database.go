@@ -55,6 +55,14 @@ func Initialize(dbPath string) (*gorm.DB, error) {
 	return db, nil
 }
 
+// OpenExisting 開啟既有的數據庫（不執行遷移，供命令列工具使用）
+func OpenExisting(dbPath string) (*gorm.DB, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+	return gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+}
+
 // autoMigrate 自動遷移數據庫表
 func autoMigrate(db *gorm.DB) error {
 	
@@ -63,11 +71,28 @@ func autoMigrate(db *gorm.DB) error {
 		&models.User{},
 		&models.UserRegistrationRequest{},
 		&models.File{},
+		&models.FileVersion{},
+		&models.FileOperation{},
+		&models.Job{},
+		&models.UserFileState{},
+		&models.FileLike{},
+		&models.FileComment{},
+		&models.FileCommentMention{},
+		&models.FolderTemplate{},
 		&models.Category{},
 		&models.ExportJob{},
 		&models.FileShare{},
 		&models.ActivityLog{},
+		&models.ActivityLogCheckpoint{},
 		&models.ChunkSession{},
+		&models.UploadLink{},
+		&models.Role{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.LoginCode{},
+		&models.OIDCAuthState{},
+		&models.PersonalAccessToken{},
+		&models.ServiceToken{},
 		// LINE 功能相關模型
 		&models.LineUploadRecord{},
 		&models.LineUser{},
@@ -90,6 +115,11 @@ func autoMigrate(db *gorm.DB) error {
 		log.Printf("Warning: Failed to initialize LINE settings: %v", err)
 	}
 
+	// 初始化預設角色
+	if err := InitializeDefaultRoles(db); err != nil {
+		log.Printf("Warning: Failed to initialize default roles: %v", err)
+	}
+
 	return nil
 }
 
@@ -175,6 +205,23 @@ func initializeLineSettings(db *gorm.DB) error {
 	return nil
 }
 
+// InitializeDefaultRoles 建立缺少的預設角色（已存在的角色保留管理員的調整）
+func InitializeDefaultRoles(db *gorm.DB) error {
+	for _, role := range models.DefaultRoles() {
+		var count int64
+		db.Model(&models.Role{}).Where("name = ?", role.Name).Count(&count)
+		if count > 0 {
+			continue
+		}
+
+		log.Printf("Creating default role: %s", role.Name)
+		if err := db.Create(&role).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // handleLegacyMigrations 處理舊版資料庫相容性問題
 func handleLegacyMigrations(db *gorm.DB) error {
 	// 檢查是否存在舊版的 migration_history 表
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"crypto/subtle"
+	"log"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/auth"
+	"memoryark/internal/config"
+	"memoryark/internal/models"
+)
+
+// lineServiceClientName 由 LINE_SERVICE_API_TOKEN 匯入的服務令牌名稱
+const lineServiceClientName = "line_service"
+
+// InitializeServiceTokens 將舊版 LINE_SERVICE_API_TOKEN 匯入服務令牌表。
+// 已存在時不覆寫，之後的輪替請使用管理介面。
+func InitializeServiceTokens(db *gorm.DB, cfg *config.Config) error {
+	legacy := cfg.API.LineServiceToken
+	if legacy == "" {
+		return nil
+	}
+
+	hash := auth.HashToken(legacy)
+
+	var existing models.ServiceToken
+	err := db.Where("client_name = ?", lineServiceClientName).First(&existing).Error
+	if err == nil {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(existing.TokenHash)) != 1 &&
+			subtle.ConstantTimeCompare([]byte(hash), []byte(existing.PreviousTokenHash)) != 1 {
+			log.Printf("Warning: LINE_SERVICE_API_TOKEN differs from the registered %s service token and is ignored; rotate it via /api/admin/service-tokens", lineServiceClientName)
+		}
+		return nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	log.Printf("Importing LINE_SERVICE_API_TOKEN as service token %q", lineServiceClientName)
+	return db.Create(&models.ServiceToken{
+		ClientName:  lineServiceClientName,
+		Description: "由 LINE_SERVICE_API_TOKEN 匯入",
+		TokenHash:   hash,
+		Scopes: models.StringList{
+			models.ServiceScopeFilesRead,
+			models.ServiceScopeFilesUpload,
+			models.ServiceScopeLineUsers,
+			models.ServiceScopeLineRecords,
+		},
+		IsActive: true,
+	}).Error
+}
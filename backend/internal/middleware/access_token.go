@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/auth"
+)
+
+// AuthTypePersonalAccessToken 以個人存取令牌認證的請求
+const AuthTypePersonalAccessToken = "personal_access_token"
+
+// personalAccessTokenAuth 以個人存取令牌認證，並記錄令牌範圍供權限檢查使用
+func personalAccessTokenAuth(c *gin.Context, db *gorm.DB, raw string) {
+	token, user, err := auth.AuthenticatePersonalAccessToken(db, raw, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAccessToken) {
+			abortUnauthorized(c, "ACCESS_TOKEN_INVALID", "Invalid, expired or revoked access token")
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "DATABASE_ERROR",
+			"message": "Failed to verify access token",
+		})
+		c.Abort()
+		return
+	}
+
+	setAuthenticatedUser(c, *user)
+	c.Set("auth_type", AuthTypePersonalAccessToken)
+	c.Set("access_token_id", token.ID)
+	c.Set("token_scopes", []string(token.Scopes))
+
+	c.Next()
+}
+
+// RequireInteractiveSession 只允許瀏覽器登入的請求，拒絕個人存取令牌（例如管理令牌或變更密碼）
+func RequireInteractiveSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_type") == AuthTypePersonalAccessToken {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"error":   "INTERACTIVE_SESSION_REQUIRED",
+				"message": "This action cannot be performed with an access token",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
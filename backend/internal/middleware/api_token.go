@@ -1,18 +1,29 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/auth"
 	"memoryark/internal/config"
+	"memoryark/internal/models"
 )
 
 // APITokenMiddleware API Token 認證中間件
-// 用於驗證服務間通信的 API Token (如 LINE Service 呼叫 MemoryArk API)
-func APITokenMiddleware(cfg *config.Config) gin.HandlerFunc {
+// 用於驗證服務間通信的服務令牌 (如 LINE Service 呼叫 MemoryArk API)，
+// 也接受個人存取令牌，以令牌所屬用戶的身分執行
+func APITokenMiddleware(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 個人存取令牌：對應到真實用戶
+		if token := auth.BearerToken(c.Request); auth.IsPersonalAccessToken(token) {
+			personalAccessTokenAuth(c, db, token)
+			return
+		}
+
 		// 開發模式：跳過 API Token 檢查但仍設置必要的上下文
 		if cfg.Development.Enabled && cfg.Development.BypassAuth {
 			fmt.Printf("🔧 API Token DEBUG: 開發模式跳過 API Token 驗證 - %s %s\n", 
@@ -25,93 +36,84 @@ func APITokenMiddleware(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
-		// 生產模式：檢查 API Token
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"error":   "Missing Authorization header",
-				"code":    "MISSING_API_TOKEN",
-			})
-			return
-		}
-
-		// 檢查 Bearer Token 格式
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"error":   "Invalid Authorization header format. Expected: Bearer <token>",
-				"code":    "INVALID_TOKEN_FORMAT",
-			})
-			return
-		}
-
-		// 提取 Token
-		apiToken := strings.TrimPrefix(authHeader, "Bearer ")
+		// 生產模式：檢查服務令牌
+		apiToken := auth.BearerToken(c.Request)
 		if apiToken == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"success": false,
-				"error":   "Empty API token",
-				"code":    "EMPTY_API_TOKEN",
+				"error":   "Missing or malformed Authorization header. Expected: Bearer <token>",
+				"code":    "MISSING_API_TOKEN",
 			})
 			return
 		}
 
-		// 驗證 API Token
-		if !validateAPIToken(apiToken, cfg) {
-			fmt.Printf("🚨 API Token 驗證失敗: %s from %s\n", apiToken[:8]+"...", c.ClientIP())
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"error":   "Invalid API token",
-				"code":    "INVALID_API_TOKEN",
-			})
+		serviceToken, err := auth.AuthenticateServiceToken(db, apiToken, c.ClientIP())
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrServiceTokenIPDenied):
+				fmt.Printf("🚨 服務令牌來源 IP 不允許: client=%s ip=%s\n", serviceToken.ClientName, c.ClientIP())
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"success": false,
+					"error":   "Client IP not allowed",
+					"code":    "API_TOKEN_IP_DENIED",
+				})
+			case errors.Is(err, auth.ErrInvalidServiceToken):
+				fmt.Printf("🚨 API Token 驗證失敗 from %s\n", c.ClientIP())
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"success": false,
+					"error":   "Invalid API token",
+					"code":    "INVALID_API_TOKEN",
+				})
+			default:
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"error":   "Failed to verify API token",
+					"code":    "DATABASE_ERROR",
+				})
+			}
 			return
 		}
 
 		// 驗證成功，設置服務身份
-		c.Set("api_client", "line_service")
+		c.Set("api_client", serviceToken.ClientName)
 		c.Set("auth_type", "api_token")
+		c.Set("service_token", serviceToken)
 		// 為 API 服務設置一個特殊的 service user ID (使用 0 表示系統服務)
 		c.Set("user_id", uint(0))
-		
-		fmt.Printf("✅ API Token 驗證成功: %s from %s\n", apiToken[:8]+"...", c.ClientIP())
+
 		c.Next()
 	}
 }
 
-// validateAPIToken 驗證 API Token 是否有效
-func validateAPIToken(token string, cfg *config.Config) bool {
-	// 從環境變數或配置中取得有效的 API Token 列表
-	validTokens := getValidAPITokens(cfg)
-	
-	for _, validToken := range validTokens {
-		if token == validToken {
-			return true
+// RequireClientAccess 檢查 /api-access 端點的呼叫權限：
+// 服務令牌需具備 serviceScope；個人存取令牌需具備 permissions（未指定時拒絕個人存取令牌）
+func RequireClientAccess(db *gorm.DB, serviceScope string, permissions ...string) gin.HandlerFunc {
+	checkPermissions := RequirePermission(db, permissions...)
+	return func(c *gin.Context) {
+		switch c.GetString("auth_type") {
+		case AuthTypePersonalAccessToken:
+			if len(permissions) == 0 {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"success": false,
+					"error":   "Service token required",
+					"code":    "SERVICE_TOKEN_REQUIRED",
+				})
+				return
+			}
+			checkPermissions(c)
+			return
+		case "api_token":
+			token, _ := c.Get("service_token")
+			if serviceToken, ok := token.(*models.ServiceToken); !ok || !serviceToken.HasScope(serviceScope) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"success": false,
+					"error":   "Service token scope does not allow this endpoint",
+					"code":    "API_TOKEN_SCOPE_DENIED",
+					"scope":   serviceScope,
+				})
+				return
+			}
 		}
+		c.Next()
 	}
-	
-	return false
 }
-
-// getValidAPITokens 取得有效的 API Token 列表
-func getValidAPITokens(cfg *config.Config) []string {
-	// 這裡可以從多個來源取得有效 Token：
-	// 1. 環境變數
-	// 2. 資料庫
-	// 3. 配置文件
-	// 4. 外部服務
-	
-	var tokens []string
-	
-	// 1. 從環境變數取得 LINE Service Token
-	if lineToken := cfg.API.LineServiceToken; lineToken != "" {
-		tokens = append(tokens, lineToken)
-	}
-	
-	// 2. 未來可以擴展其他服務的 Token
-	// if otherServiceToken := cfg.API.OtherServiceToken; otherServiceToken != "" {
-	//     tokens = append(tokens, otherServiceToken)
-	// }
-	
-	return tokens
-}
\ No newline at end of file
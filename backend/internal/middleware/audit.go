@@ -0,0 +1,241 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/services"
+)
+
+// auditMaxBody 稽核時讀取請求與回應內容的上限
+const auditMaxBody = 1 << 20
+
+// auditRequestIDKeys 批次操作時請求內容中列出資源識別碼的欄位
+var auditRequestIDKeys = []string{"file_ids", "ids"}
+
+// auditSensitiveKeys 不寫入稽核記錄的請求欄位
+var auditSensitiveKeys = map[string]bool{
+	"password": true, "current_password": true, "new_password": true,
+	"token": true, "refresh_token": true, "code": true, "client_secret": true,
+}
+
+// auditResponseWriter 保留回應內容以取得新建立資源的識別碼
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	if w.body.Len() < auditMaxBody {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *auditResponseWriter) WriteString(s string) (int, error) {
+	if w.body.Len() < auditMaxBody {
+		w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// auditTarget 一次操作涉及的單一資源
+type auditTarget struct {
+	key    string
+	before services.AuditSnapshot
+}
+
+// Audit 將成功的異動操作寫入操作記錄，並保存資源的前後差異
+// param 為路由中資源識別碼的參數名稱；留空時改由請求中的 file_ids / ids，
+// 或回應中新建立的資源決定稽核對象
+func Audit(db *gorm.DB, action, resourceType, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		request := readAuditRequest(c)
+
+		var keys []string
+		if param != "" {
+			if key := c.Param(param); key != "" {
+				keys = []string{key}
+			}
+		} else {
+			keys = requestTargetKeys(request)
+		}
+
+		targets := make([]auditTarget, 0, len(keys))
+		for _, key := range keys {
+			before, err := services.SnapshotResource(db, resourceType, key)
+			if err != nil {
+				log.Printf("讀取稽核快照失敗 (%s %s): %v", resourceType, key, err)
+			}
+			targets = append(targets, auditTarget{key: key, before: before})
+		}
+
+		writer := &auditResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		status := writer.Status()
+		if status >= 400 || c.IsAborted() {
+			return
+		}
+
+		if len(targets) == 0 {
+			for _, key := range responseTargetKeys(writer.body.Bytes()) {
+				targets = append(targets, auditTarget{key: key})
+			}
+		}
+		if len(targets) == 0 {
+			// 無法辨識個別資源時仍記錄操作本身
+			targets = append(targets, auditTarget{})
+		}
+
+		ctx := services.AuditContext{
+			Method:   c.Request.Method,
+			Route:    c.FullPath(),
+			Status:   status,
+			AuthType: c.GetString("auth_type"),
+			Client:   c.GetString("api_client"),
+			Request:  redactAuditRequest(request),
+		}
+		userID := c.GetUint("user_id")
+
+		for _, target := range targets {
+			after, err := services.SnapshotResource(db, resourceType, target.key)
+			if err != nil {
+				log.Printf("讀取稽核快照失敗 (%s %s): %v", resourceType, target.key, err)
+			}
+			if err := services.RecordAudit(db, userID, c.ClientIP(), action, resourceType, target.key, target.before, after, ctx); err != nil {
+				log.Printf("寫入操作記錄失敗 (%s %s): %v", action, target.key, err)
+			}
+		}
+	}
+}
+
+// readAuditRequest 讀取 JSON 請求內容並還原給後續處理器使用
+func readAuditRequest(c *gin.Context) map[string]interface{} {
+	if c.Request.Body == nil || !strings.HasPrefix(c.ContentType(), "application/json") {
+		return nil
+	}
+	if c.Request.ContentLength > auditMaxBody {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, auditMaxBody))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	if err != nil || len(body) == 0 {
+		return nil
+	}
+
+	var request map[string]interface{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil
+	}
+	return request
+}
+
+// redactAuditRequest 移除密碼、令牌等不應保存的欄位
+func redactAuditRequest(request map[string]interface{}) map[string]interface{} {
+	if len(request) == 0 {
+		return nil
+	}
+	result := make(map[string]interface{}, len(request))
+	for key, value := range request {
+		if auditSensitiveKeys[key] {
+			continue
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// requestTargetKeys 取得批次操作請求中的資源識別碼
+func requestTargetKeys(request map[string]interface{}) []string {
+	for _, field := range auditRequestIDKeys {
+		if values, ok := request[field].([]interface{}); ok {
+			return auditKeys(values, "")
+		}
+	}
+	return nil
+}
+
+// responseTargetKeys 取得回應中新建立資源的識別碼
+// 支援 data.id、data 下單一物件的 id（如 data.file、data.category），
+// 以及批次結果中的 uploaded_files[].id 與 success_files[].new_id
+func responseTargetKeys(body []byte) []string {
+	var response map[string]interface{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil
+	}
+	root := response
+	if data, ok := response["data"].(map[string]interface{}); ok {
+		root = data
+	}
+
+	if key := auditKey(root["id"]); key != "" {
+		return []string{key}
+	}
+	if files, ok := root["uploaded_files"].([]interface{}); ok {
+		return auditKeys(files, "id")
+	}
+	if files, ok := root["success_files"].([]interface{}); ok {
+		return auditKeys(files, "new_id")
+	}
+
+	var keys []string
+	names := make([]string, 0, len(root))
+	for name := range root {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if object, ok := root[name].(map[string]interface{}); ok {
+			if key := auditKey(object["id"]); key != "" {
+				keys = append(keys, key)
+			}
+		}
+	}
+	if len(keys) != 1 {
+		return nil
+	}
+	return keys
+}
+
+// auditKeys 將識別碼陣列（或物件陣列中的指定欄位）轉為字串
+func auditKeys(values []interface{}, field string) []string {
+	keys := make([]string, 0, len(values))
+	for _, value := range values {
+		if field != "" {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			value = object[field]
+		}
+		if key := auditKey(value); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// auditKey 將 JSON 中的識別碼轉為字串
+func auditKey(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		if v > 0 {
+			return strconv.FormatUint(uint64(v), 10)
+		}
+	case string:
+		return v
+	}
+	return ""
+}
@@ -1,15 +1,34 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"memoryark/internal/auth"
 	"memoryark/internal/config"
 	"memoryark/internal/models"
 )
 
+// AuthMiddleware 依 AUTH_PROVIDER 選擇認證方式
+// 帶有個人存取令牌的請求不論認證方式都以令牌認證
+func AuthMiddleware(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
+	providerAuth := CloudflareAccessMiddleware(cfg, db)
+	if cfg.Auth.UsesLocalSessions() {
+		providerAuth = LocalJWTMiddleware(cfg, db)
+	}
+
+	return func(c *gin.Context) {
+		if token := auth.BearerToken(c.Request); auth.IsPersonalAccessToken(token) {
+			personalAccessTokenAuth(c, db, token)
+			return
+		}
+		providerAuth(c)
+	}
+}
+
 // CloudflareAccessMiddleware Cloudflare Access 認證中間件
 func CloudflareAccessMiddleware(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -18,56 +37,27 @@ func CloudflareAccessMiddleware(cfg *config.Config, db *gorm.DB) gin.HandlerFunc
 			c.Request.Method, c.Request.URL.Path, cfg.Development.Enabled, cfg.Development.BypassAuth)
 		
 		// 開發者模式：直接給予管理員權限，跳過所有檢查
-		if cfg.Development.Enabled && cfg.Development.BypassAuth {
-			// DEBUG: 添加日誌來確認開發模式
-			fmt.Printf("🔧 DEBUG: 開發模式繞過認證 - %s %s\n", c.Request.Method, c.Request.URL.Path)
-			devEmail := cfg.Development.AutoLoginEmail
-			if devEmail == "" {
-				devEmail = cfg.Admin.RootEmail
-			}
-			fmt.Printf("🔧 DEBUG: 使用開發者郵箱: %s\n", devEmail)
-			
-			// 查詢資料庫中對應的用戶ID
-			var user models.User
-			if err := db.Where("email = ?", devEmail).First(&user).Error; err == nil {
-				// 找到對應用戶，使用真實的用戶資料
-				fmt.Printf("🔧 DEBUG: 找到用戶 ID=%d, Email=%s\n", user.ID, user.Email)
-				c.Set("user_id", user.ID)
-				c.Set("user_email", user.Email)
-				c.Set("user_role", user.Role)
-				c.Set("user", user)
-			} else {
-				// 找不到對應用戶，使用預設管理員 (ID=1)
-				fmt.Printf("🔧 DEBUG: 用戶不存在 (%v)，使用預設管理員\n", err)
-				c.Set("user_id", uint(1))
-				c.Set("user_email", devEmail)
-				c.Set("user_role", "admin")
-				c.Set("user", models.User{
-					ID:     1,
-					Email:  devEmail,
-					Name:   cfg.Admin.RootName,
-					Role:   "admin",
-					Status: "approved",
-				})
-			}
-			fmt.Printf("🔧 DEBUG: 設置完畢，呼叫 c.Next()\n")
-			c.Next()
-			fmt.Printf("🔧 DEBUG: c.Next() 完成\n")
+		if applyDevelopmentBypass(c, cfg, db) {
 			return
 		}
 
-		// 正常模式：檢查 Cloudflare Access 標頭
-		cfAccessEmail := c.GetHeader("CF-Access-Authenticated-User-Email")
-		if cfAccessEmail == "" {
-			cfAccessEmail = c.GetHeader("Cf-Access-Authenticated-User-Email")
-		}
-		if cfAccessEmail == "" {
-			cfAccessEmail = c.GetHeader("cf-access-authenticated-user-email")
-		}
-		if cfAccessEmail == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
+		// 正常模式：驗證 Cloudflare Access JWT 簽章後取得用戶郵箱
+		cfAccessEmail, err := auth.CloudflareEmailFromRequest(c.Request, cfg.Cloudflare)
+		if err != nil {
+			status := http.StatusUnauthorized
+			code := "CF_ACCESS_TOKEN_INVALID"
+			switch {
+			case errors.Is(err, auth.ErrMissingCloudflareToken):
+				code = "CF_ACCESS_HEADER_MISSING"
+			case errors.Is(err, auth.ErrCloudflareNotConfigured):
+				status = http.StatusServiceUnavailable
+				code = "CF_ACCESS_NOT_CONFIGURED"
+			default:
+				fmt.Printf("[WARN] Cloudflare Access JWT 驗證失敗: %v\n", err)
+			}
+			c.JSON(status, gin.H{
 				"success": false,
-				"error": "CF_ACCESS_HEADER_MISSING",
+				"error": code,
 				"message": "Cloudflare Access authentication required",
 			})
 			c.Abort()
@@ -106,15 +96,57 @@ func CloudflareAccessMiddleware(cfg *config.Config, db *gorm.DB) gin.HandlerFunc
 		}
 
 		// 將用戶信息存儲到上下文
-		c.Set("user_id", user.ID)
-		c.Set("user_email", user.Email)
-		c.Set("user_role", user.Role)
-		c.Set("user", user)
+		setAuthenticatedUser(c, user)
 		
 		c.Next()
 	}
 }
 
+// applyDevelopmentBypass 開發者模式下直接以開發者帳號登入，返回 true 表示已處理請求
+func applyDevelopmentBypass(c *gin.Context, cfg *config.Config, db *gorm.DB) bool {
+	if !cfg.Development.Enabled || !cfg.Development.BypassAuth {
+		return false
+	}
+
+	// DEBUG: 添加日誌來確認開發模式
+	fmt.Printf("🔧 DEBUG: 開發模式繞過認證 - %s %s\n", c.Request.Method, c.Request.URL.Path)
+	devEmail := cfg.Development.AutoLoginEmail
+	if devEmail == "" {
+		devEmail = cfg.Admin.RootEmail
+	}
+	fmt.Printf("🔧 DEBUG: 使用開發者郵箱: %s\n", devEmail)
+
+	// 查詢資料庫中對應的用戶ID
+	var user models.User
+	if err := db.Where("email = ?", devEmail).First(&user).Error; err == nil {
+		// 找到對應用戶，使用真實的用戶資料
+		fmt.Printf("🔧 DEBUG: 找到用戶 ID=%d, Email=%s\n", user.ID, user.Email)
+		setAuthenticatedUser(c, user)
+	} else {
+		// 找不到對應用戶，使用預設管理員 (ID=1)
+		fmt.Printf("🔧 DEBUG: 用戶不存在 (%v)，使用預設管理員\n", err)
+		setAuthenticatedUser(c, models.User{
+			ID:     1,
+			Email:  devEmail,
+			Name:   cfg.Admin.RootName,
+			Role:   "admin",
+			Status: "approved",
+		})
+	}
+	fmt.Printf("🔧 DEBUG: 設置完畢，呼叫 c.Next()\n")
+	c.Next()
+	fmt.Printf("🔧 DEBUG: c.Next() 完成\n")
+	return true
+}
+
+// setAuthenticatedUser 將用戶信息存儲到上下文
+func setAuthenticatedUser(c *gin.Context, user models.User) {
+	c.Set("user_id", user.ID)
+	c.Set("user_email", user.Email)
+	c.Set("user_role", user.Role)
+	c.Set("user", user)
+}
+
 // RequireRole 角色檢查中間件
 func RequireRole(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
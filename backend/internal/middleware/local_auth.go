@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/auth"
+	"memoryark/internal/config"
+	"memoryark/internal/models"
+)
+
+// LocalJWTMiddleware 內建 JWT 認證中間件（AUTH_PROVIDER=local-jwt 或 oidc）
+func LocalJWTMiddleware(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
+	sessions := auth.NewSessionManager(db, cfg.Auth)
+
+	return func(c *gin.Context) {
+		if applyDevelopmentBypass(c, cfg, db) {
+			return
+		}
+
+		tokenString := auth.BearerToken(c.Request)
+		if tokenString == "" {
+			abortUnauthorized(c, "TOKEN_MISSING", "Authorization bearer token required")
+			return
+		}
+
+		claims, err := sessions.ValidateAccessToken(tokenString)
+		if err != nil {
+			if errors.Is(err, auth.ErrTokenRevoked) {
+				abortUnauthorized(c, "TOKEN_REVOKED", "Token has been revoked")
+			} else {
+				abortUnauthorized(c, "TOKEN_INVALID", "Invalid or expired token")
+			}
+			return
+		}
+
+		// 角色與狀態以資料庫為準，令牌簽發後的變更立即生效
+		var user models.User
+		if err := db.First(&user, claims.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				abortUnauthorized(c, "TOKEN_INVALID", "User no longer exists")
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"error":   "DATABASE_ERROR",
+					"message": "Failed to query user",
+				})
+				c.Abort()
+			}
+			return
+		}
+
+		if user.Status != "approved" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"error":   "USER_NOT_APPROVED",
+				"message": "User registration is pending approval",
+			})
+			c.Abort()
+			return
+		}
+
+		setAuthenticatedUser(c, user)
+		c.Set("token_claims", claims)
+
+		c.Next()
+	}
+}
+
+// abortUnauthorized 返回 401 並中止請求
+func abortUnauthorized(c *gin.Context, code, message string) {
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"success": false,
+		"error":   code,
+		"message": message,
+	})
+	c.Abort()
+}
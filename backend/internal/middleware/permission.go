@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"memoryark/internal/auth"
+	"memoryark/internal/models"
+)
+
+// TokenScopes 以個人存取令牌認證時返回令牌範圍，其他認證方式返回 nil
+func TokenScopes(c *gin.Context) []string {
+	if scopes, ok := c.Get("token_scopes"); ok {
+		if list, ok := scopes.([]string); ok {
+			if list == nil {
+				return []string{}
+			}
+			return list
+		}
+	}
+	return nil
+}
+
+// ScopesAllow 未使用令牌（scopes 為 nil）或令牌範圍涵蓋權限時返回 true
+func ScopesAllow(scopes []string, permission string) bool {
+	return scopes == nil || models.TokenScopesAllow(scopes, permission)
+}
+
+// HasPermission 檢查目前請求的用戶角色具備權限；以個人存取令牌認證時令牌範圍也必須涵蓋該權限
+// 供處理器內依資源擁有者等條件判斷權限時使用，規則與 RequirePermission 相同
+func HasPermission(db *gorm.DB, c *gin.Context, permission string) bool {
+	if !auth.HasPermission(db, c.GetString("user_role"), permission) {
+		return false
+	}
+	return ScopesAllow(TokenScopes(c), permission)
+}
+
+// RequirePermission 權限檢查中間件 - 用戶角色必須具備所有列出的權限
+func RequirePermission(db *gorm.DB, permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userRole, exists := c.Get("user_role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "UNAUTHORIZED",
+				"message": "User not authenticated",
+			})
+			c.Abort()
+			return
+		}
+
+		role, err := auth.LoadRole(db, userRole.(string))
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"error":   "INSUFFICIENT_PERMISSIONS",
+				"message": "User role is not defined",
+			})
+			c.Abort()
+			return
+		}
+
+		for _, permission := range permissions {
+			if !role.HasPermission(permission) {
+				c.JSON(http.StatusForbidden, gin.H{
+					"success":    false,
+					"error":      "INSUFFICIENT_PERMISSIONS",
+					"message":    "User does not have required permissions",
+					"permission": permission,
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		// 個人存取令牌只能使用其範圍涵蓋的權限
+		if scopes := TokenScopes(c); scopes != nil {
+			for _, permission := range permissions {
+				if !ScopesAllow(scopes, permission) {
+					c.JSON(http.StatusForbidden, gin.H{
+						"success":    false,
+						"error":      "TOKEN_SCOPE_INSUFFICIENT",
+						"message":    "Access token scope does not allow this action",
+						"permission": permission,
+					})
+					c.Abort()
+					return
+				}
+			}
+		}
+
+		c.Set("user_permissions", []string(role.Permissions))
+		c.Next()
+	}
+}
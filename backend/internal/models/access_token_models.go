@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+// 個人存取令牌的範圍
+const (
+	TokenScopeRead   = "read"   // 瀏覽、搜尋、下載與匯出
+	TokenScopeUpload = "upload" // 上傳檔案與建立資料夾
+	TokenScopeManage = "manage" // 修改、移動、刪除、分享、分類管理、按讚、留言、星號與釘選
+)
+
+// TokenScopePermissions 各範圍涵蓋的權限；實際可用權限仍受用戶角色限制
+var TokenScopePermissions = map[string][]string{
+	TokenScopeRead:   {PermFilesRead, PermExportCreate},
+	TokenScopeUpload: {PermFilesUpload},
+	TokenScopeManage: {PermFilesEdit, PermFilesDelete, PermFilesShare, PermCategoriesCreate, PermFilesComment, PermFilesPersonalize, PermCommentsModerate},
+}
+
+// IsKnownTokenScope 檢查令牌範圍名稱是否有效
+func IsKnownTokenScope(scope string) bool {
+	_, ok := TokenScopePermissions[scope]
+	return ok
+}
+
+// TokenScopesAllow 檢查令牌範圍是否涵蓋指定權限
+func TokenScopesAllow(scopes []string, permission string) bool {
+	for _, scope := range scopes {
+		for _, p := range TokenScopePermissions[scope] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PersonalAccessToken 個人存取令牌 - 供腳本以用戶身分呼叫 API，只保存雜湊值
+type PersonalAccessToken struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	Name        string     `json:"name" gorm:"size:100;not null"`
+	TokenPrefix string     `json:"token_prefix" gorm:"size:16"` // 令牌開頭，方便用戶辨識
+	TokenHash   string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	Scopes      StringList `json:"scopes" gorm:"type:text"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	LastUsedIP  string     `json:"last_used_ip" gorm:"size:45"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// 關聯
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName 指定表名
+func (PersonalAccessToken) TableName() string {
+	return "personal_access_tokens"
+}
+
+// IsActive 令牌未撤銷且未過期
+func (t *PersonalAccessToken) IsActive() bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt)
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// activityLogHashInput 計算雜湊時使用的固定欄位順序
+type activityLogHashInput struct {
+	PrevHash     string `json:"prev_hash"`
+	UserID       uint   `json:"user_id"`
+	Action       string `json:"action"`
+	ResourceType string `json:"resource_type"`
+	ResourceID   *uint  `json:"resource_id"`
+	Details      string `json:"details"`
+	IPAddress    string `json:"ip_address"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// ComputeHash 計算記錄內容與前一筆雜湊的 SHA-256
+func (l *ActivityLog) ComputeHash() string {
+	payload, _ := json.Marshal(activityLogHashInput{
+		PrevHash:     l.PrevHash,
+		UserID:       l.UserID,
+		Action:       l.Action,
+		ResourceType: l.ResourceType,
+		ResourceID:   l.ResourceID,
+		Details:      l.Details,
+		IPAddress:    l.IPAddress,
+		CreatedAt:    l.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// ActivityLogCheckpoint 操作記錄雜湊鏈的檢查點，用於偵測尾端記錄被刪除
+type ActivityLogCheckpoint struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	LastLogID uint      `json:"last_log_id" gorm:"not null;index"`
+	LastHash  string    `json:"last_hash" gorm:"size:64;not null"`
+	LogCount  int64     `json:"log_count" gorm:"not null"`
+	Signature string    `json:"signature,omitempty" gorm:"size:64"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (ActivityLogCheckpoint) TableName() string {
+	return "activity_log_checkpoints"
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken 刷新令牌 - 只保存雜湊值，每次使用後輪替
+type RefreshToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	TokenHash  string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	FamilyID   string     `json:"family_id" gorm:"size:36;not null;index"` // 同一次登入輪替出的令牌屬於同一家族
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	ReplacedBy *uint      `json:"replaced_by"` // 輪替後的新令牌 ID
+	IPAddress  string     `json:"ip_address" gorm:"size:45"`
+	UserAgent  string     `json:"user_agent" gorm:"type:text"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// RevokedToken 已撤銷的存取令牌（依 jti），保留到原本的過期時間
+type RevokedToken struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	JTI       string    `json:"jti" gorm:"size:36;uniqueIndex;not null"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (RevokedToken) TableName() string {
+	return "revoked_tokens"
+}
+
+// LoginCode 一次性登入碼 - 只保存雜湊值
+type LoginCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Email     string     `json:"email" gorm:"size:255;not null;index"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	Attempts  int        `json:"attempts" gorm:"default:0"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (LoginCode) TableName() string {
+	return "login_codes"
+}
+
+// OIDCAuthState OIDC 登入流程中暫存的 state、nonce 與 PKCE verifier，回呼後即刪除
+type OIDCAuthState struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	StateHash    string    `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	Nonce        string    `json:"-" gorm:"size:64;not null"`
+	CodeVerifier string    `json:"-" gorm:"size:128;not null"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (OIDCAuthState) TableName() string {
+	return "oidc_auth_states"
+}
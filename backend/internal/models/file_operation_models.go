@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+)
+
+// 檔案操作類型
+const (
+	FileOperationMove   = "move"
+	FileOperationRename = "rename"
+	FileOperationCopy   = "copy"
+	FileOperationDelete = "delete"
+)
+
+// 檔案操作狀態
+const (
+	FileOperationApplied = "applied"
+	FileOperationUndone  = "undone"
+)
+
+// FileOperation 檔案樹操作記錄 - 保存還原此操作所需的資訊，可在期限內復原
+type FileOperation struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	Type      string     `json:"type" gorm:"size:20;not null"`
+	Summary   string     `json:"summary" gorm:"size:500"`
+	Items     string     `json:"-" gorm:"type:text"` // JSON 格式的 []FileOperationItem
+	Status    string     `json:"status" gorm:"size:20;default:applied;index"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UndoneAt  *time.Time `json:"undone_at"`
+	UndoneBy  *uint      `json:"undone_by"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// 計算欄位
+	ItemCount int  `json:"item_count" gorm:"-"`
+	CanUndo   bool `json:"can_undo" gorm:"-"`
+}
+
+// TableName 指定表名
+func (FileOperation) TableName() string {
+	return "file_operations"
+}
+
+// FileState 項目在操作前後的名稱與位置
+type FileState struct {
+	Name        string `json:"name"`
+	ParentID    *uint  `json:"parent_id"`
+	VirtualPath string `json:"virtual_path"`
+}
+
+// FileOperationItem 操作影響的單一項目及其反向操作所需資訊
+type FileOperationItem struct {
+	FileID      uint       `json:"file_id"`                // 移動、重新命名、刪除的項目或複製產生的複本
+	Before      *FileState `json:"before,omitempty"`       // 移動、重新命名前的狀態
+	After       *FileState `json:"after,omitempty"`        // 移動、重新命名後的狀態
+	AffectedIDs []uint     `json:"affected_ids,omitempty"` // 刪除時一併移至垃圾桶的子孫項目
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+)
+
+// FileLike 用戶對檔案的按讚記錄，每位用戶對同一檔案只能按讚一次
+// File.LikeCount 為按讚數的快取，隨按讚與取消按讚更新
+type FileLike struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	FileID    uint      `json:"file_id" gorm:"not null;uniqueIndex:idx_file_like_user"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_file_like_user;index"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// 關聯
+	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// TableName 指定表名
+func (FileLike) TableName() string {
+	return "file_likes"
+}
+
+// FileComment 檔案留言，ParentID 不為空時為回覆
+// 刪除時只清除內容並保留記錄，讓回覆仍能顯示在原本的討論串中
+type FileComment struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	FileID    uint       `json:"file_id" gorm:"not null;index"`
+	ParentID  *uint      `json:"parent_id" gorm:"index"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	Content   string     `json:"content" gorm:"type:text"`
+	EditedAt  *time.Time `json:"edited_at"`
+	EditedBy  *uint      `json:"edited_by"` // 由版主編輯時與 UserID 不同
+	IsDeleted bool       `json:"is_deleted" gorm:"default:false"`
+	DeletedAt *time.Time `json:"deleted_at"`
+	DeletedBy *uint      `json:"deleted_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	// 關聯
+	User     *User                `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Mentions []FileCommentMention `json:"mentions,omitempty" gorm:"foreignKey:CommentID"`
+
+	// 計算欄位
+	Replies []*FileComment `json:"replies,omitempty" gorm:"-"`
+}
+
+// TableName 指定表名
+func (FileComment) TableName() string {
+	return "file_comments"
+}
+
+// FileCommentMention 留言中 @提及的用戶
+type FileCommentMention struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CommentID uint      `json:"comment_id" gorm:"not null;uniqueIndex:idx_comment_mention"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_comment_mention;index"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// 關聯
+	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// TableName 指定表名
+func (FileCommentMention) TableName() string {
+	return "file_comment_mentions"
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// maxTreeDepth 計算 ID 路徑時允許的最大深度，超過時視為資料夾結構有循環
+const maxTreeDepth = 1000
+
+// ErrFileTreeCycle 父資料夾位於項目自身的子樹中
+var ErrFileTreeCycle = errors.New("資料夾結構出現循環")
+
+// FileTreePath 依父資料夾的 ID 路徑組成項目的 ID 路徑
+// 父資料夾尚未設定 ID 路徑時往上逐層計算；父資料夾不存在時視為根目錄
+func FileTreePath(db *gorm.DB, parentID *uint, id uint) (string, error) {
+	segment := fmt.Sprintf("%d/", id)
+	if parentID == nil {
+		return "/" + segment, nil
+	}
+
+	parentPath := ""
+	currentID := parentID
+	var pending []string
+	for depth := 0; currentID != nil; depth++ {
+		if depth > maxTreeDepth || *currentID == id {
+			return "", ErrFileTreeCycle
+		}
+		var parent File
+		if err := db.Select("id", "parent_id", "tree_path").Limit(1).Find(&parent, *currentID).Error; err != nil {
+			return "", err
+		}
+		if parent.ID == 0 {
+			break
+		}
+		if parent.TreePath != "" {
+			parentPath = parent.TreePath
+			break
+		}
+		pending = append(pending, fmt.Sprintf("%d/", parent.ID))
+		currentID = parent.ParentID
+	}
+	if parentPath == "" {
+		parentPath = "/"
+	}
+	for i := len(pending) - 1; i >= 0; i-- {
+		parentPath += pending[i]
+	}
+	if strings.Contains(parentPath, "/"+segment) {
+		return "", ErrFileTreeCycle
+	}
+	return parentPath + segment, nil
+}
+
+// AfterCreate 建立後依父資料夾設定 ID 路徑
+func (f *File) AfterCreate(tx *gorm.DB) error {
+	db := tx.Session(&gorm.Session{NewDB: true})
+	path, err := FileTreePath(db, f.ParentID, f.ID)
+	if err != nil {
+		return err
+	}
+	f.TreePath = path
+	return db.Model(&File{}).Where("id = ?", f.ID).UpdateColumn("tree_path", path).Error
+}
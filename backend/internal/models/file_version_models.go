@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// FileVersion 檔案的歷史版本 - 目前版本的內容保存在 File 本身
+type FileVersion struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	FileID        uint      `json:"file_id" gorm:"not null;index"`
+	VersionNumber int       `json:"version_number" gorm:"not null"`
+	FilePath      string    `json:"-" gorm:"size:500;not null;index"` // 實體檔案路徑，可能與其他檔案共用（去重）
+	SHA256Hash    string    `json:"sha256_hash" gorm:"size:64;index"`
+	FileSize      int64     `json:"size" gorm:"not null"`
+	MimeType      string    `json:"mime_type" gorm:"size:100"`
+	UploadedBy    uint      `json:"uploaded_by"` // 上傳此版本內容的用戶
+	UploadedAt    time.Time `json:"uploaded_at"` // 此版本內容成為目前版本的時間
+	CreatedAt     time.Time `json:"created_at"`  // 被新版本取代的時間
+
+	// 關聯
+	Uploader *User `json:"uploader,omitempty" gorm:"foreignKey:UploadedBy"`
+}
+
+// TableName 指定表名
+func (FileVersion) TableName() string {
+	return "file_versions"
+}
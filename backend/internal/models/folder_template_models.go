@@ -0,0 +1,88 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// FolderTemplateNode 資料夾範本中的一個資料夾，名稱可使用 {date} 等日期佔位符
+type FolderTemplateNode struct {
+	Name     string               `json:"name"`
+	Children []FolderTemplateNode `json:"children,omitempty"`
+}
+
+// FolderTemplateNodes 以 JSON 儲存的資料夾樹
+type FolderTemplateNodes []FolderTemplateNode
+
+// Value 實現 driver.Valuer 接口
+func (n FolderTemplateNodes) Value() (driver.Value, error) {
+	if n == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan 實現 sql.Scanner 接口
+func (n *FolderTemplateNodes) Scan(value interface{}) error {
+	if value == nil {
+		*n = FolderTemplateNodes{}
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("type assertion to []byte or string failed")
+	}
+
+	if len(bytes) == 0 {
+		*n = FolderTemplateNodes{}
+		return nil
+	}
+	return json.Unmarshal(bytes, n)
+}
+
+// FolderTemplate 資料夾範本 - 依 cron 排程在每次聚會前自動建立固定的資料夾結構
+// Schedule 描述聚會開始的時間，資料夾會提前 LeadDays 天建立，日期佔位符以聚會日期代入
+type FolderTemplate struct {
+	ID          uint                `json:"id" gorm:"primaryKey"`
+	Name        string              `json:"name" gorm:"size:100;uniqueIndex;not null"`
+	Description string              `json:"description" gorm:"type:text"`
+	ParentID    *uint               `json:"parent_id"` // 建立在此資料夾下，空白表示根目錄
+	Structure   FolderTemplateNodes `json:"structure" gorm:"type:text"`
+	CategoryID  *uint               `json:"category_id"`              // 建立的資料夾預設分類
+	Tags        string              `json:"tags" gorm:"size:500"`     // 建立的資料夾預設標籤（逗號分隔）
+	Schedule    string              `json:"schedule" gorm:"size:100"` // cron 表達式（分 時 日 月 星期），空白表示只能手動套用
+	LeadDays    int                 `json:"lead_days"`
+	Enabled     bool                `json:"enabled"`
+	CreatedBy   uint                `json:"created_by" gorm:"not null"` // 建立的資料夾擁有者
+
+	LastServiceAt *time.Time `json:"last_service_at"` // 最後一次已建立資料夾的聚會時間
+	LastRunAt     *time.Time `json:"last_run_at"`
+	LastError     string     `json:"last_error" gorm:"type:text"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// 關聯
+	Category *Category `json:"category,omitempty" gorm:"foreignKey:CategoryID"`
+
+	// 計算欄位
+	NextServiceAt *time.Time `json:"next_service_at,omitempty" gorm:"-"` // 下一次聚會時間
+	NextRunAt     *time.Time `json:"next_run_at,omitempty" gorm:"-"`     // 預計建立資料夾的時間
+}
+
+// TableName 指定表名
+func (FolderTemplate) TableName() string {
+	return "folder_templates"
+}
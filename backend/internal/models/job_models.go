@@ -0,0 +1,56 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 背景工作狀態
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// 背景工作類型
+const (
+	JobTypeCopy              = "copy"
+	JobTypeMove              = "move"
+	JobTypeDelete            = "delete"
+	JobTypeEmptyTrash        = "empty_trash"
+	JobTypeFolderStatsRepair = "folder_stats_repair"
+	JobTypeBulkMetadata      = "bulk_metadata"
+)
+
+// Job 背景工作模型 - 執行耗時的檔案樹操作，重新啟動後會從檢查點繼續
+type Job struct {
+	ID              uint            `json:"id" gorm:"primaryKey"`
+	UserID          uint            `json:"user_id" gorm:"not null;index"`
+	Type            string          `json:"type" gorm:"size:50;not null;index"`
+	Status          string          `json:"status" gorm:"size:20;default:queued;index"`
+	Params          json.RawMessage `json:"params" gorm:"type:text"`
+	Result          json.RawMessage `json:"result,omitempty" gorm:"type:text"`
+	Checkpoint      string          `json:"-" gorm:"type:text"` // 工作中斷後繼續執行所需的狀態
+	Error           string          `json:"error,omitempty" gorm:"type:text"`
+	Total           int             `json:"total" gorm:"default:0"`
+	Processed       int             `json:"processed" gorm:"default:0"`
+	Failed          int             `json:"failed" gorm:"default:0"`
+	Progress        int             `json:"progress" gorm:"default:0"` // 0-100
+	CancelRequested bool            `json:"cancel_requested" gorm:"default:false"`
+	StartedAt       *time.Time      `json:"started_at"`
+	FinishedAt      *time.Time      `json:"finished_at"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Job) TableName() string {
+	return "jobs"
+}
+
+// IsFinished 工作是否已結束
+func (j *Job) IsFinished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCanceled
+}
@@ -14,9 +14,11 @@ type User struct {
 	Role         string         `json:"role" gorm:"size:20;default:user"` // admin, user
 	Status       string         `json:"status" gorm:"size:20;default:pending"` // pending, approved, rejected, suspended
 	AvatarURL    string         `json:"avatar_url" gorm:"size:500"`
+	PasswordHash string         `json:"-" gorm:"size:255"` // 內建 JWT 登入使用，可為空（僅用登入碼）
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	LastLoginAt  *time.Time     `json:"last_login_at"`
+	TokensValidAfter *time.Time `json:"-"` // 此時間之前簽發的存取令牌一律失效（變更密碼、刷新令牌外洩時）
 	ApprovedBy   *uint          `json:"approved_by"`
 	ApprovedAt   *time.Time     `json:"approved_at"`
 	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
@@ -49,6 +51,7 @@ type File struct {
 	OriginalName  string         `json:"originalName" gorm:"size:255;not null"`
 	FilePath      string         `json:"filePath" gorm:"size:500;not null"` // 實體檔案路徑（UUID檔名）
 	VirtualPath   string         `json:"virtualPath" gorm:"size:1000;index"` // 虛擬路徑
+	TreePath      string         `json:"-" gorm:"size:1000;index"` // 祖先 ID 路徑（含自身），例如 /1/5/9/
 	SHA256Hash    string         `json:"sha256Hash" gorm:"size:64;index"` // 檔案雜湊值（去重用）
 	FileSize      int64          `json:"size" gorm:"not null"`
 	MimeType      string         `json:"mimeType" gorm:"size:100"`
@@ -71,6 +74,32 @@ type File struct {
 	BibleReference string        `json:"bibleReference" gorm:"size:255"` // 經文參考
 	LikeCount     int            `json:"likeCount" gorm:"default:0"` // 按讚數
 	
+	// 訪客上傳
+	UploadLinkID  *uint          `json:"uploadLinkId,omitempty" gorm:"index"` // 來源訪客上傳連結
+	GuestName     string         `json:"guestName,omitempty" gorm:"size:255"` // 訪客名稱
+	ReviewStatus  string         `json:"reviewStatus,omitempty" gorm:"size:20;index"` // pending, approved, rejected
+	
+	// 重複內容合併後的捷徑：下載與預覽時使用目標檔案目前的內容，不計入資料夾大小與使用空間
+	ShortcutTargetID *uint       `json:"shortcutTargetId,omitempty" gorm:"index"`
+	
+	// 版本歷史
+	Version           int        `json:"version" gorm:"default:1"` // 目前版本號
+	VersionUploadedBy *uint      `json:"versionUploadedBy,omitempty"` // 上傳目前版本內容的用戶（為空表示 UploadedBy）
+	VersionUpdatedAt  *time.Time `json:"versionUpdatedAt,omitempty"` // 目前版本內容的上傳時間（為空表示 CreatedAt）
+	VersionRetention  *int       `json:"versionRetention,omitempty"` // 資料夾的歷史版本保留數量（為空時沿用上層或全域設定）
+	
+	// 法律保全：資料夾設定後，其下所有項目在垃圾桶中都不會被永久刪除
+	LegalHold       bool   `json:"legalHold" gorm:"default:false"`
+	LegalHoldReason string `json:"legalHoldReason,omitempty" gorm:"size:500"`
+	
+	// 資料夾統計：所有未刪除子孫項目的大小總和與數量，隨上傳、刪除、還原、移動與複製更新
+	TotalSize int64 `json:"totalSize" gorm:"default:0"`
+	ItemCount int64 `json:"itemCount" gorm:"default:0"`
+	
+	// 計算欄位（垃圾桶）
+	PurgesAt    *time.Time `json:"purgesAt,omitempty" gorm:"-"`    // 預計自動永久刪除的時間
+	OnLegalHold bool       `json:"onLegalHold,omitempty" gorm:"-"` // 本身、上層資料夾或分類受法律保全
+	
 	CreatedAt     time.Time      `json:"createdAt"`
 	UpdatedAt     time.Time      `json:"updatedAt"`
 	
@@ -91,6 +120,8 @@ type Category struct {
 	Icon        string    `json:"icon" gorm:"size:100"` // 分類圖示
 	SortOrder   int       `json:"sort_order" gorm:"default:0"` // 排序順序
 	IsActive    bool      `json:"is_active" gorm:"default:true"` // 是否啟用
+	LegalHold       bool   `json:"legal_hold" gorm:"default:false"` // 法律保全：此分類的檔案不會從垃圾桶永久刪除
+	LegalHoldReason string `json:"legal_hold_reason,omitempty" gorm:"size:500"`
 	CreatedBy   uint      `json:"created_by" gorm:"not null"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
@@ -150,6 +181,8 @@ type ActivityLog struct {
 	Details      string    `json:"details" gorm:"type:text"`
 	IPAddress    string    `json:"ip_address" gorm:"size:45"`
 	CreatedAt    time.Time `json:"created_at"`
+	PrevHash     string    `json:"prev_hash" gorm:"size:64"`       // 前一筆記錄的雜湊
+	Hash         string    `json:"hash" gorm:"size:64;index"`      // 本筆內容與 PrevHash 的雜湊
 	
 	// 關聯
 	User         User      `json:"user" gorm:"foreignKey:UserID"`
@@ -0,0 +1,231 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// 權限名稱 - 以「資源.動作」命名，角色可使用 "*" 或 "files.*" 形式的萬用字元
+const (
+	PermFilesRead             = "files.read"
+	PermFilesComment          = "files.comment"     // 按讚與留言
+	PermFilesPersonalize      = "files.personalize" // 自己的星號與釘選資料夾
+	PermFilesUpload           = "files.upload"
+	PermFilesEdit             = "files.edit"   // 更新、移動、重新命名、複製
+	PermFilesDelete           = "files.delete" // 移至垃圾桶與還原
+	PermFilesDeletePermanent  = "files.delete.permanent"
+	PermFilesShare            = "files.share" // 分享連結與訪客上傳連結
+	PermFilesManageAll        = "files.manage_all"
+	PermTrashEmpty            = "trash.empty"
+	PermTrashLegalHold        = "trash.legal_hold" // 設定資料夾與分類的法律保全
+	PermCategoriesCreate      = "categories.create"
+	PermCategoriesManage      = "categories.manage" // 管理他人建立的分類
+	PermExportCreate          = "export.create"
+	PermExportAll             = "export.all" // 匯出所有用戶的檔案
+	PermUploadLinksManage     = "upload_links.manage"
+	PermUsersView             = "users.view"
+	PermUsersManage           = "users.manage" // 修改角色與狀態
+	PermUsersApprove          = "users.approve"
+	PermRolesManage           = "roles.manage"
+	PermSystemStats           = "system.stats"
+	PermLogsView              = "logs.view"
+	PermLogsManage            = "logs.manage" // 建立操作記錄檢查點
+	PermLineManage            = "line.manage"
+	PermServiceTokensManage   = "service_tokens.manage"
+	PermCommentsModerate      = "comments.moderate" // 編輯與刪除他人的留言
+	PermFolderTemplatesManage = "folder_templates.manage"
+)
+
+// PermissionInfo 權限說明
+type PermissionInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// AllPermissions 系統中所有可指派的權限
+var AllPermissions = []PermissionInfo{
+	{PermFilesRead, "瀏覽、搜尋、下載與預覽檔案"},
+	{PermFilesComment, "對檔案按讚與留言"},
+	{PermFilesPersonalize, "為檔案加上星號與釘選資料夾"},
+	{PermFilesUpload, "上傳檔案與建立資料夾"},
+	{PermFilesEdit, "修改、移動、重新命名與複製檔案"},
+	{PermFilesDelete, "將檔案移至垃圾桶與還原"},
+	{PermFilesDeletePermanent, "永久刪除檔案"},
+	{PermFilesShare, "建立分享連結與訪客上傳連結"},
+	{PermFilesManageAll, "在管理後台管理所有檔案"},
+	{PermTrashEmpty, "清空垃圾桶"},
+	{PermTrashLegalHold, "設定法律保全，使項目不會從垃圾桶永久刪除"},
+	{PermCategoriesCreate, "建立分類並管理自己建立的分類"},
+	{PermCategoriesManage, "管理所有分類"},
+	{PermExportCreate, "匯出自己上傳的檔案"},
+	{PermExportAll, "匯出所有用戶的檔案"},
+	{PermUploadLinksManage, "管理他人建立的訪客上傳連結"},
+	{PermUsersView, "查看用戶列表"},
+	{PermUsersManage, "修改用戶角色與狀態"},
+	{PermUsersApprove, "審核註冊申請"},
+	{PermRolesManage, "管理角色與權限"},
+	{PermSystemStats, "查看系統統計"},
+	{PermLogsView, "查看操作記錄"},
+	{PermLogsManage, "建立操作記錄檢查點並寫入匯出檔"},
+	{PermLineManage, "管理 LINE 功能與設定"},
+	{PermServiceTokensManage, "管理服務間呼叫使用的服務令牌"},
+	{PermCommentsModerate, "編輯與刪除他人的留言"},
+	{PermFolderTemplatesManage, "管理資料夾範本與自動建立資料夾的排程"},
+}
+
+// IsKnownPermission 檢查權限名稱（含萬用字元）是否有效
+func IsKnownPermission(name string) bool {
+	if name == "*" {
+		return true
+	}
+	if strings.HasSuffix(name, ".*") {
+		prefix := strings.TrimSuffix(name, "*")
+		for _, p := range AllPermissions {
+			if strings.HasPrefix(p.Name, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, p := range AllPermissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// StringList 以 JSON 陣列儲存的字串清單
+type StringList []string
+
+// Value 實現 driver.Valuer 接口
+func (s StringList) Value() (driver.Value, error) {
+	if s == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan 實現 sql.Scanner 接口
+func (s *StringList) Scan(value interface{}) error {
+	if value == nil {
+		*s = StringList{}
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("type assertion to []byte or string failed")
+	}
+
+	if len(bytes) == 0 {
+		*s = StringList{}
+		return nil
+	}
+	return json.Unmarshal(bytes, s)
+}
+
+// Role 角色模型 - 將權限組合成可指派給用戶的角色
+type Role struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Name        string     `json:"name" gorm:"size:50;uniqueIndex;not null"` // 對應 User.Role
+	DisplayName string     `json:"display_name" gorm:"size:100"`
+	Description string     `json:"description" gorm:"type:text"`
+	Permissions StringList `json:"permissions" gorm:"type:text"`
+	IsSystem    bool       `json:"is_system" gorm:"default:false"` // 系統角色不可刪除
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// 計算欄位
+	UserCount int64 `json:"user_count" gorm:"-"`
+}
+
+// TableName 指定表名
+func (Role) TableName() string {
+	return "roles"
+}
+
+// HasPermission 檢查角色是否具備指定權限
+func (r *Role) HasPermission(permission string) bool {
+	for _, p := range r.Permissions {
+		if p == "*" || p == permission {
+			return true
+		}
+		if strings.HasSuffix(p, ".*") && strings.HasPrefix(permission, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// CoversRole 檢查角色是否具備另一角色的所有權限；萬用字元權限需由相同或更廣的萬用字元涵蓋
+func (r *Role) CoversRole(other *Role) bool {
+	for _, p := range other.Permissions {
+		if !r.HasPermission(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// DefaultRoles 系統預設角色
+func DefaultRoles() []Role {
+	return []Role{
+		{
+			Name:        "admin",
+			DisplayName: "管理員",
+			Description: "擁有所有權限",
+			Permissions: StringList{"*"},
+			IsSystem:    true,
+		},
+		{
+			Name:        "user",
+			DisplayName: "一般用戶",
+			Description: "上傳、整理與分享檔案",
+			Permissions: StringList{
+				PermFilesRead, PermFilesPersonalize, PermFilesComment, PermFilesUpload, PermFilesEdit,
+				PermFilesDelete, PermFilesShare, PermCategoriesCreate, PermExportCreate,
+			},
+			IsSystem: true,
+		},
+		{
+			Name:        "editor",
+			DisplayName: "編輯",
+			Description: "管理所有檔案與分類，可永久刪除",
+			Permissions: StringList{
+				"files.*", PermCategoriesCreate, PermCategoriesManage,
+				PermExportCreate, PermExportAll, PermCommentsModerate,
+			},
+		},
+		{
+			Name:        "viewer",
+			DisplayName: "檢視者",
+			Description: "僅能瀏覽與下載檔案",
+			Permissions: StringList{PermFilesRead, PermFilesPersonalize},
+		},
+		{
+			Name:        "uploader",
+			DisplayName: "上傳者",
+			Description: "瀏覽與上傳檔案",
+			Permissions: StringList{PermFilesRead, PermFilesPersonalize, PermFilesUpload},
+		},
+		{
+			Name:        "line-moderator",
+			DisplayName: "LINE 管理員",
+			Description: "管理 LINE 上傳記錄、用戶與設定",
+			Permissions: StringList{PermFilesRead, PermFilesPersonalize, PermFilesUpload, PermLineManage},
+		},
+	}
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+)
+
+// 服務令牌範圍 - 限制服務可以呼叫的 /api/api-access 端點
+const (
+	ServiceScopeFilesRead   = "files:read"   // GET /files/:id
+	ServiceScopeFilesUpload = "files:upload" // POST /files/upload
+	ServiceScopeLineUsers   = "line:users"   // POST /line/users
+	ServiceScopeLineRecords = "line:records" // POST /line/upload-records
+)
+
+// AllServiceScopes 所有可指派給服務令牌的範圍
+var AllServiceScopes = []PermissionInfo{
+	{ServiceScopeFilesRead, "讀取檔案資訊"},
+	{ServiceScopeFilesUpload, "上傳檔案"},
+	{ServiceScopeLineUsers, "同步 LINE 用戶資料"},
+	{ServiceScopeLineRecords, "建立 LINE 上傳記錄"},
+}
+
+// IsKnownServiceScope 檢查服務令牌範圍是否有效
+func IsKnownServiceScope(scope string) bool {
+	if scope == "*" {
+		return true
+	}
+	for _, s := range AllServiceScopes {
+		if s.Name == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceToken 服務令牌 - 供其他服務（如 LINE Service）呼叫 API，只保存雜湊值
+type ServiceToken struct {
+	ID                uint       `json:"id" gorm:"primaryKey"`
+	ClientName        string     `json:"client_name" gorm:"size:100;uniqueIndex;not null"`
+	Description       string     `json:"description" gorm:"type:text"`
+	TokenPrefix       string     `json:"token_prefix" gorm:"size:16"`
+	TokenHash         string     `json:"-" gorm:"size:64;not null"`
+	PreviousTokenHash string     `json:"-" gorm:"size:64"`
+	PreviousExpiresAt *time.Time `json:"previous_expires_at"` // 輪替後舊令牌的失效時間
+	Scopes            StringList `json:"scopes" gorm:"type:text"`
+	AllowedIPs        StringList `json:"allowed_ips" gorm:"type:text"` // IP 或 CIDR，空白表示不限制
+	IsActive          bool       `json:"is_active" gorm:"default:true"`
+	LastUsedAt        *time.Time `json:"last_used_at"`
+	LastUsedIP        string     `json:"last_used_ip" gorm:"size:45"`
+	UseCount          int64      `json:"use_count" gorm:"default:0"`
+	RotatedAt         *time.Time `json:"rotated_at"`
+	CreatedBy         *uint      `json:"created_by"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ServiceToken) TableName() string {
+	return "service_tokens"
+}
+
+// HasScope 檢查服務令牌是否具備指定範圍
+func (t *ServiceToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == "*" || s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// InOverlapWindow 輪替後的舊令牌是否仍可使用
+func (t *ServiceToken) InOverlapWindow() bool {
+	return t.PreviousTokenHash != "" && t.PreviousExpiresAt != nil && time.Now().Before(*t.PreviousExpiresAt)
+}
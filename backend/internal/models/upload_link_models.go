@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+)
+
+// 訪客上傳檔案的審核狀態
+const (
+	ReviewStatusPending  = "pending"  // 等待審核，不會出現在檔案列表
+	ReviewStatusApproved = "approved" // 已核准
+	ReviewStatusRejected = "rejected" // 已拒絕（檔案移至垃圾桶）
+)
+
+// UploadLink 訪客上傳連結 - 只能上傳到指定資料夾，無需帳號
+type UploadLink struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Token         string     `json:"token" gorm:"size:64;uniqueIndex;not null"`
+	Title         string     `json:"title" gorm:"size:255"`
+	Description   string     `json:"description" gorm:"type:text"`
+	FolderID      uint       `json:"folder_id" gorm:"not null;index"`
+	CategoryID    *uint      `json:"category_id"`
+	CreatedBy     uint       `json:"created_by" gorm:"not null;index"`
+	PasswordHash  string     `json:"-" gorm:"size:255"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	MaxFiles      *int       `json:"max_files"`      // 可上傳的檔案數量上限
+	MaxFileSize   *int64     `json:"max_file_size"`  // 單檔大小上限（bytes）
+	MaxTotalSize  *int64     `json:"max_total_size"` // 累計上傳大小上限（bytes）
+	RequireReview bool       `json:"require_review" gorm:"default:false"`
+	UploadedCount int        `json:"uploaded_count" gorm:"default:0"`
+	UploadedSize  int64      `json:"uploaded_size" gorm:"default:0"`
+	IsActive      bool       `json:"is_active" gorm:"default:true"`
+	LastUsedAt    *time.Time `json:"last_used_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// 計算欄位
+	HasPassword bool `json:"has_password" gorm:"-"`
+
+	// 關聯
+	Folder  *File `json:"folder,omitempty" gorm:"foreignKey:FolderID"`
+	Creator User  `json:"creator" gorm:"foreignKey:CreatedBy"`
+}
+
+// TableName 指定表名
+func (UploadLink) TableName() string {
+	return "upload_links"
+}
+
+// IsExpired 檢查連結是否已過期
+func (l *UploadLink) IsExpired() bool {
+	return l.ExpiresAt != nil && time.Now().After(*l.ExpiresAt)
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+// 用戶開啟檔案的方式
+const (
+	FileAccessDownload = "download"
+	FileAccessPreview  = "preview"
+	FileAccessUpload   = "upload" // 最近項目中由上傳記錄產生，不會寫入資料表
+)
+
+// UserFileState 用戶對檔案的個人狀態（加星號、釘選的資料夾、最近開啟）
+// 與全域的 File.DownloadCount 分開記錄；檔案永久刪除時一併刪除
+type UserFileState struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	UserID         uint       `json:"user_id" gorm:"not null;uniqueIndex:idx_user_file_state"`
+	FileID         uint       `json:"file_id" gorm:"not null;uniqueIndex:idx_user_file_state;index"`
+	Starred        bool       `json:"starred" gorm:"default:false"`
+	StarredAt      *time.Time `json:"starred_at"`
+	Pinned         bool       `json:"pinned" gorm:"default:false"` // 釘選在導覽列的資料夾
+	PinnedAt       *time.Time `json:"pinned_at"`
+	PinOrder       int        `json:"pin_order" gorm:"default:0"`
+	LastAccessedAt *time.Time `json:"last_accessed_at" gorm:"index"`
+	LastAction     string     `json:"last_action" gorm:"size:20"` // download、preview 或 upload
+	AccessCount    int        `json:"access_count" gorm:"default:0"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// 關聯
+	File *File `json:"file,omitempty" gorm:"foreignKey:FileID"`
+}
+
+// TableName 指定表名
+func (UserFileState) TableName() string {
+	return "user_file_states"
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+// activityChainMu 確保雜湊鏈依序寫入，避免兩筆記錄接在同一個前驅之後
+var activityChainMu sync.Mutex
+
+// RecordActivity 寫入操作記錄，details 會以 JSON 格式儲存
+// 每筆記錄都會串接前一筆記錄的雜湊，形成可驗證的雜湊鏈
+func RecordActivity(db *gorm.DB, userID uint, action, resourceType string, resourceID *uint, details interface{}, ipAddress string) error {
+	var detailsText string
+	switch v := details.(type) {
+	case nil:
+	case string:
+		detailsText = v
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		detailsText = string(b)
+	}
+
+	entry := models.ActivityLog{
+		UserID:       userID,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Details:      detailsText,
+		IPAddress:    ipAddress,
+		// 截到微秒並使用 UTC，確保資料庫讀回後雜湊一致
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+
+	activityChainMu.Lock()
+	defer activityChainMu.Unlock()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var last models.ActivityLog
+		if err := tx.Select("id", "hash").Order("id DESC").Limit(1).Find(&last).Error; err != nil {
+			return err
+		}
+		entry.PrevHash = last.Hash
+		entry.Hash = entry.ComputeHash()
+		return tx.Create(&entry).Error
+	})
+}
+
+// ActivityLogFilter 操作記錄查詢條件
+type ActivityLogFilter struct {
+	UserID       *uint
+	Actions      []string
+	ResourceType string
+	ResourceID   *uint
+	From         *time.Time // 含
+	To           *time.Time // 不含
+	Search       string     // 比對操作名稱與內容
+}
+
+// Apply 將查詢條件套用到 ActivityLog 查詢
+func (f ActivityLogFilter) Apply(query *gorm.DB) *gorm.DB {
+	if f.UserID != nil {
+		query = query.Where("user_id = ?", *f.UserID)
+	}
+	if len(f.Actions) > 0 {
+		query = query.Where("action IN ?", f.Actions)
+	}
+	if f.ResourceType != "" {
+		query = query.Where("resource_type = ?", f.ResourceType)
+	}
+	if f.ResourceID != nil {
+		query = query.Where("resource_id = ?", *f.ResourceID)
+	}
+	if f.From != nil {
+		query = query.Where("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		query = query.Where("created_at < ?", *f.To)
+	}
+	if f.Search != "" {
+		pattern := "%" + EscapeLike(f.Search) + "%"
+		query = query.Where(`(details LIKE ? ESCAPE '\' OR action LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+	return query
+}
+
+// EscapeLike 跳脫 LIKE 的萬用字元，讓搜尋字串逐字比對
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+// AuditSnapshot 資源在某個時間點的欄位快照
+type AuditSnapshot map[string]interface{}
+
+// AuditChange 單一欄位的變更前後值
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// auditLoader 依識別碼讀取資源，資源不存在時返回 nil
+type auditLoader func(db *gorm.DB, key string) (interface{}, error)
+
+// auditLoaders 支援前後比對的資源類型
+var auditLoaders = map[string]auditLoader{
+	"file": func(db *gorm.DB, key string) (interface{}, error) {
+		var file models.File
+		return firstOrNil(db.Unscoped().Where("id = ?", key).First(&file), &file)
+	},
+	"user": func(db *gorm.DB, key string) (interface{}, error) {
+		var user models.User
+		return firstOrNil(db.Where("id = ?", key).First(&user), &user)
+	},
+	"registration": func(db *gorm.DB, key string) (interface{}, error) {
+		var registration models.UserRegistrationRequest
+		return firstOrNil(db.Where("id = ?", key).First(&registration), &registration)
+	},
+	"role": func(db *gorm.DB, key string) (interface{}, error) {
+		var role models.Role
+		return firstOrNil(db.Where("id = ?", key).First(&role), &role)
+	},
+	"category": func(db *gorm.DB, key string) (interface{}, error) {
+		var category models.Category
+		return firstOrNil(db.Where("id = ?", key).First(&category), &category)
+	},
+	"file_comment": func(db *gorm.DB, key string) (interface{}, error) {
+		var comment models.FileComment
+		return firstOrNil(db.Where("id = ?", key).First(&comment), &comment)
+	},
+	"upload_link": func(db *gorm.DB, key string) (interface{}, error) {
+		var link models.UploadLink
+		return firstOrNil(db.Where("id = ?", key).First(&link), &link)
+	},
+	"service_token": func(db *gorm.DB, key string) (interface{}, error) {
+		var token models.ServiceToken
+		return firstOrNil(db.Where("id = ?", key).First(&token), &token)
+	},
+	"personal_access_token": func(db *gorm.DB, key string) (interface{}, error) {
+		var token models.PersonalAccessToken
+		return firstOrNil(db.Where("id = ?", key).First(&token), &token)
+	},
+	"line_upload_record": func(db *gorm.DB, key string) (interface{}, error) {
+		var record models.LineUploadRecord
+		return firstOrNil(db.Where("id = ?", key).First(&record), &record)
+	},
+	"line_user": func(db *gorm.DB, key string) (interface{}, error) {
+		var user models.LineUser
+		return firstOrNil(db.Where("line_user_id = ?", key).First(&user), &user)
+	},
+	"line_setting": func(db *gorm.DB, key string) (interface{}, error) {
+		var setting models.LineSetting
+		return firstOrNil(db.Where("setting_key = ?", key).First(&setting), &setting)
+	},
+}
+
+// auditIgnoredFields 不列入快照的欄位：更新時間、統計計數與機密資料
+var auditIgnoredFields = map[string]bool{
+	"updated_at": true, "updatedAt": true,
+	"download_count": true, "downloadCount": true,
+	"token": true, "token_hash": true, "previous_token_hash": true, "password_hash": true, "code_hash": true,
+}
+
+// firstOrNil 查無資料時返回 nil 而非錯誤
+func firstOrNil(result *gorm.DB, value interface{}) (interface{}, error) {
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return value, nil
+}
+
+// SnapshotResource 讀取資源快照；不支援的類型或資源不存在時返回 nil
+func SnapshotResource(db *gorm.DB, resourceType, key string) (AuditSnapshot, error) {
+	loader, ok := auditLoaders[resourceType]
+	if !ok || key == "" {
+		return nil, nil
+	}
+	value, err := loader(db, key)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	return NewAuditSnapshot(value)
+}
+
+// NewAuditSnapshot 將模型轉換為快照，略過關聯物件與機密欄位
+func NewAuditSnapshot(value interface{}) (AuditSnapshot, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	snapshot := AuditSnapshot{}
+	for key, field := range fields {
+		if auditIgnoredFields[key] || isNestedObject(field) {
+			continue
+		}
+		snapshot[key] = field
+	}
+	return snapshot, nil
+}
+
+// isNestedObject 關聯資料以物件或物件陣列呈現，不列入快照
+func isNestedObject(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return true
+	case []interface{}:
+		for _, item := range v {
+			if _, ok := item.(map[string]interface{}); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ResourceID 從快照取得數字識別碼（字串主鍵的資源返回 nil）
+func (s AuditSnapshot) ResourceID() *uint {
+	if s == nil {
+		return nil
+	}
+	if id, ok := s["id"].(float64); ok && id > 0 {
+		value := uint(id)
+		return &value
+	}
+	return nil
+}
+
+// DiffSnapshots 比對兩個快照，返回有變更的欄位
+func DiffSnapshots(before, after AuditSnapshot) map[string]AuditChange {
+	changes := map[string]AuditChange{}
+	for key, old := range before {
+		if value, ok := after[key]; !ok || !reflect.DeepEqual(old, value) {
+			changes[key] = AuditChange{Before: old, After: after[key]}
+		}
+	}
+	for key, value := range after {
+		if _, ok := before[key]; !ok {
+			changes[key] = AuditChange{Before: nil, After: value}
+		}
+	}
+	return changes
+}
+
+// ParseResourceID 將字串識別碼轉為數字，非數字時返回 nil
+func ParseResourceID(key string) *uint {
+	id, err := strconv.ParseUint(key, 10, 64)
+	if err != nil || id == 0 {
+		return nil
+	}
+	value := uint(id)
+	return &value
+}
+
+// AuditContext 稽核記錄的請求資訊
+type AuditContext struct {
+	Method   string                 `json:"method"`
+	Route    string                 `json:"route"`
+	Status   int                    `json:"status"`
+	AuthType string                 `json:"auth_type,omitempty"`
+	Client   string                 `json:"client,omitempty"`
+	Request  map[string]interface{} `json:"request,omitempty"`
+}
+
+// AuditDetails 稽核記錄內容：新增記錄 after、刪除記錄 before、修改記錄 changes
+type AuditDetails struct {
+	AuditContext
+	ResourceKey string                 `json:"resource_key,omitempty"`
+	Before      AuditSnapshot          `json:"before,omitempty"`
+	After       AuditSnapshot          `json:"after,omitempty"`
+	Changes     map[string]AuditChange `json:"changes,omitempty"`
+}
+
+// RecordAudit 寫入含前後差異的稽核記錄
+func RecordAudit(db *gorm.DB, userID uint, ipAddress, action, resourceType, key string, before, after AuditSnapshot, ctx AuditContext) error {
+	details := AuditDetails{AuditContext: ctx}
+
+	resourceID := after.ResourceID()
+	if resourceID == nil {
+		resourceID = before.ResourceID()
+	}
+	if resourceID == nil {
+		resourceID = ParseResourceID(key)
+	}
+	if resourceID == nil {
+		details.ResourceKey = key
+	}
+
+	switch {
+	case before == nil:
+		details.After = after
+	case after == nil:
+		details.Before = before
+	default:
+		details.Changes = DiffSnapshots(before, after)
+	}
+
+	return RecordActivity(db, userID, action, resourceType, resourceID, details, ipAddress)
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/config"
+	"memoryark/internal/models"
+)
+
+// activityVerifyBatchSize 驗證雜湊鏈時每批讀取的筆數
+const activityVerifyBatchSize = 500
+
+// errStopVerify 發現第一個斷點後停止逐批讀取
+var errStopVerify = errors.New("activity chain broken")
+
+// ActivityChainReport 雜湊鏈驗證結果
+type ActivityChainReport struct {
+	Valid              bool   `json:"valid"`
+	CheckedEntries     int64  `json:"checked_entries"`
+	LastLogID          uint   `json:"last_log_id"`
+	LastHash           string `json:"last_hash"`
+	CheckpointsChecked int    `json:"checkpoints_checked"`
+	BrokenAt           *uint  `json:"broken_at,omitempty"` // 第一筆異常的記錄 ID
+	Reason             string `json:"reason,omitempty"`
+}
+
+func (r *ActivityChainReport) fail(id uint, reason string) {
+	r.Valid = false
+	r.BrokenAt = &id
+	r.Reason = reason
+}
+
+// VerifyActivityChain 依序檢查每筆記錄的雜湊與串接，再比對檢查點以偵測尾端被截斷
+// key 不為空時同時驗證檢查點簽章
+func VerifyActivityChain(db *gorm.DB, checkpoints []models.ActivityLogCheckpoint, key string) (*ActivityChainReport, error) {
+	report := &ActivityChainReport{Valid: true}
+
+	prevHash := ""
+	var batch []models.ActivityLog
+	result := db.Order("id").FindInBatches(&batch, activityVerifyBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, entry := range batch {
+			if entry.PrevHash != prevHash {
+				report.fail(entry.ID, "前一筆雜湊不相符，記錄可能被刪除、插入或重新排序")
+				return errStopVerify
+			}
+			if entry.Hash != entry.ComputeHash() {
+				report.fail(entry.ID, "記錄內容與雜湊不相符，內容可能被修改")
+				return errStopVerify
+			}
+			prevHash = entry.Hash
+			report.CheckedEntries++
+			report.LastLogID = entry.ID
+			report.LastHash = entry.Hash
+		}
+		return nil
+	})
+	if result.Error != nil && !errors.Is(result.Error, errStopVerify) {
+		return nil, result.Error
+	}
+	if !report.Valid {
+		return report, nil
+	}
+
+	sorted := append([]models.ActivityLogCheckpoint(nil), checkpoints...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].LastLogID < sorted[j].LastLogID })
+	for _, checkpoint := range sorted {
+		if key != "" && !hmac.Equal([]byte(checkpoint.Signature), []byte(SignActivityCheckpoint(checkpoint, key))) {
+			report.fail(checkpoint.LastLogID, fmt.Sprintf("檢查點 (%s) 簽章不符", checkpoint.CreatedAt.Format(time.RFC3339)))
+			return report, nil
+		}
+
+		var entry models.ActivityLog
+		if err := db.Select("id", "hash").Where("id = ?", checkpoint.LastLogID).Limit(1).Find(&entry).Error; err != nil {
+			return nil, err
+		}
+		if entry.ID == 0 {
+			report.fail(checkpoint.LastLogID, "檢查點記錄的最後一筆已不存在，記錄可能被截斷")
+			return report, nil
+		}
+		if entry.Hash != checkpoint.LastHash {
+			report.fail(checkpoint.LastLogID, "檢查點記錄的雜湊與目前記錄不符")
+			return report, nil
+		}
+
+		var count int64
+		if err := db.Model(&models.ActivityLog{}).Where("id <= ?", checkpoint.LastLogID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count != checkpoint.LogCount {
+			report.fail(checkpoint.LastLogID, fmt.Sprintf("檢查點時有 %d 筆記錄，目前只剩 %d 筆", checkpoint.LogCount, count))
+			return report, nil
+		}
+		report.CheckpointsChecked++
+	}
+
+	return report, nil
+}
+
+// SignActivityCheckpoint 以 HMAC-SHA256 簽署檢查點內容
+func SignActivityCheckpoint(checkpoint models.ActivityLogCheckpoint, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	fmt.Fprintf(mac, "%d|%s|%d|%s", checkpoint.LastLogID, checkpoint.LastHash, checkpoint.LogCount,
+		checkpoint.CreatedAt.UTC().Format(time.RFC3339Nano))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CreateActivityCheckpoint 記錄目前雜湊鏈的終點並附加到匯出檔；自上次檢查點後沒有新記錄時返回 nil
+func CreateActivityCheckpoint(db *gorm.DB, cfg config.AuditConfig) (*models.ActivityLogCheckpoint, error) {
+	activityChainMu.Lock()
+	defer activityChainMu.Unlock()
+
+	var last models.ActivityLog
+	if err := db.Select("id", "hash").Order("id DESC").Limit(1).Find(&last).Error; err != nil {
+		return nil, err
+	}
+	if last.ID == 0 {
+		return nil, nil
+	}
+
+	var previous models.ActivityLogCheckpoint
+	if err := db.Order("last_log_id DESC").Limit(1).Find(&previous).Error; err != nil {
+		return nil, err
+	}
+	if previous.ID != 0 && previous.LastLogID == last.ID {
+		return nil, nil
+	}
+
+	checkpoint := models.ActivityLogCheckpoint{
+		LastLogID: last.ID,
+		LastHash:  last.Hash,
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	if err := db.Model(&models.ActivityLog{}).Where("id <= ?", last.ID).Count(&checkpoint.LogCount).Error; err != nil {
+		return nil, err
+	}
+	if cfg.CheckpointKey != "" {
+		checkpoint.Signature = SignActivityCheckpoint(checkpoint, cfg.CheckpointKey)
+	}
+	if err := db.Create(&checkpoint).Error; err != nil {
+		return nil, err
+	}
+
+	if cfg.CheckpointFile != "" {
+		if err := appendCheckpointFile(cfg.CheckpointFile, checkpoint); err != nil {
+			return &checkpoint, fmt.Errorf("寫入檢查點匯出檔失敗: %w", err)
+		}
+	}
+	return &checkpoint, nil
+}
+
+// appendCheckpointFile 將檢查點以 JSONL 附加到匯出檔
+func appendCheckpointFile(path string, checkpoint models.ActivityLogCheckpoint) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	checkpoint.ID = 0
+	line, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// LoadCheckpointFile 讀取檢查點匯出檔；檔案不存在時返回空清單
+func LoadCheckpointFile(path string) ([]models.ActivityLogCheckpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var checkpoints []models.ActivityLogCheckpoint
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var checkpoint models.ActivityLogCheckpoint
+		if err := json.Unmarshal(scanner.Bytes(), &checkpoint); err != nil {
+			return nil, fmt.Errorf("檢查點匯出檔第 %d 行格式錯誤: %w", line, err)
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	return checkpoints, scanner.Err()
+}
+
+// LoadActivityCheckpoints 合併資料庫與匯出檔中的檢查點
+// 匯出檔保存在資料庫以外，即使資料庫中的檢查點被一併刪除仍可偵測截斷
+func LoadActivityCheckpoints(db *gorm.DB, cfg config.AuditConfig) ([]models.ActivityLogCheckpoint, error) {
+	var checkpoints []models.ActivityLogCheckpoint
+	if err := db.Order("last_log_id").Find(&checkpoints).Error; err != nil {
+		return nil, err
+	}
+	if cfg.CheckpointFile != "" {
+		exported, err := LoadCheckpointFile(cfg.CheckpointFile)
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, exported...)
+	}
+	return checkpoints, nil
+}
+
+// SealLegacyActivityLogs 為啟用雜湊鏈前的既有記錄建立雜湊鏈
+// 只在尚無任何已串接記錄時執行，之後才出現的未串接記錄會在驗證時被視為異常
+func SealLegacyActivityLogs(db *gorm.DB) (int64, error) {
+	activityChainMu.Lock()
+	defer activityChainMu.Unlock()
+
+	var chained int64
+	if err := db.Model(&models.ActivityLog{}).Where("hash <> ''").Count(&chained).Error; err != nil {
+		return 0, err
+	}
+	if chained > 0 {
+		return 0, nil
+	}
+
+	var sealed int64
+	prevHash := ""
+	var batch []models.ActivityLog
+	result := db.Order("id").FindInBatches(&batch, activityVerifyBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, entry := range batch {
+			entry.PrevHash = prevHash
+			entry.Hash = entry.ComputeHash()
+			if err := db.Model(&models.ActivityLog{}).Where("id = ?", entry.ID).
+				UpdateColumns(map[string]interface{}{"prev_hash": entry.PrevHash, "hash": entry.Hash}).Error; err != nil {
+				return err
+			}
+			prevHash = entry.Hash
+			sealed++
+		}
+		return nil
+	})
+	return sealed, result.Error
+}
+
+// StartActivityCheckpoints 依設定的間隔定期建立檢查點
+func StartActivityCheckpoints(db *gorm.DB, cfg config.AuditConfig) {
+	if cfg.CheckpointInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.CheckpointInterval) * time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			checkpoint, err := CreateActivityCheckpoint(db, cfg)
+			if err != nil {
+				log.Printf("建立操作記錄檢查點失敗: %v", err)
+				continue
+			}
+			if checkpoint != nil {
+				log.Printf("已建立操作記錄檢查點：最後一筆 #%d，共 %d 筆", checkpoint.LastLogID, checkpoint.LogCount)
+			}
+		}
+	}()
+}
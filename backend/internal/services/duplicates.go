@@ -0,0 +1,138 @@
+package services
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+// DuplicateFile 重複內容群組中的一個檔案
+type DuplicateFile struct {
+	ID           uint      `json:"id"`
+	Name         string    `json:"name"`
+	VirtualPath  string    `json:"virtual_path"`
+	ParentID     *uint     `json:"parent_id"`
+	UploadedBy   uint      `json:"uploaded_by"`
+	UploaderName string    `json:"uploader_name"`
+	CreatedAt    time.Time `json:"created_at"`
+	Hash         string    `json:"-"`
+}
+
+// DuplicateGroup 內容雜湊相同的一組檔案；合併後只需保留一份，其餘大小即可回收
+type DuplicateGroup struct {
+	Hash            string          `json:"hash"`
+	FileSize        int64           `json:"file_size"`
+	Count           int             `json:"count"`
+	ReclaimableSize int64           `json:"reclaimable_size"`
+	Files           []DuplicateFile `json:"files" gorm:"-"`
+}
+
+// DuplicateReport 重複內容報表
+type DuplicateReport struct {
+	Groups          []DuplicateGroup `json:"groups"`
+	TotalGroups     int64            `json:"total_groups"`
+	ReclaimableSize int64            `json:"reclaimable_size"`
+}
+
+// duplicateCandidates 可列入重複報表的檔案：未刪除、非資料夾、非捷徑且已通過審核
+// uploadedBy 不為空時只包含該用戶上傳的檔案
+func duplicateCandidates(db *gorm.DB, uploadedBy *uint) *gorm.DB {
+	query := db.Model(&models.File{}).
+		Where("files.is_deleted = ? AND files.is_directory = ? AND files.shortcut_target_id IS NULL", false, false).
+		Where("files.sha256_hash IS NOT NULL AND files.sha256_hash <> ''").
+		Where("(files.review_status IS NULL OR files.review_status <> ?)", models.ReviewStatusPending)
+	if uploadedBy != nil {
+		query = query.Where("files.uploaded_by = ?", *uploadedBy)
+	}
+	return query
+}
+
+// FindDuplicates 列出有多個檔案引用的內容雜湊，依可回收的大小由大到小排序
+func FindDuplicates(db *gorm.DB, uploadedBy *uint, page, limit int) (*DuplicateReport, error) {
+	groups := duplicateCandidates(db, uploadedBy).
+		Select("files.sha256_hash AS hash, MAX(files.file_size) AS file_size, COUNT(*) AS count, " +
+			"SUM(files.file_size) - MAX(files.file_size) AS reclaimable_size").
+		Group("files.sha256_hash").
+		Having("COUNT(*) > 1")
+
+	report := &DuplicateReport{Groups: []DuplicateGroup{}}
+	var totals struct {
+		TotalGroups     int64
+		ReclaimableSize int64
+	}
+	if err := db.Table("(?) AS duplicate_groups", groups).
+		Select("COUNT(*) AS total_groups, COALESCE(SUM(reclaimable_size), 0) AS reclaimable_size").
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	report.TotalGroups, report.ReclaimableSize = totals.TotalGroups, totals.ReclaimableSize
+	if report.TotalGroups == 0 {
+		return report, nil
+	}
+
+	if err := groups.Order("reclaimable_size DESC, hash").Offset((page - 1) * limit).Limit(limit).
+		Scan(&report.Groups).Error; err != nil {
+		return nil, err
+	}
+	if len(report.Groups) == 0 {
+		return report, nil
+	}
+
+	hashes := make([]string, len(report.Groups))
+	index := make(map[string]int, len(report.Groups))
+	for i, group := range report.Groups {
+		hashes[i] = group.Hash
+		index[group.Hash] = i
+	}
+	var files []DuplicateFile
+	if err := duplicateCandidates(db, uploadedBy).
+		Joins("LEFT JOIN users ON users.id = files.uploaded_by").
+		Where("files.sha256_hash IN ?", hashes).
+		Select("files.id, files.name, files.virtual_path, files.parent_id, files.uploaded_by, " +
+			"users.name AS uploader_name, files.created_at, files.sha256_hash AS hash").
+		Order("files.created_at, files.id").
+		Scan(&files).Error; err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		group := &report.Groups[index[file.Hash]]
+		group.Files = append(group.Files, file)
+	}
+	return report, nil
+}
+
+// DuplicateFilesByHash 載入內容雜湊相同的檔案（最早上傳的排在最前面）
+func DuplicateFilesByHash(db *gorm.DB, hash string) ([]models.File, error) {
+	var files []models.File
+	err := duplicateCandidates(db, nil).Where("files.sha256_hash = ?", hash).
+		Order("files.created_at, files.id").Find(&files).Error
+	return files, err
+}
+
+// MakeShortcut 將檔案改為指向保留檔案的捷徑，原本的名稱與位置不變
+func MakeShortcut(db *gorm.DB, fileID, targetID uint) error {
+	return db.Model(&models.File{}).Where("id = ?", fileID).Update("shortcut_target_id", targetID).Error
+}
+
+// DetachShortcuts 目標檔案永久刪除前，將指向它的捷徑還原為一般檔案並更新所在資料夾的統計
+// 捷徑保留了自己的內容路徑，實體檔案仍被引用，不會被清除
+func DetachShortcuts(db *gorm.DB, targetID uint) error {
+	var shortcuts []models.File
+	if err := db.Select("id, parent_id").Where("shortcut_target_id = ?", targetID).Find(&shortcuts).Error; err != nil {
+		return err
+	}
+	if len(shortcuts) == 0 {
+		return nil
+	}
+	if err := db.Model(&models.File{}).Where("shortcut_target_id = ?", targetID).
+		Update("shortcut_target_id", nil).Error; err != nil {
+		return err
+	}
+	parentIDs := make([]*uint, 0, len(shortcuts))
+	for _, shortcut := range shortcuts {
+		parentIDs = append(parentIDs, shortcut.ParentID)
+	}
+	return RefreshFolderStatsFor(db, parentIDs...)
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"memoryark/internal/models"
+)
+
+// MaxCommentLength 留言內容的字數上限
+const MaxCommentLength = 2000
+
+// 留言驗證錯誤
+var (
+	ErrEmptyComment         = errors.New("留言內容不能為空")
+	ErrCommentTooLong       = fmt.Errorf("留言內容不能超過 %d 字", MaxCommentLength)
+	ErrInvalidCommentParent = errors.New("回覆的留言不存在、已刪除或不屬於此檔案")
+	ErrInvalidMention       = errors.New("提及的用戶不存在或尚未啟用")
+	ErrCommentDeleted       = errors.New("留言已刪除")
+)
+
+// SetFileLiked 按讚或取消按讚，返回最新的按讚數與是否有變更（重複按讚不會重複計算）
+func SetFileLiked(db *gorm.DB, userID, fileID uint, liked bool) (int, bool, error) {
+	changed := false
+	var likeCount int
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var result *gorm.DB
+		delta := 1
+		if liked {
+			like := models.FileLike{FileID: fileID, UserID: userID}
+			result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&like)
+		} else {
+			delta = -1
+			result = tx.Where("file_id = ? AND user_id = ?", fileID, userID).Delete(&models.FileLike{})
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			changed = true
+			if err := tx.Model(&models.File{}).Where("id = ?", fileID).
+				UpdateColumn("like_count", gorm.Expr("CASE WHEN like_count + ? < 0 THEN 0 ELSE like_count + ? END", delta, delta)).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.File{}).Where("id = ?", fileID).Select("like_count").Scan(&likeCount).Error
+	})
+	return likeCount, changed, err
+}
+
+// FileLikedBy 檢查用戶是否已對檔案按讚
+func FileLikedBy(db *gorm.DB, userID, fileID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.FileLike{}).Where("file_id = ? AND user_id = ?", fileID, userID).Count(&count).Error
+	return count > 0, err
+}
+
+// FileLikes 檔案的按讚記錄，依時間由新到舊
+func FileLikes(db *gorm.DB, fileID uint) ([]models.FileLike, error) {
+	var likes []models.FileLike
+	err := db.Preload("User").Where("file_id = ?", fileID).Order("created_at DESC, id DESC").Find(&likes).Error
+	return likes, err
+}
+
+// normalizeCommentContent 去除前後空白並檢查長度
+func normalizeCommentContent(content string) (string, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", ErrEmptyComment
+	}
+	if utf8.RuneCountInString(content) > MaxCommentLength {
+		return "", ErrCommentTooLong
+	}
+	return content, nil
+}
+
+// validMentions 去除重複的提及並確認用戶存在且已啟用
+func validMentions(db *gorm.DB, userIDs []uint) ([]uint, error) {
+	seen := map[uint]bool{}
+	ids := make([]uint, 0, len(userIDs))
+	for _, id := range userIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return ids, nil
+	}
+	var count int64
+	if err := db.Model(&models.User{}).Where("id IN ? AND status = ?", ids, "approved").Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if int(count) != len(ids) {
+		return nil, ErrInvalidMention
+	}
+	return ids, nil
+}
+
+// replaceMentions 以新的提及清單取代留言原有的提及，返回新加入的用戶（用於通知）
+func replaceMentions(tx *gorm.DB, commentID uint, userIDs []uint) ([]uint, error) {
+	var existing []uint
+	if err := tx.Model(&models.FileCommentMention{}).Where("comment_id = ?", commentID).Pluck("user_id", &existing).Error; err != nil {
+		return nil, err
+	}
+	had := map[uint]bool{}
+	for _, id := range existing {
+		had[id] = true
+	}
+	keep := map[uint]bool{}
+	added := []uint{}
+	for _, id := range userIDs {
+		keep[id] = true
+		if had[id] {
+			continue
+		}
+		if err := tx.Create(&models.FileCommentMention{CommentID: commentID, UserID: id}).Error; err != nil {
+			return nil, err
+		}
+		added = append(added, id)
+	}
+	for _, id := range existing {
+		if !keep[id] {
+			if err := tx.Where("comment_id = ? AND user_id = ?", commentID, id).Delete(&models.FileCommentMention{}).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+	return added, nil
+}
+
+// loadComment 讀取留言及其作者與提及的用戶
+func loadComment(db *gorm.DB, commentID uint) (*models.FileComment, error) {
+	var comment models.FileComment
+	if err := db.Preload("User").Preload("Mentions.User").First(&comment, commentID).Error; err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// CreateFileComment 新增留言或回覆，返回留言與被提及的用戶
+func CreateFileComment(db *gorm.DB, fileID, userID uint, parentID *uint, content string, mentions []uint) (*models.FileComment, []uint, error) {
+	content, err := normalizeCommentContent(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mentions, err = validMentions(db, mentions); err != nil {
+		return nil, nil, err
+	}
+
+	var comment models.FileComment
+	var mentioned []uint
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if parentID != nil {
+			var count int64
+			if err := tx.Model(&models.FileComment{}).Where("id = ? AND file_id = ? AND is_deleted = ?", *parentID, fileID, false).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return ErrInvalidCommentParent
+			}
+		}
+		comment = models.FileComment{FileID: fileID, ParentID: parentID, UserID: userID, Content: content}
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		var err error
+		mentioned, err = replaceMentions(tx, comment.ID, mentions)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	created, err := loadComment(db, comment.ID)
+	return created, mentioned, err
+}
+
+// UpdateFileComment 修改留言內容與提及，返回修改後的留言與新加入的提及
+func UpdateFileComment(db *gorm.DB, comment *models.FileComment, editorID uint, content string, mentions []uint) (*models.FileComment, []uint, error) {
+	if comment.IsDeleted {
+		return nil, nil, ErrCommentDeleted
+	}
+	content, err := normalizeCommentContent(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mentions, err = validMentions(db, mentions); err != nil {
+		return nil, nil, err
+	}
+
+	var added []uint
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(comment).Updates(map[string]interface{}{
+			"content":   content,
+			"edited_at": time.Now(),
+			"edited_by": editorID,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		added, err = replaceMentions(tx, comment.ID, mentions)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	updated, err := loadComment(db, comment.ID)
+	return updated, added, err
+}
+
+// DeleteFileComment 刪除留言：清除內容與提及，保留記錄讓回覆維持在討論串中
+func DeleteFileComment(db *gorm.DB, comment *models.FileComment, userID uint) error {
+	if comment.IsDeleted {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(comment).Updates(map[string]interface{}{
+			"content":    "",
+			"is_deleted": true,
+			"deleted_at": time.Now(),
+			"deleted_by": userID,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("comment_id = ?", comment.ID).Delete(&models.FileCommentMention{}).Error
+	})
+}
+
+// FileComments 檔案的留言討論串：最上層留言依時間排列，回覆放在各自留言的 Replies 中
+// 已刪除且沒有回覆的留言不顯示
+func FileComments(db *gorm.DB, fileID uint) ([]*models.FileComment, error) {
+	var comments []*models.FileComment
+	if err := db.Preload("User").Preload("Mentions.User").Where("file_id = ?", fileID).
+		Order("created_at, id").Find(&comments).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]*models.FileComment, len(comments))
+	for _, comment := range comments {
+		byID[comment.ID] = comment
+	}
+	roots := []*models.FileComment{}
+	for _, comment := range comments {
+		if comment.ParentID != nil {
+			if parent, ok := byID[*comment.ParentID]; ok {
+				parent.Replies = append(parent.Replies, comment)
+				continue
+			}
+		}
+		roots = append(roots, comment)
+	}
+	return pruneDeletedComments(roots), nil
+}
+
+// pruneDeletedComments 移除已刪除且沒有可顯示回覆的留言
+func pruneDeletedComments(comments []*models.FileComment) []*models.FileComment {
+	kept := comments[:0]
+	for _, comment := range comments {
+		comment.Replies = pruneDeletedComments(comment.Replies)
+		if comment.IsDeleted && len(comment.Replies) == 0 {
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	return kept
+}
+
+// DeleteFileSocial 刪除檔案的按讚、留言與提及，在檔案永久刪除時呼叫
+func DeleteFileSocial(db *gorm.DB, fileIDs ...uint) error {
+	if len(fileIDs) == 0 {
+		return nil
+	}
+	comments := db.Model(&models.FileComment{}).Select("id").Where("file_id IN ?", fileIDs)
+	if err := db.Where("comment_id IN (?)", comments).Delete(&models.FileCommentMention{}).Error; err != nil {
+		return err
+	}
+	if err := db.Where("file_id IN ?", fileIDs).Delete(&models.FileComment{}).Error; err != nil {
+		return err
+	}
+	return db.Where("file_id IN ?", fileIDs).Delete(&models.FileLike{}).Error
+}
@@ -0,0 +1,318 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+// UpdateTreePath 項目的父資料夾變更後，更新其與所有子孫項目（含垃圾桶中的項目）的 ID 路徑
+func UpdateTreePath(db *gorm.DB, fileID uint) error {
+	var file models.File
+	if err := db.Select("id", "parent_id", "tree_path").First(&file, fileID).Error; err != nil {
+		return err
+	}
+	newPath, err := models.FileTreePath(db, file.ParentID, file.ID)
+	if err != nil {
+		return err
+	}
+	if newPath == file.TreePath {
+		return nil
+	}
+	if file.TreePath == "" {
+		// 尚未設定 ID 路徑的舊資料，子孫項目由修復工具補上
+		return db.Model(&models.File{}).Where("id = ?", file.ID).UpdateColumn("tree_path", newPath).Error
+	}
+	return db.Model(&models.File{}).Where("tree_path LIKE ?", file.TreePath+"%").
+		UpdateColumn("tree_path", gorm.Expr("? || SUBSTR(tree_path, ?)", newPath, len(file.TreePath)+1)).Error
+}
+
+// IsDescendantOf 檢查 fileID 是否為 ancestorID 本身或其子孫項目
+func IsDescendantOf(db *gorm.DB, fileID, ancestorID uint) (bool, error) {
+	if fileID == ancestorID {
+		return true, nil
+	}
+	var file models.File
+	if err := db.Select("id", "parent_id", "tree_path").First(&file, fileID).Error; err != nil {
+		return false, err
+	}
+	path := file.TreePath
+	if path == "" {
+		var err error
+		if path, err = models.FileTreePath(db, file.ParentID, file.ID); err != nil {
+			return false, err
+		}
+	}
+	return strings.Contains(path, fmt.Sprintf("/%d/", ancestorID)), nil
+}
+
+// ScopeDescendants 限定查詢為資料夾的所有子孫項目（不含資料夾本身）
+func ScopeDescendants(query *gorm.DB, folder models.File) *gorm.DB {
+	if folder.TreePath == "" {
+		return ScopeVirtualPath(query, folder.VirtualPath).Where("id <> ?", folder.ID)
+	}
+	return query.Where("tree_path LIKE ? AND id <> ?", folder.TreePath+"%", folder.ID)
+}
+
+// ScopeVirtualPath 限定查詢為虛擬路徑本身及其下的項目，不包含 /photos2 這類開頭相同的項目
+func ScopeVirtualPath(query *gorm.DB, virtualPath string) *gorm.DB {
+	virtualPath = strings.TrimSuffix(virtualPath, "/")
+	return query.Where(`(virtual_path = ? OR virtual_path LIKE ? ESCAPE '\')`, virtualPath, EscapeLike(virtualPath)+"/%")
+}
+
+// FileTreeIssue 資料夾結構檢查發現的單一問題
+type FileTreeIssue struct {
+	FileID   uint   `json:"file_id"`
+	Name     string `json:"name"`
+	ParentID *uint  `json:"parent_id,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// FileTreeReport 資料夾結構檢查與修復結果
+type FileTreeReport struct {
+	DryRun           bool            `json:"dry_run"`
+	Consistent       bool            `json:"consistent"`
+	CheckedItems     int             `json:"checked_items"`
+	Orphans          []FileTreeIssue `json:"orphans"`            // 父資料夾不存在或不是資料夾，修復時移至根目錄
+	Cycles           []FileTreeIssue `json:"cycles"`             // 形成循環的項目，修復時將循環中 ID 最小的項目移至根目錄
+	VirtualPathDrift []FileTreeIssue `json:"virtual_path_drift"` // 虛擬路徑與實際位置不符（只檢查未刪除的項目）
+	TreePathDrift    int             `json:"tree_path_drift"`    // ID 路徑與實際位置不符的項目數
+	Repaired         int             `json:"repaired"`           // 實際更新的項目數
+}
+
+// fileTree 載入到記憶體中的資料夾結構
+type fileTree struct {
+	nodes map[uint]*models.File
+	ids   []uint
+}
+
+// loadFileTree 載入所有項目（含垃圾桶）的結構欄位
+func loadFileTree(db *gorm.DB) (*fileTree, error) {
+	var files []models.File
+	if err := db.Select("id", "name", "parent_id", "is_directory", "is_deleted", "virtual_path", "tree_path").
+		Order("id").Find(&files).Error; err != nil {
+		return nil, err
+	}
+	tree := &fileTree{nodes: make(map[uint]*models.File, len(files))}
+	for i := range files {
+		tree.nodes[files[i].ID] = &files[i]
+		tree.ids = append(tree.ids, files[i].ID)
+	}
+	return tree, nil
+}
+
+// orphans 父資料夾不存在或不是資料夾的項目
+func (t *fileTree) orphans() []uint {
+	var ids []uint
+	for _, id := range t.ids {
+		node := t.nodes[id]
+		if node.ParentID == nil {
+			continue
+		}
+		if parent, ok := t.nodes[*node.ParentID]; !ok || !parent.IsDirectory {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// cycles 找出所有循環，每個循環依 ID 排序返回
+func (t *fileTree) cycles() [][]uint {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[uint]int, len(t.ids))
+	var result [][]uint
+	for _, start := range t.ids {
+		var stack []uint
+		current := &start
+		for current != nil && state[*current] == unvisited {
+			node, ok := t.nodes[*current]
+			if !ok {
+				break
+			}
+			state[*current] = visiting
+			stack = append(stack, *current)
+			current = node.ParentID
+		}
+		if current != nil && state[*current] == visiting {
+			var cycle []uint
+			for i := len(stack) - 1; i >= 0; i-- {
+				cycle = append(cycle, stack[i])
+				if stack[i] == *current {
+					break
+				}
+			}
+			sort.Slice(cycle, func(i, j int) bool { return cycle[i] < cycle[j] })
+			result = append(result, cycle)
+		}
+		for _, id := range stack {
+			state[id] = done
+		}
+	}
+	return result
+}
+
+// expectedPaths 依目前的父子關係計算每個項目應有的虛擬路徑與 ID 路徑（結構中不可有循環）
+func (t *fileTree) expectedPaths() (map[uint]string, map[uint]string) {
+	virtualPaths := make(map[uint]string, len(t.ids))
+	treePaths := make(map[uint]string, len(t.ids))
+	var resolve func(id uint)
+	resolve = func(id uint) {
+		if _, ok := treePaths[id]; ok {
+			return
+		}
+		node := t.nodes[id]
+		parentVirtual, parentTree := "", "/"
+		if node.ParentID != nil {
+			if _, ok := t.nodes[*node.ParentID]; ok {
+				resolve(*node.ParentID)
+				parentVirtual, parentTree = virtualPaths[*node.ParentID], treePaths[*node.ParentID]
+			}
+		}
+		virtualPaths[id] = parentVirtual + "/" + node.Name
+		treePaths[id] = fmt.Sprintf("%s%d/", parentTree, id)
+	}
+	for _, id := range t.ids {
+		resolve(id)
+	}
+	return virtualPaths, treePaths
+}
+
+// issue 建立項目的問題記錄
+func (t *fileTree) issue(id uint, reason string) FileTreeIssue {
+	node := t.nodes[id]
+	return FileTreeIssue{FileID: id, Name: node.Name, ParentID: node.ParentID, Reason: reason}
+}
+
+// RepairFileTree 檢查資料夾結構中的孤兒項目、循環與虛擬路徑偏差；dryRun 為 false 時一併修復
+func RepairFileTree(db *gorm.DB, dryRun bool) (*FileTreeReport, error) {
+	report := &FileTreeReport{
+		DryRun:           dryRun,
+		Orphans:          []FileTreeIssue{},
+		Cycles:           []FileTreeIssue{},
+		VirtualPathDrift: []FileTreeIssue{},
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		tree, err := loadFileTree(tx)
+		if err != nil {
+			return err
+		}
+		report.CheckedItems = len(tree.ids)
+
+		// 先將孤兒項目與循環中的一個項目移至根目錄，之後才能計算路徑
+		var detached []uint
+		for _, id := range tree.orphans() {
+			report.Orphans = append(report.Orphans, tree.issue(id, "父資料夾不存在或不是資料夾"))
+			detached = append(detached, id)
+		}
+		for _, cycle := range tree.cycles() {
+			for _, id := range cycle {
+				report.Cycles = append(report.Cycles, tree.issue(id, fmt.Sprintf("與項目 %v 形成循環", cycle)))
+			}
+			detached = append(detached, cycle[0])
+		}
+		for _, id := range detached {
+			node := tree.nodes[id]
+			node.ParentID = nil
+			if dryRun {
+				continue
+			}
+			updates := map[string]interface{}{"parent_id": nil}
+			if !node.IsDeleted {
+				name, err := UniqueName(tx, node.Name, nil)
+				if err != nil {
+					return err
+				}
+				node.Name = name
+				updates["name"] = name
+			}
+			if err := tx.Model(&models.File{}).Where("id = ?", id).UpdateColumns(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		virtualPaths, treePaths := tree.expectedPaths()
+		repaired := map[uint]bool{}
+		for _, id := range detached {
+			repaired[id] = true
+		}
+		for _, id := range tree.ids {
+			node := tree.nodes[id]
+			updates := map[string]interface{}{}
+			if node.TreePath != treePaths[id] {
+				report.TreePathDrift++
+				updates["tree_path"] = treePaths[id]
+			}
+			if !node.IsDeleted && node.VirtualPath != virtualPaths[id] {
+				issue := tree.issue(id, "")
+				issue.Actual, issue.Expected = node.VirtualPath, virtualPaths[id]
+				report.VirtualPathDrift = append(report.VirtualPathDrift, issue)
+				updates["virtual_path"] = virtualPaths[id]
+			}
+			if dryRun || len(updates) == 0 {
+				continue
+			}
+			if err := tx.Model(&models.File{}).Where("id = ?", id).UpdateColumns(updates).Error; err != nil {
+				return err
+			}
+			repaired[id] = true
+		}
+		if !dryRun {
+			report.Repaired = len(repaired)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Consistent = len(report.Orphans) == 0 && len(report.Cycles) == 0 &&
+		len(report.VirtualPathDrift) == 0 && report.TreePathDrift == 0
+	return report, nil
+}
+
+// BackfillTreePaths 為尚未設定 ID 路徑的既有項目補上 ID 路徑，返回更新的項目數
+func BackfillTreePaths(db *gorm.DB) (int, error) {
+	var missing int64
+	if err := db.Model(&models.File{}).Where("tree_path = ? OR tree_path IS NULL", "").Count(&missing).Error; err != nil {
+		return 0, err
+	}
+	if missing == 0 {
+		return 0, nil
+	}
+
+	tree, err := loadFileTree(db)
+	if err != nil {
+		return 0, err
+	}
+	// 形成循環的項目無法計算路徑，留給修復工具處理
+	for _, cycle := range tree.cycles() {
+		for _, id := range cycle {
+			tree.nodes[id].ParentID = nil
+		}
+	}
+	_, treePaths := tree.expectedPaths()
+
+	updated := 0
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, id := range tree.ids {
+			if tree.nodes[id].TreePath != "" {
+				continue
+			}
+			if err := tx.Model(&models.File{}).Where("id = ?", id).UpdateColumn("tree_path", treePaths[id]).Error; err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	})
+	return updated, err
+}
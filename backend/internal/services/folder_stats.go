@@ -0,0 +1,176 @@
+package services
+
+import (
+	"sort"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+// folderAggregate 資料夾直接子項目的統計
+type folderAggregate struct {
+	TotalSize int64
+	ItemCount int64
+}
+
+// aggregateFolder 由直接子項目計算資料夾統計（子資料夾使用其已保存的統計）
+func aggregateFolder(db *gorm.DB, folderID uint) (folderAggregate, error) {
+	var agg folderAggregate
+	err := db.Model(&models.File{}).
+		Select("COALESCE(SUM(CASE WHEN is_directory THEN total_size WHEN shortcut_target_id IS NOT NULL THEN 0 ELSE file_size END), 0) AS total_size, "+
+			"COUNT(*) + COALESCE(SUM(CASE WHEN is_directory THEN item_count ELSE 0 END), 0) AS item_count").
+		Where("parent_id = ? AND is_deleted = ?", folderID, false).
+		Scan(&agg).Error
+	return agg, err
+}
+
+// updateFolderAggregate 重新計算並保存單一資料夾的統計
+func updateFolderAggregate(db *gorm.DB, folderID uint) error {
+	agg, err := aggregateFolder(db, folderID)
+	if err != nil {
+		return err
+	}
+	return db.Model(&models.File{}).Where("id = ? AND is_directory = ?", folderID, true).
+		UpdateColumns(map[string]interface{}{"total_size": agg.TotalSize, "item_count": agg.ItemCount}).Error
+}
+
+// RefreshFolderStats 子項目變動後，由指定資料夾往上逐層更新統計（nil 表示根目錄，不需更新）
+func RefreshFolderStats(db *gorm.DB, folderID *uint) error {
+	visited := map[uint]bool{}
+	for folderID != nil && !visited[*folderID] {
+		visited[*folderID] = true
+		if err := updateFolderAggregate(db, *folderID); err != nil {
+			return err
+		}
+		var folder models.File
+		if err := db.Select("id", "parent_id").Limit(1).Find(&folder, *folderID).Error; err != nil {
+			return err
+		}
+		if folder.ID == 0 {
+			return nil
+		}
+		folderID = folder.ParentID
+	}
+	return nil
+}
+
+// RefreshFolderStatsFor 項目移出或移入資料夾後更新前後兩個位置的統計
+func RefreshFolderStatsFor(db *gorm.DB, parentIDs ...*uint) error {
+	seen := map[uint]bool{}
+	for _, parentID := range parentIDs {
+		if parentID == nil || seen[*parentID] {
+			continue
+		}
+		seen[*parentID] = true
+		if err := RefreshFolderStats(db, parentID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecomputeFolderStats 由下而上重新計算資料夾整個子樹的統計，並更新其上層資料夾
+// 用於整批還原或複製資料夾等子項目統計可能不正確的情況
+func RecomputeFolderStats(db *gorm.DB, rootID uint) error {
+	levels := [][]uint{{rootID}}
+	visited := map[uint]bool{rootID: true}
+	for frontier := levels[0]; len(frontier) > 0; {
+		var next []uint
+		for _, chunk := range ChunkIDs(frontier) {
+			var folders []models.File
+			if err := db.Select("id").Where("parent_id IN ? AND is_directory = ? AND is_deleted = ?", chunk, true, false).
+				Find(&folders).Error; err != nil {
+				return err
+			}
+			for _, folder := range folders {
+				if !visited[folder.ID] {
+					visited[folder.ID] = true
+					next = append(next, folder.ID)
+				}
+			}
+		}
+		if len(next) > 0 {
+			levels = append(levels, next)
+		}
+		frontier = next
+	}
+
+	for i := len(levels) - 1; i >= 0; i-- {
+		for _, id := range levels[i] {
+			if err := updateFolderAggregate(db, id); err != nil {
+				return err
+			}
+		}
+	}
+
+	var root models.File
+	if err := db.Select("id", "parent_id").Limit(1).Find(&root, rootID).Error; err != nil {
+		return err
+	}
+	return RefreshFolderStats(db, root.ParentID)
+}
+
+// RefreshItemFolderStats 項目整批加入（還原、複製）後更新統計：資料夾重新計算整個子樹，檔案只更新上層
+func RefreshItemFolderStats(db *gorm.DB, fileID uint) error {
+	var file models.File
+	if err := db.Select("id", "parent_id", "is_directory", "is_deleted").Limit(1).Find(&file, fileID).Error; err != nil {
+		return err
+	}
+	if file.ID == 0 {
+		return nil
+	}
+	if file.IsDirectory && !file.IsDeleted {
+		return RecomputeFolderStats(db, file.ID)
+	}
+	return RefreshFolderStats(db, file.ParentID)
+}
+
+// FolderStatsProgress 回報重新計算進度，返回 false 時停止
+type FolderStatsProgress func(done, total int) bool
+
+// RepairFolderStats 從頭重新計算所有資料夾的統計，返回已更新的資料夾數量
+// 資料夾依深度由深至淺處理，確保計算上層時子資料夾的統計已正確
+func RepairFolderStats(db *gorm.DB, progress FolderStatsProgress) (int, error) {
+	var folders []models.File
+	if err := db.Select("id", "parent_id").Where("is_directory = ?", true).Find(&folders).Error; err != nil {
+		return 0, err
+	}
+
+	parents := make(map[uint]*uint, len(folders))
+	for _, folder := range folders {
+		parents[folder.ID] = folder.ParentID
+	}
+	depths := make(map[uint]int, len(folders))
+	var depthOf func(id uint, seen map[uint]bool) int
+	depthOf = func(id uint, seen map[uint]bool) int {
+		if depth, ok := depths[id]; ok {
+			return depth
+		}
+		depth := 0
+		if parentID := parents[id]; parentID != nil && !seen[*parentID] {
+			if _, isFolder := parents[*parentID]; isFolder {
+				seen[id] = true
+				depth = depthOf(*parentID, seen) + 1
+			}
+		}
+		depths[id] = depth
+		return depth
+	}
+	for _, folder := range folders {
+		depthOf(folder.ID, map[uint]bool{})
+	}
+	sort.SliceStable(folders, func(i, j int) bool {
+		return depths[folders[i].ID] > depths[folders[j].ID]
+	})
+
+	for i, folder := range folders {
+		if err := updateFolderAggregate(db, folder.ID); err != nil {
+			return i, err
+		}
+		if progress != nil && !progress(i+1, len(folders)) {
+			return i + 1, nil
+		}
+	}
+	return len(folders), nil
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/config"
+	"memoryark/internal/models"
+	"memoryark/internal/scheduler"
+)
+
+// 資料夾範本的限制
+const (
+	maxTemplateDepth    = 8
+	maxTemplateFolders  = 200
+	maxTemplateLeadDays = 60
+	maxCatchUpServices  = 50 // 單次檢查最多為同一範本建立的聚會數
+)
+
+// ErrInvalidFolderTemplate 資料夾範本設定錯誤
+var ErrInvalidFolderTemplate = errors.New("資料夾範本設定錯誤")
+
+// placeholderPattern 資料夾名稱中的日期佔位符，例如 {date}、{date:YYYYMMDD}、{weekday}
+var placeholderPattern = regexp.MustCompile(`\{([a-z]+)(?::([^{}]*))?\}`)
+
+// weekdayNames 星期的中文名稱
+var weekdayNames = [...]string{"日", "一", "二", "三", "四", "五", "六"}
+
+// formatTemplateDate 以 YYYY、YY、MM、M、DD、D 組成的格式輸出日期
+func formatTemplateDate(layout string, date time.Time) string {
+	return strings.NewReplacer(
+		"YYYY", fmt.Sprintf("%04d", date.Year()),
+		"YY", fmt.Sprintf("%02d", date.Year()%100),
+		"MM", fmt.Sprintf("%02d", int(date.Month())),
+		"M", fmt.Sprintf("%d", int(date.Month())),
+		"DD", fmt.Sprintf("%02d", date.Day()),
+		"D", fmt.Sprintf("%d", date.Day()),
+	).Replace(layout)
+}
+
+// RenderTemplateName 以聚會日期代入資料夾名稱中的佔位符
+// 支援 {date}（2006-01-02）、{date:格式}、{year}、{month}、{day} 與 {weekday}（日、一…六）
+func RenderTemplateName(name string, date time.Time) (string, error) {
+	var renderErr error
+	rendered := placeholderPattern.ReplaceAllStringFunc(name, func(match string) string {
+		parts := placeholderPattern.FindStringSubmatch(match)
+		key, layout := parts[1], parts[2]
+		switch {
+		case key == "date" && layout == "":
+			return formatTemplateDate("YYYY-MM-DD", date)
+		case key == "date":
+			return formatTemplateDate(layout, date)
+		case layout != "":
+			// 只有 {date} 可以指定格式
+		case key == "year":
+			return fmt.Sprintf("%04d", date.Year())
+		case key == "month":
+			return fmt.Sprintf("%02d", int(date.Month()))
+		case key == "day":
+			return fmt.Sprintf("%02d", date.Day())
+		case key == "weekday":
+			return weekdayNames[date.Weekday()]
+		}
+		if renderErr == nil {
+			renderErr = fmt.Errorf("%w: 不支援的佔位符 %s", ErrInvalidFolderTemplate, match)
+		}
+		return match
+	})
+	if renderErr != nil {
+		return "", renderErr
+	}
+
+	rendered = strings.TrimSpace(rendered)
+	if rendered == "" || rendered == "." || rendered == ".." || strings.ContainsAny(rendered, `/\`) {
+		return "", fmt.Errorf("%w: 資料夾名稱無效: %q", ErrInvalidFolderTemplate, name)
+	}
+	return rendered, nil
+}
+
+// validateTemplateNodes 檢查資料夾樹的名稱、深度與數量，返回資料夾數量
+func validateTemplateNodes(nodes []models.FolderTemplateNode, depth int, sample time.Time) (int, error) {
+	if depth > maxTemplateDepth {
+		return 0, fmt.Errorf("%w: 資料夾層數不能超過 %d 層", ErrInvalidFolderTemplate, maxTemplateDepth)
+	}
+	count := 0
+	seen := map[string]bool{}
+	for _, node := range nodes {
+		name, err := RenderTemplateName(node.Name, sample)
+		if err != nil {
+			return 0, err
+		}
+		if seen[name] {
+			return 0, fmt.Errorf("%w: 同一層有重複的資料夾名稱 %q", ErrInvalidFolderTemplate, node.Name)
+		}
+		seen[name] = true
+		children, err := validateTemplateNodes(node.Children, depth+1, sample)
+		if err != nil {
+			return 0, err
+		}
+		count += 1 + children
+	}
+	return count, nil
+}
+
+// ValidateFolderTemplate 檢查資料夾範本的結構、排程、分類與上層資料夾
+func ValidateFolderTemplate(db *gorm.DB, template *models.FolderTemplate) error {
+	template.Name = strings.TrimSpace(template.Name)
+	if template.Name == "" {
+		return fmt.Errorf("%w: 範本名稱不能為空", ErrInvalidFolderTemplate)
+	}
+	if len(template.Structure) == 0 {
+		return fmt.Errorf("%w: 至少需要一個資料夾", ErrInvalidFolderTemplate)
+	}
+	count, err := validateTemplateNodes(template.Structure, 1, time.Now())
+	if err != nil {
+		return err
+	}
+	if count > maxTemplateFolders {
+		return fmt.Errorf("%w: 資料夾數量不能超過 %d 個", ErrInvalidFolderTemplate, maxTemplateFolders)
+	}
+
+	template.Schedule = strings.TrimSpace(template.Schedule)
+	if template.Schedule != "" {
+		if _, err := scheduler.Parse(template.Schedule); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidFolderTemplate, err)
+		}
+	} else if template.Enabled {
+		return fmt.Errorf("%w: 啟用排程時需要設定 cron 排程", ErrInvalidFolderTemplate)
+	}
+	if template.LeadDays < 0 || template.LeadDays > maxTemplateLeadDays {
+		return fmt.Errorf("%w: 提前建立的天數需介於 0 到 %d 天", ErrInvalidFolderTemplate, maxTemplateLeadDays)
+	}
+	if len(template.Tags) > 500 {
+		return fmt.Errorf("%w: 標籤不能超過 500 字元", ErrInvalidFolderTemplate)
+	}
+
+	if template.CategoryID != nil {
+		var count int64
+		if err := db.Model(&models.Category{}).Where("id = ?", *template.CategoryID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("%w: 分類不存在", ErrInvalidFolderTemplate)
+		}
+	}
+	if template.ParentID != nil {
+		var count int64
+		if err := db.Model(&models.File{}).Where("id = ? AND is_directory = ? AND is_deleted = ?", *template.ParentID, true, false).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("%w: 上層資料夾不存在", ErrInvalidFolderTemplate)
+		}
+	}
+	return nil
+}
+
+// FolderTemplateLocation 解讀排程使用的時區，設定無效時使用伺服器時區
+func FolderTemplateLocation(cfg config.FolderTemplateConfig) *time.Location {
+	if cfg.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		log.Printf("資料夾範本時區 %q 無效，改用伺服器時區: %v", cfg.Timezone, err)
+		return time.Local
+	}
+	return loc
+}
+
+// nextTemplateService 計算尚未建立資料夾的下一次聚會時間；已建立過的聚會之後才會再建立
+func nextTemplateService(template *models.FolderTemplate, schedule *scheduler.Schedule, now time.Time) time.Time {
+	after := now
+	if template.LastServiceAt != nil && template.LastServiceAt.After(after) {
+		after = *template.LastServiceAt
+	}
+	return schedule.Next(after.In(now.Location()))
+}
+
+// leadTime 提前建立資料夾的時間
+func leadTime(template *models.FolderTemplate) time.Duration {
+	return time.Duration(template.LeadDays) * 24 * time.Hour
+}
+
+// FillNextFolderTemplateRun 計算範本的下一次聚會與預計建立資料夾的時間（停用或沒有排程時不計算）
+func FillNextFolderTemplateRun(template *models.FolderTemplate, now time.Time) {
+	template.NextServiceAt, template.NextRunAt = nil, nil
+	if !template.Enabled || template.Schedule == "" {
+		return
+	}
+	schedule, err := scheduler.Parse(template.Schedule)
+	if err != nil {
+		return
+	}
+	next := nextTemplateService(template, schedule, now)
+	if next.IsZero() {
+		return
+	}
+	runAt := next.Add(-leadTime(template))
+	if runAt.Before(now) {
+		runAt = now
+	}
+	template.NextServiceAt, template.NextRunAt = &next, &runAt
+}
+
+// UpcomingTemplateServices 範本接下來的 count 次聚會時間
+func UpcomingTemplateServices(template *models.FolderTemplate, now time.Time, count int) ([]time.Time, error) {
+	schedule, err := scheduler.Parse(template.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFolderTemplate, err)
+	}
+	upcoming := []time.Time{}
+	next := now
+	for len(upcoming) < count {
+		if next = schedule.Next(next); next.IsZero() {
+			break
+		}
+		upcoming = append(upcoming, next)
+	}
+	return upcoming, nil
+}
+
+// FolderTemplateApplier 為指定的聚會時間建立範本的資料夾
+type FolderTemplateApplier func(template *models.FolderTemplate, serviceAt time.Time) error
+
+// RunDueFolderTemplates 為已進入提前建立期間的聚會建立資料夾，返回建立的聚會數
+// 伺服器停機期間已經開始的聚會不會補建
+func RunDueFolderTemplates(db *gorm.DB, loc *time.Location, now time.Time, apply FolderTemplateApplier) (int, error) {
+	var templates []models.FolderTemplate
+	if err := db.Where("enabled = ? AND schedule <> ?", true, "").Find(&templates).Error; err != nil {
+		return 0, err
+	}
+
+	now = now.In(loc)
+	created := 0
+	for i := range templates {
+		template := &templates[i]
+		schedule, err := scheduler.Parse(template.Schedule)
+		if err != nil {
+			db.Model(template).Updates(map[string]interface{}{"last_run_at": now, "last_error": err.Error()})
+			continue
+		}
+
+		for n := 0; n < maxCatchUpServices; n++ {
+			next := nextTemplateService(template, schedule, now)
+			if next.IsZero() || next.Add(-leadTime(template)).After(now) {
+				break
+			}
+			updates := map[string]interface{}{"last_run_at": now, "last_service_at": next, "last_error": ""}
+			if err := apply(template, next); err != nil {
+				// 失敗時保留 last_service_at，下次檢查時重試
+				log.Printf("資料夾範本 %q 建立 %s 的資料夾失敗: %v", template.Name, next.Format("2006-01-02 15:04"), err)
+				db.Model(template).Updates(map[string]interface{}{"last_run_at": now, "last_error": err.Error()})
+				break
+			}
+			if err := db.Model(template).Updates(updates).Error; err != nil {
+				return created, err
+			}
+			template.LastServiceAt = &next
+			created++
+		}
+	}
+	return created, nil
+}
+
+// StartFolderTemplates 依設定的間隔檢查並建立排程的資料夾範本
+func StartFolderTemplates(db *gorm.DB, cfg config.FolderTemplateConfig, apply FolderTemplateApplier) {
+	if cfg.CheckInterval <= 0 {
+		return
+	}
+	loc := FolderTemplateLocation(cfg)
+
+	run := func() {
+		created, err := RunDueFolderTemplates(db, loc, time.Now(), apply)
+		if err != nil {
+			log.Printf("檢查資料夾範本排程失敗: %v", err)
+			return
+		}
+		if created > 0 {
+			log.Printf("資料夾範本排程：為 %d 次聚會建立資料夾", created)
+		}
+	}
+
+	go func() {
+		run()
+		ticker := time.NewTicker(time.Duration(cfg.CheckInterval) * time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			run()
+		}
+	}()
+}
@@ -0,0 +1,419 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+// jobPollInterval 沒有新工作通知時重新檢查佇列的間隔
+const jobPollInterval = 5 * time.Second
+
+// jobReportInterval 進度保存與推送的最短間隔
+const jobReportInterval = time.Second
+
+var (
+	// ErrJobCanceled 工作已被取消
+	ErrJobCanceled = errors.New("工作已取消")
+	// ErrJobFinished 工作已結束，無法取消
+	ErrJobFinished = errors.New("工作已結束")
+	// ErrUnknownJobType 沒有註冊此類型的工作
+	ErrUnknownJobType = errors.New("不支援的工作類型")
+)
+
+// JobFunc 執行一種背景工作，返回的結果會保存在工作記錄中（取消或失敗時也會保存已完成部分的結果）
+type JobFunc func(ctx *JobContext) (interface{}, error)
+
+// JobNotifier 將工作進度推送給建立工作的用戶
+type JobNotifier interface {
+	BroadcastUserEvent(userID uint, eventType string, message string, data interface{})
+}
+
+// JobQueue 背景工作佇列與工作者池，工作記錄保存在資料庫中
+type JobQueue struct {
+	db       *gorm.DB
+	workers  int
+	handlers map[string]JobFunc
+	notifier JobNotifier
+	wake     chan struct{}
+	mutex    sync.Mutex
+	running  map[uint]context.CancelFunc
+	start    sync.Once
+}
+
+// NewJobQueue 創建背景工作佇列
+func NewJobQueue(db *gorm.DB, workers int) *JobQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	return &JobQueue{
+		db:       db,
+		workers:  workers,
+		handlers: make(map[string]JobFunc),
+		wake:     make(chan struct{}, 1),
+		running:  make(map[uint]context.CancelFunc),
+	}
+}
+
+// Register 註冊一種工作類型的執行函數
+func (q *JobQueue) Register(jobType string, fn JobFunc) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.handlers[jobType] = fn
+}
+
+// SetNotifier 設置進度推送方式
+func (q *JobQueue) SetNotifier(notifier JobNotifier) {
+	q.notifier = notifier
+}
+
+// Enqueue 建立工作並通知工作者執行
+func (q *JobQueue) Enqueue(userID uint, jobType string, params interface{}) (*models.Job, error) {
+	q.mutex.Lock()
+	_, ok := q.handlers[jobType]
+	q.mutex.Unlock()
+	if !ok {
+		return nil, ErrUnknownJobType
+	}
+
+	payload, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	job := models.Job{
+		UserID: userID,
+		Type:   jobType,
+		Status: models.JobQueued,
+		Params: payload,
+	}
+	if err := q.db.Create(&job).Error; err != nil {
+		return nil, err
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return &job, nil
+}
+
+// Cancel 取消工作：排隊中的工作直接取消，執行中的工作在目前步驟完成後停止
+func (q *JobQueue) Cancel(job *models.Job) error {
+	if job.IsFinished() {
+		return ErrJobFinished
+	}
+
+	now := time.Now()
+	result := q.db.Model(&models.Job{}).Where("id = ? AND status = ?", job.ID, models.JobQueued).
+		Updates(map[string]interface{}{"status": models.JobCanceled, "cancel_requested": true, "finished_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := q.db.Model(&models.Job{}).Where("id = ? AND status = ?", job.ID, models.JobRunning).
+			Update("cancel_requested", true).Error; err != nil {
+			return err
+		}
+		q.mutex.Lock()
+		if cancel, ok := q.running[job.ID]; ok {
+			cancel()
+		}
+		q.mutex.Unlock()
+	}
+
+	if err := q.db.First(job, job.ID).Error; err != nil {
+		return err
+	}
+	if job.Status == models.JobCanceled {
+		q.notify(job, "job_completed", "背景工作已取消")
+	}
+	return nil
+}
+
+// Start 將上次中斷的工作重新排隊並啟動工作者
+func (q *JobQueue) Start() {
+	q.start.Do(func() {
+		if resumed, err := q.Recover(); err != nil {
+			log.Printf("重新排入中斷的背景工作失敗: %v", err)
+		} else if resumed > 0 {
+			log.Printf("重新排入 %d 個中斷的背景工作", resumed)
+		}
+		for i := 0; i < q.workers; i++ {
+			go q.work()
+		}
+		log.Printf("背景工作佇列已啟動，工作者數量: %d", q.workers)
+	})
+}
+
+// Recover 將服務重新啟動前仍在執行的工作重新排隊，工作會從上次保存的檢查點繼續
+func (q *JobQueue) Recover() (int64, error) {
+	result := q.db.Model(&models.Job{}).Where("status = ?", models.JobRunning).Update("status", models.JobQueued)
+	return result.RowsAffected, result.Error
+}
+
+// work 工作者迴圈
+func (q *JobQueue) work() {
+	for {
+		for q.RunNext() {
+		}
+		select {
+		case <-q.wake:
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+// RunPending 在目前的 goroutine 中執行所有排隊中的工作，返回執行的數量
+func (q *JobQueue) RunPending() int {
+	count := 0
+	for q.RunNext() {
+		count++
+	}
+	return count
+}
+
+// RunNext 取得並執行下一個排隊中的工作，佇列為空時返回 false
+func (q *JobQueue) RunNext() bool {
+	for {
+		var job models.Job
+		if err := q.db.Where("status = ?", models.JobQueued).Order("id").Limit(1).Find(&job).Error; err != nil {
+			log.Printf("查詢背景工作失敗: %v", err)
+			return false
+		}
+		if job.ID == 0 {
+			return false
+		}
+
+		// 以條件更新取得工作，避免多個工作者執行同一個工作
+		now := time.Now()
+		updates := map[string]interface{}{"status": models.JobRunning}
+		if job.StartedAt == nil {
+			updates["started_at"] = now
+		}
+		result := q.db.Model(&models.Job{}).Where("id = ? AND status = ?", job.ID, models.JobQueued).Updates(updates)
+		if result.Error != nil {
+			log.Printf("取得背景工作 %d 失敗: %v", job.ID, result.Error)
+			return false
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		job.Status = models.JobRunning
+		if job.StartedAt == nil {
+			job.StartedAt = &now
+		}
+		q.run(&job)
+		return true
+	}
+}
+
+// run 執行工作並保存結果
+func (q *JobQueue) run(job *models.Job) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.mutex.Lock()
+	fn, ok := q.handlers[job.Type]
+	q.running[job.ID] = cancel
+	q.mutex.Unlock()
+	defer func() {
+		q.mutex.Lock()
+		delete(q.running, job.ID)
+		q.mutex.Unlock()
+	}()
+
+	if job.CancelRequested {
+		cancel()
+	}
+	if !ok {
+		q.finish(job, nil, ErrUnknownJobType)
+		return
+	}
+
+	q.notify(job, "job_progress", "背景工作開始執行")
+	jc := &JobContext{Context: ctx, DB: q.db, Job: job, queue: q}
+	result, err := jc.call(fn)
+	q.finish(job, result, err)
+}
+
+// finish 保存工作的最終狀態與結果
+func (q *JobQueue) finish(job *models.Job, result interface{}, runErr error) {
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Error = ""
+	switch {
+	case runErr == nil:
+		job.Status = models.JobSucceeded
+		job.Progress = 100
+	case errors.Is(runErr, ErrJobCanceled) || errors.Is(runErr, context.Canceled):
+		job.Status = models.JobCanceled
+	default:
+		job.Status = models.JobFailed
+		job.Error = runErr.Error()
+		log.Printf("背景工作 %d (%s) 失敗: %v", job.ID, job.Type, runErr)
+	}
+	if result != nil {
+		if payload, err := json.Marshal(result); err == nil {
+			job.Result = payload
+		}
+	}
+
+	if err := q.db.Model(&models.Job{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"status":      job.Status,
+		"result":      job.Result,
+		"error":       job.Error,
+		"total":       job.Total,
+		"processed":   job.Processed,
+		"failed":      job.Failed,
+		"progress":    job.Progress,
+		"finished_at": job.FinishedAt,
+	}).Error; err != nil {
+		log.Printf("保存背景工作 %d 結果失敗: %v", job.ID, err)
+	}
+
+	message := "背景工作已完成"
+	switch job.Status {
+	case models.JobFailed:
+		message = "背景工作失敗"
+	case models.JobCanceled:
+		message = "背景工作已取消"
+	}
+	q.notify(job, "job_completed", message)
+}
+
+// notify 推送工作狀態給建立工作的用戶
+func (q *JobQueue) notify(job *models.Job, eventType, message string) {
+	if q.notifier != nil {
+		// 推送副本，避免工作者繼續更新時與推送同時存取
+		snapshot := *job
+		q.notifier.BroadcastUserEvent(job.UserID, eventType, message, snapshot)
+	}
+}
+
+// JobContext 工作執行時的環境，提供參數、檢查點、進度與取消狀態
+type JobContext struct {
+	context.Context
+	DB  *gorm.DB
+	Job *models.Job
+
+	queue      *JobQueue
+	checkpoint interface{}
+	lastReport time.Time
+}
+
+// call 執行工作函數，將 panic 轉為錯誤
+func (j *JobContext) call(fn JobFunc) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("工作執行異常: %v", r)
+		}
+	}()
+	return fn(j)
+}
+
+// DecodeParams 解析工作參數
+func (j *JobContext) DecodeParams(v interface{}) error {
+	return json.Unmarshal(j.Job.Params, v)
+}
+
+// Track 指定要保存的檢查點狀態，工作曾中斷時先載入上次保存的內容
+func (j *JobContext) Track(state interface{}) error {
+	j.checkpoint = state
+	if j.Job.Checkpoint == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(j.Job.Checkpoint), state)
+}
+
+// Canceled 工作是否已被要求取消
+func (j *JobContext) Canceled() bool {
+	return j.Err() != nil
+}
+
+// SetTotal 設定要處理的項目總數
+func (j *JobContext) SetTotal(total int) error {
+	j.Job.Total = total
+	j.Job.Progress = jobPercent(j.Job.Processed, total)
+	return j.DB.Model(&models.Job{}).Where("id = ?", j.Job.ID).
+		Updates(map[string]interface{}{"total": total, "progress": j.Job.Progress}).Error
+}
+
+// Advance 增加已處理與失敗的項目數，在 Transaction 中呼叫時與步驟一併保存
+func (j *JobContext) Advance(processed, failed int) {
+	j.Job.Processed += processed
+	j.Job.Failed += failed
+	j.Job.Progress = jobPercent(j.Job.Processed, j.Job.Total)
+}
+
+// Transaction 在單一交易中執行一個步驟，並一併保存進度與檢查點，確保中斷後不會重複執行
+func (j *JobContext) Transaction(fn func(tx *gorm.DB) error) error {
+	processed, failed, progress := j.Job.Processed, j.Job.Failed, j.Job.Progress
+	err := j.DB.Transaction(func(tx *gorm.DB) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return j.save(tx)
+	})
+	if err != nil {
+		j.Job.Processed, j.Job.Failed, j.Job.Progress = processed, failed, progress
+		return err
+	}
+	j.report(false)
+	return nil
+}
+
+// Report 保存並推送目前進度（間隔過短時略過）
+func (j *JobContext) Report() {
+	if time.Since(j.lastReport) < jobReportInterval {
+		return
+	}
+	if err := j.save(j.DB); err != nil {
+		log.Printf("保存背景工作 %d 進度失敗: %v", j.Job.ID, err)
+	}
+	j.report(true)
+}
+
+// save 保存進度與檢查點
+func (j *JobContext) save(db *gorm.DB) error {
+	updates := map[string]interface{}{
+		"processed": j.Job.Processed,
+		"failed":    j.Job.Failed,
+		"progress":  j.Job.Progress,
+	}
+	if j.checkpoint != nil {
+		payload, err := json.Marshal(j.checkpoint)
+		if err != nil {
+			return err
+		}
+		j.Job.Checkpoint = string(payload)
+		updates["checkpoint"] = j.Job.Checkpoint
+	}
+	return db.Model(&models.Job{}).Where("id = ?", j.Job.ID).Updates(updates).Error
+}
+
+// report 推送進度，force 為 false 時限制推送頻率
+func (j *JobContext) report(force bool) {
+	if !force && time.Since(j.lastReport) < jobReportInterval {
+		return
+	}
+	j.lastReport = time.Now()
+	j.queue.notify(j.Job, "job_progress", fmt.Sprintf("背景工作進度 %d/%d", j.Job.Processed, j.Job.Total))
+}
+
+// jobPercent 計算完成百分比
+func jobPercent(processed, total int) int {
+	if total <= 0 {
+		return 0
+	}
+	if processed >= total {
+		return 100
+	}
+	return processed * 100 / total
+}
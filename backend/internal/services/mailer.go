@@ -0,0 +1,77 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"memoryark/internal/config"
+)
+
+// Mailer 寄送系統郵件，例如一次性登入碼
+type Mailer interface {
+	SendMail(to, subject, body string) error
+}
+
+// SMTPMailer 透過 SMTP 寄送純文字郵件（伺服器支援時使用 STARTTLS）
+type SMTPMailer struct {
+	cfg  config.MailConfig
+	from *mail.Address
+}
+
+// NewMailer 依設定建立郵件服務，未設定 SMTP 主機或寄件者無效時返回 nil
+func NewMailer(cfg config.MailConfig) (Mailer, error) {
+	if cfg.SMTPHost == "" {
+		return nil, nil
+	}
+	sender := cfg.From
+	if sender == "" {
+		sender = cfg.SMTPUsername
+	}
+	from, err := mail.ParseAddress(sender)
+	if err != nil {
+		return nil, fmt.Errorf("寄件者 %q 無效: %w", sender, err)
+	}
+	return &SMTPMailer{cfg: cfg, from: from}, nil
+}
+
+// SendMail 寄送一封 UTF-8 純文字郵件
+func (m *SMTPMailer) SendMail(to, subject, body string) error {
+	recipient, err := mail.ParseAddress(to)
+	if err != nil {
+		return err
+	}
+	if strings.ContainsAny(subject, "\r\n") {
+		return errors.New("郵件主旨不能包含換行")
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", recipient.String())
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+
+	var auth smtp.Auth
+	if m.cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", m.cfg.SMTPUsername, m.cfg.SMTPPassword, m.cfg.SMTPHost)
+	}
+	addr := net.JoinHostPort(m.cfg.SMTPHost, strconv.Itoa(m.cfg.SMTPPort))
+	return smtp.SendMail(addr, auth, m.from.Address, []string{recipient.Address}, msg.Bytes())
+}
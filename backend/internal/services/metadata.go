@@ -0,0 +1,233 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+// 批量編輯描述資料時單一欄位的操作方式
+const (
+	MetadataSet    = "set"    // 以新值取代
+	MetadataAppend = "append" // 附加到既有值之後（標籤會合併並去除重複）
+	MetadataClear  = "clear"  // 清除
+)
+
+// 批量編輯描述資料時每個檔案的結果
+const (
+	MetadataUpdated   = "updated"
+	MetadataUnchanged = "unchanged"
+	MetadataFailed    = "failed"
+)
+
+// ErrEmptyMetadataPatch 沒有指定要修改的欄位
+var ErrEmptyMetadataPatch = errors.New("請至少指定一個要修改的欄位")
+
+// TextPatch 文字欄位的修改
+type TextPatch struct {
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+// CategoryPatch 分類的修改（不支援 append）
+type CategoryPatch struct {
+	Op    string `json:"op"`
+	Value *uint  `json:"value"`
+}
+
+// MetadataPatch 批量編輯的欄位修改，未指定的欄位維持不變
+type MetadataPatch struct {
+	CategoryID     *CategoryPatch `json:"category_id,omitempty"`
+	Description    *TextPatch     `json:"description,omitempty"`
+	Tags           *TextPatch     `json:"tags,omitempty"`
+	Speaker        *TextPatch     `json:"speaker,omitempty"`
+	SermonTitle    *TextPatch     `json:"sermon_title,omitempty"`
+	BibleReference *TextPatch     `json:"bible_reference,omitempty"`
+}
+
+// MetadataResult 單一檔案的批量編輯結果
+type MetadataResult struct {
+	FileID  uint     `json:"file_id"`
+	Name    string   `json:"name,omitempty"`
+	Status  string   `json:"status"`            // updated、unchanged 或 failed
+	Changed []string `json:"changed,omitempty"` // 實際變更的欄位
+	Error   string   `json:"error,omitempty"`
+}
+
+// textField 可批量編輯的文字欄位
+type textField struct {
+	column    string
+	label     string
+	maxLen    int
+	separator string // append 時與既有值之間的分隔字元
+	patch     *TextPatch
+	current   func(f *models.File) string
+}
+
+// textFields 依欄位順序列出文字欄位的修改
+func (p *MetadataPatch) textFields() []textField {
+	return []textField{
+		{"description", "描述", 0, "\n", p.Description, func(f *models.File) string { return f.Description }},
+		{"tags", "標籤", 500, ",", p.Tags, func(f *models.File) string { return f.Tags }},
+		{"speaker", "講員", 255, "、", p.Speaker, func(f *models.File) string { return f.Speaker }},
+		{"sermon_title", "講道標題", 500, " ", p.SermonTitle, func(f *models.File) string { return f.SermonTitle }},
+		{"bible_reference", "經文參考", 255, "; ", p.BibleReference, func(f *models.File) string { return f.BibleReference }},
+	}
+}
+
+// Validate 檢查修改內容，指定的分類必須存在
+func (p *MetadataPatch) Validate(db *gorm.DB) error {
+	empty := p.CategoryID == nil
+	for _, field := range p.textFields() {
+		if field.patch == nil {
+			continue
+		}
+		empty = false
+		switch field.patch.Op {
+		case MetadataSet, MetadataAppend, MetadataClear:
+		default:
+			return fmt.Errorf("%s 的操作方式僅支援 set、append 或 clear", field.column)
+		}
+	}
+	if empty {
+		return ErrEmptyMetadataPatch
+	}
+
+	if p.CategoryID != nil {
+		switch p.CategoryID.Op {
+		case MetadataClear:
+		case MetadataSet:
+			if p.CategoryID.Value == nil {
+				return errors.New("category_id 的 set 操作需要指定分類")
+			}
+			var count int64
+			if err := db.Model(&models.Category{}).Where("id = ?", *p.CategoryID.Value).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return errors.New("指定的分類不存在")
+			}
+		default:
+			return errors.New("category_id 的操作方式僅支援 set 或 clear")
+		}
+	}
+	return nil
+}
+
+// splitTags 將逗號分隔的標籤去除空白與重複
+func splitTags(value string) []string {
+	seen := map[string]bool{}
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// apply 計算欄位修改後的值
+func (field textField) apply(current string) string {
+	switch field.patch.Op {
+	case MetadataClear:
+		return ""
+	case MetadataAppend:
+		if field.column == "tags" {
+			return strings.Join(splitTags(current+","+field.patch.Value), ",")
+		}
+		if current == "" {
+			return field.patch.Value
+		}
+		if field.patch.Value == "" {
+			return current
+		}
+		return current + field.separator + field.patch.Value
+	default:
+		if field.column == "tags" {
+			return strings.Join(splitTags(field.patch.Value), ",")
+		}
+		return field.patch.Value
+	}
+}
+
+// Updates 計算單一檔案需要更新的欄位，沒有變更時返回空的 map
+func (p *MetadataPatch) Updates(file *models.File) (map[string]interface{}, error) {
+	updates := map[string]interface{}{}
+	if p.CategoryID != nil {
+		var value *uint
+		if p.CategoryID.Op == MetadataSet {
+			value = p.CategoryID.Value
+		}
+		if (value == nil) != (file.CategoryID == nil) || (value != nil && *value != *file.CategoryID) {
+			updates["category_id"] = value
+		}
+	}
+	for _, field := range p.textFields() {
+		if field.patch == nil {
+			continue
+		}
+		current := field.current(file)
+		value := field.apply(current)
+		if field.maxLen > 0 && utf8.RuneCountInString(value) > field.maxLen {
+			return nil, fmt.Errorf("%s 超過 %d 字元", field.label, field.maxLen)
+		}
+		if value != current {
+			updates[field.column] = value
+		}
+	}
+	return updates, nil
+}
+
+// ApplyMetadataPatch 將修改套用到指定的檔案，每個檔案各自回報結果
+// 找不到、已刪除、等待審核或修改後超過長度限制的檔案視為失敗，不影響其他檔案
+func ApplyMetadataPatch(db *gorm.DB, fileIDs []uint, patch *MetadataPatch) ([]MetadataResult, error) {
+	var files []models.File
+	if err := db.Where("id IN ?", fileIDs).Find(&files).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*models.File, len(files))
+	for i := range files {
+		byID[files[i].ID] = &files[i]
+	}
+
+	results := make([]MetadataResult, 0, len(fileIDs))
+	for _, id := range fileIDs {
+		file, ok := byID[id]
+		// 等待審核的訪客上傳不會出現在檔案列表，與依條件選取時相同，視為不存在
+		if !ok || file.IsDeleted || file.ReviewStatus == models.ReviewStatusPending {
+			results = append(results, MetadataResult{FileID: id, Status: MetadataFailed, Error: "檔案不存在或已刪除"})
+			continue
+		}
+		result := MetadataResult{FileID: id, Name: file.Name}
+		updates, err := patch.Updates(file)
+		if err != nil {
+			result.Status, result.Error = MetadataFailed, err.Error()
+			results = append(results, result)
+			continue
+		}
+		if len(updates) == 0 {
+			result.Status = MetadataUnchanged
+			results = append(results, result)
+			continue
+		}
+		for column := range updates {
+			result.Changed = append(result.Changed, column)
+		}
+		sort.Strings(result.Changed)
+		if err := db.Model(&models.File{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+		result.Status = MetadataUpdated
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+// 同名衝突的處理方式
+const (
+	ConflictRename    = "rename"    // 以「名稱 (1).ext」形式重新命名
+	ConflictOverwrite = "overwrite" // 取代既有的同名項目（還原時將其移至垃圾桶，寫入時就地覆蓋內容）
+	ConflictSkip      = "skip"      // 略過此項目
+	ConflictFail      = "fail"      // 視為錯誤，不寫入此項目
+)
+
+// ErrInvalidConflictPolicy 不支援的衝突處理方式
+var ErrInvalidConflictPolicy = errors.New("conflict 僅支援 rename、overwrite、skip 或 fail")
+
+// ParseConflictPolicy 解析衝突處理方式，空白時使用預設值
+func ParseConflictPolicy(value, fallback string) (string, error) {
+	switch policy := strings.ToLower(strings.TrimSpace(value)); policy {
+	case "":
+		return fallback, nil
+	case ConflictRename, ConflictOverwrite, ConflictSkip, ConflictFail:
+		return policy, nil
+	default:
+		return "", ErrInvalidConflictPolicy
+	}
+}
+
+// scopeParent 依父資料夾篩選（nil 表示根目錄）
+func scopeParent(query *gorm.DB, parentID *uint) *gorm.DB {
+	if parentID == nil {
+		return query.Where("parent_id IS NULL")
+	}
+	return query.Where("parent_id = ?", *parentID)
+}
+
+// FindNameConflict 查找資料夾中同名且未刪除的項目，excludeID 為目前項目本身
+func FindNameConflict(db *gorm.DB, name string, parentID *uint, excludeID uint) (*models.File, error) {
+	var existing models.File
+	query := scopeParent(db.Where("name = ? AND is_deleted = ? AND id <> ?", name, false, excludeID), parentID)
+	if err := query.Order("id").Limit(1).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing.ID == 0 {
+		return nil, nil
+	}
+	return &existing, nil
+}
+
+// UniqueName 產生資料夾中未被使用的名稱，例如「週報 (1).pdf」
+func UniqueName(db *gorm.DB, name string, parentID *uint) (string, error) {
+	ext := filepath.Ext(name)
+	baseName := strings.TrimSuffix(name, ext)
+
+	candidate := name
+	for i := 1; i <= 1000; i++ {
+		var count int64
+		if err := scopeParent(db.Model(&models.File{}).Where("name = ? AND is_deleted = ?", candidate, false), parentID).
+			Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s (%d)%s", baseName, i, ext)
+	}
+
+	// 仍然衝突時使用時間戳
+	return fmt.Sprintf("%s_%s%s", baseName, time.Now().Format("20060102_150405"), ext), nil
+}
+
+// VirtualPathFor 依父資料夾的虛擬路徑組成項目的虛擬路徑
+func VirtualPathFor(db *gorm.DB, parentID *uint, name string) (string, error) {
+	if parentID == nil {
+		return "/" + name, nil
+	}
+
+	var parent models.File
+	if err := db.Select("id", "name", "parent_id", "virtual_path").First(&parent, *parentID).Error; err != nil {
+		return "", err
+	}
+	parentPath := parent.VirtualPath
+	if parentPath == "" {
+		var err error
+		if parentPath, err = VirtualPathFor(db, parent.ParentID, parent.Name); err != nil {
+			return "", err
+		}
+	}
+	return parentPath + "/" + name, nil
+}
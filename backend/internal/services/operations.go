@@ -0,0 +1,73 @@
+package services
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+// RecordFileOperation 在同一個交易中記錄檔案樹操作，window 為可復原期限（分鐘），0 表示不提供復原
+func RecordFileOperation(db *gorm.DB, userID uint, opType, summary string, items []models.FileOperationItem, window int) (*models.FileOperation, error) {
+	if window <= 0 || len(items) == 0 {
+		return nil, nil
+	}
+
+	payload, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	op := models.FileOperation{
+		UserID:    userID,
+		Type:      opType,
+		Summary:   summary,
+		Items:     string(payload),
+		Status:    models.FileOperationApplied,
+		ExpiresAt: now.Add(time.Duration(window) * time.Minute),
+		CreatedAt: now,
+	}
+	if err := db.Create(&op).Error; err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// FileOperationItems 解析操作記錄中的項目
+func FileOperationItems(op *models.FileOperation) ([]models.FileOperationItem, error) {
+	var items []models.FileOperationItem
+	if op.Items == "" {
+		return items, nil
+	}
+	if err := json.Unmarshal([]byte(op.Items), &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// CanUndoFileOperation 判斷操作是否仍可復原
+func CanUndoFileOperation(op *models.FileOperation, now time.Time) bool {
+	return op.Status == models.FileOperationApplied && now.Before(op.ExpiresAt)
+}
+
+// SnapshotFileState 讀取項目目前的名稱與位置
+func SnapshotFileState(db *gorm.DB, fileID uint) (*models.FileState, error) {
+	var file models.File
+	if err := db.Select("id", "name", "parent_id", "virtual_path").First(&file, fileID).Error; err != nil {
+		return nil, err
+	}
+	return &models.FileState{Name: file.Name, ParentID: file.ParentID, VirtualPath: file.VirtualPath}, nil
+}
+
+// SameFileLocation 判斷兩個狀態的名稱與父資料夾是否相同
+func SameFileLocation(a, b *models.FileState) bool {
+	if a == nil || b == nil || a.Name != b.Name {
+		return false
+	}
+	if a.ParentID == nil || b.ParentID == nil {
+		return a.ParentID == nil && b.ParentID == nil
+	}
+	return *a.ParentID == *b.ParentID
+}
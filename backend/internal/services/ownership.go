@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+// OwnershipTransferOptions 所有權轉移選項
+type OwnershipTransferOptions struct {
+	FromUserID uint
+	ToUserID   uint
+	FolderID   *uint  // 只轉移此資料夾（含）以下的項目
+	DryRun     bool   // 只計算影響數量，不實際修改
+	ActorID    uint   // 執行轉移的管理員，寫入操作記錄
+	IPAddress  string // 執行轉移的來源 IP
+}
+
+// OwnershipTransferResult 所有權轉移結果，預覽模式下為預計影響的數量
+type OwnershipTransferResult struct {
+	FromUserID  uint  `json:"from_user_id"`
+	ToUserID    uint  `json:"to_user_id"`
+	FolderID    *uint `json:"folder_id,omitempty"`
+	DryRun      bool  `json:"dry_run"`
+	Files       int64 `json:"files"`
+	Folders     int64 `json:"folders"`
+	Categories  int64 `json:"categories"`
+	FileShares  int64 `json:"file_shares"`
+	ExportJobs  int64 `json:"export_jobs"`
+	UploadLinks int64 `json:"upload_links"`
+}
+
+// ErrSameOwner 來源與目標用戶相同
+var ErrSameOwner = errors.New("來源與目標用戶不能相同")
+
+// TransferOwnership 將用戶的檔案、分類、分享連結、匯出任務與上傳連結轉移給另一位用戶。
+// 指定 FolderID 時只轉移該子樹內的檔案及其分享與上傳連結，分類與匯出任務不在子樹範圍內。
+func TransferOwnership(db *gorm.DB, opts OwnershipTransferOptions) (*OwnershipTransferResult, error) {
+	if opts.FromUserID == opts.ToUserID {
+		return nil, ErrSameOwner
+	}
+
+	result := &OwnershipTransferResult{
+		FromUserID: opts.FromUserID,
+		ToUserID:   opts.ToUserID,
+		FolderID:   opts.FolderID,
+		DryRun:     opts.DryRun,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// 在交易內取得子樹，避免與轉移期間的移動操作不一致
+		var subtree []uint
+		if opts.FolderID != nil {
+			ids, err := CollectSubtreeIDs(tx, *opts.FolderID)
+			if err != nil {
+				return err
+			}
+			subtree = ids
+		}
+
+		// 檔案與資料夾
+		for _, isDirectory := range []bool{false, true} {
+			count, err := transferScoped(tx, &models.File{}, "uploaded_by", "id", subtree, opts,
+				"is_directory = ?", isDirectory)
+			if err != nil {
+				return err
+			}
+			if isDirectory {
+				result.Folders = count
+			} else {
+				result.Files = count
+			}
+		}
+
+		// 分享連結
+		count, err := transferScoped(tx, &models.FileShare{}, "shared_by", "file_id", subtree, opts)
+		if err != nil {
+			return err
+		}
+		result.FileShares = count
+
+		// 訪客上傳連結
+		count, err = transferScoped(tx, &models.UploadLink{}, "created_by", "folder_id", subtree, opts)
+		if err != nil {
+			return err
+		}
+		result.UploadLinks = count
+
+		// 分類與匯出任務不屬於檔案樹，只在完整轉移時處理
+		if opts.FolderID == nil {
+			count, err = transferScoped(tx, &models.Category{}, "created_by", "", nil, opts)
+			if err != nil {
+				return err
+			}
+			result.Categories = count
+
+			count, err = transferScoped(tx, &models.ExportJob{}, "user_id", "", nil, opts)
+			if err != nil {
+				return err
+			}
+			result.ExportJobs = count
+		}
+
+		if opts.DryRun {
+			return nil
+		}
+
+		// 操作記錄與轉移一同提交，寫入失敗時整個轉移回滾
+		resourceID := opts.FromUserID
+		return RecordActivity(tx, opts.ActorID, "transfer_ownership", "user", &resourceID, result, opts.IPAddress)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// transferScoped 計算或更新單一資料表的擁有者欄位，subtree 不為 nil 時以 scopeColumn 限制範圍
+func transferScoped(tx *gorm.DB, model interface{}, ownerColumn, scopeColumn string, subtree []uint,
+	opts OwnershipTransferOptions, extra ...interface{}) (int64, error) {
+	scopes := [][]uint{nil}
+	if opts.FolderID != nil {
+		scopes = ChunkIDs(subtree)
+	}
+
+	var total int64
+	for _, chunk := range scopes {
+		query := tx.Model(model).Where(ownerColumn+" = ?", opts.FromUserID)
+		if chunk != nil {
+			query = query.Where(scopeColumn+" IN ?", chunk)
+		}
+		if len(extra) > 0 {
+			query = query.Where(extra[0], extra[1:]...)
+		}
+
+		if opts.DryRun {
+			var count int64
+			if err := query.Count(&count).Error; err != nil {
+				return 0, err
+			}
+			total += count
+			continue
+		}
+
+		res := query.Update(ownerColumn, opts.ToUserID)
+		if res.Error != nil {
+			return 0, res.Error
+		}
+		total += res.RowsAffected
+	}
+
+	return total, nil
+}
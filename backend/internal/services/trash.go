@@ -0,0 +1,298 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/config"
+	"memoryark/internal/models"
+)
+
+// TrashPurgeResult 永久刪除垃圾桶項目的結果
+type TrashPurgeResult struct {
+	Purged int `json:"purged"` // 已永久刪除的項目數
+	Held   int `json:"held"`   // 因法律保全而保留的項目數
+	Kept   int `json:"kept"`   // 仍有子項目而保留的資料夾數
+	Failed int `json:"failed"`
+}
+
+// LegalHolds 判斷項目是否受法律保全（本身、任一上層資料夾或分類）
+type LegalHolds struct {
+	db         *gorm.DB
+	categories map[uint]bool
+	folders    map[uint]bool // 資料夾 ID -> 該資料夾或其上層是否受保全
+}
+
+// LoadLegalHolds 讀取受法律保全的分類，資料夾則在檢查時逐層查詢並快取
+func LoadLegalHolds(db *gorm.DB) (*LegalHolds, error) {
+	var categoryIDs []uint
+	if err := db.Model(&models.Category{}).Where("legal_hold = ?", true).Pluck("id", &categoryIDs).Error; err != nil {
+		return nil, err
+	}
+	holds := &LegalHolds{db: db, categories: map[uint]bool{}, folders: map[uint]bool{}}
+	for _, id := range categoryIDs {
+		holds.categories[id] = true
+	}
+	return holds, nil
+}
+
+// Held 檢查項目是否受法律保全
+func (l *LegalHolds) Held(file *models.File) bool {
+	if file.LegalHold {
+		return true
+	}
+	if file.CategoryID != nil && l.categories[*file.CategoryID] {
+		return true
+	}
+	return file.ParentID != nil && l.folderHeld(*file.ParentID, map[uint]bool{})
+}
+
+// folderHeld 檢查資料夾本身或其上層是否受法律保全
+func (l *LegalHolds) folderHeld(folderID uint, visiting map[uint]bool) bool {
+	if held, ok := l.folders[folderID]; ok {
+		return held
+	}
+	// 防止資料異常造成的循環
+	if visiting[folderID] {
+		return false
+	}
+	visiting[folderID] = true
+
+	var folder models.File
+	held := false
+	if err := l.db.Select("id", "parent_id", "legal_hold").First(&folder, folderID).Error; err == nil {
+		held = folder.LegalHold || (folder.ParentID != nil && l.folderHeld(*folder.ParentID, visiting))
+	}
+	l.folders[folderID] = held
+	return held
+}
+
+// TrashPurgesAt 計算垃圾桶項目預計自動永久刪除的時間，未啟用自動刪除時返回 nil
+func TrashPurgesAt(deletedAt *time.Time, retentionDays int) *time.Time {
+	if deletedAt == nil || retentionDays <= 0 {
+		return nil
+	}
+	purgesAt := deletedAt.AddDate(0, 0, retentionDays)
+	return &purgesAt
+}
+
+// ErrNotInTrash 項目已不在垃圾桶中（例如在清理期間被還原），不會永久刪除
+var ErrNotInTrash = errors.New("項目已不在垃圾桶中")
+
+// PurgeFile 永久刪除單一檔案記錄、其歷史版本及不再被引用的實體檔案
+// 刪除時重新確認項目仍在垃圾桶中，已被還原時返回 ErrNotInTrash 且不清除任何資料
+func PurgeFile(db *gorm.DB, file *models.File) error {
+	result := db.Where("id = ? AND is_deleted = ?", file.ID, true).Delete(&models.File{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return ErrNotInTrash
+	}
+	if err := DeleteUserFileStates(db, file.ID); err != nil {
+		log.Printf("刪除檔案 %d 的個人狀態失敗: %v", file.ID, err)
+	}
+	if err := DeleteFileSocial(db, file.ID); err != nil {
+		log.Printf("刪除檔案 %d 的按讚與留言失敗: %v", file.ID, err)
+	}
+	if file.IsDirectory {
+		return nil
+	}
+	if err := DetachShortcuts(db, file.ID); err != nil {
+		log.Printf("還原檔案 %d 的捷徑失敗: %v", file.ID, err)
+	}
+	ReleaseFileContent(db, file)
+	return nil
+}
+
+// ReleaseFileContent 在檔案記錄刪除後清除其歷史版本，並移除不再被引用的實體檔案
+func ReleaseFileContent(db *gorm.DB, file *models.File) {
+	if err := DeleteFileVersions(db, file.ID); err != nil {
+		log.Printf("刪除檔案 %d 的歷史版本失敗: %v", file.ID, err)
+	}
+	// 刪除失敗只記錄錯誤，不中斷操作
+	ReleaseBlob(db, file.FilePath)
+}
+
+// PurgeTrash 永久刪除垃圾桶中的項目；before 不為空時只刪除在該時間之前移入垃圾桶的項目
+// 受法律保全的項目會保留，仍有子項目的資料夾也會保留
+func PurgeTrash(db *gorm.DB, before *time.Time, purgedBy uint) (*TrashPurgeResult, error) {
+	return PurgeTrashWithProgress(db, before, purgedBy, nil)
+}
+
+// TrashPurgeProgress 回報永久刪除進度，返回 false 時停止刪除
+type TrashPurgeProgress func(result *TrashPurgeResult, total int) bool
+
+// PurgeTrashWithProgress 永久刪除垃圾桶項目並在每個項目處理後回報進度
+func PurgeTrashWithProgress(db *gorm.DB, before *time.Time, purgedBy uint, progress TrashPurgeProgress) (*TrashPurgeResult, error) {
+	holds, err := LoadLegalHolds(db)
+	if err != nil {
+		return nil, err
+	}
+
+	query := func(isDirectory bool) *gorm.DB {
+		q := db.Where("is_deleted = ? AND is_directory = ?", true, isDirectory)
+		if before != nil {
+			q = q.Where("deleted_at < ?", *before)
+		}
+		return q
+	}
+
+	var files []models.File
+	if err := query(false).Find(&files).Error; err != nil {
+		return nil, err
+	}
+	var folders []models.File
+	if err := query(true).Find(&folders).Error; err != nil {
+		return nil, err
+	}
+
+	result := &TrashPurgeResult{}
+	purgeable := files[:0]
+	for _, file := range files {
+		if holds.Held(&file) {
+			result.Held++
+			continue
+		}
+		purgeable = append(purgeable, file)
+	}
+	pending := folders[:0]
+	for _, folder := range folders {
+		if holds.Held(&folder) {
+			result.Held++
+			continue
+		}
+		pending = append(pending, folder)
+	}
+	total := len(purgeable) + len(pending)
+
+	stopped := false
+	purge := func(file *models.File) {
+		if err := PurgeFile(db, file); errors.Is(err, ErrNotInTrash) {
+			// 清理期間已被還原
+		} else if err != nil {
+			log.Printf("永久刪除垃圾桶項目 %d 失敗: %v", file.ID, err)
+			result.Failed++
+		} else {
+			result.Purged++
+			fileID := file.ID
+			RecordActivity(db, purgedBy, "purge", "file", &fileID, map[string]interface{}{
+				"name":         file.Name,
+				"virtual_path": file.VirtualPath,
+				"deleted_at":   file.DeletedAt,
+				"deleted_by":   file.DeletedBy,
+			}, "")
+		}
+		if progress != nil && !progress(result, total) {
+			stopped = true
+		}
+	}
+
+	for i := range purgeable {
+		if stopped {
+			break
+		}
+		purge(&purgeable[i])
+	}
+
+	// 資料夾由深至淺刪除，直到沒有可刪除的空資料夾
+	for progressed := true; progressed && !stopped && len(pending) > 0; {
+		progressed = false
+		remaining := pending[:0]
+		for i := range pending {
+			if stopped {
+				remaining = append(remaining, pending[i])
+				continue
+			}
+			var children int64
+			if err := db.Model(&models.File{}).Where("parent_id = ?", pending[i].ID).Count(&children).Error; err != nil {
+				return nil, err
+			}
+			if children > 0 {
+				remaining = append(remaining, pending[i])
+				continue
+			}
+			purge(&pending[i])
+			progressed = true
+		}
+		pending = remaining
+	}
+	result.Kept = len(pending)
+
+	return result, nil
+}
+
+// PurgeExpiredTrash 永久刪除超過保留天數的垃圾桶項目
+// 舊資料沒有刪除時間時，從現在開始計算保留期限
+func PurgeExpiredTrash(db *gorm.DB, retentionDays int, now time.Time) (*TrashPurgeResult, error) {
+	if retentionDays <= 0 {
+		return &TrashPurgeResult{}, nil
+	}
+	if err := db.Model(&models.File{}).Where("is_deleted = ? AND deleted_at IS NULL", true).
+		Update("deleted_at", now).Error; err != nil {
+		return nil, err
+	}
+	cutoff := now.AddDate(0, 0, -retentionDays)
+	return PurgeTrash(db, &cutoff, 0)
+}
+
+// StartTrashPurge 啟動時及依設定的間隔自動永久刪除過期的垃圾桶項目
+func StartTrashPurge(db *gorm.DB, cfg config.TrashConfig) {
+	if cfg.RetentionDays <= 0 || cfg.PurgeInterval <= 0 {
+		return
+	}
+
+	run := func() {
+		result, err := PurgeExpiredTrash(db, cfg.RetentionDays, time.Now())
+		if err != nil {
+			log.Printf("自動清理垃圾桶失敗: %v", err)
+			return
+		}
+		if result.Purged > 0 || result.Failed > 0 {
+			log.Printf("自動清理垃圾桶：永久刪除 %d 個項目，法律保全保留 %d 個，失敗 %d 個", result.Purged, result.Held, result.Failed)
+		}
+	}
+
+	go func() {
+		run()
+		ticker := time.NewTicker(time.Duration(cfg.PurgeInterval) * time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			run()
+		}
+	}()
+}
+
+// SubtreeOnLegalHold 檢查項目本身或資料夾內任何項目是否受法律保全
+func SubtreeOnLegalHold(db *gorm.DB, file *models.File) (bool, error) {
+	holds, err := LoadLegalHolds(db)
+	if err != nil {
+		return false, err
+	}
+	if holds.Held(file) {
+		return true, nil
+	}
+	if !file.IsDirectory {
+		return false, nil
+	}
+
+	ids, err := CollectSubtreeIDs(db, file.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, chunk := range ChunkIDs(ids) {
+		var items []models.File
+		if err := db.Select("id", "parent_id", "category_id", "legal_hold").Where("id IN ?", chunk).Find(&items).Error; err != nil {
+			return false, err
+		}
+		for i := range items {
+			if holds.Held(&items[i]) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+// idChunkSize 批次 IN 查詢的最大參數數量，避免超過 SQLite 的變數上限
+const idChunkSize = 500
+
+// CollectSubtreeIDs 收集資料夾本身及其所有子孫項目的 ID（包含垃圾桶中的項目）
+func CollectSubtreeIDs(db *gorm.DB, rootID uint) ([]uint, error) {
+	ids := []uint{rootID}
+	visited := map[uint]bool{rootID: true}
+	frontier := []uint{rootID}
+
+	for len(frontier) > 0 {
+		var next []uint
+		for _, chunk := range ChunkIDs(frontier) {
+			var children []models.File
+			if err := db.Select("id").Where("parent_id IN ?", chunk).Find(&children).Error; err != nil {
+				return nil, err
+			}
+			for _, child := range children {
+				// 防止資料異常造成的循環
+				if visited[child.ID] {
+					continue
+				}
+				visited[child.ID] = true
+				ids = append(ids, child.ID)
+				next = append(next, child.ID)
+			}
+		}
+		frontier = next
+	}
+
+	return ids, nil
+}
+
+// ChunkIDs 將 ID 切分為多個批次，每批不超過 SQLite 的變數上限
+func ChunkIDs(ids []uint) [][]uint {
+	var chunks [][]uint
+	for start := 0; start < len(ids); start += idChunkSize {
+		end := start + idChunkSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		chunks = append(chunks, ids[start:end])
+	}
+	return chunks
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+// userFileState 取得或建立用戶對檔案的個人狀態
+func userFileState(db *gorm.DB, userID, fileID uint) (*models.UserFileState, error) {
+	state := models.UserFileState{UserID: userID, FileID: fileID}
+	if err := db.Where("user_id = ? AND file_id = ?", userID, fileID).FirstOrCreate(&state).Error; err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// pruneUserFileState 沒有加星號、釘選或開啟記錄的狀態不需保留
+func pruneUserFileState(db *gorm.DB, userID, fileID uint) error {
+	return db.Where("user_id = ? AND file_id = ? AND starred = ? AND pinned = ? AND last_accessed_at IS NULL",
+		userID, fileID, false, false).Delete(&models.UserFileState{}).Error
+}
+
+// RecordFileAccess 記錄用戶開啟（下載或預覽）檔案，供最近項目使用
+func RecordFileAccess(db *gorm.DB, userID, fileID uint, action string) error {
+	state, err := userFileState(db, userID, fileID)
+	if err != nil {
+		return err
+	}
+	return db.Model(state).Updates(map[string]interface{}{
+		"last_accessed_at": time.Now(),
+		"last_action":      action,
+		"access_count":     gorm.Expr("access_count + ?", 1),
+	}).Error
+}
+
+// SetFileStarred 為檔案或資料夾加上或移除星號
+func SetFileStarred(db *gorm.DB, userID, fileID uint, starred bool) error {
+	if !starred {
+		if err := db.Model(&models.UserFileState{}).Where("user_id = ? AND file_id = ?", userID, fileID).
+			Updates(map[string]interface{}{"starred": false, "starred_at": nil}).Error; err != nil {
+			return err
+		}
+		return pruneUserFileState(db, userID, fileID)
+	}
+	state, err := userFileState(db, userID, fileID)
+	if err != nil || state.Starred {
+		return err
+	}
+	return db.Model(state).Updates(map[string]interface{}{"starred": true, "starred_at": time.Now()}).Error
+}
+
+// SetFolderPinned 釘選或取消釘選資料夾，新釘選的資料夾排在最後
+func SetFolderPinned(db *gorm.DB, userID, folderID uint, pinned bool) error {
+	if !pinned {
+		if err := db.Model(&models.UserFileState{}).Where("user_id = ? AND file_id = ?", userID, folderID).
+			Updates(map[string]interface{}{"pinned": false, "pinned_at": nil, "pin_order": 0}).Error; err != nil {
+			return err
+		}
+		return pruneUserFileState(db, userID, folderID)
+	}
+	state, err := userFileState(db, userID, folderID)
+	if err != nil || state.Pinned {
+		return err
+	}
+	var last struct{ Max int }
+	if err := db.Model(&models.UserFileState{}).Where("user_id = ? AND pinned = ?", userID, true).
+		Select("COALESCE(MAX(pin_order), 0) AS max").Scan(&last).Error; err != nil {
+		return err
+	}
+	return db.Model(state).Updates(map[string]interface{}{"pinned": true, "pinned_at": time.Now(), "pin_order": last.Max + 1}).Error
+}
+
+// ReorderPinnedFolders 依指定順序排列用戶釘選的資料夾，未列出的資料夾排在後面
+func ReorderPinnedFolders(db *gorm.DB, userID uint, folderIDs []uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for i, id := range folderIDs {
+			if err := tx.Model(&models.UserFileState{}).Where("user_id = ? AND file_id = ? AND pinned = ?", userID, id, true).
+				Update("pin_order", i+1).Error; err != nil {
+				return err
+			}
+		}
+		listed := append([]uint{0}, folderIDs...)
+		return tx.Model(&models.UserFileState{}).Where("user_id = ? AND pinned = ? AND file_id NOT IN ?", userID, true, listed).
+			Update("pin_order", gorm.Expr("pin_order + ?", len(folderIDs))).Error
+	})
+}
+
+// scopeLiveUserFiles 限定為關聯的檔案未刪除且不在審核中的狀態（垃圾桶中的項目保留狀態，還原後重新顯示）
+func scopeLiveUserFiles(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Joins("JOIN files ON files.id = user_file_states.file_id").
+		Where("user_file_states.user_id = ? AND files.is_deleted = ?", userID, false).
+		Where("(files.review_status IS NULL OR files.review_status <> ?)", models.ReviewStatusPending).
+		Preload("File")
+}
+
+// StarredFiles 用戶加星號的檔案與資料夾，依加星號時間由新到舊
+func StarredFiles(db *gorm.DB, userID uint) ([]models.UserFileState, error) {
+	var states []models.UserFileState
+	err := scopeLiveUserFiles(db, userID).Where("user_file_states.starred = ?", true).
+		Order("user_file_states.starred_at DESC").Find(&states).Error
+	return states, err
+}
+
+// PinnedFolders 用戶釘選的資料夾，依排列順序
+func PinnedFolders(db *gorm.DB, userID uint) ([]models.UserFileState, error) {
+	var states []models.UserFileState
+	err := scopeLiveUserFiles(db, userID).Where("user_file_states.pinned = ? AND files.is_directory = ?", true, true).
+		Order("user_file_states.pin_order, user_file_states.pinned_at").Find(&states).Error
+	return states, err
+}
+
+// RecentFiles 用戶最近開啟（下載、預覽）或上傳的檔案，依時間由新到舊
+func RecentFiles(db *gorm.DB, userID uint, limit int) ([]models.UserFileState, error) {
+	var accessed []models.UserFileState
+	if err := scopeLiveUserFiles(db, userID).Where("user_file_states.last_accessed_at IS NOT NULL").
+		Order("user_file_states.last_accessed_at DESC").Limit(limit).Find(&accessed).Error; err != nil {
+		return nil, err
+	}
+	var uploaded []models.File
+	if err := db.Where("uploaded_by = ? AND is_deleted = ? AND is_directory = ?", userID, false, false).
+		Where("(review_status IS NULL OR review_status <> ?)", models.ReviewStatusPending).
+		Order("created_at DESC").Limit(limit).Find(&uploaded).Error; err != nil {
+		return nil, err
+	}
+
+	// 合併兩份清單，同一個檔案只保留較新的記錄
+	recent := make([]models.UserFileState, 0, len(accessed)+len(uploaded))
+	index := map[uint]int{}
+	for _, state := range accessed {
+		index[state.FileID] = len(recent)
+		recent = append(recent, state)
+	}
+	for i := range uploaded {
+		file := &uploaded[i]
+		createdAt := file.CreatedAt
+		if at, ok := index[file.ID]; ok {
+			if !recent[at].LastAccessedAt.Before(createdAt) {
+				continue
+			}
+			recent[at].LastAccessedAt, recent[at].LastAction = &createdAt, models.FileAccessUpload
+			continue
+		}
+		index[file.ID] = len(recent)
+		recent = append(recent, models.UserFileState{
+			UserID: userID, FileID: file.ID, LastAccessedAt: &createdAt, LastAction: models.FileAccessUpload, File: file,
+		})
+	}
+	sort.SliceStable(recent, func(i, j int) bool {
+		return recent[i].LastAccessedAt.After(*recent[j].LastAccessedAt)
+	})
+	if len(recent) > limit {
+		recent = recent[:limit]
+	}
+	return recent, nil
+}
+
+// DeleteUserFileStates 刪除檔案的所有個人狀態，在檔案永久刪除時呼叫
+func DeleteUserFileStates(db *gorm.DB, fileIDs ...uint) error {
+	if len(fileIDs) == 0 {
+		return nil
+	}
+	return db.Where("file_id IN ?", fileIDs).Delete(&models.UserFileState{}).Error
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+
+	"memoryark/internal/models"
+)
+
+// FileContent 一個版本的檔案內容（實體檔案可能與其他檔案共用）
+type FileContent struct {
+	FilePath   string
+	SHA256Hash string
+	FileSize   int64
+	MimeType   string
+}
+
+// ErrSameContent 新內容與目前版本相同，不需要建立新版本
+var ErrSameContent = errors.New("內容與目前版本相同")
+
+// ResolveVersionRetention 從檔案所在資料夾往上尋找保留數量設定，都沒有設定時使用全域值
+func ResolveVersionRetention(db *gorm.DB, parentID *uint, fallback int) int {
+	visited := map[uint]bool{}
+	for parentID != nil && !visited[*parentID] {
+		visited[*parentID] = true
+		var folder models.File
+		if err := db.Select("id", "parent_id", "version_retention").First(&folder, *parentID).Error; err != nil {
+			break
+		}
+		if folder.VersionRetention != nil {
+			return *folder.VersionRetention
+		}
+		parentID = folder.ParentID
+	}
+	return fallback
+}
+
+// AddFileVersion 將檔案目前的內容保存為歷史版本，並以新內容成為目前版本（檔案 ID 不變）
+// retention 大於 0 時刪除超出數量的最舊版本；不再被引用的實體檔案會一併移除
+// 在外層交易中呼叫時應改用 AddFileVersionDeferred，避免外層交易復原後版本指向已刪除的實體檔案
+func AddFileVersion(db *gorm.DB, file *models.File, content FileContent, userID uint, retention int) (*models.FileVersion, error) {
+	archived, pruned, err := AddFileVersionDeferred(db, file, content, userID, retention)
+	if err != nil {
+		return nil, err
+	}
+	ReleaseBlobs(db, pruned)
+	return archived, nil
+}
+
+// AddFileVersionDeferred 與 AddFileVersion 相同，但不移除實體檔案
+// 返回被刪除的舊版本實體檔案路徑，呼叫者須在最外層交易提交後以 ReleaseBlobs 釋放
+func AddFileVersionDeferred(db *gorm.DB, file *models.File, content FileContent, userID uint, retention int) (*models.FileVersion, []string, error) {
+	if file.SHA256Hash != "" && file.SHA256Hash == content.SHA256Hash {
+		return nil, nil, ErrSameContent
+	}
+
+	now := time.Now()
+	archived := models.FileVersion{
+		FileID:        file.ID,
+		VersionNumber: currentVersion(file),
+		FilePath:      file.FilePath,
+		SHA256Hash:    file.SHA256Hash,
+		FileSize:      file.FileSize,
+		MimeType:      file.MimeType,
+		UploadedBy:    file.UploadedBy,
+		UploadedAt:    file.CreatedAt,
+		CreatedAt:     now,
+	}
+	if file.VersionUploadedBy != nil {
+		archived.UploadedBy = *file.VersionUploadedBy
+	}
+	if file.VersionUpdatedAt != nil {
+		archived.UploadedAt = *file.VersionUpdatedAt
+	}
+
+	var pruned []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&archived).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{
+			"file_path":           content.FilePath,
+			"sha256_hash":         content.SHA256Hash,
+			"file_size":           content.FileSize,
+			"mime_type":           content.MimeType,
+			"version":             archived.VersionNumber + 1,
+			"version_uploaded_by": userID,
+			"version_updated_at":  now,
+			"thumbnail_url":       "",
+			"shortcut_target_id":  nil, // 捷徑上傳新版本後成為獨立的檔案
+		}
+		if err := tx.Model(&models.File{}).Where("id = ?", file.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := RefreshFolderStats(tx, file.ParentID); err != nil {
+			return err
+		}
+
+		if retention > 0 {
+			var expired []models.FileVersion
+			if err := tx.Where("file_id = ?", file.ID).
+				Order("version_number DESC").
+				Offset(retention).
+				Find(&expired).Error; err != nil {
+				return err
+			}
+			for _, version := range expired {
+				if err := tx.Delete(&version).Error; err != nil {
+					return err
+				}
+				pruned = append(pruned, version.FilePath)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file.FilePath = content.FilePath
+	file.SHA256Hash = content.SHA256Hash
+	file.FileSize = content.FileSize
+	file.MimeType = content.MimeType
+	file.Version = archived.VersionNumber + 1
+	file.VersionUploadedBy = &userID
+	file.VersionUpdatedAt = &now
+	file.ThumbnailURL = ""
+	file.ShortcutTargetID = nil
+	return &archived, pruned, nil
+}
+
+// DeleteFileVersions 刪除檔案的所有歷史版本，並移除不再被引用的實體檔案
+func DeleteFileVersions(db *gorm.DB, fileID uint) error {
+	var versions []models.FileVersion
+	if err := db.Where("file_id = ?", fileID).Find(&versions).Error; err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+	if err := db.Where("file_id = ?", fileID).Delete(&models.FileVersion{}).Error; err != nil {
+		return err
+	}
+	for _, version := range versions {
+		ReleaseBlob(db, version.FilePath)
+	}
+	return nil
+}
+
+// ReleaseBlob 在沒有任何檔案或歷史版本引用時刪除實體檔案
+// 內容去重後多筆記錄可能共用同一個實體檔案，必須在刪除資料庫記錄之後呼叫
+func ReleaseBlob(db *gorm.DB, path string) (bool, error) {
+	if path == "" {
+		return false, nil
+	}
+
+	var fileRefs, versionRefs int64
+	if err := db.Model(&models.File{}).Where("file_path = ?", path).Count(&fileRefs).Error; err != nil {
+		return false, err
+	}
+	if err := db.Model(&models.FileVersion{}).Where("file_path = ?", path).Count(&versionRefs).Error; err != nil {
+		return false, err
+	}
+	if fileRefs+versionRefs > 0 {
+		return false, nil
+	}
+
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		log.Printf("刪除實體檔案 %s 失敗: %v", path, err)
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseBlobs 逐一釋放不再被引用的實體檔案
+func ReleaseBlobs(db *gorm.DB, paths []string) {
+	for _, path := range paths {
+		ReleaseBlob(db, path)
+	}
+}
+
+// currentVersion 舊資料沒有版本號時視為第 1 版
+func currentVersion(file *models.File) int {
+	if file.Version < 1 {
+		return 1
+	}
+	return file.Version
+}
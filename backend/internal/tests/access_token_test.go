@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/auth"
+	"memoryark/internal/database"
+	"memoryark/internal/middleware"
+	"memoryark/internal/models"
+)
+
+// TestPersonalAccessToken 測試個人存取令牌的建立、範圍限制、用戶對應與撤銷
+func TestPersonalAccessToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	if err := db.AutoMigrate(&models.Role{}, &models.PersonalAccessToken{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if err := database.InitializeDefaultRoles(db); err != nil {
+		t.Fatalf("Failed to seed roles: %v", err)
+	}
+	auth.InvalidateRoleCache()
+
+	cfg := setupTestConfig(t)
+	user := models.User{Email: "script@example.com", Name: "Script", Role: "user", Status: "approved"}
+	db.Create(&user)
+
+	tokenHandler := handlers.NewAccessTokenHandler(db, cfg)
+	router := gin.New()
+	asUser := func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Next()
+	}
+	router.POST("/api/tokens", asUser, tokenHandler.CreateAccessToken)
+	router.DELETE("/api/tokens/:id", asUser, tokenHandler.RevokeAccessToken)
+
+	protected := router.Group("/api", middleware.AuthMiddleware(cfg, db))
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"user_id": c.GetUint("user_id")}) }
+	protected.GET("/files", middleware.RequirePermission(db, models.PermFilesRead), ok)
+	protected.POST("/files/upload", middleware.RequirePermission(db, models.PermFilesUpload), ok)
+	protected.PUT("/files/:id/star", middleware.RequirePermission(db, models.PermFilesPersonalize), ok)
+	protected.POST("/tokens/new", middleware.RequireInteractiveSession(), ok)
+
+	// 建立只有 read 範圍的令牌
+	payload, _ := json.Marshal(gin.H{"name": "nightly sync", "scopes": []string{"read"}})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/tokens", bytes.NewReader(payload)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Create token failed: %d %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if !auth.IsPersonalAccessToken(created.Data.Token) {
+		t.Fatalf("Unexpected token format %q", created.Data.Token)
+	}
+
+	var stored models.PersonalAccessToken
+	db.First(&stored)
+	if stored.TokenHash == created.Data.Token || stored.TokenHash != auth.HashToken(created.Data.Token) {
+		t.Errorf("Token should be stored hashed")
+	}
+
+	call := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// read 範圍可以瀏覽，並對應到真實用戶
+	w = call(http.MethodGet, "/api/files", created.Data.Token)
+	var resp struct {
+		UserID uint `json:"user_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.UserID != user.ID {
+		t.Fatalf("Expected read access as user %d, got %d %s", user.ID, w.Code, w.Body.String())
+	}
+	db.First(&stored, stored.ID)
+	if stored.LastUsedAt == nil {
+		t.Errorf("Expected last used time to be recorded")
+	}
+
+	// 範圍外的操作與令牌管理被拒絕
+	if w := call(http.MethodPost, "/api/files/upload", created.Data.Token); w.Code != http.StatusForbidden {
+		t.Errorf("Expected upload to be denied by scope, got %d", w.Code)
+	}
+	if w := call(http.MethodPut, "/api/files/1/star", created.Data.Token); w.Code != http.StatusForbidden {
+		t.Errorf("Expected starring to be denied by read scope, got %d", w.Code)
+	}
+	if w := call(http.MethodPost, "/api/tokens/new", created.Data.Token); w.Code != http.StatusForbidden {
+		t.Errorf("Expected token management to require interactive session, got %d", w.Code)
+	}
+
+	// 撤銷後無法使用
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/tokens/%d", stored.ID), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Revoke failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := call(http.MethodGet, "/api/files", created.Data.Token); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked token to be rejected, got %d", w.Code)
+	}
+}
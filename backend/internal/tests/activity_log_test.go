@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+)
+
+// TestActivityLogFiltersExportAndHistory 測試操作記錄篩選、CSV 匯出與檔案歷程
+func TestActivityLogFiltersExportAndHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	cfg := setupTestConfig(t)
+
+	alice := models.User{Email: "alice@example.com", Name: "Alice", Status: "approved"}
+	bob := models.User{Email: "bob@example.com", Name: "=Bob", Status: "approved"}
+	db.Create(&alice)
+	db.Create(&bob)
+	folder := models.File{Name: "詩歌", OriginalName: "詩歌", IsDirectory: true, UploadedBy: alice.ID}
+	db.Create(&folder)
+
+	ctx := services.AuditContext{Method: http.MethodPut, Route: "/api/folders/:id/rename", Status: http.StatusOK}
+	services.RecordAudit(db, alice.ID, "10.0.0.1", "rename", "file", fmt.Sprint(folder.ID),
+		services.AuditSnapshot{"id": float64(folder.ID), "name": "詩本"},
+		services.AuditSnapshot{"id": float64(folder.ID), "name": "詩歌"}, ctx)
+	services.RecordActivity(db, bob.ID, "update_user_role", "user", &alice.ID, `{"changes":{"role":{"before":"user","after":"editor"}}}`, "10.0.0.2")
+	old := models.ActivityLog{UserID: bob.ID, Action: "delete", ResourceType: "file", Details: "{}", CreatedAt: time.Now().AddDate(-1, 0, 0)}
+	db.Create(&old)
+
+	adminHandler := handlers.NewAdminHandler(db, cfg)
+	fileHandler := handlers.NewFileHandler(db, cfg)
+	router := gin.New()
+	router.GET("/api/admin/logs", adminHandler.GetActivityLogs)
+	router.GET("/api/admin/logs/export", adminHandler.ExportActivityLogs)
+	router.GET("/api/files/:id/history", fileHandler.GetFileHistory)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	countLogs := func(query string) int64 {
+		w := get("/api/admin/logs?" + query)
+		var resp struct {
+			Data struct {
+				Pagination struct {
+					Total int64 `json:"total"`
+				} `json:"pagination"`
+			} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Data.Pagination.Total
+	}
+
+	cases := map[string]int64{
+		"":                                3,
+		fmt.Sprintf("user_id=%d", bob.ID): 2,
+		"action=rename,delete":            2,
+		"resource_type=user":              1,
+		"q=editor":                        1,
+		"q=%25":                           0, // 萬用字元應逐字比對
+		"from=" + time.Now().Format("2006-01-02"):                 2,
+		"to=" + time.Now().AddDate(0, 0, -1).Format("2006-01-02"): 1,
+	}
+	for query, want := range cases {
+		if got := countLogs(query); got != want {
+			t.Errorf("Filter %q: expected %d logs, got %d", query, want, got)
+		}
+	}
+	if w := get("/api/admin/logs?from=not-a-date"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid date, got %d", w.Code)
+	}
+
+	// CSV 匯出：含標題列，且避免公式注入
+	w := get("/api/admin/logs/export?format=csv&user_id=" + fmt.Sprint(bob.ID))
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), ".csv") {
+		t.Fatalf("Unexpected export response: %d %v", w.Code, w.Header())
+	}
+	rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(w.Body.String(), "\ufeff"))).ReadAll()
+	if err != nil || len(rows) != 3 {
+		t.Fatalf("Expected header plus 2 rows, got %d (err=%v)", len(rows), err)
+	}
+	if rows[1][4] != "'=Bob" {
+		t.Errorf("Expected formula-like name to be escaped, got %q", rows[1][4])
+	}
+
+	// 檔案歷程：返回操作者與變更，不含 IP
+	w = get(fmt.Sprintf("/api/files/%d/history", folder.ID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("History failed: %d %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "10.0.0.1") {
+		t.Error("History should not expose IP addresses")
+	}
+	var history struct {
+		Data []handlers.FileHistoryEntry `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &history)
+	if len(history.Data) != 1 || history.Data[0].UserName != "Alice" || history.Data[0].Changes["name"].Before != "詩本" {
+		t.Errorf("Unexpected history: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+
+	"memoryark/internal/config"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+)
+
+// TestActivityLogHashChain 測試雜湊鏈驗證可找出被修改的記錄，並以檢查點偵測尾端截斷
+func TestActivityLogHashChain(t *testing.T) {
+	db := setupFileTestDB(t)
+	if err := db.AutoMigrate(&models.ActivityLogCheckpoint{}); err != nil {
+		t.Fatalf("Failed to migrate checkpoints: %v", err)
+	}
+	cfg := config.AuditConfig{
+		CheckpointFile: filepath.Join(t.TempDir(), "checkpoints.jsonl"),
+		CheckpointKey:  "board-secret",
+	}
+
+	// 啟用前的既有記錄會被封存進雜湊鏈
+	db.Create(&models.ActivityLog{UserID: 1, Action: "legacy", ResourceType: "file"})
+	if sealed, err := services.SealLegacyActivityLogs(db); err != nil || sealed != 1 {
+		t.Fatalf("Expected 1 legacy log sealed, got %d (err=%v)", sealed, err)
+	}
+
+	for _, action := range []string{"upload", "rename", "delete"} {
+		if err := services.RecordActivity(db, 1, action, "file", nil, map[string]string{"name": "週報.pdf"}, "10.0.0.1"); err != nil {
+			t.Fatalf("RecordActivity failed: %v", err)
+		}
+	}
+
+	verify := func() *services.ActivityChainReport {
+		checkpoints, err := services.LoadActivityCheckpoints(db, cfg)
+		if err != nil {
+			t.Fatalf("Failed to load checkpoints: %v", err)
+		}
+		report, err := services.VerifyActivityChain(db, checkpoints, cfg.CheckpointKey)
+		if err != nil {
+			t.Fatalf("Verify failed: %v", err)
+		}
+		return report
+	}
+
+	if report := verify(); !report.Valid || report.CheckedEntries != 4 {
+		t.Fatalf("Expected valid chain of 4 entries, got %+v", report)
+	}
+
+	checkpoint, err := services.CreateActivityCheckpoint(db, cfg)
+	if err != nil || checkpoint == nil || checkpoint.LogCount != 4 || checkpoint.Signature == "" {
+		t.Fatalf("Expected signed checkpoint of 4 entries, got %+v (err=%v)", checkpoint, err)
+	}
+	exported, _ := services.LoadCheckpointFile(cfg.CheckpointFile)
+	if len(exported) != 1 || exported[0].LastHash != checkpoint.LastHash {
+		t.Fatalf("Expected checkpoint to be exported, got %+v", exported)
+	}
+	if again, _ := services.CreateActivityCheckpoint(db, cfg); again != nil {
+		t.Error("No new checkpoint should be created without new logs")
+	}
+
+	// 修改中間的記錄
+	var logs []models.ActivityLog
+	db.Order("id").Find(&logs)
+	original := logs[2].Details
+	db.Model(&logs[2]).UpdateColumn("details", `{"name":"其他.pdf"}`)
+	if report := verify(); report.Valid || report.BrokenAt == nil || *report.BrokenAt != logs[2].ID {
+		t.Fatalf("Expected tampering at log %d, got %+v", logs[2].ID, report)
+	}
+	db.Model(&logs[2]).UpdateColumn("details", original)
+
+	// 刪除尾端記錄：雜湊鏈本身仍連續，需靠檢查點偵測（即使資料庫中的檢查點也被刪除）
+	db.Delete(&logs[3])
+	db.Where("1 = 1").Delete(&models.ActivityLogCheckpoint{})
+	if report := verify(); report.Valid || report.BrokenAt == nil || *report.BrokenAt != logs[3].ID {
+		t.Fatalf("Expected truncation to be detected at log %d, got %+v", logs[3].ID, report)
+	}
+}
@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/middleware"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+)
+
+func putJSON(router *gin.Engine, path string, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPut, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestAuditMiddlewareRecordsDiffs 測試稽核中間件記錄成功操作的前後差異，並略過失敗的請求
+func TestAuditMiddlewareRecordsDiffs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	cfg := setupTestConfig(t)
+
+	user := models.User{Email: "editor@example.com", Name: "Editor", Role: "user", Status: "approved"}
+	db.Create(&user)
+	folder := models.File{Name: "主日", OriginalName: "主日", IsDirectory: true, UploadedBy: user.ID}
+	db.Create(&folder)
+	a := models.File{Name: "a.jpg", OriginalName: "a.jpg", FilePath: "a", UploadedBy: user.ID}
+	b := models.File{Name: "b.jpg", OriginalName: "b.jpg", FilePath: "b", UploadedBy: user.ID}
+	db.Create(&a)
+	db.Create(&b)
+
+	fileHandler := handlers.NewFileHandler(db, cfg)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Next()
+	})
+	router.PUT("/api/folders/:id/rename", middleware.Audit(db, "rename", "file", "id"), fileHandler.RenameFile)
+	router.POST("/api/files/move", middleware.Audit(db, "move", "file", ""), fileHandler.MoveFiles)
+
+	// 單一資源：記錄變更欄位
+	if w := putJSON(router, fmt.Sprintf("/api/folders/%d/rename", a.ID), gin.H{"name": "a-renamed.jpg"}); w.Code != http.StatusOK {
+		t.Fatalf("Rename failed: %d %s", w.Code, w.Body.String())
+	}
+	var log models.ActivityLog
+	if err := db.Where("action = ?", "rename").First(&log).Error; err != nil {
+		t.Fatalf("Expected rename activity log: %v", err)
+	}
+	if log.UserID != user.ID || log.ResourceID == nil || *log.ResourceID != a.ID || log.ResourceType != "file" {
+		t.Errorf("Unexpected activity log: %+v", log)
+	}
+	var details services.AuditDetails
+	json.Unmarshal([]byte(log.Details), &details)
+	if change, ok := details.Changes["name"]; !ok || change.Before != "a.jpg" || change.After != "a-renamed.jpg" {
+		t.Errorf("Expected name change in details, got %s", log.Details)
+	}
+	if _, ok := details.Changes["updatedAt"]; ok {
+		t.Error("updatedAt should not be part of the diff")
+	}
+	if details.Route != "/api/folders/:id/rename" {
+		t.Errorf("Expected route pattern, got %q", details.Route)
+	}
+
+	// 失敗的請求不記錄
+	putJSON(router, "/api/folders/99999/rename", gin.H{"name": "x"})
+	var count int64
+	db.Model(&models.ActivityLog{}).Where("action = ?", "rename").Count(&count)
+	if count != 1 {
+		t.Errorf("Expected failed request to be skipped, got %d rename logs", count)
+	}
+
+	// 批次操作：每個檔案各一筆記錄
+	w, _ := postJSON(router, "/api/files/move", "", gin.H{
+		"file_ids":         []uint{a.ID, b.ID},
+		"target_folder_id": folder.ID,
+		"operation_type":   "move",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Move failed: %d %s", w.Code, w.Body.String())
+	}
+	var moves []models.ActivityLog
+	db.Where("action = ?", "move").Order("resource_id").Find(&moves)
+	if len(moves) != 2 {
+		t.Fatalf("Expected 2 move logs, got %d", len(moves))
+	}
+	details = services.AuditDetails{}
+	json.Unmarshal([]byte(moves[1].Details), &details)
+	if change, ok := details.Changes["parentId"]; !ok || change.Before != nil || change.After != float64(folder.ID) {
+		t.Errorf("Expected parentId change for moved file, got %s", moves[1].Details)
+	}
+
+	// 服務令牌：記錄設定變更，但不保存令牌本身或其雜湊
+	if err := db.AutoMigrate(&models.ServiceToken{}); err != nil {
+		t.Fatalf("Failed to migrate service tokens: %v", err)
+	}
+	tokenHandler := handlers.NewServiceTokenHandler(db, cfg)
+	router.POST("/api/admin/service-tokens", middleware.Audit(db, "create_service_token", "service_token", ""), tokenHandler.CreateServiceToken)
+	router.PUT("/api/admin/service-tokens/:id", middleware.Audit(db, "update_service_token", "service_token", "id"), tokenHandler.UpdateServiceToken)
+	router.POST("/api/admin/service-tokens/:id/rotate", middleware.Audit(db, "rotate_service_token", "service_token", "id"), tokenHandler.RotateServiceToken)
+
+	w, _ = postJSON(router, "/api/admin/service-tokens", "", gin.H{"client_name": "nightly-sync", "scopes": []string{models.ServiceScopeFilesRead}})
+	var created struct {
+		Data struct {
+			Token        string              `json:"token"`
+			ServiceToken models.ServiceToken `json:"service_token"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != http.StatusOK || created.Data.ServiceToken.ID == 0 {
+		t.Fatalf("Create service token failed: %d %s", w.Code, w.Body.String())
+	}
+	path := fmt.Sprintf("/api/admin/service-tokens/%d", created.Data.ServiceToken.ID)
+	if w := putJSON(router, path, gin.H{"scopes": []string{models.ServiceScopeFilesRead, models.ServiceScopeFilesUpload}}); w.Code != http.StatusOK {
+		t.Fatalf("Update service token failed: %d %s", w.Code, w.Body.String())
+	}
+	w, _ = postJSON(router, path+"/rotate", "", gin.H{"overlap_minutes": 0})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Rotate service token failed: %d %s", w.Code, w.Body.String())
+	}
+
+	var tokenLogs []models.ActivityLog
+	db.Where("resource_type = ?", "service_token").Order("id").Find(&tokenLogs)
+	if len(tokenLogs) != 3 {
+		t.Fatalf("Expected 3 service token logs, got %d", len(tokenLogs))
+	}
+	for _, entry := range tokenLogs {
+		if entry.ResourceID == nil || *entry.ResourceID != created.Data.ServiceToken.ID {
+			t.Errorf("Unexpected service token log target: %+v", entry)
+		}
+		if strings.Contains(entry.Details, created.Data.Token) || strings.Contains(entry.Details, "token_hash") {
+			t.Errorf("Service token secret leaked into the activity log: %s", entry.Details)
+		}
+	}
+	details = services.AuditDetails{}
+	json.Unmarshal([]byte(tokenLogs[1].Details), &details)
+	if _, ok := details.Changes["scopes"]; !ok || tokenLogs[1].Action != "update_service_token" {
+		t.Errorf("Expected scopes change for the update, got %s %s", tokenLogs[1].Action, tokenLogs[1].Details)
+	}
+}
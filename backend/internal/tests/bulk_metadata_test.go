@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+)
+
+// TestBulkMetadata 測試以檔案ID或搜尋條件批量編輯描述資料、atomic 模式與背景工作
+func TestBulkMetadata(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	cfg := setupTestConfig(t)
+
+	user := models.User{Email: "media@example.com", Name: "Media", Status: "approved"}
+	db.Create(&user)
+	category := models.Category{Name: "主日講道"}
+	db.Create(&category)
+
+	create := func(name string, parentID *uint, isDir bool, virtualPath, tags string) models.File {
+		file := models.File{
+			Name: name, OriginalName: name, ParentID: parentID, IsDirectory: isDir,
+			VirtualPath: virtualPath, UploadedBy: user.ID, FilePath: "blob-" + name, Tags: tags,
+		}
+		db.Create(&file)
+		return file
+	}
+	reload := func(file models.File) models.File {
+		var current models.File
+		db.First(&current, file.ID)
+		return current
+	}
+
+	queue := services.NewJobQueue(db, 1)
+	fileHandler := handlers.NewFileHandler(db, cfg)
+	fileHandler.SetJobQueue(queue)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Next()
+	})
+	router.POST("/api/files/metadata", fileHandler.BulkUpdateMetadata)
+
+	request := func(path string, body interface{}) (int, handlers.BulkMetadataResponse) {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp struct {
+			Data handlers.BulkMetadataResponse `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Data
+	}
+
+	sermons := create("講道", nil, true, "/講道", "")
+	first := create("第一週.mp3", &sermons.ID, false, "/講道/第一週.mp3", "主日")
+	second := create("第二週.mp3", &sermons.ID, false, "/講道/第二週.mp3", "")
+	other := create("詩歌.mp3", nil, false, "/詩歌.mp3", "")
+
+	// 以檔案ID設定分類與講員，標籤合併去除重複
+	code, resp := request("/api/files/metadata", gin.H{
+		"file_ids": []uint{first.ID, second.ID, 99999},
+		"patch": gin.H{
+			"category_id": gin.H{"op": "set", "value": category.ID},
+			"speaker":     gin.H{"op": "set", "value": "王牧師"},
+			"tags":        gin.H{"op": "append", "value": "主日, 2026"},
+		},
+	})
+	if code != http.StatusOK || resp.UpdatedCount != 2 || resp.FailedCount != 1 || len(resp.Results) != 3 {
+		t.Fatalf("Unexpected bulk update: %d %+v", code, resp)
+	}
+	if current := reload(first); current.CategoryID == nil || *current.CategoryID != category.ID || current.Speaker != "王牧師" || current.Tags != "主日,2026" {
+		t.Errorf("Unexpected first file: %+v", current)
+	}
+	if current := reload(second); current.Tags != "主日,2026" {
+		t.Errorf("Expected tags appended, got %q", current.Tags)
+	}
+
+	// 相同的修改再次套用時不變更
+	_, resp = request("/api/files/metadata", gin.H{
+		"file_ids": []uint{first.ID},
+		"patch":    gin.H{"speaker": gin.H{"op": "set", "value": "王牧師"}},
+	})
+	if resp.UnchangedCount != 1 {
+		t.Errorf("Expected unchanged result, got %+v", resp)
+	}
+
+	// 以搜尋條件選取：只影響資料夾中的檔案
+	_, resp = request("/api/files/metadata", gin.H{
+		"query": gin.H{"folder_id": sermons.ID, "recursive": true},
+		"patch": gin.H{"speaker": gin.H{"op": "clear"}, "bible_reference": gin.H{"op": "append", "value": "約翰福音 3:16"}},
+	})
+	if resp.TotalCount != 2 || resp.UpdatedCount != 2 {
+		t.Errorf("Expected 2 files selected by query, got %+v", resp)
+	}
+	if reload(first).Speaker != "" || reload(other).BibleReference != "" {
+		t.Error("Expected only files in the folder to be updated")
+	}
+
+	// atomic 模式：任一項目超過長度限制時全部不套用
+	code, resp = request("/api/files/metadata", gin.H{
+		"file_ids": []uint{first.ID, other.ID},
+		"atomic":   true,
+		"patch":    gin.H{"speaker": gin.H{"op": "append", "value": strings.Repeat("長", 300)}},
+	})
+	if code != http.StatusUnprocessableEntity || !resp.RolledBack || reload(first).Speaker != "" {
+		t.Errorf("Expected atomic update rolled back, got %d %+v", code, resp)
+	}
+
+	// 搜尋字串中的萬用字元逐字比對，不會選取所有檔案
+	_, resp = request("/api/files/metadata", gin.H{
+		"query": gin.H{"q": "%"},
+		"patch": gin.H{"speaker": gin.H{"op": "set", "value": "李傳道"}},
+	})
+	if resp.UpdatedCount != 0 || reload(other).Speaker != "" {
+		t.Errorf("Expected a literal %% search to match nothing, got %+v", resp)
+	}
+
+	// 等待審核的訪客上傳不能以檔案ID修改
+	pending := create("訪客上傳.mp3", nil, false, "/訪客上傳.mp3", "")
+	db.Model(&pending).Update("review_status", models.ReviewStatusPending)
+	_, resp = request("/api/files/metadata", gin.H{
+		"file_ids": []uint{pending.ID},
+		"patch":    gin.H{"speaker": gin.H{"op": "set", "value": "李傳道"}},
+	})
+	if resp.FailedCount != 1 || reload(pending).Speaker != "" {
+		t.Errorf("Expected pending upload to be rejected, got %+v", resp)
+	}
+
+	// 無效的請求
+	if code, _ := request("/api/files/metadata", gin.H{"file_ids": []uint{first.ID}, "patch": gin.H{"category_id": gin.H{"op": "append", "value": 1}}}); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for append on category, got %d", code)
+	}
+	if code, _ := request("/api/files/metadata", gin.H{"file_ids": []uint{first.ID}, "patch": gin.H{}}); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for empty patch, got %d", code)
+	}
+
+	// 背景工作
+	code, _ = request("/api/files/metadata?async=true", gin.H{
+		"file_ids": []uint{first.ID, second.ID, other.ID},
+		"patch":    gin.H{"description": gin.H{"op": "set", "value": "2026 年講道錄音"}},
+	})
+	if code != http.StatusAccepted {
+		t.Fatalf("Expected 202 for async request, got %d", code)
+	}
+	if ran := queue.RunPending(); ran != 1 {
+		t.Fatalf("Expected job to run, got %d", ran)
+	}
+	var job models.Job
+	db.Where("type = ?", models.JobTypeBulkMetadata).First(&job)
+	var result handlers.BulkMetadataResponse
+	json.Unmarshal(job.Result, &result)
+	if job.Status != models.JobSucceeded || job.Processed != 3 || result.UpdatedCount != 3 {
+		t.Errorf("Unexpected job: %+v %s", job, job.Result)
+	}
+	if reload(other).Description != "2026 年講道錄音" {
+		t.Error("Expected description set by background job")
+	}
+}
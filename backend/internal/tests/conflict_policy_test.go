@@ -0,0 +1,237 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/database"
+	"memoryark/internal/models"
+)
+
+// TestConflictPolicies 測試上傳、複製、移動與還原時選擇的同名衝突處理方式與每個項目的結果
+func TestConflictPolicies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	cfg := setupTestConfig(t)
+	if err := db.AutoMigrate(&models.Role{}); err != nil {
+		t.Fatalf("Failed to migrate roles: %v", err)
+	}
+	if err := database.InitializeDefaultRoles(db); err != nil {
+		t.Fatalf("Failed to create default roles: %v", err)
+	}
+
+	user := models.User{Email: "usher@example.com", Name: "Usher", Status: "approved"}
+	db.Create(&user)
+	role := "admin"
+
+	create := func(name string, parentID *uint, isDir bool, virtualPath, hash string) models.File {
+		file := models.File{
+			Name: name, OriginalName: name, ParentID: parentID, IsDirectory: isDir,
+			VirtualPath: virtualPath, UploadedBy: user.ID, FilePath: "blob-" + name, SHA256Hash: hash,
+		}
+		db.Create(&file)
+		return file
+	}
+	reload := func(file models.File) models.File {
+		var current models.File
+		db.First(&current, file.ID)
+		return current
+	}
+	countNamed := func(name string, parentID uint) int64 {
+		var count int64
+		db.Model(&models.File{}).Where("name = ? AND parent_id = ? AND is_deleted = ?", name, parentID, false).Count(&count)
+		return count
+	}
+
+	fileHandler := handlers.NewFileHandler(db, cfg)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("user_role", role)
+		c.Next()
+	})
+	router.POST("/api/files/upload", fileHandler.UploadFile)
+	router.POST("/api/files/copy", fileHandler.CopyFiles)
+	router.POST("/api/files/move", fileHandler.MoveFiles)
+	router.POST("/api/trash/restore", fileHandler.BatchRestoreFiles)
+
+	upload := func(name, content string, parentID uint, conflict string) (int, map[string]interface{}) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		writer.WriteField("parent_id", fmt.Sprint(parentID))
+		if conflict != "" {
+			writer.WriteField("conflict", conflict)
+		}
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write([]byte(content))
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/files/upload", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+	operate := func(path string, body gin.H) handlers.FileOperationResponse {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s failed: %d %s", path, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data handlers.FileOperationResponse `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Data
+	}
+
+	// 上傳：skip 略過、fail 回報衝突、rename 重新命名、overwrite 就地建立新版本
+	folder := create("詩歌", nil, true, "/詩歌", "")
+	if code, resp := upload("奇異恩典.txt", "v1", folder.ID, ""); code != http.StatusCreated || resp["status"] != handlers.WriteStatusCreated {
+		t.Fatalf("Expected created upload, got %d %v", code, resp)
+	}
+	var original models.File
+	db.Where("name = ? AND parent_id = ?", "奇異恩典.txt", folder.ID).First(&original)
+
+	if code, resp := upload("奇異恩典.txt", "v2", folder.ID, "skip"); code != http.StatusOK || resp["status"] != handlers.WriteStatusSkipped {
+		t.Errorf("Expected skipped upload, got %d %v", code, resp)
+	}
+	if code, resp := upload("奇異恩典.txt", "v2", folder.ID, "fail"); code != http.StatusConflict || resp["status"] != handlers.WriteStatusFailed {
+		t.Errorf("Expected 409 for fail policy, got %d %v", code, resp)
+	}
+	if code, resp := upload("奇異恩典.txt", "v2", folder.ID, "rename"); code != http.StatusCreated || resp["status"] != handlers.WriteStatusRenamed {
+		t.Errorf("Expected renamed upload, got %d %v", code, resp)
+	}
+	if countNamed("奇異恩典 (1).txt", folder.ID) != 1 {
+		t.Error("Expected renamed copy to be created")
+	}
+	if code, resp := upload("奇異恩典.txt", "v3", folder.ID, "overwrite"); code != http.StatusCreated || resp["status"] != handlers.WriteStatusOverwritten {
+		t.Errorf("Expected overwritten upload, got %d %v", code, resp)
+	}
+	if current := reload(original); current.Version != 2 || countNamed("奇異恩典.txt", folder.ID) != 1 {
+		t.Errorf("Expected content replaced in place, got version %d", current.Version)
+	}
+	if code, _ := upload("奇異恩典.txt", "v3", folder.ID, "bogus"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown policy, got %d", code)
+	}
+
+	// 複製：覆蓋檔案保留目標的 ID，資料夾合併到既有的同名資料夾
+	archive := create("歸檔", nil, true, "/歸檔", "")
+	source := create("本週", nil, true, "/本週", "")
+	create("程序單.pdf", &source.ID, false, "/本週/程序單.pdf", "new")
+	create("代禱.pdf", &source.ID, false, "/本週/代禱.pdf", "prayer")
+	merged := create("本週", &archive.ID, true, "/歸檔/本週", "")
+	stale := create("程序單.pdf", &merged.ID, false, "/歸檔/本週/程序單.pdf", "old")
+
+	resp := operate("/api/files/copy", gin.H{
+		"file_ids": []uint{source.ID}, "target_folder_id": archive.ID, "operation_type": "copy", "conflict": "overwrite",
+	})
+	if resp.SuccessCount != 1 || resp.SuccessFiles[0].Status != handlers.WriteStatusMerged || *resp.SuccessFiles[0].NewID != merged.ID {
+		t.Errorf("Expected folder merged, got %+v", resp)
+	}
+	if current := reload(stale); current.SHA256Hash != "new" || countNamed("程序單.pdf", merged.ID) != 1 || countNamed("代禱.pdf", merged.ID) != 1 {
+		t.Errorf("Expected file overwritten and sibling copied, got %+v", current)
+	}
+
+	resp = operate("/api/files/copy", gin.H{
+		"file_ids": []uint{source.ID}, "target_folder_id": archive.ID, "operation_type": "copy", "conflict": "skip",
+	})
+	if resp.SkippedCount != 1 || resp.SkippedFiles[0].ConflictID == nil || *resp.SkippedFiles[0].ConflictID != merged.ID {
+		t.Errorf("Expected copy skipped, got %+v", resp)
+	}
+
+	// 移動：fail 回報衝突，overwrite 覆蓋後將來源移至垃圾桶
+	loose := create("代禱.pdf", nil, false, "/代禱.pdf", "updated")
+	resp = operate("/api/files/move", gin.H{
+		"file_ids": []uint{loose.ID}, "target_folder_id": merged.ID, "operation_type": "move", "conflict": "fail",
+	})
+	if resp.FailedCount != 1 || resp.FailedFiles[0].Status != handlers.WriteStatusFailed || reload(loose).ParentID != nil {
+		t.Errorf("Expected move to fail on conflict, got %+v", resp)
+	}
+	resp = operate("/api/files/move", gin.H{
+		"file_ids": []uint{loose.ID}, "target_folder_id": merged.ID, "operation_type": "move", "conflict": "overwrite",
+	})
+	if resp.SuccessCount != 1 || resp.SuccessFiles[0].Status != handlers.WriteStatusOverwritten || !reload(loose).IsDeleted {
+		t.Errorf("Expected move to overwrite, got %+v", resp)
+	}
+	var prayer models.File
+	db.Where("name = ? AND parent_id = ? AND is_deleted = ?", "代禱.pdf", merged.ID, false).First(&prayer)
+	if prayer.SHA256Hash != "updated" {
+		t.Errorf("Expected overwritten content, got %q", prayer.SHA256Hash)
+	}
+
+	// 覆蓋他人上傳的檔案與上傳新版本的規則相同：需要編輯權限
+	notice := create("公告.pdf", &archive.ID, false, "/歸檔/公告.pdf", "theirs")
+	db.Model(&notice).Update("uploaded_by", user.ID+100)
+	mine := create("公告.pdf", nil, false, "/公告.pdf", "mine")
+	role = "uploader"
+	resp = operate("/api/files/copy", gin.H{
+		"file_ids": []uint{mine.ID}, "target_folder_id": archive.ID, "operation_type": "copy", "conflict": "overwrite",
+	})
+	if resp.FailedCount != 1 || reload(notice).SHA256Hash != "theirs" {
+		t.Errorf("Expected overwrite to be denied without edit permission, got %+v", resp)
+	}
+	role = "user"
+	resp = operate("/api/files/copy", gin.H{
+		"file_ids": []uint{mine.ID}, "target_folder_id": archive.ID, "operation_type": "copy", "conflict": "overwrite",
+	})
+	if resp.SuccessCount != 1 || resp.SuccessFiles[0].Status != handlers.WriteStatusOverwritten || reload(notice).SHA256Hash != "mine" {
+		t.Errorf("Expected a files.edit holder to overwrite another user's file, got %+v", resp)
+	}
+
+	// 合併資料夾時回報每個子項目的結果，有子項目無法覆蓋時資料夾為部分完成
+	roster := create("名單.pdf", &merged.ID, false, "/歸檔/本週/名單.pdf", "theirs")
+	db.Model(&roster).Update("uploaded_by", user.ID+100)
+	create("名單.pdf", &source.ID, false, "/本週/名單.pdf", "mine")
+	create("詩歌.pdf", &source.ID, false, "/本週/詩歌.pdf", "hymns")
+	role = "uploader"
+	resp = operate("/api/files/copy", gin.H{
+		"file_ids": []uint{source.ID}, "target_folder_id": archive.ID, "operation_type": "copy", "conflict": "overwrite",
+	})
+	if resp.FailedCount != 1 || resp.FailedFiles[0].Status != handlers.WriteStatusPartial || len(resp.FailedFiles[0].Children) != 4 {
+		t.Fatalf("Expected partial folder merge with child results, got %+v", resp)
+	}
+	childStatus := map[string]string{}
+	for _, child := range resp.FailedFiles[0].Children {
+		childStatus[child.FileName] = child.Status
+	}
+	if childStatus["名單.pdf"] != handlers.WriteStatusFailed || childStatus["詩歌.pdf"] != handlers.WriteStatusCreated {
+		t.Errorf("Unexpected child results: %v", childStatus)
+	}
+	if reload(roster).SHA256Hash != "theirs" || countNamed("詩歌.pdf", merged.ID) != 1 {
+		t.Errorf("Expected written children to be kept and the denied one untouched")
+	}
+	role = "admin"
+
+	// 還原：fail 視為失敗並留在垃圾桶
+	now := time.Now()
+	trashed := create("程序單.pdf", &merged.ID, false, "/歸檔/本週/程序單.pdf", "trashed")
+	db.Model(&trashed).Updates(map[string]interface{}{"is_deleted": true, "deleted_at": now, "deleted_by": user.ID})
+	payload, _ := json.Marshal(gin.H{"file_ids": []uint{trashed.ID}, "conflict": "fail"})
+	req := httptest.NewRequest(http.MethodPost, "/api/trash/restore", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var restored struct {
+		Data struct {
+			Items []handlers.RestoreOutcome `json:"items"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &restored)
+	if len(restored.Data.Items) != 1 || restored.Data.Items[0].Status != handlers.RestoreStatusFailed || !reload(trashed).IsDeleted {
+		t.Errorf("Expected restore to fail on conflict, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/database"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+)
+
+// TestDuplicateReportAndMerge 測試重複內容報表、合併為捷徑或移至垃圾桶，以及保留檔案永久刪除後捷徑還原
+func TestDuplicateReportAndMerge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	if err := db.AutoMigrate(&models.Role{}); err != nil {
+		t.Fatalf("Failed to migrate roles: %v", err)
+	}
+	if err := database.InitializeDefaultRoles(db); err != nil {
+		t.Fatalf("Failed to create default roles: %v", err)
+	}
+	cfg := setupTestConfig(t)
+	cfg.Operation.UndoWindow = 60
+
+	alice := models.User{Email: "alice@example.com", Name: "Alice", Role: "user", Status: "approved"}
+	bob := models.User{Email: "bob@example.com", Name: "Bob", Role: "user", Status: "approved"}
+	admin := models.User{Email: "admin@example.com", Name: "Admin", Role: "admin", Status: "approved"}
+	viewer := models.User{Email: "viewer@example.com", Name: "Viewer", Role: "viewer", Status: "approved"}
+	for _, user := range []*models.User{&alice, &bob, &admin, &viewer} {
+		db.Create(user)
+	}
+
+	blob := func(name, content string) string {
+		path := filepath.Join(cfg.Upload.UploadPath, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write blob: %v", err)
+		}
+		return path
+	}
+	original, copied := blob("original", "sermon-audio"), blob("copied", "sermon-audio")
+
+	folderA := models.File{Name: "講道", OriginalName: "講道", IsDirectory: true, VirtualPath: "/講道", UploadedBy: alice.ID}
+	folderB := models.File{Name: "備份", OriginalName: "備份", IsDirectory: true, VirtualPath: "/備份", UploadedBy: bob.ID}
+	db.Create(&folderA)
+	db.Create(&folderB)
+	newFile := func(name string, parent *models.File, owner uint, hash string, size int64, path string) *models.File {
+		file := models.File{Name: name, OriginalName: name, ParentID: &parent.ID, VirtualPath: parent.VirtualPath + "/" + name,
+			UploadedBy: owner, SHA256Hash: hash, FileSize: size, FilePath: path, MimeType: "audio/mpeg"}
+		if err := db.Create(&file).Error; err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		return &file
+	}
+	a1 := newFile("講道.mp3", &folderA, alice.ID, "h1", 12, original)
+	a2 := newFile("講道 (1).mp3", &folderA, alice.ID, "h1", 12, copied)
+	b1 := newFile("講道備份.mp3", &folderB, bob.ID, "h1", 12, original)
+	newFile("詩歌.mp3", &folderB, bob.ID, "h2", 5, "song")
+	newFile("詩歌 (1).mp3", &folderB, bob.ID, "h2", 5, "song")
+	newFile("獨一.mp3", &folderB, bob.ID, "h3", 7, "unique")
+	guest := newFile("訪客.mp3", &folderA, alice.ID, "h1", 12, original)
+	db.Model(guest).Update("review_status", models.ReviewStatusPending)
+	for _, folder := range []*models.File{&folderA, &folderB} {
+		if err := services.RecomputeFolderStats(db, folder.ID); err != nil {
+			t.Fatalf("Failed to compute folder stats: %v", err)
+		}
+	}
+	folderSize := func(folder *models.File) int64 {
+		var current models.File
+		db.First(&current, folder.ID)
+		return current.TotalSize
+	}
+	if size := folderSize(&folderA); size != 36 {
+		t.Fatalf("Expected folder size 36 before merging, got %d", size)
+	}
+
+	fileHandler := handlers.NewFileHandler(db, cfg)
+	current := alice
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", current.ID)
+		c.Set("user_role", current.Role)
+		c.Next()
+	})
+	router.GET("/api/files/duplicates", fileHandler.GetDuplicates)
+	router.POST("/api/files/duplicates/merge", fileHandler.MergeDuplicates)
+	router.GET("/api/files/:id/download", fileHandler.DownloadFile)
+
+	request := func(method, path string, body interface{}) (*httptest.ResponseRecorder, json.RawMessage) {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp struct {
+			Data json.RawMessage `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp.Data
+	}
+	type report struct {
+		Groups          []services.DuplicateGroup `json:"groups"`
+		TotalGroups     int64                     `json:"total_groups"`
+		ReclaimableSize int64                     `json:"reclaimable_size"`
+	}
+	getReport := func(scope string) (int, report) {
+		w, data := request(http.MethodGet, "/api/files/duplicates?scope="+scope, nil)
+		var result report
+		json.Unmarshal(data, &result)
+		return w.Code, result
+	}
+
+	// 一般用戶只看到自己上傳的重複檔案，審核中的訪客上傳不列入
+	code, mine := getReport("mine")
+	if code != http.StatusOK || mine.TotalGroups != 1 || mine.ReclaimableSize != 12 || len(mine.Groups[0].Files) != 2 {
+		t.Fatalf("Unexpected personal report: %d %+v", code, mine)
+	}
+	if mine.Groups[0].Files[0].ID != a1.ID || mine.Groups[0].Files[0].UploaderName != "Alice" {
+		t.Errorf("Expected the oldest file listed first, got %+v", mine.Groups[0].Files)
+	}
+	if code, _ := getReport("all"); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for scope=all without manage permission, got %d", code)
+	}
+
+	current = admin
+	_, all := getReport("all")
+	if all.TotalGroups != 2 || all.ReclaimableSize != 29 || all.Groups[0].Hash != "h1" || all.Groups[0].Count != 3 || all.Groups[0].ReclaimableSize != 24 {
+		t.Fatalf("Unexpected full report: %+v", all)
+	}
+
+	// 沒有管理全部檔案的權限時，不能將自己的檔案改為指向他人檔案的捷徑
+	current = bob
+	if w, _ := request(http.MethodPost, "/api/files/duplicates/merge", gin.H{"hash": "h1", "canonical_id": a1.ID, "file_ids": []uint{b1.ID}}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a shortcut to another user's file, got %d", w.Code)
+	}
+	var untouched models.File
+	db.First(&untouched, b1.ID)
+	if untouched.ShortcutTargetID != nil {
+		t.Errorf("Rejected merge should not create a shortcut")
+	}
+
+	// 合併為捷徑：只處理自己上傳的檔案，捷徑不再計入資料夾大小
+	current = alice
+	w, data := request(http.MethodPost, "/api/files/duplicates/merge", gin.H{"hash": "h1"})
+	var merged handlers.DuplicateMergeResponse
+	json.Unmarshal(data, &merged)
+	if w.Code != http.StatusOK || merged.CanonicalID != a1.ID || merged.MergedCount != 1 || merged.ReclaimedSize != 12 || merged.OperationID != nil {
+		t.Fatalf("Unexpected merge result: %d %s", w.Code, w.Body.String())
+	}
+	statuses := map[uint]string{}
+	for _, result := range merged.Results {
+		statuses[result.FileID] = result.Status
+	}
+	if statuses[a2.ID] != handlers.DuplicateMerged || statuses[b1.ID] != handlers.DuplicateSkipped {
+		t.Errorf("Unexpected per-file results: %+v", merged.Results)
+	}
+	var shortcut models.File
+	db.First(&shortcut, a2.ID)
+	if shortcut.ShortcutTargetID == nil || *shortcut.ShortcutTargetID != a1.ID || shortcut.IsDeleted {
+		t.Errorf("Expected a shortcut to the canonical file, got %+v", shortcut)
+	}
+	if size := folderSize(&folderA); size != 24 {
+		t.Errorf("Expected folder size 24 after merging, got %d", size)
+	}
+	if _, mine := getReport("mine"); mine.TotalGroups != 0 {
+		t.Errorf("Expected no personal duplicates after merging, got %+v", mine)
+	}
+
+	// 捷徑下載時使用保留檔案目前的內容，檔名維持捷徑本身的名稱
+	db.Model(a1).Update("file_path", blob("revised", "sermon-audio-v2"))
+	w, _ = request(http.MethodGet, fmt.Sprintf("/api/files/%d/download", a2.ID), nil)
+	if w.Code != http.StatusOK || w.Body.String() != "sermon-audio-v2" || !bytes.Contains([]byte(w.Header().Get("Content-Disposition")), []byte("(1)")) {
+		t.Errorf("Expected the shortcut to serve the canonical content, got %d %q %q", w.Code, w.Body.String(), w.Header().Get("Content-Disposition"))
+	}
+
+	// 移至垃圾桶需要刪除權限，並可透過操作記錄復原
+	current = viewer
+	if w, _ := request(http.MethodPost, "/api/files/duplicates/merge", gin.H{"hash": "h1", "action": "trash"}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for trash without delete permission, got %d", w.Code)
+	}
+	current = admin
+	if w, _ := request(http.MethodPost, "/api/files/duplicates/merge", gin.H{"hash": "h1", "canonical_id": 9999}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for canonical outside the group, got %d", w.Code)
+	}
+	if w, _ := request(http.MethodPost, "/api/files/duplicates/merge", gin.H{"hash": "h3"}); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for content without duplicates, got %d", w.Code)
+	}
+	w, data = request(http.MethodPost, "/api/files/duplicates/merge", gin.H{"hash": "h1", "action": "trash", "file_ids": []uint{b1.ID}})
+	merged = handlers.DuplicateMergeResponse{}
+	json.Unmarshal(data, &merged)
+	if w.Code != http.StatusOK || merged.MergedCount != 1 || merged.OperationID == nil {
+		t.Fatalf("Unexpected trash merge: %d %s", w.Code, w.Body.String())
+	}
+	var trashed models.File
+	db.First(&trashed, b1.ID)
+	if !trashed.IsDeleted || folderSize(&folderB) != 17 {
+		t.Errorf("Expected the duplicate in trash and folder size 17, got %+v size %d", trashed, folderSize(&folderB))
+	}
+	var operation models.FileOperation
+	if err := db.First(&operation, *merged.OperationID).Error; err != nil || operation.Type != models.FileOperationDelete {
+		t.Errorf("Expected an undoable delete operation, got %+v %v", operation, err)
+	}
+
+	// 保留的檔案永久刪除後，捷徑還原為一般檔案並使用自己的內容
+	var canonical models.File
+	db.First(&canonical, a1.ID)
+	if err := services.PurgeFile(db, &canonical); err != services.ErrNotInTrash {
+		t.Fatalf("Expected a live file not to be purged, got %v", err)
+	}
+	db.Model(&canonical).Update("is_deleted", true)
+	if err := services.PurgeFile(db, &canonical); err != nil {
+		t.Fatalf("PurgeFile failed: %v", err)
+	}
+	db.First(&shortcut, a2.ID)
+	if shortcut.ShortcutTargetID != nil || folderSize(&folderA) != 24 {
+		t.Errorf("Expected the shortcut detached with folder size 24, got %+v size %d", shortcut, folderSize(&folderA))
+	}
+	w, _ = request(http.MethodGet, fmt.Sprintf("/api/files/%d/download", a2.ID), nil)
+	if w.Code != http.StatusOK || w.Body.String() != "sermon-audio" {
+		t.Errorf("Expected the detached file to serve its own content, got %d %q", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(copied); err != nil {
+		t.Errorf("Expected the detached file's content kept: %v", err)
+	}
+}
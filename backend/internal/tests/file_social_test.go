@@ -0,0 +1,222 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/database"
+	"memoryark/internal/middleware"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+)
+
+// TestFileLikesAndComments 測試按讚不重複計算、留言討論串、@提及、版主管理留言與留言權限
+func TestFileLikesAndComments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	if err := db.AutoMigrate(&models.Role{}); err != nil {
+		t.Fatalf("Failed to migrate roles: %v", err)
+	}
+	if err := database.InitializeDefaultRoles(db); err != nil {
+		t.Fatalf("Failed to create default roles: %v", err)
+	}
+	cfg := setupTestConfig(t)
+
+	author := models.User{Email: "deacon@example.com", Name: "Deacon", Role: "user", Status: "approved"}
+	member := models.User{Email: "member@example.com", Name: "Member", Role: "user", Status: "approved"}
+	moderator := models.User{Email: "editor@example.com", Name: "Editor", Role: "editor", Status: "approved"}
+	pending := models.User{Email: "new@example.com", Name: "New", Role: "user", Status: "pending"}
+	viewer := models.User{Email: "viewer@example.com", Name: "Viewer", Role: "viewer", Status: "approved"}
+	for _, user := range []*models.User{&author, &member, &moderator, &pending, &viewer} {
+		db.Create(user)
+	}
+	folder := models.File{Name: "相簿", OriginalName: "相簿", IsDirectory: true, VirtualPath: "/相簿", UploadedBy: author.ID, FilePath: "dir"}
+	db.Create(&folder)
+	photo := models.File{Name: "聖誕節.jpg", OriginalName: "聖誕節.jpg", ParentID: &folder.ID, VirtualPath: "/相簿/聖誕節.jpg", UploadedBy: author.ID, FilePath: "blob"}
+	db.Create(&photo)
+
+	fileHandler := handlers.NewFileHandler(db, cfg)
+	current := author
+	var scopes []string
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", current.ID)
+		c.Set("user_role", current.Role)
+		if scopes != nil {
+			c.Set("token_scopes", scopes)
+		}
+		c.Next()
+	})
+	read := middleware.RequirePermission(db, models.PermFilesRead)
+	comment := middleware.RequirePermission(db, models.PermFilesComment)
+	router.GET("/api/files/:id/likes", read, fileHandler.GetFileLikes)
+	router.PUT("/api/files/:id/like", comment, middleware.Audit(db, "like", "file", "id"), fileHandler.LikeFile)
+	router.DELETE("/api/files/:id/like", comment, middleware.Audit(db, "unlike", "file", "id"), fileHandler.UnlikeFile)
+	router.GET("/api/files/:id/comments", read, fileHandler.GetFileComments)
+	router.POST("/api/files/:id/comments", comment, middleware.Audit(db, "create_comment", "file_comment", ""), fileHandler.CreateFileComment)
+	router.PUT("/api/files/:id/comments/:commentId", comment, middleware.Audit(db, "update_comment", "file_comment", "commentId"), fileHandler.UpdateFileComment)
+	router.DELETE("/api/files/:id/comments/:commentId", comment, middleware.Audit(db, "delete_comment", "file_comment", "commentId"), fileHandler.DeleteFileComment)
+
+	request := func(method, path string, body interface{}) (*httptest.ResponseRecorder, json.RawMessage) {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp struct {
+			Data json.RawMessage `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp.Data
+	}
+	likeCount := func() int {
+		var file models.File
+		db.First(&file, photo.ID)
+		return file.LikeCount
+	}
+	commentsPath := fmt.Sprintf("/api/files/%d/comments", photo.ID)
+
+	// 按讚：同一用戶重複按讚不重複計算
+	likePath := fmt.Sprintf("/api/files/%d/like", photo.ID)
+	request(http.MethodPut, likePath, nil)
+	request(http.MethodPut, likePath, nil)
+	current = member
+	request(http.MethodPut, likePath, nil)
+	if got := likeCount(); got != 2 {
+		t.Errorf("Expected 2 likes, got %d", got)
+	}
+	_, data := request(http.MethodGet, fmt.Sprintf("/api/files/%d/likes", photo.ID), nil)
+	var likes struct {
+		LikeCount int               `json:"like_count"`
+		Liked     bool              `json:"liked"`
+		Likes     []models.FileLike `json:"likes"`
+	}
+	json.Unmarshal(data, &likes)
+	if likes.LikeCount != 2 || !likes.Liked || len(likes.Likes) != 2 {
+		t.Errorf("Unexpected likes: %+v", likes)
+	}
+	request(http.MethodDelete, likePath, nil)
+	request(http.MethodDelete, likePath, nil)
+	if got := likeCount(); got != 1 {
+		t.Errorf("Expected 1 like after unlike, got %d", got)
+	}
+
+	// 僅能瀏覽的角色與唯讀權杖可以查看，但不能按讚或留言
+	current = viewer
+	if w, _ := request(http.MethodGet, commentsPath, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected viewer to read comments, got %d", w.Code)
+	}
+	if w, _ := request(http.MethodPut, likePath, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for viewer like, got %d", w.Code)
+	}
+	current, scopes = member, []string{models.TokenScopeRead}
+	if w, _ := request(http.MethodPost, commentsPath, gin.H{"content": "唯讀權杖"}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for commenting with a read-only token, got %d", w.Code)
+	}
+	scopes = []string{models.TokenScopeManage}
+	if w, _ := request(http.MethodDelete, likePath, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected manage token to unlike, got %d", w.Code)
+	}
+	request(http.MethodPut, likePath, nil)
+	scopes = nil
+
+	// 留言與回覆，@提及必須是已啟用的用戶
+	current = author
+	w, data := request(http.MethodPost, commentsPath, gin.H{"content": "  大家看看這張照片 @Member ", "mentions": []uint{member.ID, member.ID}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	var root models.FileComment
+	json.Unmarshal(data, &root)
+	if root.Content != "大家看看這張照片 @Member" || len(root.Mentions) != 1 || root.Mentions[0].UserID != member.ID {
+		t.Errorf("Unexpected comment: %+v", root)
+	}
+	if w, _ := request(http.MethodPost, commentsPath, gin.H{"content": "@New", "mentions": []uint{pending.ID}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for mentioning a pending user, got %d", w.Code)
+	}
+	if w, _ := request(http.MethodPost, commentsPath, gin.H{"content": strings.Repeat("長", services.MaxCommentLength+1)}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a long comment, got %d", w.Code)
+	}
+	current = member
+	_, data = request(http.MethodPost, commentsPath, gin.H{"content": "好美！", "parent_id": root.ID})
+	var reply models.FileComment
+	json.Unmarshal(data, &reply)
+	if w, _ := request(http.MethodPost, commentsPath, gin.H{"content": "?", "parent_id": 99999}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for replying to a missing comment, got %d", w.Code)
+	}
+
+	// 只有作者或版主可以修改、刪除留言
+	rootPath := fmt.Sprintf("%s/%d", commentsPath, root.ID)
+	if w, _ := request(http.MethodPut, rootPath, gin.H{"content": "改掉"}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for editing someone else's comment, got %d", w.Code)
+	}
+	current = moderator
+	if w, _ := request(http.MethodPut, rootPath, gin.H{"content": "已由版主修改"}); w.Code != http.StatusOK {
+		t.Errorf("Expected moderator edit to succeed, got %d %s", w.Code, w.Body.String())
+	}
+	// 版主修改他人留言時記錄修改前後的內容
+	var log models.ActivityLog
+	if err := db.Where("action = ?", "update_comment").First(&log).Error; err != nil {
+		t.Fatalf("Expected update_comment activity log: %v", err)
+	}
+	var details services.AuditDetails
+	json.Unmarshal([]byte(log.Details), &details)
+	if change, ok := details.Changes["content"]; !ok || change.Before != "大家看看這張照片 @Member" || change.After != "已由版主修改" {
+		t.Errorf("Expected content change in audit details, got %s", log.Details)
+	}
+	if w, _ := request(http.MethodDelete, rootPath, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected moderator delete to succeed, got %d", w.Code)
+	}
+	var logged int64
+	db.Model(&models.ActivityLog{}).Where("action IN ? AND resource_type = ?", []string{"create_comment", "delete_comment"}, "file_comment").Count(&logged)
+	if logged != 3 {
+		t.Errorf("Expected 2 create_comment and 1 delete_comment logs, got %d", logged)
+	}
+	db.Model(&models.ActivityLog{}).Where("action IN ?", []string{"like", "unlike"}).Count(&logged)
+	if logged == 0 {
+		t.Error("Expected likes to be audited")
+	}
+
+	// 已刪除的留言保留在討論串中讓回覆顯示；沒有回覆時不顯示
+	_, data = request(http.MethodGet, commentsPath, nil)
+	var thread []models.FileComment
+	json.Unmarshal(data, &thread)
+	if len(thread) != 1 || !thread[0].IsDeleted || thread[0].Content != "" || len(thread[0].Replies) != 1 || thread[0].Replies[0].ID != reply.ID {
+		t.Fatalf("Unexpected thread: %s", data)
+	}
+	current = member
+	request(http.MethodDelete, fmt.Sprintf("%s/%d", commentsPath, reply.ID), nil)
+	_, data = request(http.MethodGet, commentsPath, nil)
+	if json.Unmarshal(data, &thread); len(thread) != 0 {
+		t.Errorf("Expected deleted comments without replies to be hidden, got %s", data)
+	}
+
+	// 垃圾桶中的檔案不能按讚或留言；永久刪除時清除按讚與留言
+	db.Model(&photo).Update("is_deleted", true)
+	if w, _ := request(http.MethodPut, likePath, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for liking a trashed file, got %d", w.Code)
+	}
+	if err := services.PurgeFile(db, &photo); err != nil {
+		t.Fatalf("Failed to purge file: %v", err)
+	}
+	var remaining int64
+	db.Model(&models.FileLike{}).Where("file_id = ?", photo.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("Expected likes removed with the file, got %d", remaining)
+	}
+	db.Model(&models.FileComment{}).Where("file_id = ?", photo.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("Expected comments removed with the file, got %d", remaining)
+	}
+}
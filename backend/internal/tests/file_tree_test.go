@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+)
+
+// TestFileTree 測試 ID 路徑的維護、子孫判斷、虛擬路徑查詢不含同名開頭的項目，以及結構修復工具
+func TestFileTree(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	cfg := setupTestConfig(t)
+
+	user := models.User{Email: "elder@example.com", Name: "Elder", Status: "approved"}
+	db.Create(&user)
+
+	create := func(name string, parentID *uint, isDir bool, virtualPath string) models.File {
+		file := models.File{
+			Name: name, OriginalName: name, ParentID: parentID, IsDirectory: isDir,
+			VirtualPath: virtualPath, UploadedBy: user.ID, FilePath: "blob-" + name,
+		}
+		db.Create(&file)
+		return file
+	}
+	reload := func(file models.File) models.File {
+		var current models.File
+		db.First(&current, file.ID)
+		return current
+	}
+
+	fileHandler := handlers.NewFileHandler(db, cfg)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Next()
+	})
+	router.GET("/api/files", fileHandler.GetFiles)
+	router.POST("/api/files/move", fileHandler.MoveFiles)
+	router.GET("/api/admin/files/tree/check", fileHandler.CheckFileTree)
+	router.POST("/api/admin/files/tree/repair", fileHandler.RepairFileTree)
+
+	request := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	treeReport := func(method, path string) services.FileTreeReport {
+		w := request(method, path, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Tree request failed: %d %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data services.FileTreeReport `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Data
+	}
+
+	// 建立時設定 ID 路徑
+	photos := create("photos", nil, true, "/photos")
+	album := create("2024", &photos.ID, true, "/photos/2024")
+	photo := create("a.jpg", &album.ID, false, "/photos/2024/a.jpg")
+	create("photos2", nil, true, "/photos2")
+	create("photos_backup", nil, true, "/photos_backup")
+	if got, want := reload(photo).TreePath, fmt.Sprintf("/%d/%d/%d/", photos.ID, album.ID, photo.ID); got != want {
+		t.Fatalf("Expected tree path %s, got %s", want, got)
+	}
+
+	// 虛擬路徑查詢不包含 /photos2 與 /photos_backup
+	w := request(http.MethodGet, "/api/files?virtual_path=/photos", nil)
+	var list struct {
+		Data struct {
+			Files []models.File `json:"files"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Data.Files) != 3 {
+		t.Errorf("Expected /photos and its 2 descendants, got %d: %s", len(list.Data.Files), w.Body.String())
+	}
+
+	// 移動資料夾時一併更新子孫項目的 ID 路徑，並拒絕移動到自己的子資料夾
+	archive := create("archive", nil, true, "/archive")
+	request(http.MethodPost, "/api/files/move", gin.H{
+		"file_ids": []uint{photos.ID}, "target_folder_id": archive.ID, "operation_type": "move",
+	})
+	if got, want := reload(photo).TreePath, fmt.Sprintf("/%d/%d/%d/%d/", archive.ID, photos.ID, album.ID, photo.ID); got != want {
+		t.Errorf("Expected tree path %s after move, got %s", want, got)
+	}
+	if ok, _ := services.IsDescendantOf(db, photo.ID, archive.ID); !ok {
+		t.Error("Expected photo to be a descendant of archive")
+	}
+	if w := request(http.MethodPost, "/api/files/move", gin.H{
+		"file_ids": []uint{archive.ID}, "target_folder_id": album.ID, "operation_type": "move",
+	}); w.Code == http.StatusOK {
+		t.Errorf("Expected moving a folder into its own descendant to fail, got %d", w.Code)
+	}
+
+	// 結構一致時修復工具不回報問題
+	if report := treeReport(http.MethodGet, "/api/admin/files/tree/check"); !report.Consistent {
+		t.Fatalf("Expected consistent tree, got %+v", report)
+	}
+
+	// 製造路徑偏差、孤兒項目與循環
+	db.Model(&models.File{}).Where("id = ?", photo.ID).UpdateColumns(map[string]interface{}{"virtual_path": "/wrong/a.jpg", "tree_path": "/999/"})
+	orphan := create("orphan.txt", nil, false, "/orphan.txt")
+	db.Model(&models.File{}).Where("id = ?", orphan.ID).UpdateColumn("parent_id", 9999)
+	loopA := create("loopA", nil, true, "/loopA")
+	loopB := create("loopB", &loopA.ID, true, "/loopA/loopB")
+	db.Model(&models.File{}).Where("id = ?", loopA.ID).UpdateColumn("parent_id", loopB.ID)
+
+	// 試執行只回報，不做修改
+	report := treeReport(http.MethodGet, "/api/admin/files/tree/check")
+	if report.Consistent || !report.DryRun || len(report.Orphans) != 1 || len(report.Cycles) != 2 || report.Repaired != 0 {
+		t.Errorf("Unexpected dry-run report: %+v", report)
+	}
+	if len(report.VirtualPathDrift) == 0 || report.VirtualPathDrift[0].FileID != photo.ID || report.VirtualPathDrift[0].Expected != "/archive/photos/2024/a.jpg" {
+		t.Errorf("Expected drifted virtual path reported, got %+v", report.VirtualPathDrift)
+	}
+	if reload(photo).VirtualPath != "/wrong/a.jpg" {
+		t.Error("Dry run should not modify files")
+	}
+
+	// 修復後結構一致
+	report = treeReport(http.MethodPost, "/api/admin/files/tree/repair")
+	if report.Repaired == 0 {
+		t.Errorf("Expected items repaired, got %+v", report)
+	}
+	if current := reload(photo); current.VirtualPath != "/archive/photos/2024/a.jpg" || current.TreePath != fmt.Sprintf("/%d/%d/%d/%d/", archive.ID, photos.ID, album.ID, photo.ID) {
+		t.Errorf("Expected paths repaired, got %q %q", current.VirtualPath, current.TreePath)
+	}
+	if current := reload(orphan); current.ParentID != nil || current.VirtualPath != "/orphan.txt" {
+		t.Errorf("Expected orphan moved to root, got %+v", current)
+	}
+	if current := reload(loopA); current.ParentID != nil || reload(loopB).VirtualPath != "/loopA/loopB" {
+		t.Errorf("Expected cycle broken at loopA, got %+v", current)
+	}
+	if report := treeReport(http.MethodGet, "/api/admin/files/tree/check"); !report.Consistent {
+		t.Errorf("Expected consistent tree after repair, got %+v", report)
+	}
+}
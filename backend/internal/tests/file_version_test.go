@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+)
+
+// TestFileVersioning 測試同名重新上傳建立新版本、保留數量、還原與共用實體檔案的刪除
+func TestFileVersioning(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	cfg := setupTestConfig(t)
+	cfg.Upload.VersionRetention = 2
+
+	user := models.User{Email: "editor@example.com", Name: "Editor", Status: "approved"}
+	db.Create(&user)
+
+	fileHandler := handlers.NewFileHandler(db, cfg)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("user_role", "user")
+		c.Next()
+	})
+	router.POST("/api/files/upload", fileHandler.UploadFile)
+	router.GET("/api/files/:id/versions", fileHandler.GetFileVersions)
+	router.GET("/api/files/:id/versions/:versionId/download", fileHandler.DownloadFileVersion)
+	router.POST("/api/files/:id/versions/:versionId/restore", fileHandler.RestoreFileVersion)
+	router.DELETE("/api/files/:id/permanent", fileHandler.PermanentDeleteFile)
+
+	upload := func(name, content string) (*httptest.ResponseRecorder, models.File) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write([]byte(content))
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/files/upload", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp struct {
+			Data models.File `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp.Data
+	}
+	blobOf := func(hash string) string {
+		var version models.FileVersion
+		db.Where("sha256_hash = ?", hash).First(&version)
+		return version.FilePath
+	}
+
+	_, first := upload("週報.pdf", "第一版")
+	w, second := upload("週報.pdf", "第二版")
+	if w.Code != http.StatusCreated || second.ID != first.ID || second.Version != 2 {
+		t.Fatalf("Expected version 2 of file %d, got %d %s", first.ID, w.Code, w.Body.String())
+	}
+	if w, _ := upload("週報.pdf", "第二版"); !bytes.Contains(w.Body.Bytes(), []byte(`"skipped":true`)) {
+		t.Errorf("Uploading identical content should be skipped: %s", w.Body.String())
+	}
+
+	upload("週報.pdf", "第三版")
+	upload("週報.pdf", "第四版")
+
+	// 保留 2 個歷史版本：第 1 版被清除，其實體檔案不再被引用而刪除
+	if _, err := os.Stat(first.FilePath); !os.IsNotExist(err) {
+		t.Errorf("Pruned version blob should be removed, stat err=%v", err)
+	}
+	var listing struct {
+		Data struct {
+			Versions []handlers.FileVersionEntry `json:"versions"`
+		} `json:"data"`
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/files/%d/versions", first.ID), nil))
+	json.Unmarshal(w.Body.Bytes(), &listing)
+	versions := listing.Data.Versions
+	if len(versions) != 3 || !versions[0].IsCurrent || versions[0].VersionNumber != 4 || versions[1].VersionNumber != 3 || versions[2].VersionNumber != 2 {
+		t.Fatalf("Unexpected versions: %s", w.Body.String())
+	}
+
+	// 下載歷史版本
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/files/%d/versions/%d/download", first.ID, *versions[1].ID), nil))
+	if w.Code != http.StatusOK || w.Body.String() != "第三版" {
+		t.Errorf("Expected version 3 content, got %d %q", w.Code, w.Body.String())
+	}
+
+	// 還原第 2 版：成為第 5 版，第 4 版保留在歷史中
+	secondBlob := blobOf(versions[2].SHA256Hash)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/files/%d/versions/%d/restore", first.ID, *versions[2].ID), nil))
+	var current models.File
+	db.First(&current, first.ID)
+	if w.Code != http.StatusOK || current.Version != 5 || current.SHA256Hash != versions[2].SHA256Hash || current.FilePath != secondBlob {
+		t.Fatalf("Restore failed: %d %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(secondBlob); err != nil {
+		t.Errorf("Restored content must be kept even after its version is pruned: %v", err)
+	}
+
+	// 資料夾設定優先於全域保留數量
+	folder := models.File{Name: "週報", OriginalName: "週報", IsDirectory: true, UploadedBy: user.ID}
+	db.Create(&folder)
+	keep := 5
+	db.Model(&folder).Update("version_retention", keep)
+	sub := models.File{Name: "2026", OriginalName: "2026", IsDirectory: true, ParentID: &folder.ID, UploadedBy: user.ID}
+	db.Create(&sub)
+	if got := services.ResolveVersionRetention(db, &sub.ID, cfg.Upload.VersionRetention); got != keep {
+		t.Errorf("Expected folder retention %d, got %d", keep, got)
+	}
+
+	// 永久刪除：其他檔案共用的實體檔案保留，只有此檔案引用的才刪除
+	_, shared := upload("另存.pdf", "第二版")
+	if shared.FilePath != secondBlob {
+		t.Fatalf("Expected deduplicated upload to share blob %s, got %s", secondBlob, shared.FilePath)
+	}
+	var history []models.FileVersion
+	db.Where("file_id = ?", first.ID).Find(&history)
+	db.Model(&models.File{}).Where("id = ?", first.ID).Update("is_deleted", true)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/files/%d/permanent", first.ID), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Permanent delete failed: %d %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(secondBlob); err != nil {
+		t.Errorf("Shared blob should be kept: %v", err)
+	}
+	for _, version := range history {
+		if _, err := os.Stat(version.FilePath); !os.IsNotExist(err) {
+			t.Errorf("Version blob %s should be removed", version.FilePath)
+		}
+	}
+	var remaining int64
+	db.Model(&models.FileVersion{}).Where("file_id = ?", first.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("Expected versions to be deleted, %d remain", remaining)
+	}
+
+	// 在外層交易中建立版本：交易復原時被淘汰版本的實體檔案必須保留，提交後才釋放
+	_, handout := upload("講義.pdf", "甲")
+	upload("講義.pdf", "乙")
+	upload("講義.pdf", "丙")
+	oldest := blobOf(handout.SHA256Hash)
+	replacement := services.FileContent{FilePath: filepath.Join(cfg.Upload.UploadPath, "講義-丁"), SHA256Hash: "ding", FileSize: 3, MimeType: "application/pdf"}
+	os.WriteFile(replacement.FilePath, []byte("丁"), 0644)
+	addInTx := func(commit bool) []string {
+		var latest models.File
+		db.First(&latest, handout.ID)
+		tx := db.Begin()
+		_, pruned, err := services.AddFileVersionDeferred(tx, &latest, replacement, user.ID, cfg.Upload.VersionRetention)
+		if err != nil {
+			tx.Rollback()
+			t.Fatalf("AddFileVersionDeferred failed: %v", err)
+		}
+		if !commit {
+			tx.Rollback()
+			return pruned
+		}
+		if err := tx.Commit().Error; err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+		services.ReleaseBlobs(db, pruned)
+		return pruned
+	}
+	if pruned := addInTx(false); len(pruned) != 1 || pruned[0] != oldest {
+		t.Errorf("Expected the oldest version blob pruned, got %v", pruned)
+	}
+	if _, err := os.Stat(oldest); err != nil {
+		t.Errorf("Blob of a version restored by rollback must be kept: %v", err)
+	}
+	addInTx(true)
+	if _, err := os.Stat(oldest); !os.IsNotExist(err) {
+		t.Errorf("Pruned blob should be removed after commit, stat err=%v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+)
+
+// TestFolderStats 測試資料夾大小與項目數統計隨上傳、刪除、還原、移動與複製更新，以及修復工作
+func TestFolderStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	cfg := setupTestConfig(t)
+
+	user := models.User{Email: "deacon@example.com", Name: "Deacon", Status: "approved"}
+	db.Create(&user)
+
+	queue := services.NewJobQueue(db, 1)
+	fileHandler := handlers.NewFileHandler(db, cfg)
+	fileHandler.SetJobQueue(queue)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("user_role", "admin")
+		c.Next()
+	})
+	router.POST("/api/files/upload", fileHandler.UploadFile)
+	router.POST("/api/folders", fileHandler.CreateFolder)
+	router.DELETE("/api/files/:id", fileHandler.DeleteFile)
+	router.POST("/api/files/:id/restore", fileHandler.RestoreFile)
+	router.POST("/api/files/copy", fileHandler.CopyFiles)
+	router.POST("/api/files/move", fileHandler.MoveFiles)
+	router.POST("/api/admin/folders/repair-stats", fileHandler.RepairFolderStats)
+
+	request := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	createFolder := func(name string, parentID *uint) models.File {
+		w := request(http.MethodPost, "/api/folders", gin.H{"name": name, "parent_id": parentID})
+		var resp struct {
+			Data models.File `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Data.ID == 0 {
+			t.Fatalf("Create folder failed: %d %s", w.Code, w.Body.String())
+		}
+		return resp.Data
+	}
+	upload := func(name, content string, parentID uint) models.File {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		writer.WriteField("parent_id", fmt.Sprint(parentID))
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write([]byte(content))
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/files/upload", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp struct {
+			Data models.File `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Data.ID == 0 {
+			t.Fatalf("Upload failed: %d %s", w.Code, w.Body.String())
+		}
+		return resp.Data
+	}
+	expectStats := func(label string, folder models.File, size, count int64) {
+		t.Helper()
+		var current models.File
+		db.First(&current, folder.ID)
+		if current.TotalSize != size || current.ItemCount != count {
+			t.Errorf("%s: expected %s size=%d items=%d, got size=%d items=%d",
+				label, folder.Name, size, count, current.TotalSize, current.ItemCount)
+		}
+	}
+
+	// 上傳與建立資料夾時更新所有上層資料夾
+	church := createFolder("教會", nil)
+	sermons := createFolder("講道", &church.ID)
+	upload("第一篇.txt", "12345", sermons.ID)
+	second := upload("第二篇.txt", "1234567890", sermons.ID)
+	expectStats("upload", sermons, 15, 2)
+	expectStats("upload", church, 15, 3)
+
+	// 刪除與還原
+	request(http.MethodDelete, fmt.Sprintf("/api/files/%d", second.ID), nil)
+	expectStats("delete", sermons, 5, 1)
+	expectStats("delete", church, 5, 2)
+	request(http.MethodPost, fmt.Sprintf("/api/files/%d/restore", second.ID), nil)
+	expectStats("restore", church, 15, 3)
+
+	request(http.MethodDelete, fmt.Sprintf("/api/files/%d", sermons.ID), nil)
+	expectStats("delete folder", church, 0, 0)
+	if w := request(http.MethodPost, fmt.Sprintf("/api/files/%d/restore", sermons.ID), nil); w.Code != http.StatusOK {
+		t.Fatalf("Restore folder failed: %d %s", w.Code, w.Body.String())
+	}
+	expectStats("restore folder", sermons, 15, 2)
+	expectStats("restore folder", church, 15, 3)
+
+	// 移動時更新來源與目標資料夾，複製時計算複本的子樹
+	archive := createFolder("歸檔", nil)
+	request(http.MethodPost, "/api/files/move", gin.H{
+		"file_ids": []uint{sermons.ID}, "target_folder_id": archive.ID, "operation_type": "move",
+	})
+	expectStats("move", church, 0, 0)
+	expectStats("move", archive, 15, 3)
+
+	request(http.MethodPost, "/api/files/copy", gin.H{
+		"file_ids": []uint{sermons.ID}, "target_folder_id": church.ID, "operation_type": "copy",
+	})
+	var copied models.File
+	db.Where("parent_id = ? AND is_directory = ? AND is_deleted = ?", church.ID, true, false).First(&copied)
+	expectStats("copy", copied, 15, 2)
+	expectStats("copy", church, 15, 3)
+
+	// 修復工作從頭重新計算被竄改的統計
+	db.Model(&models.File{}).Where("is_directory = ?", true).UpdateColumns(map[string]interface{}{"total_size": 999, "item_count": 999})
+	if w := request(http.MethodPost, "/api/admin/folders/repair-stats", nil); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202 for repair job, got %d %s", w.Code, w.Body.String())
+	}
+	if ran := queue.RunPending(); ran != 1 {
+		t.Fatalf("Expected repair job to run, got %d", ran)
+	}
+	var job models.Job
+	db.Where("type = ?", models.JobTypeFolderStatsRepair).First(&job)
+	if job.Status != models.JobSucceeded || job.Total != 4 || job.Processed != 4 {
+		t.Errorf("Unexpected repair job: %+v", job)
+	}
+	expectStats("repair", archive, 15, 3)
+	expectStats("repair", sermons, 15, 2)
+	expectStats("repair", church, 15, 3)
+}
@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/models"
+	"memoryark/internal/scheduler"
+	"memoryark/internal/services"
+)
+
+// TestCronSchedule 測試 cron 表達式解析與下次執行時間
+func TestCronSchedule(t *testing.T) {
+	friday := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 9 * * SAT", time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 16, 10, 15, 0, 0, time.UTC)},
+		{"30 8 1 * *", time.Date(2026, 11, 1, 8, 30, 0, 0, time.UTC)},
+		{"0 0 20 * 0", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)}, // 日與星期任一符合
+		{"0 10 * * 7", time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)},
+		{"0 7 24-25 DEC *", time.Date(2026, 12, 24, 7, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		schedule, err := scheduler.Parse(tc.expr)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tc.expr, err)
+			continue
+		}
+		if got := schedule.Next(friday); !got.Equal(tc.want) {
+			t.Errorf("Next(%q) = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	if schedule, err := scheduler.Parse("0 0 30 2 *"); err != nil || !schedule.Next(friday).IsZero() {
+		t.Errorf("Expected no occurrence for February 30, got %v %v", schedule, err)
+	}
+	for _, expr := range []string{"61 * * * *", "0 9 * *", "0 9 * * FUN", "0 9 5-1 * *", "*/0 * * * *"} {
+		if _, err := scheduler.Parse(expr); err == nil {
+			t.Errorf("Expected Parse(%q) to fail", expr)
+		}
+	}
+
+	saturday := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	for name, want := range map[string]string{
+		"{date}":                     "2026-10-17",
+		"{date:YYYYMMDD} 週{weekday}": "20261017 週六",
+		"{year}年{month}月":            "2026年10月",
+		"{date:M-D}":                 "10-17",
+	} {
+		if got, err := services.RenderTemplateName(name, saturday); err != nil || got != want {
+			t.Errorf("RenderTemplateName(%q) = %q %v, want %q", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"{time}", "{year:YY}", "{date:YYYY/MM}", "  "} {
+		if _, err := services.RenderTemplateName(name, saturday); err == nil {
+			t.Errorf("Expected RenderTemplateName(%q) to fail", name)
+		}
+	}
+}
+
+// TestFolderTemplates 測試資料夾範本的建立、依排程提前建立資料夾、預設分類與標籤及手動套用
+func TestFolderTemplates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	cfg := setupTestConfig(t)
+
+	admin := models.User{Email: "media@example.com", Name: "Media", Role: "admin", Status: "approved"}
+	db.Create(&admin)
+	category := models.Category{Name: "安息日聚會", CreatedBy: admin.ID}
+	db.Create(&category)
+	// 已存在的資料夾沿用，不會重複建立
+	sabbath := models.File{Name: "安息日", OriginalName: "安息日", IsDirectory: true, VirtualPath: "/安息日", UploadedBy: admin.ID, Tags: "聚會"}
+	db.Create(&sabbath)
+
+	fileHandler := handlers.NewFileHandler(db, cfg)
+	templateHandler := handlers.NewFolderTemplateHandler(db, cfg, fileHandler)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", admin.ID)
+		c.Next()
+	})
+	router.POST("/api/admin/folder-templates", templateHandler.CreateFolderTemplate)
+	router.PUT("/api/admin/folder-templates/:id", templateHandler.UpdateFolderTemplate)
+	router.GET("/api/admin/folder-templates/:id/preview", templateHandler.PreviewFolderTemplate)
+	router.POST("/api/admin/folder-templates/:id/run", templateHandler.RunFolderTemplate)
+
+	request := func(method, path string, body interface{}) (*httptest.ResponseRecorder, json.RawMessage) {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp struct {
+			Data json.RawMessage `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp.Data
+	}
+	folder := func(path string) *models.File {
+		var file models.File
+		if err := db.Where("virtual_path = ? AND is_directory = ?", path, true).First(&file).Error; err != nil {
+			return nil
+		}
+		return &file
+	}
+
+	body := gin.H{
+		"name": "安息日聚會",
+		"structure": []gin.H{{
+			"name": "安息日",
+			"children": []gin.H{{
+				"name":     "{date}",
+				"children": []gin.H{{"name": "講道錄音"}, {"name": "詩歌"}, {"name": "照片"}},
+			}},
+		}},
+		"category_id": category.ID,
+		"tags":        "安息日,聚會",
+		"schedule":    "0 9 * * SAT",
+	}
+	w, data := request(http.MethodPost, "/api/admin/folder-templates", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	var template models.FolderTemplate
+	json.Unmarshal(data, &template)
+	if !template.Enabled || template.LeadDays != 6 || template.NextServiceAt == nil {
+		t.Errorf("Unexpected template defaults: %+v", template)
+	}
+	if w, _ := request(http.MethodPost, "/api/admin/folder-templates", body); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for duplicate name, got %d", w.Code)
+	}
+	invalid := gin.H{"name": "錯誤", "structure": []gin.H{{"name": "{date}"}}, "schedule": "0 25 * * *"}
+	if w, _ := request(http.MethodPost, "/api/admin/folder-templates", invalid); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid cron, got %d", w.Code)
+	}
+	invalid = gin.H{"name": "錯誤", "structure": []gin.H{{"name": "{when}"}}}
+	if w, _ := request(http.MethodPost, "/api/admin/folder-templates", invalid); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown placeholder, got %d", w.Code)
+	}
+
+	// 預覽接下來的聚會
+	_, data = request(http.MethodGet, fmt.Sprintf("/api/admin/folder-templates/%d/preview?count=2", template.ID), nil)
+	var previews []handlers.FolderTemplatePreview
+	json.Unmarshal(data, &previews)
+	if len(previews) != 2 || len(previews[0].Paths) != 5 || previews[0].ServiceAt.Weekday() != time.Saturday {
+		t.Errorf("Unexpected preview: %s", data)
+	}
+
+	// 聚會前 6 天內才建立資料夾
+	apply := func(template *models.FolderTemplate, serviceAt time.Time) error {
+		_, err := fileHandler.ApplyFolderTemplate(template, serviceAt)
+		return err
+	}
+	run := func(now time.Time) int {
+		created, err := services.RunDueFolderTemplates(db, time.UTC, now, apply)
+		if err != nil {
+			t.Fatalf("RunDueFolderTemplates failed: %v", err)
+		}
+		return created
+	}
+	if created := run(time.Date(2026, 10, 10, 10, 0, 0, 0, time.UTC)); created != 0 || folder("/安息日/2026-10-10") != nil {
+		t.Errorf("Expected nothing created for a service that already started, got %d", created)
+	}
+	if created := run(time.Date(2026, 10, 11, 8, 0, 0, 0, time.UTC)); created != 0 {
+		t.Errorf("Expected nothing created before the lead time, got %d", created)
+	}
+	if created := run(time.Date(2026, 10, 12, 10, 0, 0, 0, time.UTC)); created != 1 {
+		t.Fatalf("Expected one service created, got %d", created)
+	}
+	for _, path := range []string{"/安息日/2026-10-17", "/安息日/2026-10-17/講道錄音", "/安息日/2026-10-17/詩歌", "/安息日/2026-10-17/照片"} {
+		created := folder(path)
+		if created == nil {
+			t.Fatalf("Expected folder %s to be created", path)
+		}
+		if created.CategoryID == nil || *created.CategoryID != category.ID || created.Tags != "安息日,聚會" || created.UploadedBy != admin.ID {
+			t.Errorf("Unexpected defaults on %s: %+v", path, created)
+		}
+	}
+	var roots int64
+	db.Model(&models.File{}).Where("name = ? AND parent_id IS NULL", "安息日").Count(&roots)
+	if current := folder("/安息日"); roots != 1 || current.Tags != "聚會" {
+		t.Errorf("Expected the existing folder reused with its tags kept, got %d %+v", roots, current)
+	}
+	if created := run(time.Date(2026, 10, 13, 10, 0, 0, 0, time.UTC)); created != 0 {
+		t.Errorf("Expected the same service not created twice, got %d", created)
+	}
+	if created := run(time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)); created != 1 || folder("/安息日/2026-10-24/照片") == nil {
+		t.Errorf("Expected the following service created, got %d", created)
+	}
+
+	// 停用後不再自動建立；可手動指定日期套用
+	body["enabled"] = false
+	if w, _ := request(http.MethodPut, fmt.Sprintf("/api/admin/folder-templates/%d", template.ID), body); w.Code != http.StatusOK {
+		t.Fatalf("Expected update to succeed, got %d %s", w.Code, w.Body.String())
+	}
+	if created := run(time.Date(2026, 10, 25, 10, 0, 0, 0, time.UTC)); created != 0 {
+		t.Errorf("Expected disabled template skipped, got %d", created)
+	}
+	w, data = request(http.MethodPost, fmt.Sprintf("/api/admin/folder-templates/%d/run", template.ID), gin.H{"date": "2026-12-25"})
+	var result handlers.FolderTemplateResult
+	json.Unmarshal(data, &result)
+	if w.Code != http.StatusOK || len(result.Folders) != 5 || folder("/安息日/2026-12-25/詩歌") == nil {
+		t.Errorf("Unexpected manual run: %d %s", w.Code, data)
+	}
+	if w, _ := request(http.MethodPost, fmt.Sprintf("/api/admin/folder-templates/%d/run", template.ID), gin.H{"date": "12/25"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid date, got %d", w.Code)
+	}
+}
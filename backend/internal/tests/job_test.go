@@ -0,0 +1,215 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/database"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+)
+
+// recordingNotifier 記錄推送給用戶的工作事件
+type recordingNotifier struct {
+	events []string
+}
+
+func (n *recordingNotifier) BroadcastUserEvent(userID uint, eventType string, message string, data interface{}) {
+	if job, ok := data.(models.Job); ok {
+		n.events = append(n.events, fmt.Sprintf("%d:%s:%s", userID, eventType, job.Status))
+	}
+}
+
+// TestBackgroundJobs 測試檔案樹操作以背景工作執行、取消與中斷後從檢查點繼續
+func TestBackgroundJobs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	cfg := setupTestConfig(t)
+	cfg.Operation.UndoWindow = 60
+	if err := db.AutoMigrate(&models.Role{}); err != nil {
+		t.Fatalf("Failed to migrate roles: %v", err)
+	}
+	if err := database.InitializeDefaultRoles(db); err != nil {
+		t.Fatalf("Failed to create default roles: %v", err)
+	}
+
+	user := models.User{Email: "sexton@example.com", Name: "Sexton", Role: "user", Status: "approved"}
+	other := models.User{Email: "visitor@example.com", Name: "Visitor", Role: "user", Status: "approved"}
+	db.Create(&user)
+	db.Create(&other)
+
+	create := func(name string, parentID *uint, isDir bool, virtualPath string) models.File {
+		file := models.File{
+			Name: name, OriginalName: name, ParentID: parentID, IsDirectory: isDir,
+			VirtualPath: virtualPath, UploadedBy: user.ID, FilePath: "blob-" + name,
+		}
+		db.Create(&file)
+		return file
+	}
+	reload := func(file models.File) models.File {
+		var current models.File
+		db.First(&current, file.ID)
+		return current
+	}
+	loadJob := func(id uint) models.Job {
+		var job models.Job
+		db.First(&job, id)
+		return job
+	}
+
+	notifier := &recordingNotifier{}
+	queue := services.NewJobQueue(db, 1)
+	queue.SetNotifier(notifier)
+	fileHandler := handlers.NewFileHandler(db, cfg)
+	fileHandler.SetJobQueue(queue)
+	jobHandler := handlers.NewJobHandler(db, cfg, queue)
+
+	currentUser := user.ID
+	var scopes []string
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", currentUser)
+		c.Set("user_role", "user")
+		if scopes != nil {
+			c.Set("token_scopes", scopes)
+		}
+		c.Next()
+	})
+	router.DELETE("/api/files/:id", fileHandler.DeleteFile)
+	router.POST("/api/files/copy", fileHandler.CopyFiles)
+	router.POST("/api/files/move", fileHandler.MoveFiles)
+	router.GET("/api/jobs", jobHandler.GetJobs)
+	router.GET("/api/jobs/:id", jobHandler.GetJob)
+	router.POST("/api/jobs/:id/cancel", jobHandler.CancelJob)
+
+	request := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	enqueue := func(method, path string, body interface{}) uint {
+		w := request(method, path, body)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("Expected 202 for async request, got %d %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data models.Job `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Data.Status != models.JobQueued {
+			t.Fatalf("Expected queued job, got %+v", resp.Data)
+		}
+		return resp.Data.ID
+	}
+
+	// 背景刪除資料夾：子項目與資料夾一併移至垃圾桶，並記錄可復原的操作
+	sermons := create("講道", nil, true, "/講道")
+	var children []models.File
+	for i := 0; i < 3; i++ {
+		children = append(children, create(fmt.Sprintf("第%d篇.mp3", i+1), &sermons.ID, false, fmt.Sprintf("/講道/第%d篇.mp3", i+1)))
+	}
+	deleteJob := enqueue(http.MethodDelete, fmt.Sprintf("/api/files/%d?async=true", sermons.ID), nil)
+	if reload(sermons).IsDeleted {
+		t.Fatal("Folder should not be deleted before the job runs")
+	}
+	if ran := queue.RunPending(); ran != 1 {
+		t.Fatalf("Expected 1 job to run, got %d", ran)
+	}
+	job := loadJob(deleteJob)
+	if job.Status != models.JobSucceeded || job.Total != 4 || job.Processed != 4 || job.Progress != 100 {
+		t.Errorf("Unexpected delete job: %+v", job)
+	}
+	if !reload(sermons).IsDeleted || !reload(children[2]).IsDeleted {
+		t.Error("Expected folder and children moved to trash")
+	}
+	var deleteResult struct {
+		DeletedCount int   `json:"deletedCount"`
+		OperationID  *uint `json:"operationId"`
+	}
+	json.Unmarshal(job.Result, &deleteResult)
+	if deleteResult.DeletedCount != 4 || deleteResult.OperationID == nil {
+		t.Errorf("Unexpected delete result: %s", job.Result)
+	}
+	if len(notifier.events) == 0 || notifier.events[len(notifier.events)-1] != fmt.Sprintf("%d:job_completed:succeeded", user.ID) {
+		t.Errorf("Expected completion pushed to job owner, got %v", notifier.events)
+	}
+
+	// 取消排隊中的工作
+	archive := create("歸檔", nil, true, "/歸檔")
+	bulletin := create("週報.pdf", nil, false, "/週報.pdf")
+	copyJob := enqueue(http.MethodPost, "/api/files/copy?async=true", gin.H{
+		"file_ids": []uint{bulletin.ID}, "target_folder_id": archive.ID, "operation_type": "copy",
+	})
+	// 唯讀令牌可以查看工作，但不能取消需要編輯權限的工作
+	scopes = []string{models.TokenScopeRead}
+	if w := request(http.MethodGet, fmt.Sprintf("/api/jobs/%d", copyJob), nil); w.Code != http.StatusOK {
+		t.Errorf("Expected read-only token to view its job, got %d", w.Code)
+	}
+	if w := request(http.MethodPost, fmt.Sprintf("/api/jobs/%d/cancel", copyJob), nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 when canceling with a read-only token, got %d", w.Code)
+	}
+	scopes = nil
+	if w := request(http.MethodPost, fmt.Sprintf("/api/jobs/%d/cancel", copyJob), nil); w.Code != http.StatusOK {
+		t.Fatalf("Cancel failed: %d %s", w.Code, w.Body.String())
+	}
+	if queue.RunPending() != 0 || loadJob(copyJob).Status != models.JobCanceled {
+		t.Errorf("Canceled job should not run, got %+v", loadJob(copyJob))
+	}
+	if w := request(http.MethodPost, fmt.Sprintf("/api/jobs/%d/cancel", copyJob), nil); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 when canceling a finished job, got %d", w.Code)
+	}
+
+	// 服務中斷時執行中的工作：重新排隊後從檢查點繼續，已完成的項目不會重複處理
+	photos := create("相片", nil, true, "/相片")
+	videos := create("影片", nil, true, "/影片")
+	params, _ := json.Marshal(handlers.FileOperationRequest{
+		FileIDs: []uint{photos.ID, videos.ID}, TargetFolderID: &archive.ID, OperationType: "move",
+	})
+	db.Model(&photos).Updates(map[string]interface{}{"parent_id": archive.ID, "virtual_path": "/歸檔/相片"})
+	interrupted := models.Job{
+		UserID: user.ID, Type: models.JobTypeMove, Status: models.JobRunning, Params: params,
+		Total: 2, Processed: 1, Progress: 50,
+		Checkpoint: fmt.Sprintf(`{"next":1,"response":{"success_count":1,"failed_count":0,"success_files":[{"original_id":%d,"file_name":"相片"}],"failed_files":[]},"items":[]}`, photos.ID),
+	}
+	db.Create(&interrupted)
+	if resumed, err := queue.Recover(); err != nil || resumed != 1 {
+		t.Fatalf("Expected 1 interrupted job re-queued, got %d (%v)", resumed, err)
+	}
+	queue.RunPending()
+	job = loadJob(interrupted.ID)
+	var moveResult handlers.FileOperationResponse
+	json.Unmarshal(job.Result, &moveResult)
+	if job.Status != models.JobSucceeded || job.Processed != 2 || moveResult.SuccessCount != 2 {
+		t.Errorf("Unexpected resumed job: %+v %s", job, job.Result)
+	}
+	if current := reload(videos); current.ParentID == nil || *current.ParentID != archive.ID {
+		t.Errorf("Expected remaining item moved after resume, got %+v", current)
+	}
+
+	// 工作列表只顯示自己的工作，其他用戶無法查看
+	w := request(http.MethodGet, "/api/jobs", nil)
+	var list struct {
+		Data []models.Job `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Data) != 3 {
+		t.Errorf("Expected 3 jobs, got %d", len(list.Data))
+	}
+	currentUser = other.ID
+	if w := request(http.MethodGet, fmt.Sprintf("/api/jobs/%d", deleteJob), nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another user's job, got %d", w.Code)
+	}
+}
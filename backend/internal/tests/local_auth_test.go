@@ -0,0 +1,311 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/auth"
+	"memoryark/internal/config"
+	"memoryark/internal/middleware"
+	"memoryark/internal/models"
+)
+
+// tokenResponse 登入與刷新回應中的令牌
+type tokenResponse struct {
+	Success bool `json:"success"`
+	Data    struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	} `json:"data"`
+	Error struct {
+		Code string `json:"code"`
+	} `json:"error"`
+}
+
+func postJSON(router *gin.Engine, path, bearer string, body interface{}) (*httptest.ResponseRecorder, tokenResponse) {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp tokenResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+func getWithBearer(router *gin.Engine, path, bearer string) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+bearer)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+// TestLocalJWTAuthFlow 測試內建登入、刷新令牌輪替、重複使用偵測與登出撤銷
+func TestLocalJWTAuthFlow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	if err := db.AutoMigrate(&models.RefreshToken{}, &models.RevokedToken{}, &models.LoginCode{}); err != nil {
+		t.Fatalf("Failed to migrate auth tables: %v", err)
+	}
+
+	cfg := setupTestConfig(t)
+	cfg.Auth = config.AuthConfig{
+		Provider:        config.AuthProviderLocalJWT,
+		JWTSecret:       "test-secret",
+		TokenExpiry:     1,
+		RefreshExpiry:   24,
+		LoginCodeExpiry: 10,
+	}
+
+	hash, _ := auth.HashPassword("correct-horse")
+	user := models.User{Email: "member@example.com", Name: "Member", Role: "user", Status: "approved", PasswordHash: hash}
+	db.Create(&user)
+
+	authHandler := handlers.NewAuthHandler(db, cfg)
+	router := gin.New()
+	router.POST("/api/auth/login", authHandler.Login)
+	router.POST("/api/auth/refresh", authHandler.RefreshToken)
+	router.POST("/api/auth/logout", authHandler.Logout)
+	router.GET("/api/auth/me", middleware.AuthMiddleware(cfg, db), authHandler.GetCurrentUser)
+
+	// 錯誤密碼
+	if w, _ := postJSON(router, "/api/auth/login", "", gin.H{"email": user.Email, "password": "wrong-password"}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for wrong password, got %d", w.Code)
+	}
+
+	// 密碼登入
+	w, login := postJSON(router, "/api/auth/login", "", gin.H{"email": user.Email, "password": "correct-horse"})
+	if w.Code != http.StatusOK || login.Data.AccessToken == "" || login.Data.RefreshToken == "" {
+		t.Fatalf("Password login failed: %d %s", w.Code, w.Body.String())
+	}
+	if code := getWithBearer(router, "/api/auth/me", login.Data.AccessToken); code != http.StatusOK {
+		t.Fatalf("Expected access token to be accepted, got %d", code)
+	}
+
+	// 登入碼只能使用一次
+	code, err := auth.IssueLoginCode(db, user.Email, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to issue login code: %v", err)
+	}
+	if w, _ := postJSON(router, "/api/auth/login", "", gin.H{"email": user.Email, "code": code}); w.Code != http.StatusOK {
+		t.Fatalf("Code login failed: %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := postJSON(router, "/api/auth/login", "", gin.H{"email": user.Email, "code": code}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected used login code to be rejected, got %d", w.Code)
+	}
+
+	// 刷新令牌輪替
+	w, rotated := postJSON(router, "/api/auth/refresh", "", gin.H{"refresh_token": login.Data.RefreshToken})
+	if w.Code != http.StatusOK || rotated.Data.RefreshToken == login.Data.RefreshToken {
+		t.Fatalf("Refresh failed: %d %s", w.Code, w.Body.String())
+	}
+
+	// 重複使用舊令牌：整個家族被撤銷，連新令牌也失效
+	w, reused := postJSON(router, "/api/auth/refresh", "", gin.H{"refresh_token": login.Data.RefreshToken})
+	if w.Code != http.StatusUnauthorized || reused.Error.Code != "REFRESH_TOKEN_REUSED" {
+		t.Fatalf("Expected reuse detection, got %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := postJSON(router, "/api/auth/refresh", "", gin.H{"refresh_token": rotated.Data.RefreshToken}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected rotated token to be revoked after reuse, got %d", w.Code)
+	}
+	// 外洩的刷新令牌換得的存取令牌也要失效
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if reloaded.TokensValidAfter == nil {
+		t.Errorf("Expected reuse detection to cut off issued access tokens")
+	}
+
+	// 登出後存取令牌立即失效
+	_, fresh := postJSON(router, "/api/auth/login", "", gin.H{"email": user.Email, "password": "correct-horse"})
+	if w, _ := postJSON(router, "/api/auth/logout", fresh.Data.AccessToken, gin.H{}); w.Code != http.StatusOK {
+		t.Fatalf("Logout failed: %d %s", w.Code, w.Body.String())
+	}
+	if code := getWithBearer(router, "/api/auth/me", fresh.Data.AccessToken); code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked access token to be rejected, got %d", code)
+	}
+}
+
+// TestLoginAttemptLimits 測試帳號與 IP 的登入嘗試限制，以及令牌失效時間點之前簽發的存取令牌被拒絕
+func TestLoginAttemptLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	if err := db.AutoMigrate(&models.RefreshToken{}, &models.RevokedToken{}, &models.LoginCode{}); err != nil {
+		t.Fatalf("Failed to migrate auth tables: %v", err)
+	}
+	cfg := setupTestConfig(t)
+	cfg.Auth = config.AuthConfig{
+		Provider:              config.AuthProviderLocalJWT,
+		JWTSecret:             "test-secret",
+		TokenExpiry:           1,
+		RefreshExpiry:         24,
+		LoginCodeExpiry:       10,
+		LoginMaxAttempts:      3,
+		LoginMaxAttemptsPerIP: 5,
+		LoginLockoutMinutes:   15,
+	}
+
+	hash, _ := auth.HashPassword("correct-horse")
+	user := models.User{Email: "elder@example.com", Name: "Elder", Role: "user", Status: "approved", PasswordHash: hash}
+	other := models.User{Email: "choir@example.com", Name: "Choir", Role: "user", Status: "approved", PasswordHash: hash}
+	db.Create(&user)
+	db.Create(&other)
+
+	authHandler := handlers.NewAuthHandler(db, cfg)
+	authHandler.SetMailer(&captureMailer{})
+	router := gin.New()
+	router.POST("/api/auth/login", authHandler.Login)
+	router.POST("/api/auth/login/code", authHandler.RequestLoginCode)
+	router.GET("/api/auth/me", middleware.AuthMiddleware(cfg, db), authHandler.GetCurrentUser)
+	router.PUT("/api/auth/password", middleware.AuthMiddleware(cfg, db), authHandler.ChangePassword)
+	login := func(email, password string) (*httptest.ResponseRecorder, tokenResponse) {
+		return postJSON(router, "/api/auth/login", "", gin.H{"email": email, "password": password})
+	}
+
+	// 成功登入後重新計算帳號的失敗次數
+	login(user.Email, "wrong-password")
+	w, session := login(user.Email, "correct-horse")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Login failed: %d %s", w.Code, w.Body.String())
+	}
+
+	// 帳號失敗次數達到上限後，連正確的密碼也暫時拒絕
+	for i := 0; i < 3; i++ {
+		if w, _ := login(user.Email, "wrong-password"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected 401 for wrong password, got %d", w.Code)
+		}
+	}
+	w, locked := login(strings.ToUpper(user.Email), "correct-horse")
+	if w.Code != http.StatusTooManyRequests || locked.Error.Code != "TOO_MANY_ATTEMPTS" || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected the account to be locked, got %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := postJSON(router, "/api/auth/login/code", "", gin.H{"email": user.Email}); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected login codes to be refused for a locked account, got %d", w.Code)
+	}
+
+	// 同一 IP 的失敗次數跨帳號累計
+	if w, _ := login(other.Email, "wrong-password"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for wrong password, got %d", w.Code)
+	}
+	if w, _ := login(other.Email, "correct-horse"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the IP to be locked, got %d", w.Code)
+	}
+
+	// 失效時間點之前簽發的存取令牌一律拒絕
+	if code := getWithBearer(router, "/api/auth/me", session.Data.AccessToken); code != http.StatusOK {
+		t.Fatalf("Expected access token to be accepted, got %d", code)
+	}
+	db.Model(&models.User{}).Where("id = ?", user.ID).Update("tokens_valid_after", time.Now().Add(2*time.Second))
+	if code := getWithBearer(router, "/api/auth/me", session.Data.AccessToken); code != http.StatusUnauthorized {
+		t.Errorf("Expected access token issued before the cutoff to be rejected, got %d", code)
+	}
+
+	// 變更密碼會設定失效時間點，新簽發的令牌仍然有效
+	db.Model(&models.User{}).Where("id = ?", user.ID).Update("tokens_valid_after", nil)
+	payload, _ := json.Marshal(gin.H{"current_password": "correct-horse", "new_password": "battery-staple"})
+	req := httptest.NewRequest(http.MethodPut, "/api/auth/password", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+session.Data.AccessToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var changed struct {
+		Data struct {
+			AccessToken string `json:"access_token"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &changed)
+	if w.Code != http.StatusOK || changed.Data.AccessToken == "" {
+		t.Fatalf("Password change failed: %d %s", w.Code, w.Body.String())
+	}
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if reloaded.TokensValidAfter == nil {
+		t.Errorf("Expected the password change to cut off issued access tokens")
+	}
+	if code := getWithBearer(router, "/api/auth/me", changed.Data.AccessToken); code != http.StatusOK {
+		t.Errorf("Expected the token issued with the new password to be accepted, got %d", code)
+	}
+}
+
+// captureMailer 記錄寄出的郵件，fail 為 true 時模擬寄送失敗
+type captureMailer struct {
+	to, body string
+	fail     bool
+}
+
+func (m *captureMailer) SendMail(to, subject, body string) error {
+	if m.fail {
+		return errors.New("smtp unavailable")
+	}
+	m.to, m.body = to, body
+	return nil
+}
+
+// TestLoginCodeDelivery 測試登入碼只透過郵件寄送：未設定郵件服務時停用，寄送失敗時可立即重新索取
+func TestLoginCodeDelivery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	if err := db.AutoMigrate(&models.RefreshToken{}, &models.RevokedToken{}, &models.LoginCode{}); err != nil {
+		t.Fatalf("Failed to migrate auth tables: %v", err)
+	}
+	cfg := setupTestConfig(t)
+	cfg.Auth = config.AuthConfig{
+		Provider:        config.AuthProviderLocalJWT,
+		JWTSecret:       "test-secret",
+		TokenExpiry:     1,
+		RefreshExpiry:   24,
+		LoginCodeExpiry: 10,
+	}
+	user := models.User{Email: "deacon@example.com", Name: "Deacon", Role: "user", Status: "approved"}
+	db.Create(&user)
+
+	authHandler := handlers.NewAuthHandler(db, cfg)
+	router := gin.New()
+	router.POST("/api/auth/login", authHandler.Login)
+	router.POST("/api/auth/login/code", authHandler.RequestLoginCode)
+	requestCode := func() (*httptest.ResponseRecorder, tokenResponse) {
+		return postJSON(router, "/api/auth/login/code", "", gin.H{"email": user.Email})
+	}
+
+	if w, resp := requestCode(); w.Code != http.StatusServiceUnavailable || resp.Error.Code != "LOGIN_CODE_UNAVAILABLE" {
+		t.Fatalf("Expected 503 without a mailer, got %d %s", w.Code, w.Body.String())
+	}
+	var issued int64
+	db.Model(&models.LoginCode{}).Count(&issued)
+	if issued != 0 {
+		t.Errorf("Expected no login code issued without a mailer, got %d", issued)
+	}
+
+	mailer := &captureMailer{fail: true}
+	authHandler.SetMailer(mailer)
+	if w, resp := requestCode(); w.Code != http.StatusBadGateway || resp.Error.Code != "LOGIN_CODE_SEND_FAILED" {
+		t.Fatalf("Expected 502 when sending fails, got %d %s", w.Code, w.Body.String())
+	}
+
+	mailer.fail = false
+	w, _ := requestCode()
+	if w.Code != http.StatusOK || mailer.to != user.Email {
+		t.Fatalf("Expected the code mailed right after a failed attempt, got %d %s", w.Code, w.Body.String())
+	}
+	code := regexp.MustCompile(`\d{6}`).FindString(mailer.body)
+	if code == "" || strings.Contains(w.Body.String(), code) {
+		t.Fatalf("Expected the code only in the mail, got body %q response %s", mailer.body, w.Body.String())
+	}
+	if w, _ := postJSON(router, "/api/auth/login", "", gin.H{"email": user.Email, "code": code}); w.Code != http.StatusOK {
+		t.Errorf("Login with the mailed code failed: %d %s", w.Code, w.Body.String())
+	}
+}
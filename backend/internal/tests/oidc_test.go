@@ -0,0 +1,208 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/auth"
+	"memoryark/internal/config"
+	"memoryark/internal/models"
+)
+
+// mockOIDCServer 本地 OIDC 提供者替身，支援 discovery、JWKS 與授權碼 + PKCE
+type mockOIDCServer struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	mu    sync.Mutex
+	codes map[string]mockAuthCode
+}
+
+type mockAuthCode struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockOIDCServer(t *testing.T, clientID string) *mockOIDCServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	m := &mockOIDCServer{key: key, clientID: clientID, codes: map[string]mockAuthCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "mock-key",
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		m.mu.Lock()
+		code, ok := m.codes[r.PostForm.Get("code")]
+		delete(m.codes, r.PostForm.Get("code"))
+		m.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge || r.PostForm.Get("client_id") != clientID {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, code.claims)
+		token.Header["kid"] = "mock-key"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// authorize 模擬用戶在提供者登入後核發授權碼
+func (m *mockOIDCServer) authorize(t *testing.T, authURL string, email string, verified bool) (code, state string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("Invalid authorization URL: %v", err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("Expected PKCE S256 challenge, got %q", u.RawQuery)
+	}
+
+	now := time.Now()
+	code = "code-" + email
+	m.mu.Lock()
+	m.codes[code] = mockAuthCode{
+		challenge: q.Get("code_challenge"),
+		claims: jwt.MapClaims{
+			"iss":            m.server.URL,
+			"aud":            m.clientID,
+			"sub":            "subject-" + email,
+			"email":          email,
+			"email_verified": verified,
+			"name":           "OIDC Member",
+			"nonce":          q.Get("nonce"),
+			"iat":            now.Unix(),
+			"exp":            now.Add(time.Hour).Unix(),
+		},
+	}
+	m.mu.Unlock()
+	return code, q.Get("state")
+}
+
+// TestOIDCLoginFlow 測試 OIDC 授權碼 + PKCE 登入、未註冊用戶建立申請與 state 驗證
+func TestOIDCLoginFlow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	if err := db.AutoMigrate(&models.UserRegistrationRequest{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.OIDCAuthState{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	mock := newMockOIDCServer(t, "memoryark-test")
+	cfg := setupTestConfig(t)
+	cfg.Auth = config.AuthConfig{Provider: config.AuthProviderOIDC, JWTSecret: "test-secret", TokenExpiry: 1, RefreshExpiry: 24}
+	cfg.OIDC = config.OIDCConfig{
+		IssuerURL:            mock.server.URL,
+		ClientID:             "memoryark-test",
+		RedirectURL:          "http://memoryark.test/api/auth/oidc/callback",
+		Scopes:               []string{"openid", "email", "profile"},
+		EmailClaim:           "email",
+		NameClaim:            "name",
+		RequireVerifiedEmail: true,
+		PostLoginRedirect:    "http://memoryark.test/login",
+	}
+
+	db.Create(&models.User{Email: "member@example.com", Name: "Member", Role: "user", Status: "approved"})
+
+	oidcHandler := handlers.NewOIDCHandler(db, cfg)
+	router := gin.New()
+	router.GET("/api/auth/oidc/login", oidcHandler.Login)
+	router.GET("/api/auth/oidc/callback", oidcHandler.Callback)
+
+	// login 導向提供者，callback 帶回授權碼
+	login := func(email string, verified bool, tamperState bool) *url.URL {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil))
+		if w.Code != http.StatusFound {
+			t.Fatalf("Expected redirect to provider, got %d %s", w.Code, w.Body.String())
+		}
+		cookies := w.Result().Cookies()
+		code, state := mock.authorize(t, w.Header().Get("Location"), email, verified)
+		if tamperState {
+			state = "forged-state"
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusFound {
+			t.Fatalf("Expected redirect back to app, got %d %s", w.Code, w.Body.String())
+		}
+		location, _ := url.Parse(w.Header().Get("Location"))
+		return location
+	}
+
+	// 已核准的用戶取得令牌
+	location := login("member@example.com", true, false)
+	fragment, _ := url.ParseQuery(location.Fragment)
+	claims, err := auth.NewSessionManager(db, cfg.Auth).ValidateAccessToken(fragment.Get("access_token"))
+	if err != nil || claims.Email != "member@example.com" {
+		t.Fatalf("Expected valid access token for member, got %v (location %s)", err, location)
+	}
+	if fragment.Get("refresh_token") == "" {
+		t.Errorf("Expected refresh token in fragment")
+	}
+
+	// 未註冊的 email 建立註冊申請
+	location = login("newcomer@example.com", true, false)
+	if location.Query().Get("auth_status") != "registration_pending" {
+		t.Errorf("Expected registration_pending, got %s", location)
+	}
+	var request models.UserRegistrationRequest
+	if err := db.Where("email = ?", "newcomer@example.com").First(&request).Error; err != nil || request.Name != "OIDC Member" {
+		t.Errorf("Expected registration request from OIDC claims, got %+v err=%v", request, err)
+	}
+
+	// email 未驗證
+	if location = login("unverified@example.com", false, false); location.Query().Get("auth_error") != "email_not_allowed" {
+		t.Errorf("Expected email_not_allowed, got %s", location)
+	}
+
+	// state 不符
+	if location = login("member@example.com", true, true); location.Query().Get("auth_error") != "invalid_state" {
+		t.Errorf("Expected invalid_state, got %s", location)
+	}
+}
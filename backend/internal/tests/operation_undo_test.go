@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/database"
+	"memoryark/internal/models"
+)
+
+// TestOperationUndo 測試移動、重新命名、複製與刪除的操作記錄及期限內復原
+func TestOperationUndo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	if err := db.AutoMigrate(&models.Role{}); err != nil {
+		t.Fatalf("Failed to migrate roles: %v", err)
+	}
+	if err := database.InitializeDefaultRoles(db); err != nil {
+		t.Fatalf("Failed to create default roles: %v", err)
+	}
+	cfg := setupTestConfig(t)
+	cfg.Operation.UndoWindow = 60
+
+	user := models.User{Email: "usher@example.com", Name: "Usher", Role: "user", Status: "approved"}
+	db.Create(&user)
+
+	create := func(name string, parentID *uint, isDir bool, virtualPath string) models.File {
+		file := models.File{
+			Name: name, OriginalName: name, ParentID: parentID, IsDirectory: isDir,
+			VirtualPath: virtualPath, UploadedBy: user.ID, FilePath: "blob-" + name,
+		}
+		db.Create(&file)
+		return file
+	}
+	reload := func(file models.File) models.File {
+		var current models.File
+		db.First(&current, file.ID)
+		return current
+	}
+
+	fileHandler := handlers.NewFileHandler(db, cfg)
+	role := user.Role
+	var scopes []string
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("user_role", role)
+		if scopes != nil {
+			c.Set("token_scopes", scopes)
+		}
+		c.Next()
+	})
+	router.DELETE("/api/files/:id", fileHandler.DeleteFile)
+	router.POST("/api/files/copy", fileHandler.CopyFiles)
+	router.POST("/api/files/move", fileHandler.MoveFiles)
+	router.PUT("/api/folders/:id/rename", fileHandler.RenameFile)
+	router.GET("/api/operations", fileHandler.GetFileOperations)
+	router.POST("/api/operations/:id/undo", fileHandler.UndoFileOperation)
+
+	request := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	operationOf := func(w *httptest.ResponseRecorder) uint {
+		if w.Code != http.StatusOK {
+			t.Fatalf("Operation failed: %d %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			OperationID *uint `json:"operationId"`
+			Data        struct {
+				OperationID      *uint `json:"operationId"`
+				SnakeOperationID *uint `json:"operation_id"`
+			} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		for _, id := range []*uint{resp.OperationID, resp.Data.OperationID, resp.Data.SnakeOperationID} {
+			if id != nil {
+				return *id
+			}
+		}
+		t.Fatalf("Response has no operation id: %s", w.Body.String())
+		return 0
+	}
+	undo := func(id uint) *httptest.ResponseRecorder {
+		return request(http.MethodPost, fmt.Sprintf("/api/operations/%d/undo", id), nil)
+	}
+
+	// 重新命名後復原，重複復原返回 409
+	bulletin := create("週報.pdf", nil, false, "/週報.pdf")
+	renameOp := operationOf(request(http.MethodPut, fmt.Sprintf("/api/folders/%d/rename", bulletin.ID), gin.H{"name": "舊週報.pdf"}))
+	if w := undo(renameOp); w.Code != http.StatusOK {
+		t.Fatalf("Undo rename failed: %d %s", w.Code, w.Body.String())
+	}
+	if current := reload(bulletin); current.Name != "週報.pdf" || current.VirtualPath != "/週報.pdf" {
+		t.Errorf("Expected original name, got %+v", current)
+	}
+	if w := undo(renameOp); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for repeated undo, got %d", w.Code)
+	}
+
+	// 項目在操作後又被變更時拒絕復原
+	renameOp = operationOf(request(http.MethodPut, fmt.Sprintf("/api/folders/%d/rename", bulletin.ID), gin.H{"name": "A.pdf"}))
+	operationOf(request(http.MethodPut, fmt.Sprintf("/api/folders/%d/rename", bulletin.ID), gin.H{"name": "B.pdf"}))
+	if w := undo(renameOp); w.Code != http.StatusConflict || reload(bulletin).Name != "B.pdf" {
+		t.Errorf("Expected 409 when item changed since the operation, got %d", w.Code)
+	}
+
+	// 批量移動後復原，子項目的虛擬路徑一併還原
+	archive := create("歸檔", nil, true, "/歸檔")
+	photos := create("相片", nil, true, "/相片")
+	photo := create("聖誕.jpg", &photos.ID, false, "/相片/聖誕.jpg")
+	moveOp := operationOf(request(http.MethodPost, "/api/files/move", gin.H{
+		"file_ids": []uint{photos.ID}, "target_folder_id": archive.ID, "operation_type": "move",
+	}))
+	if current := reload(photos); current.ParentID == nil || *current.ParentID != archive.ID {
+		t.Fatalf("Expected folder moved, got %+v", current)
+	}
+	if w := undo(moveOp); w.Code != http.StatusOK {
+		t.Fatalf("Undo move failed: %d %s", w.Code, w.Body.String())
+	}
+	if current := reload(photos); current.ParentID != nil || current.VirtualPath != "/相片" {
+		t.Errorf("Expected folder back at root, got %+v", current)
+	}
+	if current := reload(photo); current.VirtualPath != "/相片/聖誕.jpg" {
+		t.Errorf("Expected child path restored, got %q", current.VirtualPath)
+	}
+
+	// 刪除後復原，只還原此次刪除的項目
+	oldPhoto := create("舊相片.jpg", &photos.ID, false, "/相片/舊相片.jpg")
+	request(http.MethodDelete, fmt.Sprintf("/api/files/%d", oldPhoto.ID), nil)
+	deleteOp := operationOf(request(http.MethodDelete, fmt.Sprintf("/api/files/%d", photos.ID), nil))
+	if !reload(photo).IsDeleted {
+		t.Fatal("Expected child moved to trash with folder")
+	}
+	if w := undo(deleteOp); w.Code != http.StatusOK {
+		t.Fatalf("Undo delete failed: %d %s", w.Code, w.Body.String())
+	}
+	if reload(photos).IsDeleted || reload(photo).IsDeleted || !reload(oldPhoto).IsDeleted {
+		t.Error("Expected folder and child restored, previously trashed item kept in trash")
+	}
+
+	// 複製後復原，複本移至垃圾桶
+	copyOp := operationOf(request(http.MethodPost, "/api/files/copy", gin.H{
+		"file_ids": []uint{bulletin.ID}, "operation_type": "copy",
+	}))
+	var copies []models.File
+	db.Where("name LIKE ? AND id <> ? AND is_deleted = ?", "B%", bulletin.ID, false).Find(&copies)
+	if len(copies) != 1 {
+		t.Fatalf("Expected one copy, got %d", len(copies))
+	}
+	// 復原複製會刪除複本：唯讀令牌或降級為檢視者後都不能復原自己的操作
+	scopes = []string{models.TokenScopeRead}
+	if w := undo(copyOp); w.Code != http.StatusForbidden || reload(copies[0]).IsDeleted {
+		t.Errorf("Expected 403 for undo with a read-only token, got %d", w.Code)
+	}
+	scopes, role = nil, "viewer"
+	if w := undo(copyOp); w.Code != http.StatusForbidden || reload(copies[0]).IsDeleted {
+		t.Errorf("Expected 403 for undo after demotion to viewer, got %d", w.Code)
+	}
+	role = user.Role
+	if w := undo(copyOp); w.Code != http.StatusOK || !reload(copies[0]).IsDeleted || reload(bulletin).IsDeleted {
+		t.Errorf("Expected copy trashed and original kept, got %d", w.Code)
+	}
+
+	// 超過期限無法復原
+	expiredOp := operationOf(request(http.MethodPut, fmt.Sprintf("/api/folders/%d/rename", archive.ID), gin.H{"name": "典藏"}))
+	db.Model(&models.FileOperation{}).Where("id = ?", expiredOp).Update("expires_at", time.Now().Add(-time.Minute))
+	if w := undo(expiredOp); w.Code != http.StatusGone || reload(archive).Name != "典藏" {
+		t.Errorf("Expected 410 for expired operation, got %d", w.Code)
+	}
+
+	// 操作列表標示是否仍可復原
+	w := request(http.MethodGet, "/api/operations", nil)
+	var list struct {
+		Data struct {
+			Operations []models.FileOperation `json:"operations"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	undoable := 0
+	for _, op := range list.Data.Operations {
+		if op.CanUndo {
+			undoable++
+		}
+	}
+	if len(list.Data.Operations) != 8 || undoable != 3 {
+		t.Errorf("Expected 8 operations with 3 undoable, got %d/%d", len(list.Data.Operations), undoable)
+	}
+
+	// 大型資料夾分批復原，不受單一查詢的參數數量限制
+	large := create("歷年週報", nil, true, "/歷年週報")
+	issues := make([]models.File, 1200)
+	for i := range issues {
+		name := fmt.Sprintf("週報-%04d.pdf", i)
+		issues[i] = models.File{
+			Name: name, OriginalName: name, ParentID: &large.ID,
+			VirtualPath: "/歷年週報/" + name, UploadedBy: user.ID, FilePath: "blob-" + name,
+		}
+	}
+	db.CreateInBatches(&issues, 200)
+	largeOp := operationOf(request(http.MethodDelete, fmt.Sprintf("/api/files/%d", large.ID), nil))
+	if w := undo(largeOp); w.Code != http.StatusOK {
+		t.Fatalf("Undo large delete failed: %d %s", w.Code, w.Body.String())
+	}
+	var trashedIssues int64
+	db.Model(&models.File{}).Where("parent_id = ? AND is_deleted = ?", large.ID, true).Count(&trashedIssues)
+	if reload(large).IsDeleted || trashedIssues != 0 {
+		t.Errorf("Expected the large folder fully restored, %d items still in trash", trashedIssues)
+	}
+}
@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"testing"
+
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+)
+
+// TestTransferOwnership 測試所有權轉移的預覽、子樹範圍與完整轉移
+func TestTransferOwnership(t *testing.T) {
+	db := setupFileTestDB(t)
+
+	from := models.User{Email: "leaving@example.com", Name: "Leaving", Status: "suspended"}
+	to := models.User{Email: "successor@example.com", Name: "Successor", Status: "approved"}
+	db.Create(&from)
+	db.Create(&to)
+
+	root := models.File{Name: "詩班", OriginalName: "詩班", IsDirectory: true, UploadedBy: from.ID}
+	db.Create(&root)
+	child := models.File{Name: "譜.pdf", OriginalName: "譜.pdf", FilePath: "x", ParentID: &root.ID, UploadedBy: from.ID}
+	db.Create(&child)
+	outside := models.File{Name: "其他.pdf", OriginalName: "其他.pdf", FilePath: "y", UploadedBy: from.ID}
+	db.Create(&outside)
+	db.Create(&models.Category{Name: "詩班資料", CreatedBy: from.ID})
+	db.Create(&models.FileShare{FileID: child.ID, SharedBy: from.ID, ShareToken: "t1"})
+	db.Create(&models.ExportJob{JobID: "job-1", UserID: from.ID})
+
+	// 預覽不應修改資料
+	preview, err := services.TransferOwnership(db, services.OwnershipTransferOptions{
+		FromUserID: from.ID, ToUserID: to.ID, DryRun: true,
+	})
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if preview.Files != 2 || preview.Folders != 1 || preview.Categories != 1 || preview.FileShares != 1 || preview.ExportJobs != 1 {
+		t.Errorf("Unexpected preview counts: %+v", preview)
+	}
+	var stillOwned int64
+	db.Model(&models.File{}).Where("uploaded_by = ?", from.ID).Count(&stillOwned)
+	if stillOwned != 3 {
+		t.Errorf("Dry run should not modify files, %d still owned", stillOwned)
+	}
+	var logs int64
+	db.Model(&models.ActivityLog{}).Where("action = ?", "transfer_ownership").Count(&logs)
+	if logs != 0 {
+		t.Errorf("Dry run should not write an activity log, got %d", logs)
+	}
+
+	// 子樹轉移只影響資料夾內的項目
+	result, err := services.TransferOwnership(db, services.OwnershipTransferOptions{
+		FromUserID: from.ID, ToUserID: to.ID, FolderID: &root.ID, ActorID: to.ID,
+	})
+	if err != nil {
+		t.Fatalf("Subtree transfer failed: %v", err)
+	}
+	if result.Files != 1 || result.Folders != 1 || result.FileShares != 1 || result.Categories != 0 {
+		t.Errorf("Unexpected subtree counts: %+v", result)
+	}
+	db.First(&outside, outside.ID)
+	if outside.UploadedBy != from.ID {
+		t.Errorf("File outside subtree should keep its owner")
+	}
+	var entry models.ActivityLog
+	if err := db.Where("action = ? AND resource_id = ?", "transfer_ownership", from.ID).First(&entry).Error; err != nil {
+		t.Errorf("Transfer should be recorded with the data change: %v", err)
+	} else if entry.UserID != to.ID {
+		t.Errorf("Activity log should record the actor, got user %d", entry.UserID)
+	}
+
+	// 完整轉移
+	if _, err := services.TransferOwnership(db, services.OwnershipTransferOptions{
+		FromUserID: from.ID, ToUserID: to.ID,
+	}); err != nil {
+		t.Fatalf("Full transfer failed: %v", err)
+	}
+	db.Model(&models.File{}).Where("uploaded_by = ?", from.ID).Count(&stillOwned)
+	var category models.Category
+	db.First(&category)
+	if stillOwned != 0 || category.CreatedBy != to.ID {
+		t.Errorf("Full transfer left resources behind: files=%d category owner=%d", stillOwned, category.CreatedBy)
+	}
+
+	if _, err := services.TransferOwnership(db, services.OwnershipTransferOptions{
+		FromUserID: to.ID, ToUserID: to.ID,
+	}); err != services.ErrSameOwner {
+		t.Errorf("Expected ErrSameOwner, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/auth"
+	"memoryark/internal/database"
+	"memoryark/internal/middleware"
+	"memoryark/internal/models"
+)
+
+// TestRoleHasPermission 測試角色權限與萬用字元比對
+func TestRoleHasPermission(t *testing.T) {
+	roles := map[string]models.Role{}
+	for _, role := range models.DefaultRoles() {
+		roles[role.Name] = role
+	}
+
+	cases := []struct {
+		role       string
+		permission string
+		expected   bool
+	}{
+		{"admin", models.PermRolesManage, true},
+		{"editor", models.PermFilesDeletePermanent, true},
+		{"editor", models.PermUsersApprove, false},
+		{"user", models.PermFilesUpload, true},
+		{"user", models.PermFilesDeletePermanent, false},
+		{"viewer", models.PermFilesUpload, false},
+		{"viewer", models.PermFilesPersonalize, true},
+		{"viewer", models.PermFilesComment, false},
+		{"uploader", models.PermFilesUpload, true},
+		{"line-moderator", models.PermLineManage, true},
+		{"line-moderator", models.PermTrashEmpty, false},
+		{"admin", models.PermLogsManage, true},
+		{"editor", models.PermLogsManage, false},
+	}
+
+	for _, tc := range cases {
+		role := roles[tc.role]
+		if got := role.HasPermission(tc.permission); got != tc.expected {
+			t.Errorf("%s.HasPermission(%s) = %v, expected %v", tc.role, tc.permission, got, tc.expected)
+		}
+	}
+
+	if !models.IsKnownPermission("files.*") || models.IsKnownPermission("files.fly") {
+		t.Errorf("IsKnownPermission should accept wildcards and reject unknown names")
+	}
+}
+
+// TestRequirePermissionMiddleware 測試權限中間件依資料庫角色放行或拒絕
+func TestRequirePermissionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	if err := db.AutoMigrate(&models.Role{}); err != nil {
+		t.Fatalf("Failed to migrate roles: %v", err)
+	}
+	if err := database.InitializeDefaultRoles(db); err != nil {
+		t.Fatalf("Failed to seed roles: %v", err)
+	}
+	auth.InvalidateRoleCache()
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_role", c.GetHeader("X-Test-Role"))
+		c.Next()
+	})
+	router.DELETE("/files/:id/permanent", middleware.RequirePermission(db, models.PermFilesDeletePermanent), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	cases := map[string]int{
+		"admin":   http.StatusOK,
+		"editor":  http.StatusOK,
+		"user":    http.StatusForbidden,
+		"viewer":  http.StatusForbidden,
+		"unknown": http.StatusForbidden,
+	}
+	for role, expected := range cases {
+		req := httptest.NewRequest(http.MethodDelete, "/files/1/permanent", nil)
+		req.Header.Set("X-Test-Role", role)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != expected {
+			t.Errorf("role %s: expected %d, got %d", role, expected, w.Code)
+		}
+	}
+}
+
+// TestUpdateUserRoleEscalation 測試只有用戶管理權限時不能指派或調整超出自己權限的角色與狀態，也不能停用最後一位管理員
+func TestUpdateUserRoleEscalation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	if err := db.AutoMigrate(&models.Role{}); err != nil {
+		t.Fatalf("Failed to migrate roles: %v", err)
+	}
+	if err := database.InitializeDefaultRoles(db); err != nil {
+		t.Fatalf("Failed to seed roles: %v", err)
+	}
+	db.Create(&models.Role{Name: "user-manager", DisplayName: "用戶管理", Permissions: models.StringList{
+		models.PermUsersManage, models.PermFilesRead, models.PermFilesPersonalize, models.PermFilesUpload,
+	}})
+	db.Create(&models.Role{Name: "role-manager", DisplayName: "角色管理", Permissions: models.StringList{
+		models.PermUsersManage, models.PermRolesManage,
+	}})
+	auth.InvalidateRoleCache()
+
+	manager := models.User{Email: "clerk@example.com", Name: "Clerk", Role: "user-manager", Status: "approved"}
+	admin := models.User{Email: "pastor@example.com", Name: "Pastor", Role: "admin", Status: "approved"}
+	member := models.User{Email: "member@example.com", Name: "Member", Role: "viewer", Status: "approved"}
+	steward := models.User{Email: "steward@example.com", Name: "Steward", Role: "role-manager", Status: "approved"}
+	for _, user := range []*models.User{&manager, &admin, &member, &steward} {
+		db.Create(user)
+	}
+
+	adminHandler := handlers.NewAdminHandler(db, setupTestConfig(t))
+	current := manager
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", current.ID)
+		c.Set("user_role", current.Role)
+		c.Next()
+	})
+	router.PUT("/api/admin/users/:id/role", adminHandler.UpdateUserRole)
+	router.PUT("/api/admin/users/:id/status", adminHandler.UpdateUserStatus)
+	put := func(user models.User, field, value string) int {
+		body := fmt.Sprintf(`{%q:%q}`, field, value)
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/%s", user.ID, field), bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	setRole := func(user models.User, role string) int { return put(user, "role", role) }
+	setStatus := func(user models.User, status string) int { return put(user, "status", status) }
+
+	cases := []struct {
+		user     models.User
+		role     string
+		expected int
+	}{
+		{member, "uploader", http.StatusOK},      // 權限範圍內
+		{member, "user", http.StatusForbidden},   // 目標角色有自己沒有的權限
+		{manager, "admin", http.StatusForbidden}, // 不能提升自己
+		{admin, "viewer", http.StatusForbidden},  // 不能調整權限比自己高的用戶
+	}
+	for _, tc := range cases {
+		if code := setRole(tc.user, tc.role); code != tc.expected {
+			t.Errorf("%s -> %s: expected %d, got %d", tc.user.Email, tc.role, tc.expected, code)
+		}
+	}
+
+	// 狀態：不能停用權限比自己高的用戶，也不能變更自己的狀態
+	if code := setStatus(admin, "suspended"); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for suspending an admin, got %d", code)
+	}
+	if code := setStatus(manager, "suspended"); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for changing own status, got %d", code)
+	}
+	if code := setStatus(member, "suspended"); code != http.StatusOK {
+		t.Errorf("Expected manager to suspend a viewer, got %d", code)
+	}
+
+	// 具備角色管理權限時可以指派任何角色，但不能停用或降級最後一位管理員
+	current = steward
+	if code := setStatus(admin, "suspended"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for suspending the last admin, got %d", code)
+	}
+	if code := setRole(admin, "viewer"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for demoting the last admin, got %d", code)
+	}
+	current = admin
+	if code := setRole(member, "editor"); code != http.StatusOK {
+		t.Errorf("Expected admin to assign editor, got %d", code)
+	}
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/models"
+)
+
+// TestRestoreFromTrash 測試還原時重建上層資料夾、衝突處理方式與指定還原位置
+func TestRestoreFromTrash(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	cfg := setupTestConfig(t)
+
+	user := models.User{Email: "deacon@example.com", Name: "Deacon", Status: "approved"}
+	db.Create(&user)
+
+	now := time.Now()
+	create := func(name string, parentID *uint, isDir, deleted bool, virtualPath string) models.File {
+		file := models.File{
+			Name: name, OriginalName: name, ParentID: parentID, IsDirectory: isDir,
+			VirtualPath: virtualPath, UploadedBy: user.ID, FilePath: "blob-" + name,
+		}
+		if deleted {
+			file.IsDeleted = true
+			file.DeletedAt = &now
+			file.DeletedBy = &user.ID
+		}
+		db.Create(&file)
+		return file
+	}
+
+	fileHandler := handlers.NewFileHandler(db, cfg)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Next()
+	})
+	router.POST("/api/files/:id/restore", fileHandler.RestoreFile)
+	router.POST("/api/trash/restore", fileHandler.BatchRestoreFiles)
+
+	type restoreResponse struct {
+		Data struct {
+			RestoredCount int                       `json:"restoredCount"`
+			SkippedCount  int                       `json:"skippedCount"`
+			Items         []handlers.RestoreOutcome `json:"items"`
+		} `json:"data"`
+	}
+	post := func(path string, body interface{}) restoreResponse {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s failed: %d %s", path, w.Code, w.Body.String())
+		}
+		var resp restoreResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+	statuses := func(resp restoreResponse) map[string]int {
+		counts := map[string]int{}
+		for _, item := range resp.Data.Items {
+			counts[item.Status]++
+		}
+		return counts
+	}
+	reload := func(file models.File) models.File {
+		db.First(&file, file.ID)
+		return file
+	}
+
+	// 上層資料夾在垃圾桶中：只還原上層資料夾本身，其他子項目留在垃圾桶
+	ministry := create("事工", nil, true, true, "/事工")
+	youth := create("青年", &ministry.ID, true, true, "/事工/青年")
+	plan := create("計畫.pdf", &youth.ID, false, true, "/事工/青年/計畫.pdf")
+	sibling := create("預算.pdf", &youth.ID, false, true, "/事工/青年/預算.pdf")
+
+	resp := post(fmt.Sprintf("/api/files/%d/restore", plan.ID), nil)
+	if counts := statuses(resp); counts[handlers.RestoreStatusAncestorRestored] != 2 || counts[handlers.RestoreStatusRestored] != 1 {
+		t.Errorf("Unexpected outcomes: %+v", resp.Data.Items)
+	}
+	if reload(ministry).IsDeleted || reload(youth).IsDeleted || reload(plan).IsDeleted || !reload(sibling).IsDeleted {
+		t.Error("Expected ancestors and the file to be restored, sibling to stay in trash")
+	}
+
+	// 上層資料夾已永久刪除：依虛擬路徑重建
+	orphan := create("講章.pdf", nil, false, true, "/講道/2026/講章.pdf")
+	missingParent := uint(99999)
+	db.Model(&orphan).Update("parent_id", missingParent)
+	resp = post(fmt.Sprintf("/api/files/%d/restore", orphan.ID), nil)
+	if counts := statuses(resp); counts[handlers.RestoreStatusAncestorCreated] != 2 {
+		t.Errorf("Expected 2 recreated folders, got %+v", resp.Data.Items)
+	}
+	orphan = reload(orphan)
+	if orphan.IsDeleted || orphan.VirtualPath != "/講道/2026/講章.pdf" {
+		t.Errorf("Unexpected restored orphan: %+v", orphan)
+	}
+
+	// 名稱衝突：skip 留在垃圾桶、rename 重新命名、overwrite 將既有項目移至垃圾桶
+	old := create("週報.pdf", nil, false, true, "/週報.pdf")
+	current := create("週報.pdf", nil, false, false, "/週報.pdf")
+
+	resp = post(fmt.Sprintf("/api/files/%d/restore", old.ID), gin.H{"conflict": "skip"})
+	if resp.Data.SkippedCount != 1 || !reload(old).IsDeleted {
+		t.Errorf("Expected skip, got %+v", resp.Data.Items)
+	}
+
+	resp = post(fmt.Sprintf("/api/files/%d/restore", old.ID), gin.H{"conflict": "overwrite"})
+	if item := resp.Data.Items[0]; item.Status != handlers.RestoreStatusOverwritten || item.ReplacedID == nil || *item.ReplacedID != current.ID {
+		t.Errorf("Expected overwrite, got %+v", resp.Data.Items)
+	}
+	if reload(old).IsDeleted || !reload(current).IsDeleted {
+		t.Error("Overwrite should move the existing file to trash")
+	}
+
+	resp = post(fmt.Sprintf("/api/files/%d/restore", current.ID), nil)
+	if item := resp.Data.Items[0]; item.Status != handlers.RestoreStatusRenamed || item.NewName != "週報 (1).pdf" {
+		t.Errorf("Expected rename by default, got %+v", resp.Data.Items)
+	}
+
+	// 批量還原到指定資料夾，每個項目各自回報結果
+	target := create("整理", nil, true, false, "/整理")
+	resp = post("/api/trash/restore", gin.H{"file_ids": []uint{sibling.ID, 424242}, "target_folder_id": target.ID})
+	if resp.Data.RestoredCount != 1 || len(resp.Data.Items) != 2 || resp.Data.Items[1].Status != handlers.RestoreStatusFailed {
+		t.Errorf("Unexpected batch outcomes: %+v", resp.Data.Items)
+	}
+	if sibling = reload(sibling); sibling.ParentID == nil || *sibling.ParentID != target.ID || sibling.VirtualPath != "/整理/預算.pdf" {
+		t.Errorf("Expected sibling restored into target folder, got %+v", sibling)
+	}
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/auth"
+	"memoryark/internal/database"
+	"memoryark/internal/middleware"
+	"memoryark/internal/models"
+)
+
+// TestServiceTokenRegistry 測試服務令牌的範圍、IP 允許清單、輪替重疊期與使用統計
+func TestServiceTokenRegistry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	if err := db.AutoMigrate(&models.ServiceToken{}, &models.PersonalAccessToken{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	// 舊版環境變數中的令牌會被匯入
+	cfg := setupTestConfig(t)
+	cfg.API.LineServiceToken = "legacy-line-token"
+	if err := database.InitializeServiceTokens(db, cfg); err != nil {
+		t.Fatalf("Failed to import legacy token: %v", err)
+	}
+
+	router := gin.New()
+	apiRoutes := router.Group("/api/api-access", middleware.APITokenMiddleware(cfg, db))
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"client": c.GetString("api_client")}) }
+	apiRoutes.POST("/files/upload", middleware.RequireClientAccess(db, models.ServiceScopeFilesUpload, models.PermFilesUpload), ok)
+	apiRoutes.POST("/line/users", middleware.RequireClientAccess(db, models.ServiceScopeLineUsers), ok)
+
+	call := func(path, token, ip string) int {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.RemoteAddr = ip + ":12345"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := call("/api/api-access/line/users", "legacy-line-token", "10.0.0.5"); code != http.StatusOK {
+		t.Fatalf("Expected imported legacy token to work, got %d", code)
+	}
+	if code := call("/api/api-access/line/users", "wrong-token", "10.0.0.5"); code != http.StatusUnauthorized {
+		t.Errorf("Expected unknown token to be rejected, got %d", code)
+	}
+
+	// 只有上傳範圍、限制來源 IP 的令牌
+	raw, _ := auth.GenerateServiceToken()
+	token := models.ServiceToken{
+		ClientName: "nightly-sync",
+		TokenHash:  auth.HashToken(raw),
+		Scopes:     models.StringList{models.ServiceScopeFilesUpload},
+		AllowedIPs: models.StringList{"192.168.1.0/24"},
+		IsActive:   true,
+	}
+	db.Create(&token)
+
+	if code := call("/api/api-access/files/upload", raw, "192.168.1.20"); code != http.StatusOK {
+		t.Errorf("Expected scoped token from allowed IP to work, got %d", code)
+	}
+	if code := call("/api/api-access/files/upload", raw, "10.0.0.5"); code != http.StatusForbidden {
+		t.Errorf("Expected disallowed IP to be rejected, got %d", code)
+	}
+	if code := call("/api/api-access/line/users", raw, "192.168.1.20"); code != http.StatusForbidden {
+		t.Errorf("Expected out-of-scope endpoint to be rejected, got %d", code)
+	}
+
+	db.First(&token, token.ID)
+	if token.UseCount != 2 || token.LastUsedAt == nil || token.LastUsedIP != "192.168.1.20" {
+		t.Errorf("Unexpected usage stats: count=%d ip=%q", token.UseCount, token.LastUsedIP)
+	}
+
+	// 輪替：重疊期間新舊令牌都可用，過期後舊令牌失效
+	rotated, _ := auth.GenerateServiceToken()
+	overlapEnd := time.Now().Add(time.Hour)
+	db.Model(&token).Updates(map[string]interface{}{
+		"previous_token_hash": token.TokenHash,
+		"previous_expires_at": overlapEnd,
+		"token_hash":          auth.HashToken(rotated),
+	})
+	for _, candidate := range []string{raw, rotated} {
+		if code := call("/api/api-access/files/upload", candidate, "192.168.1.20"); code != http.StatusOK {
+			t.Errorf("Expected token to work during overlap, got %d", code)
+		}
+	}
+
+	db.Model(&token).Update("previous_expires_at", time.Now().Add(-time.Minute))
+	if code := call("/api/api-access/files/upload", raw, "192.168.1.20"); code != http.StatusUnauthorized {
+		t.Errorf("Expected old token to expire after overlap, got %d", code)
+	}
+}
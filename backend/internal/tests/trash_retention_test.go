@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/models"
+	"memoryark/internal/services"
+)
+
+// TestTrashRetentionPurge 測試垃圾桶過期項目自動永久刪除、法律保全豁免與共用實體檔案的保留
+func TestTrashRetentionPurge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	cfg := setupTestConfig(t)
+	cfg.Trash.RetentionDays = 30
+
+	user := models.User{Email: "secretary@example.com", Name: "Secretary", Status: "approved"}
+	db.Create(&user)
+
+	writeBlob := func(name string) string {
+		path := filepath.Join(cfg.Upload.UploadPath, name)
+		os.WriteFile(path, []byte(name), 0644)
+		return path
+	}
+	now := time.Now()
+	expired := now.AddDate(0, 0, -40)
+	recent := now.AddDate(0, 0, -5)
+	trashed := func(file models.File, deletedAt *time.Time) models.File {
+		file.OriginalName = file.Name
+		file.UploadedBy = user.ID
+		file.IsDeleted = true
+		file.DeletedAt = deletedAt
+		db.Create(&file)
+		return file
+	}
+
+	heldCategory := models.Category{Name: "會議記錄", CreatedBy: user.ID, LegalHold: true}
+	db.Create(&heldCategory)
+
+	sharedBlob := writeBlob("shared")
+	uniqueBlob := writeBlob("unique")
+	db.Create(&models.File{Name: "副本.pdf", OriginalName: "副本.pdf", FilePath: sharedBlob, UploadedBy: user.ID})
+
+	plain := trashed(models.File{Name: "舊週報.pdf", FilePath: uniqueBlob}, &expired)
+	shared := trashed(models.File{Name: "共用.pdf", FilePath: sharedBlob}, &expired)
+	folder := trashed(models.File{Name: "舊資料夾", IsDirectory: true}, &expired)
+	child := trashed(models.File{Name: "子檔案.pdf", FilePath: writeBlob("child"), ParentID: &folder.ID}, &expired)
+	heldFolder := trashed(models.File{Name: "理事會", IsDirectory: true, LegalHold: true}, &expired)
+	heldChild := trashed(models.File{Name: "決議.pdf", FilePath: writeBlob("held"), ParentID: &heldFolder.ID}, &expired)
+	categorized := trashed(models.File{Name: "紀錄.pdf", FilePath: writeBlob("minutes"), CategoryID: &heldCategory.ID}, &expired)
+	fresh := trashed(models.File{Name: "新.pdf", FilePath: writeBlob("fresh")}, &recent)
+	legacy := trashed(models.File{Name: "無刪除時間.pdf", FilePath: writeBlob("legacy")}, nil)
+
+	result, err := services.PurgeExpiredTrash(db, cfg.Trash.RetentionDays, now)
+	if err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if result.Purged != 4 || result.Held != 3 || result.Failed != 0 {
+		t.Errorf("Unexpected purge result: %+v", result)
+	}
+
+	exists := func(id uint) bool {
+		var count int64
+		db.Model(&models.File{}).Where("id = ?", id).Count(&count)
+		return count > 0
+	}
+	for _, file := range []models.File{plain, shared, folder, child} {
+		if exists(file.ID) {
+			t.Errorf("Expired item %q should be purged", file.Name)
+		}
+	}
+	for _, file := range []models.File{heldFolder, heldChild, categorized, fresh, legacy} {
+		if !exists(file.ID) {
+			t.Errorf("Item %q should be kept", file.Name)
+		}
+	}
+	if _, err := os.Stat(uniqueBlob); !os.IsNotExist(err) {
+		t.Errorf("Unreferenced blob should be removed")
+	}
+	if _, err := os.Stat(sharedBlob); err != nil {
+		t.Errorf("Blob still referenced by another file should be kept: %v", err)
+	}
+	db.First(&legacy, legacy.ID)
+	if legacy.DeletedAt == nil {
+		t.Error("Trashed item without deletion time should start its retention period now")
+	}
+
+	// 清理期間被還原的項目不會被永久刪除，實體檔案保留
+	first := trashed(models.File{Name: "先.pdf", FilePath: writeBlob("first")}, &expired)
+	restoredBlob := writeBlob("restored")
+	restored := trashed(models.File{Name: "已還原.pdf", FilePath: restoredBlob}, &expired)
+	result, err = services.PurgeTrashWithProgress(db, &recent, 0, func(result *services.TrashPurgeResult, total int) bool {
+		db.Model(&models.File{}).Where("id = ?", restored.ID).Update("is_deleted", false)
+		return true
+	})
+	if err != nil || result.Purged != 1 || result.Failed != 0 || exists(first.ID) || !exists(restored.ID) {
+		t.Errorf("Expected only the still-trashed item purged, got %+v (err=%v)", result, err)
+	}
+	if _, err := os.Stat(restoredBlob); err != nil {
+		t.Errorf("Restored item's blob should be kept: %v", err)
+	}
+
+	fileHandler := handlers.NewFileHandler(db, cfg)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Next()
+	})
+	router.GET("/api/trash", fileHandler.GetTrash)
+	router.DELETE("/api/files/:id/permanent", fileHandler.PermanentDeleteFile)
+
+	// 垃圾桶列表顯示預計刪除日期，受保全的項目不顯示
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/trash", nil))
+	var resp struct {
+		Data struct {
+			Files []models.File `json:"files"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	items := map[uint]models.File{}
+	for _, file := range resp.Data.Files {
+		items[file.ID] = file
+	}
+	if item := items[fresh.ID]; item.PurgesAt == nil || !item.PurgesAt.Equal(recent.AddDate(0, 0, 30)) {
+		t.Errorf("Expected purge date 30 days after deletion, got %v", item.PurgesAt)
+	}
+	if item := items[categorized.ID]; !item.OnLegalHold || item.PurgesAt != nil {
+		t.Errorf("Category hold should be reported without purge date: %+v", item)
+	}
+
+	// 受保全的資料夾不能手動永久刪除
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/files/%d/permanent", heldFolder.ID), nil))
+	if w.Code != http.StatusConflict || !exists(heldChild.ID) {
+		t.Errorf("Expected 409 for folder on legal hold, got %d", w.Code)
+	}
+}
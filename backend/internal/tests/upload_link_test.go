@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/config"
+	"memoryark/internal/models"
+)
+
+// setupFileTestDB 設置檔案相關測試資料庫
+func setupFileTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.File{},
+		&models.FileVersion{},
+		&models.FileOperation{},
+		&models.Job{},
+		&models.UserFileState{},
+		&models.FileLike{},
+		&models.FileComment{},
+		&models.FileCommentMention{},
+		&models.FolderTemplate{},
+		&models.Category{},
+		&models.UploadLink{},
+		&models.FileShare{},
+		&models.ExportJob{},
+		&models.ActivityLog{},
+		&models.LineUploadRecord{},
+		&models.LineUser{},
+	); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+// setupTestConfig 建立使用暫存目錄的測試設定
+func setupTestConfig(t *testing.T) *config.Config {
+	cfg := &config.Config{}
+	cfg.Upload.UploadPath = t.TempDir()
+	return cfg
+}
+
+// guestUploadRequest 建立訪客上傳的 multipart 請求
+func guestUploadRequest(t *testing.T, token, guestName, password, fileName string, content []byte) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("guest_name", guestName)
+	if password != "" {
+		writer.WriteField("password", password)
+	}
+	part, err := writer.CreateFormFile("file", fileName)
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	part.Write(content)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/public/upload/"+token, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+// TestGuestUploadLink 測試訪客上傳連結的建立、密碼、審核與數量限制
+func TestGuestUploadLink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	cfg := setupTestConfig(t)
+
+	owner := models.User{Email: "owner@example.com", Name: "Owner", Role: "user", Status: "approved"}
+	db.Create(&owner)
+	folder := models.File{Name: "活動照片", OriginalName: "活動照片", VirtualPath: "/活動照片", IsDirectory: true, UploadedBy: owner.ID}
+	db.Create(&folder)
+
+	fileHandler := handlers.NewFileHandler(db, cfg)
+	linkHandler := handlers.NewUploadLinkHandler(db, cfg, fileHandler)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", owner.ID)
+		c.Set("user_role", owner.Role)
+		c.Next()
+	})
+	router.POST("/api/upload-links", linkHandler.CreateUploadLink)
+	router.GET("/api/files", fileHandler.GetFiles)
+	router.POST("/api/public/upload/:token", linkHandler.GuestUpload)
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"folder_id":      folder.ID,
+		"password":       "photo2024",
+		"max_files":      1,
+		"require_review": true,
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/upload-links", bytes.NewReader(payload)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 when creating link, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var link models.UploadLink
+	if err := db.First(&link).Error; err != nil {
+		t.Fatalf("Upload link not stored: %v", err)
+	}
+	if link.PasswordHash == "" || link.PasswordHash == "photo2024" {
+		t.Errorf("Password should be stored hashed")
+	}
+
+	// 密碼錯誤
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, guestUploadRequest(t, link.Token, "攝影師小王", "wrong", "photo.jpg", []byte("image-data")))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for wrong password, got %d", w.Code)
+	}
+
+	// 成功上傳，歸屬於連結建立者並等待審核
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, guestUploadRequest(t, link.Token, "攝影師小王", "photo2024", "photo.jpg", []byte("image-data")))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 for guest upload, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var uploaded models.File
+	if err := db.Where("name = ?", "photo.jpg").First(&uploaded).Error; err != nil {
+		t.Fatalf("Guest upload not stored: %v", err)
+	}
+	if uploaded.UploadedBy != owner.ID {
+		t.Errorf("Expected upload attributed to %d, got %d", owner.ID, uploaded.UploadedBy)
+	}
+	if uploaded.GuestName != "攝影師小王" || uploaded.Tags != "guest:攝影師小王" {
+		t.Errorf("Expected guest name tag, got name=%q tags=%q", uploaded.GuestName, uploaded.Tags)
+	}
+	if uploaded.ReviewStatus != models.ReviewStatusPending {
+		t.Errorf("Expected pending review status, got %q", uploaded.ReviewStatus)
+	}
+
+	// 待審核的檔案不應出現在檔案列表
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/files?parent_id=%d", folder.ID), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 when listing files, got %d", w.Code)
+	}
+	var listResp struct {
+		Data struct {
+			Files []models.File `json:"files"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &listResp)
+	if len(listResp.Data.Files) != 0 {
+		t.Errorf("Pending guest uploads should be hidden, got %d files", len(listResp.Data.Files))
+	}
+
+	// 超過檔案數量限制
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, guestUploadRequest(t, link.Token, "攝影師小王", "photo2024", "photo2.jpg", []byte("other-data")))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 when limit reached, got %d", w.Code)
+	}
+}
@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"memoryark/internal/api/handlers"
+	"memoryark/internal/models"
+)
+
+// TestUserFileState 測試每位用戶各自的星號、釘選資料夾與最近項目，以及刪除檔案時的清理
+func TestUserFileState(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	cfg := setupTestConfig(t)
+
+	user := models.User{Email: "choir@example.com", Name: "Choir", Status: "approved"}
+	other := models.User{Email: "pianist@example.com", Name: "Pianist", Status: "approved"}
+	db.Create(&user)
+	db.Create(&other)
+
+	create := func(name string, parentID *uint, isDir bool, uploadedBy uint, createdAt time.Time) models.File {
+		path := filepath.Join(cfg.Upload.UploadPath, name)
+		if !isDir {
+			os.WriteFile(path, []byte(name), 0644)
+		}
+		file := models.File{
+			Name: name, OriginalName: name, ParentID: parentID, IsDirectory: isDir, VirtualPath: "/" + name,
+			UploadedBy: uploadedBy, FilePath: path, MimeType: "text/plain", CreatedAt: createdAt,
+		}
+		db.Create(&file)
+		return file
+	}
+
+	fileHandler := handlers.NewFileHandler(db, cfg)
+	currentUser := user.ID
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", currentUser)
+		c.Next()
+	})
+	router.GET("/api/files/starred", fileHandler.GetStarredFiles)
+	router.GET("/api/files/recent", fileHandler.GetRecentFiles)
+	router.PUT("/api/files/:id/star", fileHandler.StarFile)
+	router.DELETE("/api/files/:id/star", fileHandler.UnstarFile)
+	router.GET("/api/files/:id/download", fileHandler.DownloadFile)
+	router.GET("/api/files/:id/preview", fileHandler.PreviewFile)
+	router.DELETE("/api/files/:id", fileHandler.DeleteFile)
+	router.POST("/api/files/:id/restore", fileHandler.RestoreFile)
+	router.DELETE("/api/files/:id/permanent", fileHandler.PermanentDeleteFile)
+	router.GET("/api/folders/pinned", fileHandler.GetPinnedFolders)
+	router.PUT("/api/folders/pinned/order", fileHandler.ReorderPinnedFolders)
+	router.PUT("/api/folders/:id/pin", fileHandler.PinFolder)
+	router.DELETE("/api/folders/:id/pin", fileHandler.UnpinFolder)
+
+	request := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	list := func(path string) []models.UserFileState {
+		w := request(http.MethodGet, path, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s failed: %d %s", path, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data []models.UserFileState `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Data
+	}
+	ids := func(states []models.UserFileState) []uint {
+		result := []uint{}
+		for _, state := range states {
+			result = append(result, state.FileID)
+		}
+		return result
+	}
+
+	past := time.Now().Add(-time.Hour)
+	worship := create("敬拜", nil, true, user.ID, past)
+	youth := create("青年", nil, true, user.ID, past)
+	hymn := create("詩歌.txt", &worship.ID, false, other.ID, past)
+	score := create("樂譜.txt", &worship.ID, false, other.ID, past)
+	mine := create("練習.txt", &youth.ID, false, user.ID, past.Add(time.Minute))
+
+	// 星號只屬於加上星號的用戶
+	request(http.MethodPut, fmt.Sprintf("/api/files/%d/star", hymn.ID), nil)
+	request(http.MethodPut, fmt.Sprintf("/api/files/%d/star", worship.ID), nil)
+	if got := ids(list("/api/files/starred")); len(got) != 2 || got[0] != worship.ID {
+		t.Errorf("Expected 2 starred items newest first, got %v", got)
+	}
+	currentUser = other.ID
+	if got := list("/api/files/starred"); len(got) != 0 {
+		t.Errorf("Stars should be per user, got %v", ids(got))
+	}
+	currentUser = user.ID
+	request(http.MethodDelete, fmt.Sprintf("/api/files/%d/star", worship.ID), nil)
+	if got := ids(list("/api/files/starred")); len(got) != 1 || got[0] != hymn.ID {
+		t.Errorf("Expected only hymn starred, got %v", got)
+	}
+
+	// 最近項目：下載、預覽與自己上傳的檔案，依時間由新到舊
+	request(http.MethodGet, fmt.Sprintf("/api/files/%d/download", score.ID), nil)
+	request(http.MethodGet, fmt.Sprintf("/api/files/%d/preview", hymn.ID), nil)
+	recent := list("/api/files/recent")
+	if got := ids(recent); len(got) != 3 || got[0] != hymn.ID || got[1] != score.ID || got[2] != mine.ID {
+		t.Fatalf("Unexpected recent order: %v", got)
+	}
+	if recent[0].LastAction != models.FileAccessPreview || recent[2].LastAction != models.FileAccessUpload || recent[0].File == nil {
+		t.Errorf("Unexpected recent actions: %+v", recent)
+	}
+	currentUser = other.ID
+	if got := ids(list("/api/files/recent")); len(got) != 2 {
+		t.Errorf("Expected other user's recents to be their own uploads only, got %v", got)
+	}
+	currentUser = user.ID
+
+	// 釘選資料夾與排序；檔案不能釘選
+	request(http.MethodPut, fmt.Sprintf("/api/folders/%d/pin", worship.ID), nil)
+	request(http.MethodPut, fmt.Sprintf("/api/folders/%d/pin", youth.ID), nil)
+	if w := request(http.MethodPut, fmt.Sprintf("/api/folders/%d/pin", hymn.ID), nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when pinning a file, got %d", w.Code)
+	}
+	if got := ids(list("/api/folders/pinned")); len(got) != 2 || got[0] != worship.ID {
+		t.Errorf("Expected pins in order, got %v", got)
+	}
+	request(http.MethodPut, "/api/folders/pinned/order", gin.H{"folder_ids": []uint{youth.ID}})
+	if got := ids(list("/api/folders/pinned")); len(got) != 2 || got[0] != youth.ID {
+		t.Errorf("Expected reordered pins, got %v", got)
+	}
+
+	// 垃圾桶中的項目不顯示，還原後重新出現；永久刪除時清除個人狀態
+	request(http.MethodDelete, fmt.Sprintf("/api/files/%d", hymn.ID), nil)
+	if got := list("/api/files/starred"); len(got) != 0 {
+		t.Errorf("Trashed items should be hidden, got %v", ids(got))
+	}
+	request(http.MethodPost, fmt.Sprintf("/api/files/%d/restore", hymn.ID), nil)
+	if got := list("/api/files/starred"); len(got) != 1 {
+		t.Errorf("Restored item should be starred again, got %v", ids(got))
+	}
+	request(http.MethodDelete, fmt.Sprintf("/api/files/%d", hymn.ID), nil)
+	if w := request(http.MethodDelete, fmt.Sprintf("/api/files/%d/permanent", hymn.ID), nil); w.Code != http.StatusOK {
+		t.Fatalf("Permanent delete failed: %d %s", w.Code, w.Body.String())
+	}
+	var remaining int64
+	db.Model(&models.UserFileState{}).Where("file_id = ?", hymn.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("Expected personal state removed with the file, got %d", remaining)
+	}
+}
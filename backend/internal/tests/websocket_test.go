@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gorillaws "github.com/gorilla/websocket"
+
+	"memoryark/internal/auth"
+	"memoryark/internal/config"
+	"memoryark/internal/database"
+	"memoryark/internal/middleware"
+	"memoryark/internal/models"
+	"memoryark/internal/websocket"
+)
+
+// TestWebSocketRequiresAuthAndFiltersEvents 測試 WebSocket 需要認證、依權限接收事件，且停用後斷線
+func TestWebSocketRequiresAuthAndFiltersEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupFileTestDB(t)
+	if err := db.AutoMigrate(&models.Role{}, &models.RefreshToken{}, &models.RevokedToken{}); err != nil {
+		t.Fatalf("Failed to migrate tables: %v", err)
+	}
+	if err := database.InitializeDefaultRoles(db); err != nil {
+		t.Fatalf("Failed to seed roles: %v", err)
+	}
+	db.Create(&models.Role{Name: "stats-only", DisplayName: "Stats", Permissions: models.StringList{models.PermSystemStats}})
+	auth.InvalidateRoleCache()
+
+	cfg := setupTestConfig(t)
+	cfg.Auth = config.AuthConfig{
+		Provider:      config.AuthProviderLocalJWT,
+		JWTSecret:     "test-secret",
+		TokenExpiry:   1,
+		RefreshExpiry: 24,
+	}
+
+	reader := models.User{Email: "reader@example.com", Name: "Reader", Role: "user", Status: "approved"}
+	outsider := models.User{Email: "stats@example.com", Name: "Stats", Role: "stats-only", Status: "approved"}
+	db.Create(&reader)
+	db.Create(&outsider)
+
+	sessions := auth.NewSessionManager(db, cfg.Auth)
+	readerTokens, err := sessions.IssueTokens(&reader, auth.SessionMeta{})
+	if err != nil {
+		t.Fatalf("Failed to issue tokens: %v", err)
+	}
+	outsiderTokens, _ := sessions.IssueTokens(&outsider, auth.SessionMeta{})
+
+	wsHandler := websocket.NewWebSocketHandler(db, cfg)
+	router := gin.New()
+	router.GET("/api/ws", middleware.AuthMiddleware(cfg, db), middleware.RequirePermission(db, models.PermFilesRead), wsHandler.HandleWebSocket)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/ws"
+
+	// 未登入無法建立連線
+	if _, resp, err := gorillaws.DefaultDialer.Dial(wsURL, nil); err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without token, got err=%v resp=%v", err, resp)
+	}
+
+	// 缺少檔案讀取權限無法建立連線
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+outsiderTokens.AccessToken)
+	if _, resp, err := gorillaws.DefaultDialer.Dial(wsURL, header); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected 403 without files.read, got err=%v resp=%v", err, resp)
+	}
+
+	// 瀏覽器透過子協定傳遞令牌
+	dialer := gorillaws.Dialer{Subprotocols: []string{auth.WebSocketBearerProtocol, readerTokens.AccessToken}}
+	conn, resp, err := dialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Expected reader to connect, got %v (resp=%v)", err, resp)
+	}
+	defer conn.Close()
+	if conn.Subprotocol() != auth.WebSocketBearerProtocol {
+		t.Errorf("Expected negotiated subprotocol %q, got %q", auth.WebSocketBearerProtocol, conn.Subprotocol())
+	}
+
+	// 收到 pong 代表客戶端已註冊到 Hub
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.WriteJSON(map[string]string{"type": "ping"})
+	var event websocket.FileSystemEvent
+	if err := conn.ReadJSON(&event); err != nil || event.Type != "pong" {
+		t.Fatalf("Expected pong, got %+v (err=%v)", event, err)
+	}
+
+	wsHandler.BroadcastFileEvent("file_uploaded", nil, "新檔案", gin.H{"name": "photo.jpg"})
+	if err := conn.ReadJSON(&event); err != nil || event.Type != "file_uploaded" {
+		t.Fatalf("Expected file_uploaded event, got %+v (err=%v)", event, err)
+	}
+
+	// 停用後重新檢查權限應關閉連線
+	db.Model(&reader).Update("status", "suspended")
+	wsHandler.RefreshUserPermissions(reader.ID)
+	wsHandler.BroadcastFileEvent("file_uploaded", nil, "另一個檔案", nil)
+	for {
+		if err := conn.ReadJSON(&event); err != nil {
+			break
+		}
+		if event.Type == "file_uploaded" && event.Message == "另一個檔案" {
+			t.Fatal("Suspended user should not receive events")
+		}
+	}
+}
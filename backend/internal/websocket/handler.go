@@ -1,49 +1,102 @@
 package websocket
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
-)
+	"gorm.io/gorm"
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// 生產環境中應該檢查來源
-		return true
-	},
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-}
+	"memoryark/internal/auth"
+	"memoryark/internal/config"
+	"memoryark/internal/middleware"
+	"memoryark/internal/models"
+)
 
 // WebSocketHandler WebSocket 處理器
 type WebSocketHandler struct {
-	hub *Hub
+	hub      *Hub
+	upgrader websocket.Upgrader
 }
 
 // NewWebSocketHandler 創建新的 WebSocket 處理器
-func NewWebSocketHandler() *WebSocketHandler {
-	hub := NewHub()
+func NewWebSocketHandler(db *gorm.DB, cfg *config.Config) *WebSocketHandler {
+	hub := NewHub(NewIdentityResolver(db))
 	go hub.Run()
+
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		// 令牌以子協定傳遞時需回應相同的子協定
+		Subprotocols: []string{auth.WebSocketBearerProtocol},
+	}
+	if cfg.Development.Enabled && cfg.Development.CORSEnabled {
+		// 開發模式前端與後端不同來源
+		upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	}
+	// 其餘情況使用預設的同源檢查，避免跨站頁面利用 Cookie 建立連線
+
 	return &WebSocketHandler{
-		hub: hub,
+		hub:      hub,
+		upgrader: upgrader,
 	}
 }
 
-// HandleWebSocket 處理 WebSocket 連線
+// NewIdentityResolver 從資料庫重新讀取用戶狀態與角色權限
+func NewIdentityResolver(db *gorm.DB) IdentityResolver {
+	return func(userID uint) (*ClientIdentity, error) {
+		var user models.User
+		if err := db.First(&user, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if user.Status != "approved" {
+			return nil, nil
+		}
+
+		permissions := auth.RolePermissions(db, user.Role)
+		role := models.Role{Permissions: permissions}
+		if !role.HasPermission(models.PermFilesRead) {
+			return nil, nil
+		}
+		return &ClientIdentity{
+			UserID:      user.ID,
+			Role:        user.Role,
+			Permissions: permissions,
+		}, nil
+	}
+}
+
+// HandleWebSocket 處理 WebSocket 連線（需先通過認證中間件）
 func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	identity, ok := identityFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "UNAUTHORIZED",
+				"message": "需要登入才能建立即時連線",
+			},
+		})
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("WebSocket 升級失敗: %v", err)
 		return
 	}
 
 	client := &Client{
-		conn: conn,
-		send: make(chan FileSystemEvent, 256),
-		hub:  h.hub,
+		conn:     conn,
+		send:     make(chan FileSystemEvent, 256),
+		hub:      h.hub,
+		identity: identity,
 	}
 
 	client.hub.register <- client
@@ -52,21 +105,67 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 	go client.WritePump()
 	go client.ReadPump()
 
-	log.Printf("新的 WebSocket 連線已建立")
+	log.Printf("新的 WebSocket 連線已建立 (用戶 %d)", identity.UserID)
 }
 
-// BroadcastFileEvent 廣播檔案系統事件
+// identityFromContext 從認證中間件設置的上下文建立連線身分
+func identityFromContext(c *gin.Context) (ClientIdentity, bool) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		return ClientIdentity{}, false
+	}
+
+	identity := ClientIdentity{
+		UserID: userID,
+		Role:   c.GetString("user_role"),
+	}
+	if permissions, ok := c.Get("user_permissions"); ok {
+		identity.Permissions, _ = permissions.([]string)
+	}
+	identity.Scopes = middleware.TokenScopes(c)
+	if value, ok := c.Get("token_claims"); ok {
+		if claims, ok := value.(*auth.JWTClaims); ok && claims.ExpiresAt != nil {
+			expiresAt := claims.ExpiresAt.Time
+			identity.ExpiresAt = &expiresAt
+		}
+	}
+	return identity, true
+}
+
+// BroadcastFileEvent 廣播檔案系統事件（僅發送給具備檔案讀取權限的用戶）
 func (h *WebSocketHandler) BroadcastFileEvent(eventType string, folderId *int, message string, data interface{}) {
 	event := FileSystemEvent{
+		Type:       eventType,
+		FolderId:   folderId,
+		Message:    message,
+		Data:       data,
+		Timestamp:  time.Now().Unix(),
+		Permission: models.PermFilesRead,
+	}
+
+	h.hub.BroadcastEvent(event)
+	log.Printf("廣播檔案系統事件: %s, 資料夾: %v, 訊息: %s", eventType, folderId, message)
+}
+
+// BroadcastUserEvent 只發送給指定用戶的事件（例如背景工作進度）
+func (h *WebSocketHandler) BroadcastUserEvent(userID uint, eventType string, message string, data interface{}) {
+	h.hub.BroadcastEvent(FileSystemEvent{
 		Type:      eventType,
-		FolderId:  folderId,
 		Message:   message,
 		Data:      data,
 		Timestamp: time.Now().Unix(),
-	}
+		Audience:  []uint{userID},
+	})
+}
 
-	h.hub.BroadcastEvent(event)
-	log.Printf("廣播檔案系統事件: %s, 資料夾: %v, 訊息: %s", eventType, folderId, message)
+// RefreshUserPermissions 用戶角色或狀態變更後重新檢查其即時連線
+func (h *WebSocketHandler) RefreshUserPermissions(userID uint) {
+	h.hub.RefreshUser(userID)
+}
+
+// RefreshAllPermissions 角色權限變更後重新檢查所有即時連線
+func (h *WebSocketHandler) RefreshAllPermissions() {
+	h.hub.RefreshAll()
 }
 
 // GetHub 獲取 Hub 實例（用於其他處理器廣播事件）
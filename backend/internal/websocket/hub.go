@@ -4,10 +4,17 @@ import (
 	"encoding/json"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
+
+	"memoryark/internal/middleware"
+	"memoryark/internal/models"
 )
 
+// identityRefreshInterval 定期重新檢查連線用戶的狀態與權限，作為未通知變更時的保底
+const identityRefreshInterval = time.Minute
+
 // FileSystemEvent 檔案系統事件結構
 type FileSystemEvent struct {
 	Type      string      `json:"type"`      // upload, delete, create, move, rename
@@ -15,14 +22,30 @@ type FileSystemEvent struct {
 	Message   string      `json:"message"`   // 事件描述
 	Data      interface{} `json:"data"`      // 事件相關數據
 	Timestamp int64       `json:"timestamp"` // 事件時間戳
+
+	Permission string `json:"-"` // 接收者需具備的權限
+	Audience   []uint `json:"-"` // 不為空時只發送給這些用戶
 }
 
+// ClientIdentity 連線用戶的身分與權限
+type ClientIdentity struct {
+	UserID      uint
+	Role        string
+	Permissions []string
+	Scopes      []string   // 以個人存取令牌連線時的令牌範圍
+	ExpiresAt   *time.Time // 連線使用的令牌過期時間，過期後斷線
+}
+
+// IdentityResolver 重新讀取用戶的角色與權限；用戶已停用或不存在時返回 nil
+type IdentityResolver func(userID uint) (*ClientIdentity, error)
+
 // Client 代表一個 WebSocket 連線
 type Client struct {
 	conn     *websocket.Conn
 	send     chan FileSystemEvent
 	hub      *Hub
 	folderId *int // 客戶端正在瀏覽的資料夾ID（可選）
+	identity ClientIdentity
 }
 
 // Hub 管理所有 WebSocket 連線
@@ -31,34 +54,40 @@ type Hub struct {
 	broadcast  chan FileSystemEvent
 	register   chan *Client
 	unregister chan *Client
+	refresh    chan *uint // 重新檢查權限：指定用戶 ID，nil 表示所有連線
+	resolver   IdentityResolver
 	mutex      sync.RWMutex
 }
 
 // NewHub 創建新的 Hub
-func NewHub() *Hub {
+func NewHub(resolver IdentityResolver) *Hub {
 	return &Hub{
 		clients:    make(map[*Client]bool),
-		broadcast:  make(chan FileSystemEvent),
+		broadcast:  make(chan FileSystemEvent, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		refresh:    make(chan *uint, 64),
+		resolver:   resolver,
 	}
 }
 
 // Run 運行 Hub
 func (h *Hub) Run() {
+	ticker := time.NewTicker(identityRefreshInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case client := <-h.register:
 			h.mutex.Lock()
 			h.clients[client] = true
 			h.mutex.Unlock()
-			log.Printf("客戶端已連接，總連線數: %d", len(h.clients))
+			log.Printf("客戶端已連接 (用戶 %d)，總連線數: %d", client.identity.UserID, len(h.clients))
 
 		case client := <-h.unregister:
 			h.mutex.Lock()
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+				h.removeClient(client)
 				h.mutex.Unlock()
 				log.Printf("客戶端已斷開，總連線數: %d", len(h.clients))
 			} else {
@@ -66,7 +95,7 @@ func (h *Hub) Run() {
 			}
 
 		case event := <-h.broadcast:
-			h.mutex.RLock()
+			h.mutex.Lock()
 			for client := range h.clients {
 				// 檢查是否應該向此客戶端發送事件
 				if h.shouldSendToClient(client, event) {
@@ -74,18 +103,122 @@ func (h *Hub) Run() {
 					case client.send <- event:
 					default:
 						// 如果發送失敗，關閉此客戶端
-						delete(h.clients, client)
-						close(client.send)
+						h.removeClient(client)
 					}
 				}
 			}
-			h.mutex.RUnlock()
+			h.mutex.Unlock()
+
+		case userID := <-h.refresh:
+			h.refreshIdentities(userID)
+
+		case <-ticker.C:
+			h.refreshIdentities(nil)
+		}
+	}
+}
+
+// removeClient 移除並關閉客戶端（呼叫者需持有寫入鎖）
+func (h *Hub) removeClient(client *Client) {
+	delete(h.clients, client)
+	close(client.send)
+}
+
+// refreshIdentities 重新讀取連線用戶的權限，已停用或令牌過期的連線會被關閉
+func (h *Hub) refreshIdentities(userID *uint) {
+	if h.resolver == nil {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	resolved := map[uint]*ClientIdentity{}
+	for client := range h.clients {
+		id := client.identity.UserID
+		if userID != nil && id != *userID {
+			continue
+		}
+
+		if client.identity.ExpiresAt != nil && time.Now().After(*client.identity.ExpiresAt) {
+			log.Printf("WebSocket 連線令牌已過期，關閉連線 (用戶 %d)", id)
+			h.removeClient(client)
+			continue
+		}
+
+		identity, ok := resolved[id]
+		if !ok {
+			var err error
+			identity, err = h.resolver(id)
+			if err != nil {
+				// 暫時無法讀取時保留原本的權限
+				log.Printf("重新檢查 WebSocket 用戶權限失敗 (用戶 %d): %v", id, err)
+				continue
+			}
+			resolved[id] = identity
+		}
+
+		if identity == nil {
+			log.Printf("WebSocket 用戶已無存取權限，關閉連線 (用戶 %d)", id)
+			h.removeClient(client)
+			continue
+		}
+		client.identity.Role = identity.Role
+		client.identity.Permissions = identity.Permissions
+	}
+}
+
+// RefreshUser 用戶角色或狀態變更後重新檢查其連線
+func (h *Hub) RefreshUser(userID uint) {
+	h.queueRefresh(&userID)
+}
+
+// RefreshAll 角色權限變更後重新檢查所有連線
+func (h *Hub) RefreshAll() {
+	h.queueRefresh(nil)
+}
+
+// queueRefresh 排入重新檢查請求，佇列已滿時改為全部重新檢查的保底機制處理
+func (h *Hub) queueRefresh(userID *uint) {
+	select {
+	case h.refresh <- userID:
+	default:
+		log.Printf("警告: 權限重新檢查佇列已滿，將於下次定期檢查時處理")
+	}
+}
+
+// canReceive 檢查客戶端是否可以看到事件
+func (c *Client) canReceive(event FileSystemEvent) bool {
+	if len(event.Audience) > 0 {
+		allowed := false
+		for _, id := range event.Audience {
+			if id == c.identity.UserID {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
 		}
 	}
+
+	if event.Permission == "" {
+		return true
+	}
+	role := models.Role{Permissions: c.identity.Permissions}
+	if !role.HasPermission(event.Permission) {
+		return false
+	}
+	return middleware.ScopesAllow(c.identity.Scopes, event.Permission)
 }
 
 // shouldSendToClient 判斷是否應該向特定客戶端發送事件
 func (h *Hub) shouldSendToClient(client *Client, event FileSystemEvent) bool {
+	// 用戶必須有權限看到此事件
+	if !client.canReceive(event) {
+		return false
+	}
+
 	// 如果客戶端沒有設置特定資料夾，發送所有事件
 	if client.folderId == nil {
 		return true
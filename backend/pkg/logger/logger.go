@@ -50,7 +50,7 @@ func Debug(msg string, args ...interface{}) {
 	log.Printf("[DEBUG] "+msg, args...)
 }
 
-// LogActivity 記錄活動日誌（稍後會整合到數據庫）
+// LogActivity 將活動輸出到日誌檔（資料庫操作記錄由 middleware.Audit 寫入）
 func LogActivity(userID *uint, action, resource string, resourceID *uint, details string) {
 	log.Printf("Activity: UserID=%v, Action=%s, Resource=%s, ResourceID=%v, Details=%s", 
 		userID, action, resource, resourceID, details)